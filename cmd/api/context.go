@@ -3,12 +3,18 @@ package main
 import (
 	"context"
 	"net/http"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
 )
 
 type contextKey string
 
 const (
 	authenticatedMerchantContextKey = contextKey("authenticatedMerchantID")
+	scopesContextKey                = contextKey("scopes")
+	signingKeyIDContextKey          = contextKey("signingKeyID")
+	actorContextKey                 = contextKey("actor")
+	requestIDContextKey             = contextKey("requestID")
 )
 
 func contextSetAuthenticatedMerchantID(r *http.Request, merchantID string) *http.Request {
@@ -24,3 +30,59 @@ func contextGetAuthenticatedMerchantID(r *http.Request) string {
 
 	return merchantID
 }
+
+func contextSetScopes(r *http.Request, scopes []string) *http.Request {
+	ctx := context.WithValue(r.Context(), scopesContextKey, scopes)
+	return r.WithContext(ctx)
+}
+
+func contextGetScopes(r *http.Request) []string {
+	scopes, ok := r.Context().Value(scopesContextKey).([]string)
+	if !ok {
+		return nil
+	}
+
+	return scopes
+}
+
+func contextSetSigningKeyID(r *http.Request, keyID string) *http.Request {
+	ctx := context.WithValue(r.Context(), signingKeyIDContextKey, keyID)
+	return r.WithContext(ctx)
+}
+
+func contextGetSigningKeyID(r *http.Request) string {
+	keyID, ok := r.Context().Value(signingKeyIDContextKey).(string)
+	if !ok {
+		return ""
+	}
+
+	return keyID
+}
+
+func contextSetActor(r *http.Request, actor entities.Actor) *http.Request {
+	ctx := context.WithValue(r.Context(), actorContextKey, actor)
+	return r.WithContext(ctx)
+}
+
+func contextGetActor(r *http.Request) entities.Actor {
+	actor, ok := r.Context().Value(actorContextKey).(entities.Actor)
+	if !ok {
+		return entities.Actor{}
+	}
+
+	return actor
+}
+
+func contextSetRequestID(r *http.Request, requestID string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, requestID)
+	return r.WithContext(ctx)
+}
+
+func contextGetRequestID(r *http.Request) string {
+	requestID, ok := r.Context().Value(requestIDContextKey).(string)
+	if !ok {
+		return ""
+	}
+
+	return requestID
+}
@@ -5,7 +5,9 @@ import (
 	"log/slog"
 	"net/http"
 	"runtime/debug"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mgajewskik/payment-platform/internal/response"
 	"github.com/mgajewskik/payment-platform/internal/validator"
@@ -78,6 +80,51 @@ func (app *application) invalidAuthenticationToken(w http.ResponseWriter, r *htt
 	app.errorMessage(w, r, http.StatusUnauthorized, "Invalid authentication token", headers)
 }
 
+func (app *application) invalidClientCertificate(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusUnauthorized,
+		"The client certificate is not registered to a merchant",
+		nil,
+	)
+}
+
+func (app *application) clientCertificateRequired(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusUnauthorized,
+		"The merchant must authenticate with a client certificate",
+		nil,
+	)
+}
+
+func (app *application) invalidRequestSignature(
+	w http.ResponseWriter,
+	r *http.Request,
+	message string,
+) {
+	app.errorMessage(w, r, http.StatusUnauthorized, message, nil)
+}
+
+func (app *application) adminAuthenticationRequired(w http.ResponseWriter, r *http.Request) {
+	headers := make(http.Header)
+	headers.Set("WWW-Authenticate", `Basic realm="admin", charset="UTF-8"`)
+
+	app.errorMessage(
+		w,
+		r,
+		http.StatusUnauthorized,
+		"You must be authenticated as an administrator to access this resource",
+		headers,
+	)
+}
+
+func (app *application) invalidCredentials(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(w, r, http.StatusUnauthorized, "Invalid API key credentials", nil)
+}
+
 func (app *application) authenticationRequired(w http.ResponseWriter, r *http.Request) {
 	app.errorMessage(
 		w,
@@ -87,3 +134,166 @@ func (app *application) authenticationRequired(w http.ResponseWriter, r *http.Re
 		nil,
 	)
 }
+
+func (app *application) missingScope(w http.ResponseWriter, r *http.Request, scope string) {
+	data := map[string]string{
+		"Error": "The authentication token is missing the required scope " + scope,
+		"Scope": scope,
+	}
+
+	err := response.JSON(w, http.StatusForbidden, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) rateLimitExceeded(
+	w http.ResponseWriter,
+	r *http.Request,
+	retryAfter time.Duration,
+) {
+	headers := make(http.Header)
+	headers.Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+
+	app.errorMessage(w, r, http.StatusTooManyRequests, "Rate limit exceeded", headers)
+}
+
+func (app *application) paymentBlocked(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusPaymentRequired,
+		"The payment was declined by risk assessment",
+		nil,
+	)
+}
+
+func (app *application) exchangeRatesUnavailable(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusServiceUnavailable,
+		"Exchange rates are temporarily unavailable, please try again later",
+		nil,
+	)
+}
+
+func (app *application) paymentRefunded(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(w, r, http.StatusConflict, "The payment was already refunded", nil)
+}
+
+func (app *application) paymentDisputed(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusConflict,
+		"The payment has an open dispute or was charged back in full",
+		nil,
+	)
+}
+
+func (app *application) paymentChanged(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusConflict,
+		"The payment was changed by another request, please retry",
+		nil,
+	)
+}
+
+func (app *application) merchantInactive(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusForbidden,
+		"The merchant does not exist or is deactivated",
+		nil,
+	)
+}
+
+func (app *application) merchantExists(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(w, r, http.StatusConflict, "A merchant with this ID already exists", nil)
+}
+
+func (app *application) merchantChanged(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusConflict,
+		"The merchant was changed by another request, please retry",
+		nil,
+	)
+}
+
+func (app *application) limitExceeded(w http.ResponseWriter, r *http.Request, limit string) {
+	data := map[string]string{
+		"Error": "The request exceeds the merchant limit " + limit,
+		"Limit": limit,
+	}
+
+	err := response.JSON(w, http.StatusUnprocessableEntity, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) sepaNotConfigured(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusServiceUnavailable,
+		"SEPA payouts are not configured",
+		nil,
+	)
+}
+
+func (app *application) invalidStatusReport(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorMessage(w, r, http.StatusUnprocessableEntity, err.Error(), nil)
+}
+
+func (app *application) disputeResponded(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusConflict,
+		"Evidence was already submitted or the dispute was decided",
+		nil,
+	)
+}
+
+func (app *application) disputeDeadlinePassed(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(w, r, http.StatusConflict, "The dispute response deadline has passed", nil)
+}
+
+func (app *application) disputeClosed(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(w, r, http.StatusConflict, "The dispute was already decided", nil)
+}
+
+func (app *application) disputeChanged(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusConflict,
+		"The dispute was changed by another request, please retry",
+		nil,
+	)
+}
+
+func (app *application) webhookDeliveryPending(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(w, r, http.StatusConflict, "The webhook delivery is still pending", nil)
+}
+
+func (app *application) webhookEndpointDeleted(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(
+		w,
+		r,
+		http.StatusConflict,
+		"The webhook endpoint of the delivery was deleted",
+		nil,
+	)
+}
+
+func (app *application) subscriptionCancelled(w http.ResponseWriter, r *http.Request) {
+	app.errorMessage(w, r, http.StatusConflict, "The subscription was already cancelled", nil)
+}
@@ -1,17 +1,24 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/google/uuid"
 	"github.com/pascaldekloe/jwt"
+	"github.com/tomasen/realip"
 
 	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/domain/fx"
+	"github.com/mgajewskik/payment-platform/internal/domain/service"
 	"github.com/mgajewskik/payment-platform/internal/request"
 	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/storage"
 	"github.com/mgajewskik/payment-platform/internal/validator"
 )
 
@@ -26,9 +33,53 @@ func (app *application) status(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (app *application) generateToken(w http.ResponseWriter, r *http.Request) {
+func (app *application) jwks(w http.ResponseWriter, r *http.Request) {
+	err := response.JSON(w, http.StatusOK, app.jwtKeys.JWKS())
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) createAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		KeyID     string              `json:"KeyID"`
+		KeySecret string              `json:"KeySecret"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Validator.CheckField(input.KeyID != "", "KeyID", "KeyID is required")
+	input.Validator.CheckField(input.KeySecret != "", "KeySecret", "KeySecret is required")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	key, err := app.service.AuthenticateAPIKey(input.KeyID, input.KeySecret)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidCredentials):
+			app.invalidCredentials(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
 	var claims jwt.Claims
-	claims.Subject = app.config.merchantID
+	claims.ID = uuid.New().String()
+	claims.Subject = key.MerchantID
+	claims.Set = map[string]any{"scope": strings.Join(key.Scopes, " "), "api_key": key.ID}
+
+	if key.SigningSecret != "" {
+		claims.Set["signing_key"] = key.ID
+	}
 
 	expiry := time.Now().Add(24 * time.Hour)
 	claims.Issued = jwt.NewNumericTime(time.Now())
@@ -38,7 +89,7 @@ func (app *application) generateToken(w http.ResponseWriter, r *http.Request) {
 	claims.Issuer = app.config.baseURL
 	claims.Audiences = []string{app.config.baseURL}
 
-	jwtBytes, err := claims.HMACSign(jwt.HS256, []byte(app.config.jwt.secretKey))
+	jwtBytes, err := app.jwtKeys.Sign(&claims)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -59,14 +110,15 @@ func (app *application) createPayment(w http.ResponseWriter, r *http.Request) {
 	merchantID := contextGetAuthenticatedMerchantID(r)
 
 	var input struct {
-		CustomerID     string              `json:"CustomerID"`
-		CustomerName   string              `json:"CustomerName"`
-		CardNumber     string              `json:"CardNumber"`
-		CardCVV        int                 `json:"CardCVV"`
-		CardExpiryDate string              `json:"CardExpiryDate"`
-		Price          int64               `json:"Price"`
-		Currency       string              `json:"Currency"`
-		Validator      validator.Validator `json:"-"`
+		CustomerID      string              `json:"CustomerID"`
+		PaymentMethodID string              `json:"PaymentMethodID"`
+		CustomerName    string              `json:"CustomerName"`
+		CardNumber      string              `json:"CardNumber"`
+		CardCVV         int                 `json:"CardCVV"`
+		CardExpiryDate  string              `json:"CardExpiryDate"`
+		Price           int64               `json:"Price"`
+		Currency        string              `json:"Currency"`
+		Validator       validator.Validator `json:"-"`
 	}
 
 	err := request.DecodeJSON(w, r, &input)
@@ -76,26 +128,39 @@ func (app *application) createPayment(w http.ResponseWriter, r *http.Request) {
 	}
 
 	input.Validator.CheckField(input.CustomerID != "", "CustomerID", "CustomerID is required")
-	input.Validator.CheckField(input.CustomerName != "", "CustomerName", "CustomerName is required")
-	input.Validator.CheckField(input.CardNumber != "", "CardNumber", "CardNumber is required")
-	input.Validator.CheckField(
-		len([]rune(input.CardNumber)) == 16,
-		"CardNumber",
-		"CardNumber must be exactly 16 digits",
-	)
-	input.Validator.CheckField(input.CardCVV != 0, "CardCVV", "CardCVV is required")
-	input.Validator.CheckField(
-		input.CardCVV >= 100 && input.CardCVV <= 999,
-		"CardCVV",
-		"CardCVV must be exactly 3 digits",
-	)
-	input.Validator.CheckField(
-		input.CardExpiryDate != "",
-		"CardExpiryDate",
-		"CardExpiryDate is required",
-	)
+
+	if input.PaymentMethodID != "" {
+		input.Validator.CheckField(
+			input.CardNumber == "" && input.CardCVV == 0 && input.CardExpiryDate == "",
+			"PaymentMethodID",
+			"PaymentMethodID cannot be combined with card details",
+		)
+	} else {
+		checkCardInput(
+			&input.Validator,
+			input.CustomerName,
+			input.CardNumber,
+			input.CardCVV,
+			input.CardExpiryDate,
+		)
+	}
+
 	input.Validator.CheckField(input.Price != 0, "Price", "Price is required and cannot be zero")
+	input.Validator.CheckField(input.Price >= 0, "Price", "Price cannot be negative")
 	input.Validator.CheckField(input.Currency != "", "Currency", "Currency is required")
+	input.Validator.CheckField(
+		entities.IsCurrency(input.Currency),
+		"Currency",
+		"Currency must be a valid ISO 4217 code",
+	)
+
+	if currency, ok := entities.LookupCurrency(input.Currency); ok {
+		input.Validator.CheckField(
+			input.Price <= currency.MaxAmount(),
+			"Price",
+			"Price must not be greater than "+strconv.FormatInt(currency.MaxAmount(), 10),
+		)
+	}
 
 	if input.Validator.HasErrors() {
 		app.failedValidation(w, r, input.Validator)
@@ -110,12 +175,36 @@ func (app *application) createPayment(w http.ResponseWriter, r *http.Request) {
 			SecurityCode:   input.CardCVV,
 			ExpirationDate: input.CardExpiryDate,
 		}},
-		Price: entities.Money{Amount: input.Price, Currency: input.Currency},
+		PaymentMethodID: input.PaymentMethodID,
+		IPAddress:       realip.FromRequest(r),
+		Price:           entities.Money{Amount: input.Price, Currency: input.Currency},
 	}
 
-	paymentID, err := app.service.CreateNewPayment(payment)
+	paymentID, err := app.service.CreateNewPayment(auditActor(r), payment)
 	if err != nil {
-		app.serverError(w, r, err)
+		var limitErr *service.LimitExceededError
+
+		switch {
+		case errors.Is(err, service.ErrUnknownPaymentMethod):
+			input.Validator.AddFieldError("PaymentMethodID", "PaymentMethodID does not exist")
+			app.failedValidation(w, r, input.Validator)
+		case errors.Is(err, service.ErrMerchantInactive):
+			app.merchantInactive(w, r)
+		case errors.Is(err, service.ErrPaymentBlocked):
+			app.paymentBlocked(w, r)
+		case errors.As(err, &limitErr):
+			app.limitExceeded(w, r, limitErr.Limit)
+		case errors.Is(err, fx.ErrUnsupportedCurrency):
+			input.Validator.AddFieldError(
+				"Currency",
+				"Currency cannot be converted to the merchant settlement currency",
+			)
+			app.failedValidation(w, r, input.Validator)
+		case errors.Is(err, fx.ErrStaleRates):
+			app.exchangeRatesUnavailable(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
@@ -144,13 +233,49 @@ func (app *application) getPayment(w http.ResponseWriter, r *http.Request) {
 		"MerchantID": paymentDetails.MerchantID,
 		"CustomerID": paymentDetails.CustomerID,
 		"Price":      strconv.Itoa(int(paymentDetails.Price.Amount)),
+		"Amount":     paymentDetails.Price.MajorUnits(),
 		"Currency":   paymentDetails.Price.Currency,
 		"Timestamp":  strconv.Itoa(int(paymentDetails.Timestamp)),
 	}
 
+	if paymentDetails.CardLast4 != "" {
+		data["CardLast4"] = paymentDetails.CardLast4
+		data["CardBrand"] = paymentDetails.CardBrand
+	}
+
+	if paymentDetails.Settlement.Currency != "" {
+		data["SettlementPrice"] = strconv.Itoa(int(paymentDetails.Settlement.Amount))
+		data["SettlementAmount"] = paymentDetails.Settlement.MajorUnits()
+		data["SettlementCurrency"] = paymentDetails.Settlement.Currency
+	}
+
+	if paymentDetails.FX != nil {
+		data["FXProvider"] = paymentDetails.FX.Provider
+		data["FXMidRate"] = paymentDetails.FX.MidRate
+		data["FXMarkup"] = paymentDetails.FX.Markup
+		data["FXRate"] = paymentDetails.FX.AppliedRate
+		data["FXTimestamp"] = strconv.Itoa(int(paymentDetails.FX.Timestamp))
+	}
+
+	if paymentDetails.Fees.Gross.Currency != "" {
+		data["Gross"] = strconv.Itoa(int(paymentDetails.Fees.Gross.Amount))
+		data["Fee"] = strconv.Itoa(int(paymentDetails.Fees.Fee.Amount))
+		data["Net"] = strconv.Itoa(int(paymentDetails.Fees.Net.Amount))
+		data["RefundFeePolicy"] = paymentDetails.Fees.RefundPolicy
+	}
+
+	if paymentDetails.Risk.Decision != "" {
+		data["RiskScore"] = strconv.Itoa(paymentDetails.Risk.Score)
+		data["RiskDecision"] = paymentDetails.Risk.Decision
+	}
+
 	if paymentDetails.Refunded {
 		data["Refunded"] = strconv.FormatBool(paymentDetails.Refunded)
 		data["RefundTimestamp"] = strconv.Itoa(int(paymentDetails.RefundTimestamp))
+
+		if paymentDetails.Fees.Gross.Currency != "" {
+			data["RefundedFee"] = strconv.Itoa(int(paymentDetails.Fees.RefundedFee.Amount))
+		}
 	}
 
 	err = response.JSON(w, http.StatusOK, data)
@@ -163,9 +288,22 @@ func (app *application) refundPayment(w http.ResponseWriter, r *http.Request) {
 	paymentID := chi.URLParam(r, "paymentID")
 	merchantID := contextGetAuthenticatedMerchantID(r)
 
-	err := app.service.RefundPayment(merchantID, paymentID)
+	err := app.service.RefundPayment(auditActor(r), merchantID, paymentID)
 	if err != nil {
-		app.serverError(w, r, err)
+		var limitErr *service.LimitExceededError
+
+		switch {
+		case errors.As(err, &limitErr):
+			app.limitExceeded(w, r, limitErr.Limit)
+		case errors.Is(err, service.ErrPaymentRefunded):
+			app.paymentRefunded(w, r)
+		case errors.Is(err, service.ErrPaymentDisputed):
+			app.paymentDisputed(w, r)
+		case errors.Is(err, storage.ErrConflict):
+			app.paymentChanged(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
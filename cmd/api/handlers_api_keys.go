@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/request"
+	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+func (app *application) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	var input struct {
+		Name                  string              `json:"Name"`
+		Scopes                []string            `json:"Scopes"`
+		RequireSignedRequests bool                `json:"RequireSignedRequests"`
+		Validator             validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Validator.CheckField(validator.NotBlank(input.Name), "Name", "Name is required")
+	input.Validator.CheckField(
+		validator.MaxRunes(input.Name, 100),
+		"Name",
+		"Name must not be more than 100 characters",
+	)
+
+	// NOTE: keys default to the scopes of the token creating them and can never exceed them
+	scopes := contextGetScopes(r)
+	if input.Scopes != nil {
+		for _, scope := range input.Scopes {
+			input.Validator.CheckField(
+				entities.IsScope(scope),
+				"Scopes",
+				"Scopes must only contain "+strings.Join(entities.Scopes, ", "),
+			)
+			input.Validator.CheckField(
+				slices.Contains(scopes, scope),
+				"Scopes",
+				"Scopes must not exceed the scopes of the authentication token",
+			)
+		}
+
+		scopes = input.Scopes
+	}
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	key, secret, err := app.service.CreateAPIKey(
+		auditActor(r),
+		merchantID,
+		input.Name,
+		scopes,
+		input.RequireSignedRequests,
+	)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]string{
+		"KeyID":                 key.ID,
+		"KeySecret":             secret,
+		"Name":                  key.Name,
+		"Scopes":                strings.Join(key.Scopes, " "),
+		"Timestamp":             strconv.Itoa(int(key.Timestamp)),
+		"RequireSignedRequests": strconv.FormatBool(key.SigningSecret != ""),
+	}
+
+	if key.SigningSecret != "" {
+		data["SigningSecret"] = key.SigningSecret
+	}
+
+	err = response.JSON(w, http.StatusCreated, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	keys, err := app.service.ListAPIKeys(merchantID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	apiKeys := make([]map[string]string, 0, len(keys))
+	for _, key := range keys {
+		apiKey := map[string]string{
+			"KeyID":                 key.ID,
+			"Name":                  key.Name,
+			"Scopes":                strings.Join(key.Scopes, " "),
+			"Timestamp":             strconv.Itoa(int(key.Timestamp)),
+			"RequireSignedRequests": strconv.FormatBool(key.SigningSecret != ""),
+		}
+
+		if key.Revoked {
+			apiKey["Revoked"] = strconv.FormatBool(key.Revoked)
+			apiKey["RevokedTimestamp"] = strconv.Itoa(int(key.RevokedTimestamp))
+		}
+
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	data := map[string]any{
+		"APIKeys": apiKeys,
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	keyID := chi.URLParam(r, "keyID")
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	err := app.service.RevokeAPIKey(auditActor(r), merchantID, keyID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
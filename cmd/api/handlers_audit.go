@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+const (
+	defaultAuditEventsLimit = 100
+	maxAuditEventsLimit     = 1000
+)
+
+// listAuditEvents returns the merchant's audit events in sequence order, filtered by the action,
+// resourceID and after query parameters. ChainValid reports whether no event is missing or
+// changed from the after sequence up to the last returned event.
+func (app *application) listAuditEvents(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	query := r.URL.Query()
+
+	filter := storage.AuditEventFilter{
+		Action:     query.Get("action"),
+		ResourceID: query.Get("resourceID"),
+		Limit:      defaultAuditEventsLimit,
+	}
+
+	var v validator.Validator
+
+	if after := query.Get("after"); after != "" {
+		sequence, err := strconv.ParseInt(after, 10, 64)
+		v.CheckField(err == nil && sequence >= 0, "after", "after must be a sequence number")
+		filter.AfterSequence = sequence
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		v.CheckField(
+			err == nil && n > 0 && n <= maxAuditEventsLimit,
+			"limit",
+			"limit must be between 1 and "+strconv.Itoa(maxAuditEventsLimit),
+		)
+		filter.Limit = n
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	events, valid, err := app.service.ListAuditEvents(merchantID, filter)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"AuditEvents": events,
+		"ChainValid":  valid,
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
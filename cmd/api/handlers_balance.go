@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/response"
+)
+
+// getBalance returns the funds the platform owes the merchant per currency, Available funds can
+// be paid out while Pending funds are not released yet
+func (app *application) getBalance(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	balance, err := app.service.GetBalance(merchantID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]any{
+		"MerchantID": merchantID,
+		"Available":  balanceAmounts(balance.Available),
+		"Pending":    balanceAmounts(balance.Pending),
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func balanceAmounts(amounts []entities.Money) []map[string]string {
+	data := make([]map[string]string, 0, len(amounts))
+
+	for _, amount := range amounts {
+		data = append(data, map[string]string{
+			"Balance":  strconv.FormatInt(amount.Amount, 10),
+			"Amount":   amount.MajorUnits(),
+			"Currency": amount.Currency,
+		})
+	}
+
+	return data
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/domain/service"
+	"github.com/mgajewskik/payment-platform/internal/request"
+	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+const (
+	// maxEvidenceBytes limits the size of the evidence submitted for a dispute, text and files
+	maxEvidenceBytes     = 10_485_760
+	maxEvidenceFiles     = 10
+	maxEvidenceTextRunes = 20_000
+)
+
+// evidenceContentTypes are the types of files accepted as dispute evidence
+var evidenceContentTypes = []string{"application/pdf", "image/jpeg", "image/png", "text/plain"}
+
+func disputeResponse(dispute entities.Dispute) map[string]any {
+	data := map[string]any{
+		"DisputeID":        dispute.ID,
+		"MerchantID":       dispute.MerchantID,
+		"PaymentID":        dispute.PaymentID,
+		"Reason":           dispute.Reason,
+		"Status":           dispute.Status,
+		"Amount":           dispute.Amount.MajorUnits(),
+		"Currency":         dispute.Amount.Currency,
+		"Deadline":         strconv.Itoa(int(dispute.Deadline)),
+		"Timestamp":        strconv.Itoa(int(dispute.Timestamp)),
+		"UpdatedTimestamp": strconv.Itoa(int(dispute.UpdatedTimestamp)),
+	}
+
+	if dispute.Evidence != nil {
+		files := make([]map[string]string, 0, len(dispute.Evidence.Files))
+		for _, file := range dispute.Evidence.Files {
+			files = append(files, map[string]string{
+				"FileID":      file.ID,
+				"Name":        file.Name,
+				"ContentType": file.ContentType,
+				"Size":        strconv.Itoa(int(file.Size)),
+			})
+		}
+
+		data["Evidence"] = map[string]any{
+			"Text":      dispute.Evidence.Text,
+			"Files":     files,
+			"Timestamp": strconv.Itoa(int(dispute.Evidence.Timestamp)),
+		}
+	}
+
+	return data
+}
+
+// listDisputes returns the disputes of the merchant, the latest first, filtered by the status
+// query parameter
+func (app *application) listDisputes(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	status := r.URL.Query().Get("status")
+
+	var v validator.Validator
+
+	if status != "" {
+		v.CheckField(
+			validator.In(status, entities.DisputeStatuses...),
+			"status",
+			"status must be one of "+strings.Join(entities.DisputeStatuses, ", "),
+		)
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	disputes, err := app.service.ListDisputes(merchantID, status)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := make([]map[string]any, 0, len(disputes))
+	for _, dispute := range disputes {
+		data = append(data, disputeResponse(dispute))
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{"Disputes": data})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getDispute(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	disputeID := chi.URLParam(r, "disputeID")
+
+	dispute, err := app.service.GetDispute(merchantID, disputeID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, disputeResponse(dispute))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// submitDisputeEvidence takes the evidence as a multipart form with a text field and any
+// number of files fields
+func (app *application) submitDisputeEvidence(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	disputeID := chi.URLParam(r, "disputeID")
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxEvidenceBytes)
+
+	err := r.ParseMultipartForm(maxEvidenceBytes)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	text := r.FormValue("text")
+	headers := r.MultipartForm.File["files"]
+
+	var v validator.Validator
+
+	v.CheckField(
+		validator.NotBlank(text) || len(headers) > 0,
+		"text",
+		"text or files are required",
+	)
+	v.CheckField(
+		validator.MaxRunes(text, maxEvidenceTextRunes),
+		"text",
+		"text must not be more than 20000 characters long",
+	)
+	v.CheckField(
+		len(headers) <= maxEvidenceFiles,
+		"files",
+		"files must not be more than 10",
+	)
+
+	for _, header := range headers {
+		v.CheckField(
+			validator.In(header.Header.Get("Content-Type"), evidenceContentTypes...),
+			"files",
+			"files must be one of "+strings.Join(evidenceContentTypes, ", "),
+		)
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	var files []service.EvidenceUpload
+
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		defer file.Close()
+
+		files = append(files, service.EvidenceUpload{
+			Name:        header.Filename,
+			ContentType: header.Header.Get("Content-Type"),
+			Content:     file,
+		})
+	}
+
+	dispute, err := app.service.SubmitDisputeEvidence(
+		auditActor(r),
+		merchantID,
+		disputeID,
+		text,
+		files,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		case errors.Is(err, service.ErrDisputeResponded):
+			app.disputeResponded(w, r)
+		case errors.Is(err, service.ErrDisputeDeadlinePassed):
+			app.disputeDeadlinePassed(w, r)
+		case errors.Is(err, storage.ErrConflict):
+			app.disputeChanged(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, disputeResponse(dispute))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// getEvidenceFile returns the content of a file submitted as evidence
+func (app *application) getEvidenceFile(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	disputeID := chi.URLParam(r, "disputeID")
+	fileID := chi.URLParam(r, "fileID")
+
+	file, content, err := app.service.GetEvidenceFile(merchantID, disputeID, fileID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(int(file.Size)))
+	w.Header().Set(
+		"Content-Disposition",
+		mime.FormatMediaType("attachment", map[string]string{"filename": file.Name}),
+	)
+	w.WriteHeader(http.StatusOK)
+
+	_, err = io.Copy(w, content)
+	if err != nil {
+		app.reportServerError(r, err)
+	}
+}
+
+// openDispute records a dispute reported by the card issuer for a payment of the merchant
+func (app *application) openDispute(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+
+	var input struct {
+		PaymentID string              `json:"PaymentID"`
+		Reason    string              `json:"Reason"`
+		Amount    int64               `json:"Amount"`
+		Currency  string              `json:"Currency"`
+		Deadline  string              `json:"Deadline"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Validator.CheckField(input.PaymentID != "", "PaymentID", "PaymentID is required")
+	input.Validator.CheckField(
+		validator.In(input.Reason, entities.DisputeReasons...),
+		"Reason",
+		"Reason must be one of "+strings.Join(entities.DisputeReasons, ", "),
+	)
+
+	if input.Amount != 0 || input.Currency != "" {
+		input.Validator.CheckField(input.Amount > 0, "Amount", "Amount must be positive")
+		input.Validator.CheckField(
+			entities.IsCurrency(input.Currency),
+			"Currency",
+			"Currency must be a valid ISO 4217 code",
+		)
+	}
+
+	var deadline time.Time
+
+	if input.Deadline != "" {
+		deadline, err = time.Parse(time.RFC3339, input.Deadline)
+		input.Validator.CheckField(
+			err == nil,
+			"Deadline",
+			"Deadline must be an RFC 3339 time",
+		)
+	}
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	dispute := entities.Dispute{
+		MerchantID: merchantID,
+		PaymentID:  input.PaymentID,
+		Reason:     input.Reason,
+		Amount:     entities.Money{Amount: input.Amount, Currency: input.Currency},
+	}
+
+	if !deadline.IsZero() {
+		dispute.Deadline = deadline.UnixMilli()
+	}
+
+	dispute, err = app.service.OpenDispute(auditActor(r), dispute)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		case errors.Is(err, service.ErrPaymentRefunded):
+			app.paymentRefunded(w, r)
+		case errors.Is(err, service.ErrInvalidDisputeAmount):
+			input.Validator.AddFieldError(
+				"Amount",
+				"Amount must not be more than the undisputed part of the payment price, "+
+					"in its currency",
+			)
+			app.failedValidation(w, r, input.Validator)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusCreated, disputeResponse(dispute))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// resolveDispute records the decision of the card issuer, the outcome is either won or lost
+func (app *application) resolveDispute(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+	disputeID := chi.URLParam(r, "disputeID")
+
+	var input struct {
+		Outcome   string              `json:"Outcome"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Validator.CheckField(
+		validator.In(input.Outcome, entities.DisputeStatusWon, entities.DisputeStatusLost),
+		"Outcome",
+		"Outcome must be one of won, lost",
+	)
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	dispute, err := app.service.ResolveDispute(
+		auditActor(r),
+		merchantID,
+		disputeID,
+		input.Outcome == entities.DisputeStatusWon,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		case errors.Is(err, service.ErrDisputeClosed):
+			app.disputeClosed(w, r)
+		case errors.Is(err, storage.ErrConflict):
+			app.disputeChanged(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, disputeResponse(dispute))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
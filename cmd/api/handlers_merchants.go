@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/request"
+	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+// NOTE: merchant IDs are used in storage keys so the key separator is not allowed
+var rgxMerchantID = regexp.MustCompile(`^[a-zA-Z0-9._@-]{1,128}$`)
+
+type merchantInput struct {
+	AccountDetails struct {
+		Name     string `json:"Name"`
+		IBAN     string `json:"IBAN"`
+		BIC      string `json:"BIC"`
+		Currency string `json:"Currency"`
+	} `json:"AccountDetails"`
+	Limits struct {
+		MaxPaymentAmount map[string]int64 `json:"MaxPaymentAmount"`
+		DailyVolume      map[string]int64 `json:"DailyVolume"`
+		MonthlyVolume    map[string]int64 `json:"MonthlyVolume"`
+		MaxRefundsPerDay int64            `json:"MaxRefundsPerDay"`
+	} `json:"Limits"`
+	PricingPlan struct {
+		Rules []struct {
+			Currency   string `json:"Currency"`
+			CardBrand  string `json:"CardBrand"`
+			Percentage string `json:"Percentage"`
+			Fixed      int64  `json:"Fixed"`
+			Minimum    int64  `json:"Minimum"`
+		} `json:"Rules"`
+		RefundPolicy string `json:"RefundPolicy"`
+	} `json:"PricingPlan"`
+}
+
+// normalize converts the IBAN to electronic format and the BIC to upper case, it has to be
+// called before check
+func (i *merchantInput) normalize() {
+	i.AccountDetails.IBAN = validator.NormalizeIBAN(i.AccountDetails.IBAN)
+	i.AccountDetails.BIC = validator.NormalizeBIC(i.AccountDetails.BIC)
+}
+
+func (i merchantInput) check(v *validator.Validator) {
+	details := i.AccountDetails
+
+	v.CheckField(validator.NotBlank(details.Name), "AccountDetails.Name", "Name is required")
+	v.CheckField(details.IBAN != "", "AccountDetails.IBAN", "IBAN is required")
+	v.CheckField(
+		validator.IsIBAN(details.IBAN),
+		"AccountDetails.IBAN",
+		"IBAN must be a valid IBAN",
+	)
+	v.CheckField(details.BIC != "", "AccountDetails.BIC", "BIC is required")
+	v.CheckField(
+		validator.IsBIC(details.BIC),
+		"AccountDetails.BIC",
+		"BIC must be a valid 8 or 11 character BIC",
+	)
+
+	if validator.IsIBAN(details.IBAN) && validator.IsBIC(details.BIC) {
+		v.CheckField(
+			validator.IBANMatchesBIC(details.IBAN, details.BIC),
+			"AccountDetails.BIC",
+			"BIC country must match the IBAN country",
+		)
+	}
+	v.CheckField(
+		entities.IsCurrency(details.Currency),
+		"AccountDetails.Currency",
+		"Currency must be a valid ISO 4217 code",
+	)
+
+	checkAmountLimits(v, "Limits.MaxPaymentAmount", i.Limits.MaxPaymentAmount)
+	checkAmountLimits(v, "Limits.DailyVolume", i.Limits.DailyVolume)
+	checkAmountLimits(v, "Limits.MonthlyVolume", i.Limits.MonthlyVolume)
+	v.CheckField(
+		i.Limits.MaxRefundsPerDay >= 0,
+		"Limits.MaxRefundsPerDay",
+		"MaxRefundsPerDay cannot be negative",
+	)
+
+	plan := i.PricingPlan
+
+	if plan.RefundPolicy != "" {
+		v.CheckField(
+			validator.In(plan.RefundPolicy, entities.RefundFeePolicies...),
+			"PricingPlan.RefundPolicy",
+			"RefundPolicy must be one of "+strings.Join(entities.RefundFeePolicies, ", "),
+		)
+	}
+
+	for _, rule := range plan.Rules {
+		if rule.Currency != "" {
+			v.CheckField(
+				entities.IsCurrency(rule.Currency),
+				"PricingPlan.Rules",
+				"Currency must be a valid ISO 4217 code",
+			)
+		}
+
+		if rule.CardBrand != "" {
+			v.CheckField(
+				validator.In(rule.CardBrand, entities.CardBrands...),
+				"PricingPlan.Rules",
+				"CardBrand must be one of "+strings.Join(entities.CardBrands, ", "),
+			)
+		}
+
+		if rule.Percentage != "" {
+			percentage, ok := new(big.Rat).SetString(rule.Percentage)
+			v.CheckField(
+				ok && percentage.Sign() >= 0 && percentage.Cmp(big.NewRat(1, 1)) <= 0,
+				"PricingPlan.Rules",
+				"Percentage must be a decimal fraction between 0 and 1",
+			)
+		}
+
+		v.CheckField(
+			rule.Fixed >= 0 && rule.Minimum >= 0,
+			"PricingPlan.Rules",
+			"Fees cannot be negative",
+		)
+	}
+}
+
+func checkAmountLimits(v *validator.Validator, key string, limits map[string]int64) {
+	for currency, amount := range limits {
+		v.CheckField(
+			entities.IsCurrency(currency),
+			key,
+			"Limits must be keyed by valid ISO 4217 codes",
+		)
+		v.CheckField(amount >= 0, key, "Limits cannot be negative")
+	}
+}
+
+func (i merchantInput) accountDetails() entities.AccountDetails {
+	return entities.AccountDetails{
+		Name:     i.AccountDetails.Name,
+		IBAN:     i.AccountDetails.IBAN,
+		BIC:      i.AccountDetails.BIC,
+		Currency: i.AccountDetails.Currency,
+	}
+}
+
+func (i merchantInput) limits() entities.Limits {
+	return entities.Limits{
+		MaxPaymentAmount: i.Limits.MaxPaymentAmount,
+		DailyVolume:      i.Limits.DailyVolume,
+		MonthlyVolume:    i.Limits.MonthlyVolume,
+		MaxRefundsPerDay: i.Limits.MaxRefundsPerDay,
+	}
+}
+
+func (i merchantInput) pricingPlan() entities.PricingPlan {
+	plan := entities.PricingPlan{RefundPolicy: i.PricingPlan.RefundPolicy}
+
+	for _, rule := range i.PricingPlan.Rules {
+		plan.Rules = append(plan.Rules, entities.FeeRule{
+			Currency:   rule.Currency,
+			CardBrand:  rule.CardBrand,
+			Percentage: rule.Percentage,
+			Fixed:      rule.Fixed,
+			Minimum:    rule.Minimum,
+		})
+	}
+
+	return plan
+}
+
+func merchantResponse(merchant entities.Merchant) map[string]any {
+	data := map[string]any{
+		"MerchantID": merchant.ID,
+		"AccountDetails": map[string]string{
+			"Name":     merchant.AccountDetails.Name,
+			"IBAN":     merchant.AccountDetails.IBAN,
+			"BIC":      merchant.AccountDetails.BIC,
+			"Currency": merchant.AccountDetails.Currency,
+		},
+		"Limits":      merchant.Limits,
+		"PricingPlan": merchant.PricingPlan,
+		"Timestamp":   strconv.Itoa(int(merchant.Timestamp)),
+	}
+
+	if merchant.Deactivated {
+		data["Deactivated"] = strconv.FormatBool(merchant.Deactivated)
+		data["DeactivatedTimestamp"] = strconv.Itoa(int(merchant.DeactivatedTimestamp))
+	}
+
+	return data
+}
+
+func (app *application) createMerchant(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MerchantID string `json:"MerchantID"`
+		merchantInput
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	if input.MerchantID != "" {
+		input.Validator.CheckField(
+			validator.Matches(input.MerchantID, rgxMerchantID),
+			"MerchantID",
+			"MerchantID must be at most 128 letters, digits or . _ @ - characters",
+		)
+	}
+
+	input.normalize()
+	input.check(&input.Validator)
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	merchant, err := app.service.CreateMerchant(auditActor(r), entities.Merchant{
+		ID:             input.MerchantID,
+		AccountDetails: input.accountDetails(),
+		Limits:         input.limits(),
+		PricingPlan:    input.pricingPlan(),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrConflict):
+			app.merchantExists(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusCreated, merchantResponse(merchant))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getMerchant(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+
+	merchant, err := app.service.GetMerchant(merchantID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, merchantResponse(merchant))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) updateMerchant(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+
+	var input struct {
+		merchantInput
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.normalize()
+	input.check(&input.Validator)
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	merchant, err := app.service.UpdateMerchant(
+		auditActor(r),
+		merchantID,
+		input.accountDetails(),
+		input.limits(),
+		input.pricingPlan(),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		case errors.Is(err, storage.ErrConflict):
+			app.merchantChanged(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, merchantResponse(merchant))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) deactivateMerchant(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+
+	merchant, err := app.service.DeactivateMerchant(auditActor(r), merchantID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		case errors.Is(err, storage.ErrConflict):
+			app.merchantChanged(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, merchantResponse(merchant))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/request"
+	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+func (app *application) createPaymentMethod(w http.ResponseWriter, r *http.Request) {
+	customerID := chi.URLParam(r, "customerID")
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	var input struct {
+		CustomerName   string              `json:"CustomerName"`
+		CardNumber     string              `json:"CardNumber"`
+		CardCVV        int                 `json:"CardCVV"`
+		CardExpiryDate string              `json:"CardExpiryDate"`
+		Validator      validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	checkCardInput(
+		&input.Validator,
+		input.CustomerName,
+		input.CardNumber,
+		input.CardCVV,
+		input.CardExpiryDate,
+	)
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	method := entities.PaymentMethod{
+		MerchantID: merchantID,
+		CustomerID: customerID,
+	}
+	card := entities.CardDetails{
+		Name:           input.CustomerName,
+		Number:         input.CardNumber,
+		SecurityCode:   input.CardCVV,
+		ExpirationDate: input.CardExpiryDate,
+	}
+
+	paymentMethodID, err := app.service.CreatePaymentMethod(auditActor(r), method, card)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]string{
+		"PaymentMethodID": paymentMethodID,
+	}
+
+	err = response.JSON(w, http.StatusCreated, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) listPaymentMethods(w http.ResponseWriter, r *http.Request) {
+	customerID := chi.URLParam(r, "customerID")
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	methods, err := app.service.ListPaymentMethods(merchantID, customerID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	paymentMethods := make([]map[string]string, 0, len(methods))
+	for _, method := range methods {
+		paymentMethods = append(paymentMethods, map[string]string{
+			"PaymentMethodID": method.ID,
+			"CustomerID":      method.CustomerID,
+			"CardName":        method.CardName,
+			"CardLast4":       method.CardLast4,
+			"CardExpiryDate":  method.CardExpiryDate,
+			"Timestamp":       strconv.Itoa(int(method.Timestamp)),
+		})
+	}
+
+	data := map[string]any{
+		"PaymentMethods": paymentMethods,
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) deletePaymentMethod(w http.ResponseWriter, r *http.Request) {
+	customerID := chi.URLParam(r, "customerID")
+	paymentMethodID := chi.URLParam(r, "paymentMethodID")
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	err := app.service.DeletePaymentMethod(
+		auditActor(r),
+		merchantID,
+		customerID,
+		paymentMethodID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+func payoutResponse(payout entities.Payout) map[string]string {
+	data := map[string]string{
+		"PayoutID":         payout.ID,
+		"MerchantID":       payout.MerchantID,
+		"Status":           payout.Status,
+		"Amount":           payout.Amount.MajorUnits(),
+		"Currency":         payout.Amount.Currency,
+		"AccountName":      payout.Destination.Name,
+		"IBAN":             payout.Destination.IBAN,
+		"BIC":              payout.Destination.BIC,
+		"Timestamp":        strconv.Itoa(int(payout.Timestamp)),
+		"UpdatedTimestamp": strconv.Itoa(int(payout.UpdatedTimestamp)),
+	}
+
+	if payout.BankTransferID != "" {
+		data["BankTransferID"] = payout.BankTransferID
+	}
+
+	if payout.FailureReason != "" {
+		data["FailureReason"] = payout.FailureReason
+	}
+
+	return data
+}
+
+// listPayouts returns the payouts of the merchant, the latest first, filtered by the status
+// query parameter
+func (app *application) listPayouts(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	status := r.URL.Query().Get("status")
+
+	var v validator.Validator
+
+	if status != "" {
+		v.CheckField(
+			validator.In(status, entities.PayoutStatuses...),
+			"status",
+			"status must be one of pending, in_transit, paid or failed",
+		)
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	payouts, err := app.service.ListPayouts(merchantID, status)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := make([]map[string]string, 0, len(payouts))
+	for _, payout := range payouts {
+		data = append(data, payoutResponse(payout))
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{"Payouts": data})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getPayout(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	payoutID := chi.URLParam(r, "payoutID")
+
+	payout, err := app.service.GetPayout(merchantID, payoutID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, payoutResponse(payout))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/service"
+	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/sepa"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+// maxStatusReportBytes limits the size of uploaded pain.002 status reports
+const maxStatusReportBytes = 10_485_760
+
+// exportSEPAPayouts returns the pending EUR payouts as a pain.001 credit transfer file to be
+// uploaded to the bank, executed on the executionDate query parameter or today
+func (app *application) exportSEPAPayouts(w http.ResponseWriter, r *http.Request) {
+	if app.config.sepa.debtorIBAN == "" {
+		app.sepaNotConfigured(w, r)
+		return
+	}
+
+	executionDate := time.Now().UTC()
+
+	var v validator.Validator
+
+	if value := r.URL.Query().Get("executionDate"); value != "" {
+		date, err := time.Parse(time.DateOnly, value)
+		v.CheckField(err == nil, "executionDate", "executionDate must be a YYYY-MM-DD date")
+		v.CheckField(
+			err != nil || !date.Before(executionDate.Truncate(24*time.Hour)),
+			"executionDate",
+			"executionDate cannot be in the past",
+		)
+
+		executionDate = date
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	export, err := app.service.ExportSEPAPayouts(
+		auditActor(r),
+		sepaDebtor(app.config),
+		app.config.sepa.initiatingParty,
+		executionDate,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrNoPayoutsToExport):
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+export.MessageID+`.xml"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(export.Document)
+}
+
+// getSEPAExport returns the pain.001 credit transfer file of an earlier export again
+func (app *application) getSEPAExport(w http.ResponseWriter, r *http.Request) {
+	messageID := chi.URLParam(r, "messageID")
+
+	document, err := app.service.GetSEPAExport(messageID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+messageID+`.xml"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(document)
+}
+
+// applySEPAStatusReport settles the exported payouts from the pain.002 status report in the
+// request body
+func (app *application) applySEPAStatusReport(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxStatusReportBytes)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	report, err := sepa.ParseStatusReport(data)
+	if err != nil {
+		app.invalidStatusReport(w, r, err)
+		return
+	}
+
+	result, err := app.service.ApplySEPAStatusReport(auditActor(r), report)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{
+		"OriginalMessageID": report.OriginalMessageID,
+		"Paid":              result.Paid,
+		"Failed":            result.Failed,
+		"Unmatched":         result.Unmatched,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/domain/service"
+	"github.com/mgajewskik/payment-platform/internal/request"
+	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+func planData(plan entities.Plan) map[string]any {
+	return map[string]any{
+		"PlanID":    plan.ID,
+		"Name":      plan.Name,
+		"Price":     strconv.Itoa(int(plan.Price.Amount)),
+		"Amount":    plan.Price.MajorUnits(),
+		"Currency":  plan.Price.Currency,
+		"Interval":  plan.Interval,
+		"TrialDays": plan.TrialDays,
+		"Timestamp": strconv.Itoa(int(plan.Timestamp)),
+	}
+}
+
+func subscriptionData(subscription entities.Subscription) map[string]any {
+	data := map[string]any{
+		"SubscriptionID":     subscription.ID,
+		"PlanID":             subscription.PlanID,
+		"CustomerID":         subscription.CustomerID,
+		"PaymentMethodID":    subscription.PaymentMethodID,
+		"Status":             subscription.Status,
+		"CurrentPeriodStart": strconv.Itoa(int(subscription.CurrentPeriodStart)),
+		"CurrentPeriodEnd":   strconv.Itoa(int(subscription.CurrentPeriodEnd)),
+		"FailedAttempts":     subscription.FailedAttempts,
+		"LastPaymentID":      subscription.LastPaymentID,
+		"LastError":          subscription.LastError,
+		"Timestamp":          strconv.Itoa(int(subscription.Timestamp)),
+		"UpdatedTimestamp":   strconv.Itoa(int(subscription.UpdatedTimestamp)),
+	}
+
+	if subscription.TrialEnd != 0 {
+		data["TrialEnd"] = strconv.Itoa(int(subscription.TrialEnd))
+	}
+
+	if subscription.Status == entities.SubscriptionStatusCancelled {
+		data["CancelledTimestamp"] = strconv.Itoa(int(subscription.CancelledTimestamp))
+	} else {
+		data["NextAttempt"] = strconv.Itoa(int(subscription.NextAttempt))
+	}
+
+	return data
+}
+
+func (app *application) createPlan(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	var input struct {
+		Name      string              `json:"Name"`
+		Price     int64               `json:"Price"`
+		Currency  string              `json:"Currency"`
+		Interval  string              `json:"Interval"`
+		TrialDays int                 `json:"TrialDays"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Validator.CheckField(input.Name != "", "Name", "Name is required")
+	input.Validator.CheckField(
+		validator.MaxRunes(input.Name, 200),
+		"Name",
+		"Name must not be more than 200 characters",
+	)
+	input.Validator.CheckField(input.Price > 0, "Price", "Price is required and must be positive")
+	input.Validator.CheckField(input.Currency != "", "Currency", "Currency is required")
+	input.Validator.CheckField(
+		entities.IsCurrency(input.Currency),
+		"Currency",
+		"Currency must be a valid ISO 4217 code",
+	)
+
+	if currency, ok := entities.LookupCurrency(input.Currency); ok {
+		input.Validator.CheckField(
+			input.Price <= currency.MaxAmount(),
+			"Price",
+			"Price must not be greater than "+strconv.FormatInt(currency.MaxAmount(), 10),
+		)
+	}
+
+	input.Validator.CheckField(
+		validator.In(input.Interval, entities.PlanIntervals...),
+		"Interval",
+		"Interval must be one of "+strings.Join(entities.PlanIntervals, ", "),
+	)
+	input.Validator.CheckField(input.TrialDays >= 0, "TrialDays", "TrialDays cannot be negative")
+	input.Validator.CheckField(
+		input.TrialDays <= 365,
+		"TrialDays",
+		"TrialDays must not be more than 365",
+	)
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	plan, err := app.service.CreatePlan(auditActor(r), entities.Plan{
+		MerchantID: merchantID,
+		Name:       input.Name,
+		Price:      entities.Money{Amount: input.Price, Currency: input.Currency},
+		Interval:   input.Interval,
+		TrialDays:  input.TrialDays,
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = response.JSON(w, http.StatusCreated, planData(plan))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) listPlans(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	plans, err := app.service.ListPlans(merchantID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := make([]map[string]any, 0, len(plans))
+	for _, plan := range plans {
+		data = append(data, planData(plan))
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{"Plans": data})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getPlan(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	planID := chi.URLParam(r, "planID")
+
+	plan, err := app.service.GetPlan(merchantID, planID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, planData(plan))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// createSubscription subscribes a customer with one of their stored payment methods, the payment
+// of the first period is created by the billing scheduler
+func (app *application) createSubscription(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	var input struct {
+		PlanID          string              `json:"PlanID"`
+		CustomerID      string              `json:"CustomerID"`
+		PaymentMethodID string              `json:"PaymentMethodID"`
+		Validator       validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Validator.CheckField(input.PlanID != "", "PlanID", "PlanID is required")
+	input.Validator.CheckField(input.CustomerID != "", "CustomerID", "CustomerID is required")
+	input.Validator.CheckField(
+		input.PaymentMethodID != "",
+		"PaymentMethodID",
+		"PaymentMethodID is required",
+	)
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	subscription, err := app.service.CreateSubscription(auditActor(r), entities.Subscription{
+		MerchantID:      merchantID,
+		PlanID:          input.PlanID,
+		CustomerID:      input.CustomerID,
+		PaymentMethodID: input.PaymentMethodID,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownPlan):
+			input.Validator.AddFieldError("PlanID", "PlanID does not exist")
+			app.failedValidation(w, r, input.Validator)
+		case errors.Is(err, service.ErrUnknownPaymentMethod):
+			input.Validator.AddFieldError(
+				"PaymentMethodID",
+				"PaymentMethodID does not exist for the customer",
+			)
+			app.failedValidation(w, r, input.Validator)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusCreated, subscriptionData(subscription))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// listSubscriptions returns the subscriptions of the merchant, the latest first, filtered by the
+// status query parameter
+func (app *application) listSubscriptions(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	status := r.URL.Query().Get("status")
+
+	if status != "" {
+		var v validator.Validator
+
+		v.CheckField(
+			validator.In(status, entities.SubscriptionStatuses...),
+			"status",
+			"status must be one of "+strings.Join(entities.SubscriptionStatuses, ", "),
+		)
+
+		if v.HasErrors() {
+			app.failedValidation(w, r, v)
+			return
+		}
+	}
+
+	subscriptions, err := app.service.ListSubscriptions(merchantID, status)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := make([]map[string]any, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		data = append(data, subscriptionData(subscription))
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{"Subscriptions": data})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) getSubscription(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	subscriptionID := chi.URLParam(r, "subscriptionID")
+
+	subscription, err := app.service.GetSubscription(merchantID, subscriptionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, subscriptionData(subscription))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) cancelSubscription(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+	subscriptionID := chi.URLParam(r, "subscriptionID")
+
+	subscription, err := app.service.CancelSubscription(
+		auditActor(r),
+		merchantID,
+		subscriptionID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		case errors.Is(err, service.ErrSubscriptionCancelled):
+			app.subscriptionCancelled(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusOK, subscriptionData(subscription))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
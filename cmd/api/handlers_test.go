@@ -2,46 +2,132 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"log/slog"
+	"math/big"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/mgajewskik/payment-platform/internal/blobstore"
 	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/domain/fx"
+	"github.com/mgajewskik/payment-platform/internal/domain/risk"
 	"github.com/mgajewskik/payment-platform/internal/domain/service"
 	"github.com/mgajewskik/payment-platform/internal/domain/simulator"
+	"github.com/mgajewskik/payment-platform/internal/jwtkeys"
+	"github.com/mgajewskik/payment-platform/internal/mtls"
+	"github.com/mgajewskik/payment-platform/internal/ratelimit"
+	"github.com/mgajewskik/payment-platform/internal/sepa"
+	"github.com/mgajewskik/payment-platform/internal/signing"
 	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/webhook"
 	"github.com/pascaldekloe/jwt"
 	"github.com/stretchr/testify/assert"
 )
 
-func TestGenerateToken(t *testing.T) {
+func newTestConverter() *fx.MarkupConverter {
+	provider, _ := fx.NewStaticProvider(fx.Rates{
+		Base:      "EUR",
+		Timestamp: time.Unix(100, 0),
+		Rates: map[string]string{
+			"CHF": "0.94",
+			"GBP": "0.85",
+			"JPY": "161.50",
+			"PLN": "4.30",
+			"SEK": "11.40",
+			"USD": "1.08",
+		},
+	})
+	return fx.NewMarkupConverter(provider, big.NewRat(1, 100))
+}
+
+func newTestApplication() (*application, *storage.MemoryRepository) {
+	logger := slog.Default()
+	repository := storage.NewMemoryRepository()
 	app := &application{
-		config: config{
-			merchantID: "testMerchant",
-			baseURL:    "http://localhost",
-			jwt: struct {
-				secretKey string
-			}{
-				secretKey: "testSecret",
+		service: service.NewService(
+			repository,
+			simulator.NewBankSimulator(logger),
+			risk.NewEngine(risk.DefaultConfig()),
+			newTestConverter(),
+			blobstore.NewMemory(),
+			webhook.NewHTTPSender(time.Second),
+			logger,
+		),
+		logger: logger,
+	}
+
+	app.config.baseURL = "http://localhost"
+	app.config.jwt.secretKey = "testSecret"
+	app.jwtKeys = jwtkeys.NewHMACKeySet([]byte(app.config.jwt.secretKey))
+	app.config.signing.maxSkew = 5 * time.Minute
+
+	for _, merchantID := range []string{"testMerchant", "testMerchantID"} {
+		_ = repository.CreateMerchant(entities.Merchant{
+			ID: merchantID,
+			AccountDetails: entities.AccountDetails{
+				Name:     "Test Merchant",
+				IBAN:     "DE89370400440532013000",
+				BIC:      "COBADEFFXXX",
+				Currency: "EUR",
 			},
-		},
+		})
+	}
+
+	return app, repository
+}
+
+var testActor = entities.Actor{Type: entities.ActorTypeSystem, ID: "test"}
+
+// newTestAuthenticationToken issues a token with the given scopes, all scopes when none are given
+func newTestAuthenticationToken(
+	t *testing.T,
+	app *application,
+	merchantID string,
+	scopes ...string,
+) string {
+	if len(scopes) == 0 {
+		scopes = entities.Scopes
+	}
+
+	key, secret, err := app.service.CreateAPIKey(
+		testActor,
+		merchantID,
+		"test key",
+		scopes,
+		false,
+	)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	req, err := http.NewRequest("GET", "/token", nil)
+	return exchangeTestAPIKey(t, app, key.ID, secret)
+}
+
+func exchangeTestAPIKey(t *testing.T, app *application, keyID, secret string) string {
+	body, _ := json.Marshal(map[string]string{"KeyID": keyID, "KeySecret": secret})
+
+	req, err := http.NewRequest("POST", "/token", bytes.NewBuffer(body))
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	rr := httptest.NewRecorder()
 
-	handler := http.HandlerFunc(app.generateToken)
-	handler.ServeHTTP(rr, req)
+	app.routes().ServeHTTP(rr, req)
 
-	assert.Equal(t, http.StatusOK, rr.Code)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status code creating token: %d", rr.Code)
+	}
 
 	responseMap := make(map[string]string)
 	err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
@@ -49,38 +135,113 @@ func TestGenerateToken(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	tokenString := responseMap["AuthenticationToken"]
-	claims, err := jwt.HMACCheck([]byte(tokenString), []byte(app.config.jwt.secretKey))
+	return responseMap["AuthenticationToken"]
+}
+
+func TestCreateAuthenticationToken(t *testing.T) {
+	app, _ := newTestApplication()
+
+	key, secret, err := app.service.CreateAPIKey(
+		testActor,
+		"testMerchant",
+		"test key",
+		[]string{entities.ScopePaymentsRead},
+		false,
+	)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	assert.Equal(t, app.config.merchantID, claims.Subject)
+	t.Run("should exchange API key for token", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]string{"KeyID": key.ID, "KeySecret": secret})
+
+		req, err := http.NewRequest("POST", "/token", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(app.createAuthenticationToken)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		responseMap := make(map[string]string)
+		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tokenString := responseMap["AuthenticationToken"]
+		claims, err := jwt.HMACCheck([]byte(tokenString), []byte(app.config.jwt.secretKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "testMerchant", claims.Subject)
+
+		scope, _ := claims.String("scope")
+		assert.Equal(t, entities.ScopePaymentsRead, scope)
+
+		expiry, err := time.Parse(time.RFC3339, responseMap["AuthenticationTokenExpiry"])
+		assert.Nil(t, err)
+		assert.True(t, expiry.After(time.Now()))
+	})
+
+	t.Run("should reject invalid secret", func(t *testing.T) {
+		body, _ := json.Marshal(map[string]string{"KeyID": key.ID, "KeySecret": "wrong"})
+
+		req, err := http.NewRequest("POST", "/token", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(app.createAuthenticationToken)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should reject revoked key", func(t *testing.T) {
+		err := app.service.RevokeAPIKey(testActor, "testMerchant", key.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := json.Marshal(map[string]string{"KeyID": key.ID, "KeySecret": secret})
+
+		req, err := http.NewRequest("POST", "/token", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+
+		handler := http.HandlerFunc(app.createAuthenticationToken)
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should not expose the open token endpoint", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/token", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
 
-	assert.NotNil(t, claims)
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
 
-	expiry, err := time.Parse(time.RFC3339, responseMap["AuthenticationTokenExpiry"])
-	assert.Nil(t, err)
-	assert.True(t, expiry.After(time.Now()))
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
 }
 
 func TestCreatePayment(t *testing.T) {
-	logger := slog.Default()
-	bank := simulator.NewBankSimulator(logger)
-	storage := storage.NewMemoryRepository()
-	app := &application{
-		config: config{
-			merchantID: "testMerchant",
-			baseURL:    "http://localhost",
-			jwt: struct {
-				secretKey string
-			}{
-				secretKey: "testSecret",
-			},
-		},
-		service: service.NewService(storage, bank, logger),
-		logger:  logger,
-	}
+	app, _ := newTestApplication()
 
 	paymentRequest := map[string]interface{}{
 		"CustomerID":     "testCustomer",
@@ -102,6 +263,7 @@ func TestCreatePayment(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		req = contextSetAuthenticatedMerchantID(req, "testMerchantID")
 
 		rr := httptest.NewRecorder()
 
@@ -121,11 +283,15 @@ func TestCreatePayment(t *testing.T) {
 	t.Run("should create payment with middleware", func(t *testing.T) {
 		r := app.routes()
 
-		req, err := http.NewRequest("GET", "/token", nil)
+		tokenString := newTestAuthenticationToken(t, app, "testMerchantID")
+
+		req, err := http.NewRequest("POST", "/payments", bytes.NewBuffer(jsonValue))
 		if err != nil {
 			t.Fatal(err)
 		}
 
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+
 		rr := httptest.NewRecorder()
 
 		r.ServeHTTP(rr, req)
@@ -138,48 +304,54 @@ func TestCreatePayment(t *testing.T) {
 			t.Fatal(err)
 		}
 
-		tokenString := responseMap["AuthenticationToken"]
+		assert.NotEmpty(t, responseMap["paymentID"])
+	})
+
+	t.Run("should reject a currency without an exchange rate", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Post("/payments", app.createPayment)
+
+		paymentRequest["Currency"] = "BRL"
+		jsonValue, _ := json.Marshal(paymentRequest)
 
-		req, err = http.NewRequest("POST", "/payments", bytes.NewBuffer(jsonValue))
+		req, err := http.NewRequest("POST", "/payments", bytes.NewBuffer(jsonValue))
 		if err != nil {
 			t.Fatal(err)
 		}
+		req = contextSetAuthenticatedMerchantID(req, "testMerchantID")
 
-		req.Header.Set("Authorization", "Bearer "+tokenString)
-
-		rr = httptest.NewRecorder()
+		rr := httptest.NewRecorder()
 
 		r.ServeHTTP(rr, req)
 
-		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "merchant settlement currency")
+	})
 
-		responseMap = make(map[string]string)
-		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+	t.Run("should reject an unknown payment method", func(t *testing.T) {
+		r := chi.NewRouter()
+		r.Post("/payments", app.createPayment)
+
+		body := `{"CustomerID":"testCustomer","PaymentMethodID":"unknownID",` +
+			`"Price":1000,"Currency":"EUR"}`
+
+		req, err := http.NewRequest("POST", "/payments", bytes.NewBufferString(body))
 		if err != nil {
 			t.Fatal(err)
 		}
+		req = contextSetAuthenticatedMerchantID(req, "testMerchantID")
 
-		assert.NotEmpty(t, responseMap["paymentID"])
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "PaymentMethodID does not exist")
 	})
 }
 
 func TestGetPayment(t *testing.T) {
-	logger := slog.Default()
-	bank := simulator.NewBankSimulator(logger)
-	storage := storage.NewMemoryRepository()
-	app := &application{
-		config: config{
-			merchantID: "testMerchant",
-			baseURL:    "http://localhost",
-			jwt: struct {
-				secretKey string
-			}{
-				secretKey: "testSecret",
-			},
-		},
-		service: service.NewService(storage, bank, logger),
-		logger:  logger,
-	}
+	app, storage := newTestApplication()
 
 	t.Run("should get payment", func(t *testing.T) {
 		input := entities.Payment{
@@ -206,6 +378,24 @@ func TestGetPayment(t *testing.T) {
 				Amount:   100,
 				Currency: "USD",
 			},
+			Settlement: entities.Money{
+				Amount:   92,
+				Currency: "EUR",
+			},
+			FX: &entities.FXRate{
+				Provider:    "static",
+				MidRate:     "0.92592593",
+				Markup:      "0.01",
+				AppliedRate: "0.91666666",
+				Timestamp:   100,
+			},
+			Fees: entities.Fees{
+				Gross:        entities.Money{Amount: 92, Currency: "EUR"},
+				Fee:          entities.Money{Amount: 3, Currency: "EUR"},
+				Net:          entities.Money{Amount: 89, Currency: "EUR"},
+				FixedFee:     entities.Money{Amount: 0, Currency: "EUR"},
+				RefundPolicy: entities.RefundFeeRetain,
+			},
 			BankTransactionID: "simulatedTransactionID",
 			Timestamp:         123,
 		}
@@ -237,6 +427,15 @@ func TestGetPayment(t *testing.T) {
 		assert.Equal(t, "testCustomerID", responseMap["CustomerID"])
 		assert.Equal(t, "100", responseMap["Price"])
 		assert.Equal(t, "USD", responseMap["Currency"])
+		assert.Equal(t, "92", responseMap["SettlementPrice"])
+		assert.Equal(t, "0.92", responseMap["SettlementAmount"])
+		assert.Equal(t, "EUR", responseMap["SettlementCurrency"])
+		assert.Equal(t, "0.91666666", responseMap["FXRate"])
+		assert.Equal(t, "0.01", responseMap["FXMarkup"])
+		assert.Equal(t, "92", responseMap["Gross"])
+		assert.Equal(t, "3", responseMap["Fee"])
+		assert.Equal(t, "89", responseMap["Net"])
+		assert.Equal(t, entities.RefundFeeRetain, responseMap["RefundFeePolicy"])
 		assert.Equal(t, "123", responseMap["Timestamp"])
 	})
 
@@ -273,39 +472,22 @@ func TestGetPayment(t *testing.T) {
 
 		r := app.routes()
 
-		req, err := http.NewRequest("GET", "/token", nil)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		rr := httptest.NewRecorder()
-
-		r.ServeHTTP(rr, req)
-
-		assert.Equal(t, http.StatusOK, rr.Code)
-
-		responseMap := make(map[string]string)
-		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
-		if err != nil {
-			t.Fatal(err)
-		}
-
-		tokenString := responseMap["AuthenticationToken"]
+		tokenString := newTestAuthenticationToken(t, app, "testMerchantID")
 
-		req, err = http.NewRequest("GET", "/payments/11111111-1111-1111-1111-111111111111", nil)
+		req, err := http.NewRequest("GET", "/payments/11111111-1111-1111-1111-111111111111", nil)
 		if err != nil {
 			t.Fatal(err)
 		}
 
 		req.Header.Set("Authorization", "Bearer "+tokenString)
 
-		rr = httptest.NewRecorder()
+		rr := httptest.NewRecorder()
 
 		r.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusOK, rr.Code)
 
-		responseMap = make(map[string]string)
+		responseMap := make(map[string]string)
 		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
 		if err != nil {
 			t.Fatal(err)
@@ -321,22 +503,7 @@ func TestGetPayment(t *testing.T) {
 }
 
 func TestRefundPayment(t *testing.T) {
-	logger := slog.Default()
-	bank := simulator.NewBankSimulator(logger)
-	storage := storage.NewMemoryRepository()
-	app := &application{
-		config: config{
-			merchantID: "testMerchant",
-			baseURL:    "http://localhost",
-			jwt: struct {
-				secretKey string
-			}{
-				secretKey: "testSecret",
-			},
-		},
-		service: service.NewService(storage, bank, logger),
-		logger:  logger,
-	}
+	app, storage := newTestApplication()
 
 	t.Run("should refund payment", func(t *testing.T) {
 		input := entities.Payment{
@@ -380,6 +547,7 @@ func TestRefundPayment(t *testing.T) {
 		if err != nil {
 			t.Fatal(err)
 		}
+		req = contextSetAuthenticatedMerchantID(req, "testMerchantID")
 
 		rr := httptest.NewRecorder()
 
@@ -424,26 +592,35 @@ func TestRefundPayment(t *testing.T) {
 
 		r := app.routes()
 
-		req, err := http.NewRequest("GET", "/token", nil)
+		tokenString := newTestAuthenticationToken(t, app, "testMerchantID")
+
+		req, err := http.NewRequest(
+			"PATCH",
+			"/payments/11111111-1111-1111-1111-111111111111/refund",
+			nil,
+		)
 		if err != nil {
 			t.Fatal(err)
 		}
 
+		req.Header.Set("Authorization", "Bearer "+tokenString)
+
 		rr := httptest.NewRecorder()
 
 		r.ServeHTTP(rr, req)
 
+		got, _ := storage.GetPayment("testMerchantID", "11111111-1111-1111-1111-111111111111")
+
 		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, true, got.Refunded)
+	})
 
-		responseMap := make(map[string]string)
-		err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
-		if err != nil {
-			t.Fatal(err)
-		}
+	t.Run("should not refund payment twice", func(t *testing.T) {
+		r := app.routes()
 
-		tokenString := responseMap["AuthenticationToken"]
+		tokenString := newTestAuthenticationToken(t, app, "testMerchantID")
 
-		req, err = http.NewRequest(
+		req, err := http.NewRequest(
 			"PATCH",
 			"/payments/11111111-1111-1111-1111-111111111111/refund",
 			nil,
@@ -454,13 +631,1734 @@ func TestRefundPayment(t *testing.T) {
 
 		req.Header.Set("Authorization", "Bearer "+tokenString)
 
-		rr = httptest.NewRecorder()
+		rr := httptest.NewRecorder()
 
 		r.ServeHTTP(rr, req)
 
-		got, _ := storage.GetPayment("testMerchantID", "11111111-1111-1111-1111-111111111111")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("should report refunds racing another request as a conflict", func(t *testing.T) {
+		input := entities.Payment{
+			ID:                "22222222-2222-2222-2222-222222222222",
+			Merchant:          entities.Merchant{ID: "testMerchantID"},
+			Price:             entities.Money{Amount: 100, Currency: "EUR"},
+			BankTransactionID: "simulatedTransactionID",
+			Timestamp:         123,
+		}
+
+		_ = storage.CreateNewPayment(input)
+
+		// NOTE: the refund entries of the payment were posted by another request
+		_ = storage.PostJournalEntries(entities.NewJournalEntry(
+			input,
+			entities.JournalEntryRefund,
+			entities.AccountMerchantPending,
+			entities.AccountBankClearing,
+			input.Price,
+			123,
+		))
+
+		r := chi.NewRouter()
+		r.Patch("/payments/{paymentID}/refund", app.refundPayment)
+
+		req, err := http.NewRequest("PATCH", "/payments/"+input.ID+"/refund", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = contextSetAuthenticatedMerchantID(req, "testMerchantID")
+
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("should reject refunds of payments with an open dispute", func(t *testing.T) {
+		input := entities.Payment{
+			ID:                "33333333-3333-3333-3333-333333333333",
+			Merchant:          entities.Merchant{ID: "testMerchantID"},
+			Price:             entities.Money{Amount: 100, Currency: "EUR"},
+			BankTransactionID: "simulatedTransactionID",
+			Timestamp:         123,
+			DisputedAmount:    100,
+			OpenDisputes:      1,
+		}
+
+		_ = storage.CreateNewPayment(input)
+
+		r := chi.NewRouter()
+		r.Patch("/payments/{paymentID}/refund", app.refundPayment)
+
+		req, err := http.NewRequest("PATCH", "/payments/"+input.ID+"/refund", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = contextSetAuthenticatedMerchantID(req, "testMerchantID")
+
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusConflict, rr.Code)
+		assert.Contains(t, rr.Body.String(), "open dispute")
+	})
+}
+
+func TestGetBalance(t *testing.T) {
+	app, storage := newTestApplication()
+
+	payment := entities.Payment{
+		ID:       "00000000-0000-0000-0000-000000000000",
+		Merchant: entities.Merchant{ID: "testMerchant"},
+		Price:    entities.Money{Amount: 10000, Currency: "EUR"},
+	}
+
+	_ = storage.CreateNewPayment(
+		payment,
+		entities.NewJournalEntry(
+			payment,
+			entities.JournalEntryCharge,
+			entities.AccountBankClearing,
+			entities.AccountMerchantPending,
+			payment.Price,
+			123,
+		),
+		entities.NewJournalEntry(
+			payment,
+			entities.JournalEntryFee,
+			entities.AccountMerchantPending,
+			entities.AccountPlatformFees,
+			entities.Money{Amount: 250, Currency: "EUR"},
+			123,
+		),
+	)
+
+	get := func(t *testing.T, token string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/balance", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should get balance", func(t *testing.T) {
+		token := newTestAuthenticationToken(t, app, "testMerchant", entities.ScopeBalanceRead)
+
+		rr := get(t, token)
 
 		assert.Equal(t, http.StatusOK, rr.Code)
-		assert.Equal(t, true, got.Refunded)
+
+		var response struct {
+			MerchantID string
+			Available  []map[string]string
+			Pending    []map[string]string
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "testMerchant", response.MerchantID)
+		assert.Empty(t, response.Available)
+		assert.Equal(t, []map[string]string{
+			{"Balance": "9750", "Amount": "97.50", "Currency": "EUR"},
+		}, response.Pending)
+	})
+
+	t.Run("should not show balances of other merchants", func(t *testing.T) {
+		token := newTestAuthenticationToken(t, app, "testMerchantID")
+
+		rr := get(t, token)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"Pending": []`)
+	})
+
+	t.Run("should require balance:read", func(t *testing.T) {
+		token := newTestAuthenticationToken(t, app, "testMerchant", entities.ScopePaymentsRead)
+
+		rr := get(t, token)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestCreatePaymentValidation(t *testing.T) {
+	app, _ := newTestApplication()
+
+	paymentRequest := map[string]interface{}{
+		"CustomerID":     "testCustomer",
+		"CustomerName":   "Test Customer",
+		"CardNumber":     "1234123412341234",
+		"CardCVV":        123,
+		"CardExpiryDate": "12/23",
+		"Price":          -1000,
+		"Currency":       "XYZ",
+	}
+
+	jsonValue, _ := json.Marshal(paymentRequest)
+
+	r := chi.NewRouter()
+	r.Post("/payments", app.createPayment)
+
+	req, err := http.NewRequest("POST", "/payments", bytes.NewBuffer(jsonValue))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+
+	r.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	var responseBody struct {
+		FieldErrors map[string]string
+	}
+	err = json.Unmarshal(rr.Body.Bytes(), &responseBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, map[string]string{
+		"Price":    "Price cannot be negative",
+		"Currency": "Currency must be a valid ISO 4217 code",
+	}, responseBody.FieldErrors)
+}
+
+func TestRequireScope(t *testing.T) {
+	app, _ := newTestApplication()
+
+	readToken := newTestAuthenticationToken(t, app, "testMerchant", entities.ScopePaymentsRead)
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		body          string
+		expectedScope string
+	}{
+		{
+			name:          "should reject payment creation without payments:write",
+			method:        "POST",
+			path:          "/payments",
+			body:          "{}",
+			expectedScope: entities.ScopePaymentsWrite,
+		},
+		{
+			name:          "should reject refunds without refunds:write",
+			method:        "PATCH",
+			path:          "/payments/testPayment/refund",
+			expectedScope: entities.ScopeRefundsWrite,
+		},
+		{
+			name:          "should reject key creation without api_keys:write",
+			method:        "POST",
+			path:          "/api-keys",
+			body:          `{"Name":"key"}`,
+			expectedScope: entities.ScopeAPIKeysWrite,
+		},
+		{
+			name:   "should allow reading payments with payments:read",
+			method: "GET",
+			path:   "/payments/testPayment",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+readToken)
+
+			rr := httptest.NewRecorder()
+
+			app.routes().ServeHTTP(rr, req)
+
+			if tt.expectedScope == "" {
+				assert.NotEqual(t, http.StatusForbidden, rr.Code)
+				return
+			}
+
+			assert.Equal(t, http.StatusForbidden, rr.Code)
+
+			responseMap := make(map[string]string)
+			err = json.Unmarshal(rr.Body.Bytes(), &responseMap)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assert.Equal(t, tt.expectedScope, responseMap["Scope"])
+		})
+	}
+
+	t.Run("should not grant API keys more scopes than the token", func(t *testing.T) {
+		token := newTestAuthenticationToken(
+			t,
+			app,
+			"testMerchant",
+			entities.ScopePaymentsRead,
+			entities.ScopeAPIKeysWrite,
+		)
+
+		body := `{"Name":"key","Scopes":["payments:write"]}`
+
+		req, err := http.NewRequest("POST", "/api-keys", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+}
+
+func TestRevokeAuthenticationToken(t *testing.T) {
+	app, _ := newTestApplication()
+
+	token := newTestAuthenticationToken(t, app, "testMerchant")
+	otherToken := newTestAuthenticationToken(t, app, "otherMerchant")
+
+	send := func(t *testing.T, path, authToken, token string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"Token": token})
+
+		req, err := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+authToken)
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	introspect := func(t *testing.T, authToken, token string) map[string]string {
+		rr := send(t, "/token/introspect", authToken, token)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		responseMap := make(map[string]string)
+		err := json.Unmarshal(rr.Body.Bytes(), &responseMap)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return responseMap
+	}
+
+	t.Run("should report active tokens", func(t *testing.T) {
+		responseMap := introspect(t, token, token)
+
+		assert.Equal(t, "true", responseMap["Active"])
+		assert.Equal(t, "testMerchant", responseMap["MerchantID"])
+		assert.NotEmpty(t, responseMap["TokenID"])
+	})
+
+	t.Run("should not disclose other merchants' tokens", func(t *testing.T) {
+		responseMap := introspect(t, token, otherToken)
+
+		assert.Equal(t, "false", responseMap["Active"])
+		assert.Empty(t, responseMap["TokenID"])
+	})
+
+	t.Run("should not revoke other merchants' tokens", func(t *testing.T) {
+		rr := send(t, "/token/revoke", token, otherToken)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		assert.Equal(t, "true", introspect(t, otherToken, otherToken)["Active"])
+	})
+
+	t.Run("should reject revoked tokens", func(t *testing.T) {
+		revokingToken := newTestAuthenticationToken(t, app, "testMerchant")
+
+		rr := send(t, "/token/revoke", revokingToken, token)
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		assert.Equal(t, "false", introspect(t, revokingToken, token)["Active"])
+
+		rr = send(t, "/token/introspect", token, token)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should reject tokens of revoked API keys", func(t *testing.T) {
+		key, secret, err := app.service.CreateAPIKey(
+			testActor,
+			"testMerchant",
+			"test key",
+			entities.Scopes,
+			false,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		keyToken := exchangeTestAPIKey(t, app, key.ID, secret)
+		revokingToken := newTestAuthenticationToken(t, app, "testMerchant")
+
+		assert.Equal(t, "true", introspect(t, keyToken, keyToken)["Active"])
+
+		req, err := http.NewRequest("DELETE", "/api-keys/"+key.ID, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+revokingToken)
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		rr = send(t, "/token/introspect", keyToken, keyToken)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		assert.Equal(t, "false", introspect(t, revokingToken, keyToken)["Active"])
+	})
+}
+
+func TestClientCertificateAuthentication(t *testing.T) {
+	const path = "/customers/testCustomer/payment-methods"
+
+	app, _ := newTestApplication()
+
+	registry, err := mtls.NewRegistry([]mtls.Binding{
+		{
+			MerchantID: "certMerchant",
+			Identities: []string{"dns:api.cert.example.com"},
+			Scopes:     []string{entities.ScopePaymentsRead},
+			Exclusive:  true,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.mtls = registry
+
+	withCertificate := func(req *http.Request, dnsName string) {
+		cert := &x509.Certificate{DNSNames: []string{dnsName}}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+
+	send := func(t *testing.T, method, path, dnsName, token string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, bytes.NewBufferString("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if dnsName != "" {
+			withCertificate(req, dnsName)
+		}
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should authenticate with a registered certificate", func(t *testing.T) {
+		rr := send(t, "GET", "/api-keys", "api.cert.example.com", "")
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = send(t, "GET", path, "api.cert.example.com", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should reject unregistered certificates", func(t *testing.T) {
+		rr := send(t, "GET", path, "unknown.example.com", "")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should require a certificate for exclusive merchants", func(t *testing.T) {
+		token := newTestAuthenticationToken(t, app, "certMerchant")
+
+		rr := send(t, "GET", path, "", token)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = send(t, "GET", path, "api.cert.example.com", token)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should reject tokens of another merchant than the certificate", func(t *testing.T) {
+		token := newTestAuthenticationToken(t, app, "testMerchant")
+
+		rr := send(t, "GET", path, "api.cert.example.com", token)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+		rr = send(t, "GET", path, "", token)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should not widen the certificate scopes with a token", func(t *testing.T) {
+		token := newTestAuthenticationToken(t, app, "certMerchant", entities.Scopes...)
+
+		rr := send(t, "GET", "/api-keys", "api.cert.example.com", token)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		rr = send(t, "GET", path, "api.cert.example.com", token)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should narrow the certificate scopes with a token", func(t *testing.T) {
+		token := newTestAuthenticationToken(t, app, "certMerchant", entities.ScopeAuditRead)
+
+		rr := send(t, "GET", path, "api.cert.example.com", token)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestVerifyRequestSignature(t *testing.T) {
+	app, _ := newTestApplication()
+
+	key, secret, err := app.service.CreateAPIKey(
+		testActor,
+		"testMerchant",
+		"signed",
+		entities.Scopes,
+		true,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := exchangeTestAPIKey(t, app, key.ID, secret)
+	body := `{"CustomerName":"Test Name","CardNumber":"1234123412341234",` +
+		`"CardCVV":123,"CardExpiryDate":"12/30"}`
+	path := "/customers/testCustomer/payment-methods"
+
+	send := func(t *testing.T, sign func(req *http.Request)) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		if sign != nil {
+			sign(req)
+		}
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	signWith := func(nonce string, timestamp time.Time, signedBody string) func(*http.Request) {
+		return func(req *http.Request) {
+			request := signing.Request{
+				Method:    "POST",
+				Path:      path,
+				Timestamp: strconv.FormatInt(timestamp.Unix(), 10),
+				Nonce:     nonce,
+				Body:      []byte(signedBody),
+			}
+
+			req.Header.Set(signing.HeaderTimestamp, request.Timestamp)
+			req.Header.Set(signing.HeaderNonce, request.Nonce)
+			req.Header.Set(signing.HeaderSignature, signing.Sign(key.SigningSecret, request))
+		}
+	}
+
+	t.Run("should reject unsigned requests", func(t *testing.T) {
+		rr := send(t, nil)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should accept signed requests", func(t *testing.T) {
+		rr := send(t, signWith("nonce-1", time.Now(), body))
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+
+	t.Run("should reject replayed nonces", func(t *testing.T) {
+		rr := send(t, signWith("nonce-1", time.Now(), body))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should reject stale timestamps", func(t *testing.T) {
+		rr := send(t, signWith("nonce-2", time.Now().Add(-10*time.Minute), body))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should reject tampered bodies", func(t *testing.T) {
+		rr := send(t, signWith("nonce-3", time.Now(), `{}`))
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("should not require signatures for other keys", func(t *testing.T) {
+		token = newTestAuthenticationToken(t, app, "testMerchant")
+
+		rr := send(t, nil)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	app, _ := newTestApplication()
+
+	app.limiter = ratelimit.NewLimiter(ratelimit.Config{
+		Anonymous: ratelimit.Limits{Default: ratelimit.Limit{RequestsPerMinute: 60, Burst: 1}},
+	})
+
+	send := func(t *testing.T, method, path, token string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should limit unauthenticated requests by IP", func(t *testing.T) {
+		rr := send(t, "GET", "/status", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, "0", rr.Header().Get("RateLimit-Remaining"))
+		assert.Equal(t, "1", rr.Header().Get("RateLimit-Reset"))
+
+		rr = send(t, "GET", "/status", "")
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "1", rr.Header().Get("Retry-After"))
+	})
+
+	t.Run("should limit merchants per route", func(t *testing.T) {
+		app.limiter = ratelimit.NewLimiter(ratelimit.Config{
+			Merchant: ratelimit.Limits{
+				Default: ratelimit.Limit{RequestsPerMinute: 600, Burst: 10},
+				Routes: map[string]ratelimit.Limit{
+					"GET /payments/{paymentID}": {RequestsPerMinute: 6, Burst: 1},
+				},
+			},
+		})
+
+		token := newTestAuthenticationToken(t, app, "testMerchant")
+
+		rr := send(t, "GET", "/payments/testPayment", token)
+		assert.NotEqual(t, http.StatusTooManyRequests, rr.Code)
+
+		rr = send(t, "GET", "/payments/otherPayment", token)
+		assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+		assert.Equal(t, "10", rr.Header().Get("Retry-After"))
+
+		rr = send(t, "GET", "/api-keys", token)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "10", rr.Header().Get("RateLimit-Limit"))
+	})
+}
+
+func TestListAuditEvents(t *testing.T) {
+	app, _ := newTestApplication()
+
+	token := newTestAuthenticationToken(t, app, "testMerchant")
+
+	req, err := http.NewRequest("POST", "/api-keys", bytes.NewBufferString(`{"Name":"key"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Request-ID", "testRequestID")
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	rr := httptest.NewRecorder()
+
+	app.routes().ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("unexpected status code creating API key: %d", rr.Code)
+	}
+
+	assert.Equal(t, "testRequestID", rr.Header().Get("X-Request-ID"))
+
+	list := func(t *testing.T, token, query string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/audit-events"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should list events recorded for the request", func(t *testing.T) {
+		rr := list(t, token, "?action=api_key.create&after=1")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var response struct {
+			AuditEvents []entities.AuditEvent
+			ChainValid  bool
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.True(t, response.ChainValid)
+		assert.Len(t, response.AuditEvents, 1)
+
+		event := response.AuditEvents[0]
+		assert.Equal(t, int64(2), event.Sequence)
+		assert.Equal(t, entities.ActorTypeAPIKey, event.Actor.Type)
+		assert.NotEmpty(t, event.Actor.ID)
+		assert.Equal(t, "10.0.0.1", event.Actor.IPAddress)
+		assert.Equal(t, "testRequestID", event.Actor.RequestID)
+		assert.Equal(t, entities.AuditOutcomeSuccess, event.Outcome)
+	})
+
+	t.Run("should generate a request ID when none is given", func(t *testing.T) {
+		rr := list(t, token, "")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotEmpty(t, rr.Header().Get("X-Request-ID"))
+	})
+
+	t.Run("should reject invalid filters", func(t *testing.T) {
+		rr := list(t, token, "?limit=0")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should require audit:read", func(t *testing.T) {
+		readToken := newTestAuthenticationToken(t, app, "testMerchant", entities.ScopePaymentsRead)
+
+		rr := list(t, readToken, "")
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestPayouts(t *testing.T) {
+	app, storage := newTestApplication()
+
+	for _, payout := range []entities.Payout{
+		{
+			ID:         "paidPayoutID",
+			MerchantID: "testMerchant",
+			Amount:     entities.Money{Amount: 9750, Currency: "EUR"},
+			Status:     entities.PayoutStatusPaid,
+			Destination: entities.AccountDetails{
+				Name: "Test Merchant",
+				IBAN: "DE89370400440532013000",
+				BIC:  "COBADEFFXXX",
+			},
+			BankTransferID: "transferID",
+			Timestamp:      100,
+		},
+		{
+			ID:         "pendingPayoutID",
+			MerchantID: "testMerchant",
+			Amount:     entities.Money{Amount: 500, Currency: "EUR"},
+			Status:     entities.PayoutStatusPending,
+			Timestamp:  200,
+		},
+		{
+			ID:         "otherPayoutID",
+			MerchantID: "testMerchantID",
+			Amount:     entities.Money{Amount: 500, Currency: "EUR"},
+			Status:     entities.PayoutStatusPending,
+			Timestamp:  300,
+		},
+	} {
+		_ = storage.CreatePayout(payout)
+	}
+
+	token := newTestAuthenticationToken(t, app, "testMerchant", entities.ScopePayoutsRead)
+
+	get := func(t *testing.T, token, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	list := func(t *testing.T, query string) []map[string]string {
+		rr := get(t, token, "/payouts"+query)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var response struct {
+			Payouts []map[string]string
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return response.Payouts
+	}
+
+	t.Run("should list payouts of the merchant latest first", func(t *testing.T) {
+		payouts := list(t, "")
+
+		assert.Len(t, payouts, 2)
+		assert.Equal(t, "pendingPayoutID", payouts[0]["PayoutID"])
+		assert.Equal(t, "paidPayoutID", payouts[1]["PayoutID"])
+	})
+
+	t.Run("should filter payouts by status", func(t *testing.T) {
+		payouts := list(t, "?status=paid")
+
+		assert.Len(t, payouts, 1)
+		assert.Equal(t, "paidPayoutID", payouts[0]["PayoutID"])
+	})
+
+	t.Run("should reject unknown statuses", func(t *testing.T) {
+		rr := get(t, token, "/payouts?status=lost")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should get payout", func(t *testing.T) {
+		rr := get(t, token, "/payouts/paidPayoutID")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var response map[string]string
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, map[string]string{
+			"PayoutID":         "paidPayoutID",
+			"MerchantID":       "testMerchant",
+			"Status":           entities.PayoutStatusPaid,
+			"Amount":           "97.50",
+			"Currency":         "EUR",
+			"AccountName":      "Test Merchant",
+			"IBAN":             "DE89370400440532013000",
+			"BIC":              "COBADEFFXXX",
+			"BankTransferID":   "transferID",
+			"Timestamp":        "100",
+			"UpdatedTimestamp": "0",
+		}, response)
+	})
+
+	t.Run("should not get payouts of other merchants", func(t *testing.T) {
+		rr := get(t, token, "/payouts/otherPayoutID")
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should require payouts:read", func(t *testing.T) {
+		readToken := newTestAuthenticationToken(t, app, "testMerchant", entities.ScopePaymentsRead)
+
+		rr := get(t, readToken, "/payouts")
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestAdminMerchants(t *testing.T) {
+	app, _ := newTestApplication()
+	app.config.admin.username = "admin"
+	app.config.admin.password = "adminPassword"
+
+	admin := func(t *testing.T, method, path, body, password string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("admin", password)
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	body := `{"MerchantID":"newMerchant","AccountDetails":{"Name":"New Merchant",` +
+		`"IBAN":"DE89370400440532013000","BIC":"COBADEFFXXX","Currency":"EUR"},` +
+		`"Limits":{"MaxPaymentAmount":{"EUR":10000}},` +
+		`"PricingPlan":{"Rules":[{"Percentage":"0.029","Fixed":30}],"RefundPolicy":"return"}}`
+
+	t.Run("should require admin credentials", func(t *testing.T) {
+		rr := admin(t, "GET", "/admin/merchants/testMerchant", "", "wrongPassword")
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		assert.Contains(t, rr.Header().Get("WWW-Authenticate"), "Basic")
+	})
+
+	t.Run("should create merchants", func(t *testing.T) {
+		rr := admin(t, "POST", "/admin/merchants", body, "adminPassword")
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var response struct {
+			MerchantID     string
+			AccountDetails map[string]string
+			Limits         entities.Limits
+			PricingPlan    entities.PricingPlan
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, "newMerchant", response.MerchantID)
+		assert.Equal(t, "New Merchant", response.AccountDetails["Name"])
+		assert.Equal(t, int64(10000), response.Limits.MaxPaymentAmount["EUR"])
+		assert.Equal(t, entities.PricingPlan{
+			Rules:        []entities.FeeRule{{Percentage: "0.029", Fixed: 30}},
+			RefundPolicy: entities.RefundFeeReturn,
+		}, response.PricingPlan)
+
+		rr = admin(t, "POST", "/admin/merchants", body, "adminPassword")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("should validate merchants", func(t *testing.T) {
+		invalid := `{"AccountDetails":{"Name":"Merchant","IBAN":"DE89","BIC":"COBADEFFXXX",` +
+			`"Currency":"XXX"},"Limits":{"DailyVolume":{"EUR":-1}}}`
+
+		rr := admin(t, "POST", "/admin/merchants", invalid, "adminPassword")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "AccountDetails.IBAN")
+		assert.Contains(t, rr.Body.String(), "AccountDetails.Currency")
+		assert.Contains(t, rr.Body.String(), "Limits.DailyVolume")
+
+		mismatched := `{"AccountDetails":{"Name":"Merchant","IBAN":"DE89370400440532013000",` +
+			`"BIC":"WBKPPLPP","Currency":"EUR"}}`
+
+		rr = admin(t, "POST", "/admin/merchants", mismatched, "adminPassword")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "BIC country must match the IBAN country")
+
+		pricing := `{"AccountDetails":{"Name":"Merchant","IBAN":"DE89370400440532013000",` +
+			`"BIC":"COBADEFFXXX","Currency":"EUR"},"PricingPlan":{"RefundPolicy":"keep",` +
+			`"Rules":[{"CardBrand":"other","Percentage":"2.9","Fixed":-30}]}}`
+
+		rr = admin(t, "POST", "/admin/merchants", pricing, "adminPassword")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "PricingPlan.RefundPolicy")
+		assert.Contains(t, rr.Body.String(), "PricingPlan.Rules")
+	})
+
+	t.Run("should normalize IBANs", func(t *testing.T) {
+		spaced := `{"MerchantID":"spacedMerchant","AccountDetails":{"Name":"Merchant",` +
+			`"IBAN":"pl61 1090 1014 0000 0712 1981 2874","BIC":"wbkpplpp","Currency":"PLN"}}`
+
+		rr := admin(t, "POST", "/admin/merchants", spaced, "adminPassword")
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"PL61109010140000071219812874"`)
+		assert.Contains(t, rr.Body.String(), `"WBKPPLPP"`)
+	})
+
+	t.Run("should update merchants", func(t *testing.T) {
+		update := `{"AccountDetails":{"Name":"Renamed Merchant",` +
+			`"IBAN":"DE89370400440532013000","BIC":"COBADEFFXXX","Currency":"EUR"}}`
+
+		rr := admin(t, "PUT", "/admin/merchants/newMerchant", update, "adminPassword")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		rr = admin(t, "GET", "/admin/merchants/newMerchant", "", "adminPassword")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Renamed Merchant")
+
+		rr = admin(t, "PUT", "/admin/merchants/unknownMerchant", update, "adminPassword")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should reject payments of deactivated merchants", func(t *testing.T) {
+		rr := admin(t, "POST", "/admin/merchants/testMerchant/deactivate", "", "adminPassword")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"Deactivated": "true"`)
+
+		token := newTestAuthenticationToken(t, app, "testMerchant")
+
+		payment := `{"CustomerID":"testCustomer","CustomerName":"Test Customer",` +
+			`"CardNumber":"1234123412341234","CardCVV":123,"CardExpiryDate":"12/23",` +
+			`"Price":1000,"Currency":"USD"}`
+
+		req, err := http.NewRequest("POST", "/payments", bytes.NewBufferString(payment))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr = httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should disable the admin API without a password", func(t *testing.T) {
+		app.config.admin.password = ""
+
+		rr := admin(t, "GET", "/admin/merchants/testMerchant", "", "")
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestSEPAPayouts(t *testing.T) {
+	app, storage := newTestApplication()
+	app.config.admin.username = "admin"
+	app.config.admin.password = "adminPassword"
+
+	_ = storage.CreatePayout(entities.Payout{
+		ID:         "pendingPayoutID",
+		MerchantID: "testMerchant",
+		Amount:     entities.Money{Amount: 9750, Currency: "EUR"},
+		Status:     entities.PayoutStatusPending,
+		Destination: entities.AccountDetails{
+			Name: "Test Merchant",
+			IBAN: "DE89370400440532013000",
+			BIC:  "COBADEFFXXX",
+		},
+		Timestamp: 100,
+	})
+
+	admin := func(t *testing.T, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("admin", "adminPassword")
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should require a configured debtor account", func(t *testing.T) {
+		rr := admin(t, "/admin/payouts/sepa-export", "")
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+
+	app.config.sepa.debtorName = "Payment Platform"
+	app.config.sepa.debtorIBAN = "NL91 ABNA 0417 1643 00"
+	app.config.sepa.debtorBIC = "abnanl2a"
+	app.config.sepa.initiatingParty = "Payment Platform"
+
+	t.Run("should validate the execution date", func(t *testing.T) {
+		rr := admin(t, "/admin/payouts/sepa-export?executionDate=02.01.2024", "")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	var messageID string
+
+	t.Run("should export pending payouts", func(t *testing.T) {
+		rr := admin(t, "/admin/payouts/sepa-export", "")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+		assert.NoError(t, sepa.VerifyControlSums(rr.Body.Bytes()))
+		assert.Contains(t, rr.Body.String(), "<IBAN>NL91ABNA0417164300</IBAN>")
+		assert.Contains(t, rr.Body.String(), "<InstdAmt Ccy=\"EUR\">97.50</InstdAmt>")
+
+		payout, _ := storage.GetPayout("testMerchant", "pendingPayoutID")
+		assert.Equal(t, entities.PayoutStatusInTransit, payout.Status)
+
+		messageID, _, _ = strings.Cut(payout.BankTransferID, "/")
+		assert.Contains(t, rr.Header().Get("Content-Disposition"), messageID+".xml")
+
+		rr = admin(t, "/admin/payouts/sepa-export", "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("should download exports again", func(t *testing.T) {
+		get := func(path string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest("GET", path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.SetBasicAuth("admin", "adminPassword")
+
+			rr := httptest.NewRecorder()
+
+			app.routes().ServeHTTP(rr, req)
+
+			return rr
+		}
+
+		rr := get("/admin/payouts/sepa-exports/" + messageID)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/xml", rr.Header().Get("Content-Type"))
+		assert.Contains(t, rr.Body.String(), "<MsgId>"+messageID+"</MsgId>")
+
+		rr = get("/admin/payouts/sepa-exports/unknownMessageID")
+
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should reject invalid status reports", func(t *testing.T) {
+		rr := admin(t, "/admin/payouts/sepa-status-reports", "<Document>")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should apply status reports", func(t *testing.T) {
+		report := `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.002.001.03">
+  <CstmrPmtStsRpt>
+    <GrpHdr><MsgId>reportID</MsgId></GrpHdr>
+    <OrgnlGrpInfAndSts>
+      <OrgnlMsgId>` + messageID + `</OrgnlMsgId>
+      <GrpSts>ACSC</GrpSts>
+    </OrgnlGrpInfAndSts>
+  </CstmrPmtStsRpt>
+</Document>`
+
+		rr := admin(t, "/admin/payouts/sepa-status-reports", report)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var response struct {
+			OriginalMessageID string
+			Paid              int
+			Failed            int
+			Unmatched         []string
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &response)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Equal(t, messageID, response.OriginalMessageID)
+		assert.Equal(t, 1, response.Paid)
+		assert.Equal(t, 0, response.Failed)
+		assert.Empty(t, response.Unmatched)
+
+		payout, _ := storage.GetPayout("testMerchant", "pendingPayoutID")
+		assert.Equal(t, entities.PayoutStatusPaid, payout.Status)
+	})
+}
+
+func TestDisputes(t *testing.T) {
+	app, storage := newTestApplication()
+	app.config.admin.username = "admin"
+	app.config.admin.password = "adminPassword"
+
+	_ = storage.CreateNewPayment(entities.Payment{
+		ID:         "paymentID",
+		Merchant:   entities.Merchant{ID: "testMerchant"},
+		Price:      entities.Money{Amount: 10000, Currency: "EUR"},
+		Settlement: entities.Money{Amount: 10000, Currency: "EUR"},
+	})
+
+	token := newTestAuthenticationToken(
+		t,
+		app,
+		"testMerchant",
+		entities.ScopeDisputesRead,
+		entities.ScopeDisputesWrite,
+	)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	admin := func(t *testing.T, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("admin", "adminPassword")
+
+		return serve(req)
+	}
+
+	get := func(t *testing.T, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		return serve(req)
+	}
+
+	submit := func(t *testing.T, disputeID, text, contentType string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+
+		writer := multipart.NewWriter(&body)
+		_ = writer.WriteField("text", text)
+
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", `form-data; name="files"; filename="receipt.pdf"`)
+		header.Set("Content-Type", contentType)
+
+		part, _ := writer.CreatePart(header)
+		_, _ = part.Write([]byte("receipt"))
+		_ = writer.Close()
+
+		req, err := http.NewRequest("POST", "/disputes/"+disputeID+"/evidence", &body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+
+		return serve(req)
+	}
+
+	var dispute struct {
+		DisputeID string
+		Status    string
+		Amount    string
+		Evidence  struct {
+			Text  string
+			Files []map[string]string
+		}
+	}
+
+	decode := func(t *testing.T, rr *httptest.ResponseRecorder) {
+		err := json.Unmarshal(rr.Body.Bytes(), &dispute)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("should open disputes of merchant payments", func(t *testing.T) {
+		rr := admin(
+			t,
+			"/admin/merchants/testMerchant/disputes",
+			`{"PaymentID":"paymentID","Reason":"fraudulent","Amount":2500,"Currency":"EUR"}`,
+		)
+
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		decode(t, rr)
+		assert.Equal(t, "needs_response", dispute.Status)
+		assert.Equal(t, "25.00", dispute.Amount)
+
+		rr = admin(
+			t,
+			"/admin/merchants/testMerchant/disputes",
+			`{"PaymentID":"paymentID","Reason":"unknown"}`,
+		)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		rr = admin(
+			t,
+			"/admin/merchants/testMerchant/disputes",
+			`{"PaymentID":"paymentID","Reason":"fraudulent","Amount":10001,"Currency":"EUR"}`,
+		)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should reject evidence files of other types", func(t *testing.T) {
+		rr := submit(t, dispute.DisputeID, "Delivered", "application/x-msdownload")
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should submit evidence", func(t *testing.T) {
+		rr := submit(t, dispute.DisputeID, "Delivered", "application/pdf")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		decode(t, rr)
+		assert.Equal(t, "under_review", dispute.Status)
+		assert.Equal(t, "Delivered", dispute.Evidence.Text)
+		assert.Len(t, dispute.Evidence.Files, 1)
+
+		rr = get(t, "/disputes/"+dispute.DisputeID+"/evidence/"+dispute.Evidence.Files[0]["FileID"])
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/pdf", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "receipt", rr.Body.String())
+
+		rr = submit(t, dispute.DisputeID, "Delivered", "application/pdf")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("should charge back lost disputes", func(t *testing.T) {
+		path := "/admin/merchants/testMerchant/disputes/" + dispute.DisputeID + "/resolve"
+
+		rr := admin(t, path, `{"Outcome":"lost"}`)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		decode(t, rr)
+		assert.Equal(t, "lost", dispute.Status)
+
+		payment, _ := storage.GetPayment("testMerchant", "paymentID")
+		assert.Len(t, payment.Adjustments, 1)
+		assert.Equal(t, int64(-2500), payment.Adjustments[0].Amount.Amount)
+
+		rr = admin(t, path, `{"Outcome":"won"}`)
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("should list disputes of the merchant", func(t *testing.T) {
+		rr := get(t, "/disputes?status=lost")
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), dispute.DisputeID)
+
+		otherToken := newTestAuthenticationToken(t, app, "testMerchantID")
+
+		req, _ := http.NewRequest("GET", "/disputes/"+dispute.DisputeID, nil)
+		req.Header.Set("Authorization", "Bearer "+otherToken)
+		assert.Equal(t, http.StatusNotFound, serve(req).Code)
+	})
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	app, storage := newTestApplication()
+
+	token := newTestAuthenticationToken(
+		t,
+		app,
+		"testMerchant",
+		entities.ScopeWebhooksRead,
+		entities.ScopeWebhooksWrite,
+	)
+
+	serve := func(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	var endpointID string
+
+	t.Run("should register endpoints and return their secret once", func(t *testing.T) {
+		// tested function
+		rr := serve(
+			t,
+			"POST",
+			"/webhook-endpoints",
+			`{"URL":"https://merchant.example/webhooks","EventTypes":["payment.refunded"]}`,
+		)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var created struct {
+			EndpointID string
+			Secret     string
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &created)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, created.Secret)
+
+		endpointID = created.EndpointID
+
+		endpoint, err := storage.GetWebhookEndpoint("testMerchant", endpointID)
+		assert.NoError(t, err)
+		assert.Equal(t, created.Secret, endpoint.Secret)
+
+		// tested function
+		rr = serve(t, "GET", "/webhook-endpoints", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), endpointID)
+		assert.NotContains(t, rr.Body.String(), created.Secret)
+	})
+
+	t.Run("should validate the URL and event types", func(t *testing.T) {
+		// tested function
+		rr := serve(
+			t,
+			"POST",
+			"/webhook-endpoints",
+			`{"URL":"ftp://merchant.example","EventTypes":["payment.unknown"]}`,
+		)
+
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "URL must be an absolute https URL of a public host")
+		assert.Contains(t, rr.Body.String(), "EventTypes must only contain")
+	})
+
+	t.Run("should reject plain http and internal URLs", func(t *testing.T) {
+		for _, url := range []string{
+			"http://merchant.example/webhooks",
+			"https://127.0.0.1/webhooks",
+			"https://169.254.169.254/latest",
+			"https://[::1]:8443/webhooks",
+		} {
+			// tested function
+			rr := serve(
+				t,
+				"POST",
+				"/webhook-endpoints",
+				`{"URL":"`+url+`","EventTypes":["payment.created"]}`,
+			)
+
+			assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, url)
+		}
+	})
+
+	t.Run("should delete endpoints", func(t *testing.T) {
+		// tested function
+		rr := serve(t, "DELETE", "/webhook-endpoints/"+endpointID, "")
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+
+		// tested function
+		rr = serve(t, "DELETE", "/webhook-endpoints/"+endpointID, "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	app, storage := newTestApplication()
+
+	_ = storage.CreateWebhookEndpoint(entities.WebhookEndpoint{
+		ID:         "endpointID",
+		MerchantID: "testMerchant",
+		URL:        "https://merchant.example/webhooks",
+		EventTypes: []string{entities.WebhookEventPaymentRefunded},
+	})
+	_ = storage.CreateWebhookDelivery(entities.WebhookDelivery{
+		ID:         "deliveryID",
+		MerchantID: "testMerchant",
+		EndpointID: "endpointID",
+		EventID:    "eventID",
+		EventType:  entities.WebhookEventPaymentRefunded,
+		Payload:    []byte(`{"ID":"eventID"}`),
+		Status:     entities.WebhookDeliveryFailed,
+		Attempts:   20,
+		LastError:  "endpoint responded with status 500",
+	})
+
+	token := newTestAuthenticationToken(
+		t,
+		app,
+		"testMerchant",
+		entities.ScopeWebhooksRead,
+		entities.ScopeWebhooksWrite,
+	)
+
+	serve := func(t *testing.T, method, path string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	t.Run("should list deliveries by status", func(t *testing.T) {
+		// tested function
+		rr := serve(t, "GET", "/webhook-deliveries?status=failed&eventType=payment.refunded")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"deliveryID"`)
+
+		// tested function
+		rr = serve(t, "GET", "/webhook-deliveries?status=succeeded")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "deliveryID")
+
+		// tested function
+		rr = serve(t, "GET", "/webhook-deliveries?status=unknown")
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should return deliveries with their payload", func(t *testing.T) {
+		// tested function
+		rr := serve(t, "GET", "/webhook-deliveries/deliveryID")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var delivery struct {
+			Payload    string
+			AttemptLog []map[string]any
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &delivery)
+		assert.NoError(t, err)
+		assert.Equal(t, `{"ID":"eventID"}`, delivery.Payload)
+		assert.Empty(t, delivery.AttemptLog)
+
+		// tested function
+		rr = serve(t, "GET", "/webhook-deliveries/unknownID")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("should page through deliveries the latest first", func(t *testing.T) {
+		for i, deliveryID := range []string{"firstDeliveryID", "secondDeliveryID"} {
+			_ = storage.CreateWebhookDelivery(entities.WebhookDelivery{
+				ID:         deliveryID,
+				MerchantID: "testMerchant",
+				EndpointID: "endpointID",
+				EventID:    deliveryID,
+				EventType:  entities.WebhookEventPaymentRefunded,
+				Status:     entities.WebhookDeliverySucceeded,
+				Timestamp:  int64(1000 * (i + 1)),
+			})
+		}
+
+		page := func(t *testing.T, path string) []string {
+			rr := serve(t, "GET", path)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			var body struct {
+				WebhookDeliveries []struct{ DeliveryID string }
+			}
+			err := json.Unmarshal(rr.Body.Bytes(), &body)
+			assert.NoError(t, err)
+
+			var ids []string
+			for _, delivery := range body.WebhookDeliveries {
+				ids = append(ids, delivery.DeliveryID)
+			}
+
+			return ids
+		}
+
+		// tested function
+		ids := page(t, "/webhook-deliveries?limit=2")
+		assert.Equal(t, []string{"secondDeliveryID", "firstDeliveryID"}, ids)
+
+		// tested function
+		ids = page(t, "/webhook-deliveries?limit=2&after=firstDeliveryID")
+		assert.Equal(t, []string{"deliveryID"}, ids)
+
+		// tested function
+		rr := serve(t, "GET", "/webhook-deliveries?after=unknownID")
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+		// tested function
+		rr = serve(t, "GET", "/webhook-deliveries?limit=0")
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	})
+
+	t.Run("should replay finished deliveries", func(t *testing.T) {
+		// tested function
+		rr := serve(t, "POST", "/webhook-deliveries/deliveryID/replay")
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+
+		var replay struct {
+			DeliveryID string
+			ReplayOf   string
+			Status     string
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &replay)
+		assert.NoError(t, err)
+		assert.Equal(t, "deliveryID", replay.ReplayOf)
+		assert.Equal(t, entities.WebhookDeliveryPending, replay.Status)
+
+		// tested function
+		rr = serve(t, "POST", "/webhook-deliveries/"+replay.DeliveryID+"/replay")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+	})
+
+	t.Run("should serve deliveries of any merchant to admins", func(t *testing.T) {
+		app.config.admin.username = "admin"
+		app.config.admin.password = "adminPassword"
+
+		admin := func(method, path string) *httptest.ResponseRecorder {
+			req, err := http.NewRequest(method, path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.SetBasicAuth("admin", "adminPassword")
+
+			rr := httptest.NewRecorder()
+
+			app.routes().ServeHTTP(rr, req)
+
+			return rr
+		}
+
+		// tested function
+		rr := admin("GET", "/admin/merchants/testMerchant/webhook-deliveries?status=failed")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"deliveryID"`)
+
+		// tested function
+		rr = admin("GET", "/admin/merchants/otherMerchant/webhook-deliveries/deliveryID")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
+
+		// tested function
+		rr = admin("GET", "/admin/merchants/testMerchant/webhook-deliveries/deliveryID")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"AttemptLog"`)
+
+		// tested function
+		rr = admin("POST", "/admin/merchants/testMerchant/webhook-deliveries/deliveryID/replay")
+		assert.Equal(t, http.StatusAccepted, rr.Code)
+
+		// tested function
+		rr = serve(t, "GET", "/admin/merchants/testMerchant/webhook-deliveries")
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestSubscriptions(t *testing.T) {
+	app, storage := newTestApplication()
+
+	_ = storage.CreatePaymentMethod(entities.PaymentMethod{
+		ID:             "paymentMethodID",
+		MerchantID:     "testMerchant",
+		CustomerID:     "customerID",
+		CardToken:      "tok_test",
+		CardName:       "Test Customer",
+		CardLast4:      "1111",
+		CardExpiryDate: "12/30",
+	})
+
+	token := newTestAuthenticationToken(
+		t,
+		app,
+		"testMerchant",
+		entities.ScopeSubscriptionsRead,
+		entities.ScopeSubscriptionsWrite,
+	)
+
+	serve := func(t *testing.T, method, path, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		rr := httptest.NewRecorder()
+
+		app.routes().ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	var planID, subscriptionID string
+
+	t.Run("should create plans", func(t *testing.T) {
+		// tested function
+		rr := serve(
+			t,
+			"POST",
+			"/plans",
+			`{"Name":"Pro","Price":1500,"Currency":"EUR","Interval":"month","TrialDays":14}`,
+		)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var plan struct {
+			PlanID string
+			Amount string
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &plan)
+		assert.NoError(t, err)
+		assert.Equal(t, "15.00", plan.Amount)
+
+		planID = plan.PlanID
+
+		// tested function
+		rr = serve(t, "GET", "/plans/"+planID, "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// tested function
+		rr = serve(
+			t,
+			"POST",
+			"/plans",
+			`{"Name":"Pro","Price":1500,"Currency":"EUR","Interval":"fortnight"}`,
+		)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Interval must be one of")
+	})
+
+	t.Run("should subscribe customers with stored payment methods", func(t *testing.T) {
+		// tested function
+		rr := serve(
+			t,
+			"POST",
+			"/subscriptions",
+			`{"PlanID":"`+planID+`","CustomerID":"customerID","PaymentMethodID":"paymentMethodID"}`,
+		)
+		assert.Equal(t, http.StatusCreated, rr.Code)
+
+		var subscription struct {
+			SubscriptionID string
+			Status         string
+			TrialEnd       string
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &subscription)
+		assert.NoError(t, err)
+		assert.Equal(t, entities.SubscriptionStatusActive, subscription.Status)
+		assert.NotEmpty(t, subscription.TrialEnd)
+
+		subscriptionID = subscription.SubscriptionID
+
+		// tested function
+		rr = serve(
+			t,
+			"POST",
+			"/subscriptions",
+			`{"PlanID":"`+planID+`","CustomerID":"otherID","PaymentMethodID":"paymentMethodID"}`,
+		)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+		assert.Contains(t, rr.Body.String(), "PaymentMethodID does not exist")
+	})
+
+	t.Run("should cancel subscriptions once", func(t *testing.T) {
+		// tested function
+		rr := serve(t, "POST", "/subscriptions/"+subscriptionID+"/cancel", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "CancelledTimestamp")
+
+		// tested function
+		rr = serve(t, "POST", "/subscriptions/"+subscriptionID+"/cancel", "")
+		assert.Equal(t, http.StatusConflict, rr.Code)
+
+		// tested function
+		rr = serve(t, "GET", "/subscriptions?status=cancelled", "")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), subscriptionID)
+
+		// tested function
+		rr = serve(t, "GET", "/subscriptions/unknownID", "")
+		assert.Equal(t, http.StatusNotFound, rr.Code)
 	})
 }
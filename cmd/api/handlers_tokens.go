@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+
+	"github.com/mgajewskik/payment-platform/internal/request"
+	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+// merchantTokenClaims returns the claims of the token when it is active and was issued to the
+// merchant, nil is returned for any other token so that other merchants' tokens are not disclosed
+func (app *application) merchantTokenClaims(merchantID, token string) (*jwt.Claims, error) {
+	claims, err := app.checkAuthenticationToken(token)
+	if err != nil {
+		if errors.Is(err, errInvalidAuthenticationToken) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if claims.Subject != merchantID {
+		return nil, nil
+	}
+
+	return claims, nil
+}
+
+func (app *application) revokeAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	var input struct {
+		Token     string              `json:"Token"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Validator.CheckField(input.Token != "", "Token", "Token is required")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	claims, err := app.merchantTokenClaims(merchantID, input.Token)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// NOTE: inactive tokens are not reported as errors, they cannot be used either way
+	if claims != nil {
+		err = app.service.RevokeToken(
+			auditActor(r),
+			merchantID,
+			claims.ID,
+			claims.Expires.Time(),
+		)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) introspectAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	var input struct {
+		Token     string              `json:"Token"`
+		Validator validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Validator.CheckField(input.Token != "", "Token", "Token is required")
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	claims, err := app.merchantTokenClaims(merchantID, input.Token)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := map[string]string{
+		"Active": strconv.FormatBool(claims != nil),
+	}
+
+	if claims != nil {
+		scope, _ := claims.String("scope")
+
+		data["TokenID"] = claims.ID
+		data["MerchantID"] = claims.Subject
+		data["Scopes"] = scope
+		data["AuthenticationTokenExpiry"] = claims.Expires.Time().Format(time.RFC3339)
+
+		if claims.Issued != nil {
+			data["IssuedAt"] = claims.Issued.Time().Format(time.RFC3339)
+		}
+	}
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
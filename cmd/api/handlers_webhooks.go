@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/domain/service"
+	"github.com/mgajewskik/payment-platform/internal/request"
+	"github.com/mgajewskik/payment-platform/internal/response"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/validator"
+	"github.com/mgajewskik/payment-platform/internal/webhook"
+)
+
+// webhookEndpointData is the endpoint as returned to the merchant, the secret is only returned
+// when the endpoint is created
+func webhookEndpointData(endpoint entities.WebhookEndpoint) map[string]any {
+	return map[string]any{
+		"EndpointID": endpoint.ID,
+		"URL":        endpoint.URL,
+		"EventTypes": endpoint.EventTypes,
+		"Timestamp":  strconv.Itoa(int(endpoint.Timestamp)),
+	}
+}
+
+func webhookDeliveryData(delivery entities.WebhookDelivery) map[string]any {
+	data := map[string]any{
+		"DeliveryID":       delivery.ID,
+		"EndpointID":       delivery.EndpointID,
+		"EventID":          delivery.EventID,
+		"EventType":        delivery.EventType,
+		"Status":           delivery.Status,
+		"Attempts":         delivery.Attempts,
+		"LastError":        delivery.LastError,
+		"Timestamp":        strconv.Itoa(int(delivery.Timestamp)),
+		"UpdatedTimestamp": strconv.Itoa(int(delivery.UpdatedTimestamp)),
+	}
+
+	if delivery.Status == entities.WebhookDeliveryPending {
+		data["NextAttempt"] = strconv.Itoa(int(delivery.NextAttempt))
+	}
+
+	if delivery.ReplayOf != "" {
+		data["ReplayOf"] = delivery.ReplayOf
+	}
+
+	return data
+}
+
+func (app *application) createWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	var input struct {
+		URL        string              `json:"URL"`
+		EventTypes []string            `json:"EventTypes"`
+		Validator  validator.Validator `json:"-"`
+	}
+
+	err := request.DecodeJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.Validator.CheckField(
+		isWebhookURL(input.URL),
+		"URL",
+		"URL must be an absolute https URL of a public host",
+	)
+	input.Validator.CheckField(
+		validator.MaxRunes(input.URL, 2048),
+		"URL",
+		"URL must not be more than 2048 characters",
+	)
+	input.Validator.CheckField(len(input.EventTypes) > 0, "EventTypes", "EventTypes are required")
+	input.Validator.CheckField(
+		validator.AllIn(input.EventTypes, entities.WebhookEventTypes...),
+		"EventTypes",
+		"EventTypes must only contain "+strings.Join(entities.WebhookEventTypes, ", "),
+	)
+	input.Validator.CheckField(
+		validator.NoDuplicates(input.EventTypes),
+		"EventTypes",
+		"EventTypes must not contain duplicates",
+	)
+
+	if input.Validator.HasErrors() {
+		app.failedValidation(w, r, input.Validator)
+		return
+	}
+
+	endpoint, err := app.service.CreateWebhookEndpoint(
+		auditActor(r),
+		merchantID,
+		input.URL,
+		input.EventTypes,
+	)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := webhookEndpointData(endpoint)
+	data["Secret"] = endpoint.Secret
+
+	err = response.JSON(w, http.StatusCreated, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) listWebhookEndpoints(w http.ResponseWriter, r *http.Request) {
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	endpoints, err := app.service.ListWebhookEndpoints(merchantID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := make([]map[string]any, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		data = append(data, webhookEndpointData(endpoint))
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{"WebhookEndpoints": data})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func (app *application) deleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpointID := chi.URLParam(r, "endpointID")
+	merchantID := contextGetAuthenticatedMerchantID(r)
+
+	err := app.service.DeleteWebhookEndpoint(auditActor(r), merchantID, endpointID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webhookDeliveriesMerchantID is the merchant of the admin routes for webhook deliveries, which
+// share their handlers with the merchant routes, or the authenticated merchant otherwise
+func webhookDeliveriesMerchantID(r *http.Request) string {
+	if merchantID := chi.URLParam(r, "merchantID"); merchantID != "" {
+		return merchantID
+	}
+
+	return contextGetAuthenticatedMerchantID(r)
+}
+
+const (
+	defaultWebhookDeliveriesLimit = 100
+	maxWebhookDeliveriesLimit     = 1000
+)
+
+// listWebhookDeliveries returns the deliveries of the merchant, the latest first, filtered by
+// the status, eventType, endpointID and eventID query parameters. A page holds at most limit
+// deliveries, the next one is listed after the ID of the last delivery.
+func (app *application) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	merchantID := webhookDeliveriesMerchantID(r)
+	query := r.URL.Query()
+
+	filter := storage.WebhookDeliveryFilter{
+		Status:     query.Get("status"),
+		EventType:  query.Get("eventType"),
+		EndpointID: query.Get("endpointID"),
+		EventID:    query.Get("eventID"),
+		After:      query.Get("after"),
+		Limit:      defaultWebhookDeliveriesLimit,
+	}
+
+	var v validator.Validator
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		v.CheckField(
+			err == nil && n > 0 && n <= maxWebhookDeliveriesLimit,
+			"limit",
+			"limit must be between 1 and "+strconv.Itoa(maxWebhookDeliveriesLimit),
+		)
+		filter.Limit = n
+	}
+
+	if filter.Status != "" {
+		v.CheckField(
+			validator.In(filter.Status, entities.WebhookDeliveryStatuses...),
+			"status",
+			"status must be one of "+strings.Join(entities.WebhookDeliveryStatuses, ", "),
+		)
+	}
+
+	if filter.EventType != "" {
+		v.CheckField(
+			validator.In(filter.EventType, entities.WebhookEventTypes...),
+			"eventType",
+			"eventType must be one of "+strings.Join(entities.WebhookEventTypes, ", "),
+		)
+	}
+
+	if v.HasErrors() {
+		app.failedValidation(w, r, v)
+		return
+	}
+
+	deliveries, err := app.service.ListWebhookDeliveries(merchantID, filter)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			v.AddFieldError("after", "after must be the ID of a delivery")
+			app.failedValidation(w, r, v)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	data := make([]map[string]any, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		data = append(data, webhookDeliveryData(delivery))
+	}
+
+	err = response.JSON(w, http.StatusOK, map[string]any{"WebhookDeliveries": data})
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// getWebhookDelivery returns the delivery with the log of its attempts, the request body of
+// every attempt is the payload of the delivery
+func (app *application) getWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	merchantID := webhookDeliveriesMerchantID(r)
+	deliveryID := chi.URLParam(r, "deliveryID")
+
+	delivery, attempts, err := app.service.GetWebhookDelivery(merchantID, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	log := make([]map[string]any, 0, len(attempts))
+	for _, attempt := range attempts {
+		log = append(log, map[string]any{
+			"Number":         attempt.Number,
+			"URL":            attempt.URL,
+			"RequestBody":    string(attempt.RequestBody),
+			"ResponseStatus": attempt.ResponseStatus,
+			"Latency":        attempt.Latency,
+			"Error":          attempt.Error,
+			"Timestamp":      strconv.Itoa(int(attempt.Timestamp)),
+		})
+	}
+
+	data := webhookDeliveryData(delivery)
+	data["Payload"] = string(delivery.Payload)
+	data["AttemptLog"] = log
+
+	err = response.JSON(w, http.StatusOK, data)
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// replayWebhookDelivery queues the event of the delivery again, the replay is attempted by the
+// delivery scheduler like any other delivery
+func (app *application) replayWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	merchantID := webhookDeliveriesMerchantID(r)
+	deliveryID := chi.URLParam(r, "deliveryID")
+
+	replay, err := app.service.ReplayWebhookDelivery(auditActor(r), merchantID, deliveryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			app.notFound(w, r)
+		case errors.Is(err, service.ErrWebhookDeliveryPending):
+			app.webhookDeliveryPending(w, r)
+		case errors.Is(err, service.ErrWebhookEndpointDeleted):
+			app.webhookEndpointDeleted(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = response.JSON(w, http.StatusAccepted, webhookDeliveryData(replay))
+	if err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+func isWebhookURL(value string) bool {
+	if !validator.IsURL(value) {
+		return false
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+
+	if u.Scheme != "https" {
+		return false
+	}
+
+	// NOTE: hostnames are checked by the sender when dialing as they can resolve differently
+	// at delivery time
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil {
+		return webhook.IsPublicAddress(addr)
+	}
+
+	return true
+}
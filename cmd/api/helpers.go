@@ -1,10 +1,134 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+	"github.com/tomasen/realip"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/oidc"
+	"github.com/mgajewskik/payment-platform/internal/validator"
 )
 
+var errInvalidAuthenticationToken = errors.New("invalid authentication token")
+
+// authenticatedToken is what a verified bearer token grants, signingKeyID is set when the token
+// was issued for an API key requiring signed requests. The actor is who the token was issued to.
+type authenticatedToken struct {
+	merchantID   string
+	scopes       []string
+	signingKeyID string
+	actor        entities.Actor
+}
+
+// authenticateBearerToken verifies a token issued either by the platform or by the configured
+// identity provider
+func (app *application) authenticateBearerToken(token string) (authenticatedToken, error) {
+	// NOTE: tokens from the identity provider are verified against its published keys
+	if app.oidc != nil && app.oidc.Issued([]byte(token)) {
+		identity, err := app.oidc.Verify([]byte(token))
+		if err != nil {
+			if errors.Is(err, oidc.ErrInvalidToken) {
+				return authenticatedToken{}, errInvalidAuthenticationToken
+			}
+
+			return authenticatedToken{}, err
+		}
+
+		return authenticatedToken{
+			merchantID: identity.MerchantID,
+			scopes:     identity.Scopes,
+			actor:      entities.Actor{Type: entities.ActorTypeOIDC, ID: identity.Claims.Subject},
+		}, nil
+	}
+
+	claims, err := app.checkAuthenticationToken(token)
+	if err != nil {
+		return authenticatedToken{}, err
+	}
+
+	scope, _ := claims.String("scope")
+	signingKeyID, _ := claims.String("signing_key")
+	apiKeyID, _ := claims.String("api_key")
+
+	return authenticatedToken{
+		merchantID:   claims.Subject,
+		scopes:       strings.Fields(scope),
+		signingKeyID: signingKeyID,
+		actor:        entities.Actor{Type: entities.ActorTypeAPIKey, ID: apiKeyID},
+	}, nil
+}
+
+// checkAuthenticationToken verifies the token signature and claims and that neither the token
+// nor the API key it was exchanged from was revoked, any token that cannot be accepted returns errInvalidAuthenticationToken
+func (app *application) checkAuthenticationToken(token string) (*jwt.Claims, error) {
+	claims, err := app.jwtKeys.Check([]byte(token))
+	if err != nil {
+		return nil, errInvalidAuthenticationToken
+	}
+
+	if !claims.Valid(time.Now()) {
+		return nil, errInvalidAuthenticationToken
+	}
+
+	if claims.Issuer != app.config.baseURL {
+		return nil, errInvalidAuthenticationToken
+	}
+
+	if !claims.AcceptAudience(app.config.baseURL) {
+		return nil, errInvalidAuthenticationToken
+	}
+
+	if claims.Subject == "" {
+		return nil, errInvalidAuthenticationToken
+	}
+
+	// NOTE: tokens without an ID or expiry could never be revoked
+	if claims.ID == "" || claims.Expires == nil {
+		return nil, errInvalidAuthenticationToken
+	}
+
+	revoked, err := app.service.IsTokenRevoked(claims.ID, claims.Expires.Time())
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, errInvalidAuthenticationToken
+	}
+
+	// NOTE: revoking an API key also revokes the tokens exchanged from it
+	apiKeyID, _ := claims.String("api_key")
+	if apiKeyID == "" {
+		return nil, errInvalidAuthenticationToken
+	}
+
+	revoked, err = app.service.IsAPIKeyRevoked(claims.Subject, apiKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, errInvalidAuthenticationToken
+	}
+
+	return claims, nil
+}
+
+// auditActor returns the actor of the request for the audit log
+func auditActor(r *http.Request) entities.Actor {
+	actor := contextGetActor(r)
+	actor.IPAddress = realip.FromRequest(r)
+	actor.RequestID = contextGetRequestID(r)
+
+	return actor
+}
+
 func (app *application) backgroundTask(r *http.Request, fn func() error) {
 	app.wg.Add(1)
 
@@ -24,3 +148,25 @@ func (app *application) backgroundTask(r *http.Request, fn func() error) {
 		}
 	}()
 }
+
+func checkCardInput(
+	v *validator.Validator,
+	name, number string,
+	securityCode int,
+	expiryDate string,
+) {
+	v.CheckField(name != "", "CustomerName", "CustomerName is required")
+	v.CheckField(number != "", "CardNumber", "CardNumber is required")
+	v.CheckField(
+		len([]rune(number)) == 16,
+		"CardNumber",
+		"CardNumber must be exactly 16 digits",
+	)
+	v.CheckField(securityCode != 0, "CardCVV", "CardCVV is required")
+	v.CheckField(
+		securityCode >= 100 && securityCode <= 999,
+		"CardCVV",
+		"CardCVV must be exactly 3 digits",
+	)
+	v.CheckField(expiryDate != "", "CardExpiryDate", "CardExpiryDate is required")
+}
@@ -7,16 +7,28 @@ import (
 	"log/slog"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"time"
 
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 
+	"github.com/mgajewskik/payment-platform/internal/blobstore"
+	"github.com/mgajewskik/payment-platform/internal/domain/fx"
+	"github.com/mgajewskik/payment-platform/internal/domain/risk"
 	"github.com/mgajewskik/payment-platform/internal/domain/service"
 	"github.com/mgajewskik/payment-platform/internal/domain/simulator"
 	"github.com/mgajewskik/payment-platform/internal/env"
+	"github.com/mgajewskik/payment-platform/internal/jwtkeys"
+	"github.com/mgajewskik/payment-platform/internal/mtls"
+	"github.com/mgajewskik/payment-platform/internal/oidc"
+	"github.com/mgajewskik/payment-platform/internal/ratelimit"
+	"github.com/mgajewskik/payment-platform/internal/sepa"
 	"github.com/mgajewskik/payment-platform/internal/setup"
 	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/validator"
 	"github.com/mgajewskik/payment-platform/internal/version"
+	"github.com/mgajewskik/payment-platform/internal/webhook"
 
 	"github.com/lmittmann/tint"
 )
@@ -35,11 +47,69 @@ func main() {
 type config struct {
 	baseURL          string
 	httpPort         int
-	merchantID       string
 	awsRegion        string
 	awsDynamoDBTable string
 	jwt              struct {
-		secretKey string
+		secretKey        string
+		signingKeyID     string
+		signingKeyFile   string
+		verificationKeys string
+	}
+	oidc struct {
+		issuer        string
+		audience      string
+		merchantClaim string
+	}
+	tls struct {
+		certFile     string
+		keyFile      string
+		clientCAFile string
+		registryFile string
+	}
+	signing struct {
+		maxSkew time.Duration
+	}
+	rateLimit struct {
+		enabled    bool
+		configFile string
+	}
+	risk struct {
+		rulesFile string
+	}
+	fx struct {
+		ratesFile           string
+		feedFile            string
+		feedRefreshInterval time.Duration
+		feedMaxAge          time.Duration
+		markup              string
+	}
+	payouts struct {
+		enabled         bool
+		interval        time.Duration
+		settlementDelay time.Duration
+		transfers       string
+	}
+	sepa struct {
+		debtorName      string
+		debtorIBAN      string
+		debtorBIC       string
+		initiatingParty string
+	}
+	blobs struct {
+		dir string
+	}
+	webhooks struct {
+		enabled  bool
+		interval time.Duration
+		timeout  time.Duration
+	}
+	subscriptions struct {
+		enabled  bool
+		interval time.Duration
+	}
+	admin struct {
+		username string
+		password string
 	}
 	setup bool
 }
@@ -47,6 +117,10 @@ type config struct {
 type application struct {
 	config  config
 	service *service.Service
+	jwtKeys *jwtkeys.KeySet
+	oidc    *oidc.Verifier
+	mtls    *mtls.Registry
+	limiter *ratelimit.Limiter
 	logger  *slog.Logger
 	wg      sync.WaitGroup
 }
@@ -56,16 +130,56 @@ func run(logger *slog.Logger) error {
 
 	cfg.baseURL = env.GetString("BASE_URL", "http://localhost:4444")
 	cfg.httpPort = env.GetInt("HTTP_PORT", 4444)
-	cfg.merchantID = env.GetString(
-		"MERCHANT_ID",
-		"test@merchant",
-	) // NOTE: this is only used for token generation
 	cfg.awsRegion = env.GetString("AWS_REGION", "us-east-1")
 	cfg.awsDynamoDBTable = env.GetString("AWS_DYNAMODB_TABLE", "payment-platform-table")
-	cfg.jwt.secretKey = env.GetString("JWT_SECRET_KEY", "dqohby7dgnt6dus6rnch26n3p6kwhsbn")
+	cfg.jwt.secretKey = env.GetString("JWT_SECRET_KEY", "")
+	cfg.jwt.signingKeyID = env.GetString("JWT_SIGNING_KEY_ID", "")
+	cfg.jwt.signingKeyFile = env.GetString("JWT_SIGNING_KEY_FILE", "")
+	cfg.jwt.verificationKeys = env.GetString("JWT_VERIFICATION_KEYS", "")
+	cfg.oidc.issuer = env.GetString("OIDC_ISSUER", "")
+	cfg.oidc.audience = env.GetString("OIDC_AUDIENCE", cfg.baseURL)
+	cfg.oidc.merchantClaim = env.GetString("OIDC_MERCHANT_CLAIM", "sub")
+	cfg.tls.certFile = env.GetString("TLS_CERT_FILE", "")
+	cfg.tls.keyFile = env.GetString("TLS_KEY_FILE", "")
+	cfg.tls.clientCAFile = env.GetString("TLS_CLIENT_CA_FILE", "")
+	cfg.tls.registryFile = env.GetString("MTLS_REGISTRY_FILE", "")
+	cfg.signing.maxSkew = time.Duration(env.GetInt("REQUEST_SIGNATURE_MAX_SKEW", 300)) * time.Second
+	cfg.rateLimit.enabled = env.GetBool("RATE_LIMIT_ENABLED", true)
+	cfg.rateLimit.configFile = env.GetString("RATE_LIMIT_FILE", "")
+	cfg.risk.rulesFile = env.GetString("RISK_RULES_FILE", "")
+	cfg.fx.ratesFile = env.GetString("FX_RATES_FILE", "")
+	cfg.fx.feedFile = env.GetString("FX_FEED_FILE", "")
+	cfg.fx.feedRefreshInterval = time.Duration(env.GetInt("FX_FEED_REFRESH_INTERVAL", 60)) *
+		time.Second
+	cfg.fx.feedMaxAge = time.Duration(env.GetInt("FX_FEED_MAX_AGE", 86400)) * time.Second
+	cfg.fx.markup = env.GetString("FX_MARKUP", "0")
+	cfg.payouts.enabled = env.GetBool("PAYOUTS_ENABLED", false)
+	cfg.payouts.interval = time.Duration(env.GetInt("PAYOUT_INTERVAL", 3600)) * time.Second
+	cfg.payouts.settlementDelay = time.Duration(env.GetInt("PAYOUT_SETTLEMENT_DELAY", 172800)) *
+		time.Second
+	cfg.payouts.transfers = env.GetString("PAYOUT_TRANSFERS", payoutTransfersBank)
+	cfg.sepa.debtorName = env.GetString("SEPA_DEBTOR_NAME", "")
+	cfg.sepa.debtorIBAN = env.GetString("SEPA_DEBTOR_IBAN", "")
+	cfg.sepa.debtorBIC = env.GetString("SEPA_DEBTOR_BIC", "")
+	cfg.sepa.initiatingParty = env.GetString("SEPA_INITIATING_PARTY", cfg.sepa.debtorName)
+	cfg.blobs.dir = env.GetString("BLOB_STORE_DIR", "data/blobs")
+	cfg.webhooks.enabled = env.GetBool("WEBHOOKS_ENABLED", true)
+	cfg.webhooks.interval = time.Duration(env.GetInt("WEBHOOK_DELIVERY_INTERVAL", 10)) * time.Second
+	cfg.webhooks.timeout = time.Duration(env.GetInt("WEBHOOK_TIMEOUT", 10)) * time.Second
+	cfg.subscriptions.enabled = env.GetBool("SUBSCRIPTIONS_ENABLED", false)
+	cfg.subscriptions.interval = time.Duration(env.GetInt("SUBSCRIPTION_BILLING_INTERVAL", 300)) *
+		time.Second
+	cfg.admin.username = env.GetString("ADMIN_USERNAME", "admin")
+	cfg.admin.password = env.GetString("ADMIN_PASSWORD", "")
 	cfg.setup = env.GetBool("SETUP", false)
 
 	showVersion := flag.Bool("version", false, "display version and exit")
+	processPayouts := flag.Bool("process-payouts", false, "process payouts once and exit")
+	billSubscriptions := flag.Bool(
+		"bill-subscriptions",
+		false,
+		"charge due subscriptions once and exit",
+	)
 
 	flag.Parse()
 
@@ -89,15 +203,190 @@ func run(logger *slog.Logger) error {
 		defer dbSetup.Teardown()
 	}
 
+	riskConfig := risk.DefaultConfig()
+	if cfg.risk.rulesFile != "" {
+		riskConfig, err = risk.LoadConfig(cfg.risk.rulesFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = checkSEPAConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	jwtKeys, err := loadJWTKeys(cfg)
+	if err != nil {
+		return err
+	}
+
+	converter, err := loadFXConverter(cfg)
+	if err != nil {
+		return err
+	}
+
+	blobs, err := blobstore.NewFileSystem(cfg.blobs.dir)
+	if err != nil {
+		return err
+	}
+
 	storage := storage.NewDynamoDBRepository(cfg.awsDynamoDBTable, awsCfg, logger)
 	bank := simulator.NewBankSimulator(logger)
-	svc := service.NewService(storage, bank, logger)
+	riskEngine := risk.NewEngine(riskConfig)
+	webhooks := webhook.NewHTTPSender(cfg.webhooks.timeout)
+	svc := service.NewService(storage, bank, riskEngine, converter, blobs, webhooks, logger)
 
 	app := &application{
 		config:  cfg,
 		service: svc,
+		jwtKeys: jwtKeys,
 		logger:  logger,
 	}
 
+	if cfg.oidc.issuer != "" {
+		app.oidc = oidc.NewVerifier(oidc.Config{
+			Issuer:        cfg.oidc.issuer,
+			Audience:      cfg.oidc.audience,
+			MerchantClaim: cfg.oidc.merchantClaim,
+		})
+	}
+
+	if cfg.tls.registryFile != "" {
+		app.mtls, err = mtls.LoadRegistry(cfg.tls.registryFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.rateLimit.enabled {
+		rateLimitConfig := ratelimit.DefaultConfig()
+		if cfg.rateLimit.configFile != "" {
+			rateLimitConfig, err = ratelimit.LoadConfig(cfg.rateLimit.configFile)
+			if err != nil {
+				return err
+			}
+		}
+
+		app.limiter = ratelimit.NewLimiter(rateLimitConfig)
+	}
+
+	if *processPayouts {
+		return app.processPayouts()
+	}
+
+	if *billSubscriptions {
+		return app.billSubscriptions()
+	}
+
 	return app.serveHTTP()
 }
+
+// loadFXConverter quotes rates from the feed when one is configured or from the static rates
+// file otherwise, without either only payments in the merchant currency are accepted
+func loadFXConverter(cfg config) (*fx.MarkupConverter, error) {
+	markup, err := fx.ParseMarkup(cfg.fx.markup)
+	if err != nil {
+		return nil, err
+	}
+
+	var provider fx.Provider
+
+	switch {
+	case cfg.fx.feedFile != "":
+		provider, err = fx.NewFeedProvider(fx.FeedConfig{
+			Path:            cfg.fx.feedFile,
+			RefreshInterval: cfg.fx.feedRefreshInterval,
+			MaxAge:          cfg.fx.feedMaxAge,
+		})
+	case cfg.fx.ratesFile != "":
+		provider, err = fx.LoadStaticProvider(cfg.fx.ratesFile)
+	default:
+		provider = fx.NoProvider{}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return fx.NewMarkupConverter(provider, markup), nil
+}
+
+// checkSEPAConfig requires a valid debtor account when payouts are exported as SEPA credit
+// transfers, the account is optional otherwise and the export is unavailable without it
+func checkSEPAConfig(cfg config) error {
+	switch cfg.payouts.transfers {
+	case payoutTransfersBank:
+		if cfg.sepa.debtorIBAN == "" {
+			return nil
+		}
+	case payoutTransfersSEPA:
+	default:
+		return fmt.Errorf("invalid payout transfers %q", cfg.payouts.transfers)
+	}
+
+	err := sepa.ValidateDebtor(sepaDebtor(cfg), cfg.sepa.initiatingParty)
+	if err != nil {
+		return fmt.Errorf("invalid SEPA configuration: %w", err)
+	}
+
+	return nil
+}
+
+// sepaDebtor returns the configured debtor account with a normalised IBAN and BIC
+func sepaDebtor(cfg config) sepa.Party {
+	return sepa.Party{
+		Name: cfg.sepa.debtorName,
+		IBAN: validator.NormalizeIBAN(cfg.sepa.debtorIBAN),
+		BIC:  validator.NormalizeBIC(cfg.sepa.debtorBIC),
+	}
+}
+
+// minJWTSecretKeyLength is the size of the HS256 hash, shorter secrets weaken the signature
+const minJWTSecretKeyLength = 32
+
+// loadJWTKeys uses the PEM signing key when one is configured and falls back to HS256 with
+// the shared secret otherwise. Keys retired by a rotation are listed in JWT_VERIFICATION_KEYS
+// as comma separated "kid=path" entries, optionally followed by "@<RFC 3339 time>" after
+// which the key is no longer accepted.
+func loadJWTKeys(cfg config) (*jwtkeys.KeySet, error) {
+	if cfg.jwt.signingKeyFile == "" {
+		if len(cfg.jwt.secretKey) < minJWTSecretKeyLength {
+			return nil, fmt.Errorf(
+				"JWT_SIGNING_KEY_FILE or a JWT_SECRET_KEY of at least %d bytes is required",
+				minJWTSecretKeyLength,
+			)
+		}
+
+		return jwtkeys.NewHMACKeySet([]byte(cfg.jwt.secretKey)), nil
+	}
+
+	var verification []jwtkeys.VerificationKeyFile
+
+	for _, entry := range strings.Split(cfg.jwt.verificationKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid JWT verification key entry %q", entry)
+		}
+
+		file := jwtkeys.VerificationKeyFile{ID: id, Path: path}
+
+		if path, expires, ok := strings.Cut(path, "@"); ok {
+			t, err := time.Parse(time.RFC3339, expires)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JWT verification key expiry %q: %w", expires, err)
+			}
+
+			file.Path = path
+			file.Expires = t
+		}
+
+		verification = append(verification, file)
+	}
+
+	return jwtkeys.Load(cfg.jwt.signingKeyID, cfg.jwt.signingKeyFile, verification)
+}
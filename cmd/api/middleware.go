@@ -1,18 +1,66 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
-	"time"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/domain/service"
 	"github.com/mgajewskik/payment-platform/internal/response"
-	"github.com/pascaldekloe/jwt"
+	"github.com/mgajewskik/payment-platform/internal/signing"
 
 	"github.com/tomasen/realip"
 )
 
+const (
+	maxSignedBodyBytes = 1_048_576
+	maxRequestIDLength = 128
+)
+
+// requestID takes the request ID from the X-Request-ID header, or generates one when it is
+// missing or invalid, and echoes it back in the response
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get("X-Request-ID")
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		w.Header().Set("X-Request-ID", requestID)
+
+		next.ServeHTTP(w, contextSetRequestID(r, requestID))
+	})
+}
+
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+
+	for _, c := range requestID {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
 func (app *application) recoverPanic(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
@@ -39,7 +87,13 @@ func (app *application) logAccess(next http.Handler) http.Handler {
 		)
 
 		userAttrs := slog.Group("user", "ip", ip)
-		requestAttrs := slog.Group("request", "method", method, "url", url, "proto", proto)
+		requestAttrs := slog.Group(
+			"request",
+			"id", contextGetRequestID(r),
+			"method", method,
+			"url", url,
+			"proto", proto,
+		)
 		responseAttrs := slog.Group("response", "status", mw.StatusCode, "size", mw.BytesCount)
 
 		app.logger.Info("access", userAttrs, requestAttrs, responseAttrs)
@@ -50,6 +104,27 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
 
+		var (
+			merchantID   string
+			scopes       []string
+			signingKeyID string
+			actor        entities.Actor
+		)
+
+		if app.mtls != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			cert := r.TLS.VerifiedChains[0][0]
+
+			binding, ok := app.mtls.Lookup(cert)
+			if !ok {
+				app.invalidClientCertificate(w, r)
+				return
+			}
+
+			merchantID = binding.MerchantID
+			scopes = binding.Scopes
+			actor = entities.Actor{Type: entities.ActorTypeCertificate, ID: cert.Subject.String()}
+		}
+
 		authorizationHeader := r.Header.Get("Authorization")
 
 		if authorizationHeader != "" {
@@ -58,36 +133,51 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			if len(headerParts) == 2 && headerParts[0] == "Bearer" {
 				token := headerParts[1]
 
-				claims, err := jwt.HMACCheck([]byte(token), []byte(app.config.jwt.secretKey))
+				authenticated, err := app.authenticateBearerToken(token)
 				if err != nil {
-					app.invalidAuthenticationToken(w, r)
+					switch {
+					case errors.Is(err, errInvalidAuthenticationToken):
+						app.invalidAuthenticationToken(w, r)
+					default:
+						app.serverError(w, r, err)
+					}
 					return
 				}
 
-				if !claims.Valid(time.Now()) {
+				if merchantID != "" && authenticated.merchantID != merchantID {
 					app.invalidAuthenticationToken(w, r)
 					return
 				}
 
-				if claims.Issuer != app.config.baseURL {
-					app.invalidAuthenticationToken(w, r)
+				exclusive := app.mtls != nil && app.mtls.RequiresCertificate(authenticated.merchantID)
+				if merchantID == "" && exclusive {
+					app.clientCertificateRequired(w, r)
 					return
 				}
 
-				if !claims.AcceptAudience(app.config.baseURL) {
-					app.invalidAuthenticationToken(w, r)
-					return
+				// NOTE: a token sent along a client certificate can only narrow its scopes
+				if merchantID != "" {
+					scopes = slices.DeleteFunc(
+						slices.Clone(authenticated.scopes),
+						func(scope string) bool { return !slices.Contains(scopes, scope) },
+					)
+				} else {
+					scopes = authenticated.scopes
 				}
 
-				if claims.Subject == "" {
-					app.invalidAuthenticationToken(w, r)
-					return
-				}
-
-				r = contextSetAuthenticatedMerchantID(r, claims.Subject)
+				merchantID = authenticated.merchantID
+				signingKeyID = authenticated.signingKeyID
+				actor = authenticated.actor
 			}
 		}
 
+		if merchantID != "" {
+			r = contextSetAuthenticatedMerchantID(r, merchantID)
+			r = contextSetScopes(r, scopes)
+			r = contextSetSigningKeyID(r, signingKeyID)
+			r = contextSetActor(r, actor)
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
@@ -104,3 +194,142 @@ func (app *application) requireAuthenticatedMerchant(next http.Handler) http.Han
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requireAdmin only lets through requests with the administrator credentials in the
+// Authorization header, the admin API is disabled when no password is configured
+func (app *application) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.config.admin.password == "" {
+			app.notFound(w, r)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			app.adminAuthenticationRequired(w, r)
+			return
+		}
+
+		// NOTE: hashing makes the comparisons take the same time whatever the input length
+		usernameHash := sha256.Sum256([]byte(username))
+		passwordHash := sha256.Sum256([]byte(password))
+		expectedUsernameHash := sha256.Sum256([]byte(app.config.admin.username))
+		expectedPasswordHash := sha256.Sum256([]byte(app.config.admin.password))
+
+		usernameMatch := subtle.ConstantTimeCompare(usernameHash[:], expectedUsernameHash[:]) == 1
+		passwordMatch := subtle.ConstantTimeCompare(passwordHash[:], expectedPasswordHash[:]) == 1
+
+		if !usernameMatch || !passwordMatch {
+			app.adminAuthenticationRequired(w, r)
+			return
+		}
+
+		r = contextSetActor(r, entities.Actor{Type: entities.ActorTypeAdmin, ID: username})
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireScope only lets through tokens granted the scope, it has to be used after
+// requireAuthenticatedMerchant
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(contextGetScopes(r), scope) {
+				app.missingScope(w, r, scope)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// verifyRequestSignature checks the signature of requests made with tokens of API keys that
+// require signed requests, the body is read and replaced so that handlers can still decode it
+func (app *application) verifyRequestSignature(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keyID := contextGetSigningKeyID(r)
+		if keyID == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodyBytes))
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		request := signing.Request{
+			Method:    r.Method,
+			Path:      r.URL.RequestURI(),
+			Timestamp: r.Header.Get(signing.HeaderTimestamp),
+			Nonce:     r.Header.Get(signing.HeaderNonce),
+			Body:      body,
+		}
+
+		err = app.service.VerifyRequestSignature(
+			keyID,
+			request,
+			r.Header.Get(signing.HeaderSignature),
+			app.config.signing.maxSkew,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, signing.ErrMissingSignature):
+				app.invalidRequestSignature(w, r, "The request signature is missing")
+			case errors.Is(err, signing.ErrInvalidTimestamp):
+				app.invalidRequestSignature(
+					w,
+					r,
+					"The request signature timestamp is outside the allowed window",
+				)
+			case errors.Is(err, service.ErrNonceReused):
+				app.invalidRequestSignature(w, r, "The request signature nonce was already used")
+			case errors.Is(err, signing.ErrInvalidSignature),
+				errors.Is(err, service.ErrInvalidCredentials):
+				app.invalidRequestSignature(w, r, "The request signature is invalid")
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit limits requests per merchant, or per client IP for unauthenticated requests. It has
+// to be used inside a route group so that the matched route pattern is known.
+func (app *application) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := r.Method + " " + chi.RouteContext(r.Context()).RoutePattern()
+
+		result := app.limiter.Allow(
+			contextGetAuthenticatedMerchantID(r),
+			realip.FromRequest(r),
+			route,
+		)
+
+		if !result.Unlimited {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(int(result.Reset.Seconds())))
+		}
+
+		if !result.Allowed {
+			app.rateLimitExceeded(w, r, result.RetryAfter)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
 )
 
 func (app *application) routes() http.Handler {
@@ -12,19 +14,112 @@ func (app *application) routes() http.Handler {
 	mux.NotFound(app.notFound)
 	mux.MethodNotAllowed(app.methodNotAllowed)
 
+	mux.Use(app.requestID)
 	mux.Use(app.logAccess)
 	mux.Use(app.recoverPanic)
 	mux.Use(app.authenticate)
 
-	mux.Get("/status", app.status)
-	mux.Get("/token", app.generateToken)
+	mux.Group(func(mux chi.Router) {
+		mux.Use(app.rateLimit)
+
+		mux.Get("/status", app.status)
+		mux.Get("/.well-known/jwks.json", app.jwks)
+		mux.Post("/token", app.createAuthenticationToken)
+	})
 
 	mux.Group(func(mux chi.Router) {
 		mux.Use(app.requireAuthenticatedMerchant)
+		mux.Use(app.rateLimit)
+		mux.Use(app.verifyRequestSignature)
+
+		mux.Post("/token/revoke", app.revokeAuthenticationToken)
+		mux.Post("/token/introspect", app.introspectAuthenticationToken)
+
+		read := app.requireScope(entities.ScopePaymentsRead)
+		write := app.requireScope(entities.ScopePaymentsWrite)
+
+		mux.With(write).Post("/payments", app.createPayment)
+		mux.With(read).Get("/payments/{paymentID}", app.getPayment)
+		mux.With(app.requireScope(entities.ScopeRefundsWrite)).
+			Patch("/payments/{paymentID}/refund", app.refundPayment)
+
+		mux.With(write).Post("/customers/{customerID}/payment-methods", app.createPaymentMethod)
+		mux.With(read).Get("/customers/{customerID}/payment-methods", app.listPaymentMethods)
+		mux.With(write).Delete(
+			"/customers/{customerID}/payment-methods/{paymentMethodID}",
+			app.deletePaymentMethod,
+		)
+
+		mux.With(app.requireScope(entities.ScopeAPIKeysWrite)).Post("/api-keys", app.createAPIKey)
+		mux.With(app.requireScope(entities.ScopeAPIKeysRead)).Get("/api-keys", app.listAPIKeys)
+		mux.With(app.requireScope(entities.ScopeAPIKeysWrite)).
+			Delete("/api-keys/{keyID}", app.revokeAPIKey)
+
+		mux.With(app.requireScope(entities.ScopeAuditRead)).
+			Get("/audit-events", app.listAuditEvents)
+
+		mux.With(app.requireScope(entities.ScopeBalanceRead)).Get("/balance", app.getBalance)
+		mux.With(app.requireScope(entities.ScopePayoutsRead)).Get("/payouts", app.listPayouts)
+		mux.With(app.requireScope(entities.ScopePayoutsRead)).
+			Get("/payouts/{payoutID}", app.getPayout)
+
+		mux.With(app.requireScope(entities.ScopeDisputesRead)).Get("/disputes", app.listDisputes)
+		mux.With(app.requireScope(entities.ScopeDisputesRead)).
+			Get("/disputes/{disputeID}", app.getDispute)
+		mux.With(app.requireScope(entities.ScopeDisputesWrite)).
+			Post("/disputes/{disputeID}/evidence", app.submitDisputeEvidence)
+		mux.With(app.requireScope(entities.ScopeDisputesRead)).
+			Get("/disputes/{disputeID}/evidence/{fileID}", app.getEvidenceFile)
+
+		mux.With(app.requireScope(entities.ScopeWebhooksWrite)).
+			Post("/webhook-endpoints", app.createWebhookEndpoint)
+		mux.With(app.requireScope(entities.ScopeWebhooksRead)).
+			Get("/webhook-endpoints", app.listWebhookEndpoints)
+		mux.With(app.requireScope(entities.ScopeWebhooksWrite)).
+			Delete("/webhook-endpoints/{endpointID}", app.deleteWebhookEndpoint)
+		mux.With(app.requireScope(entities.ScopeWebhooksRead)).
+			Get("/webhook-deliveries", app.listWebhookDeliveries)
+		mux.With(app.requireScope(entities.ScopeWebhooksRead)).
+			Get("/webhook-deliveries/{deliveryID}", app.getWebhookDelivery)
+		mux.With(app.requireScope(entities.ScopeWebhooksWrite)).
+			Post("/webhook-deliveries/{deliveryID}/replay", app.replayWebhookDelivery)
+
+		mux.With(app.requireScope(entities.ScopeSubscriptionsWrite)).Post("/plans", app.createPlan)
+		mux.With(app.requireScope(entities.ScopeSubscriptionsRead)).Get("/plans", app.listPlans)
+		mux.With(app.requireScope(entities.ScopeSubscriptionsRead)).
+			Get("/plans/{planID}", app.getPlan)
+		mux.With(app.requireScope(entities.ScopeSubscriptionsWrite)).
+			Post("/subscriptions", app.createSubscription)
+		mux.With(app.requireScope(entities.ScopeSubscriptionsRead)).
+			Get("/subscriptions", app.listSubscriptions)
+		mux.With(app.requireScope(entities.ScopeSubscriptionsRead)).
+			Get("/subscriptions/{subscriptionID}", app.getSubscription)
+		mux.With(app.requireScope(entities.ScopeSubscriptionsWrite)).
+			Post("/subscriptions/{subscriptionID}/cancel", app.cancelSubscription)
+	})
+
+	mux.Route("/admin", func(mux chi.Router) {
+		mux.Use(app.requireAdmin)
+
+		mux.Post("/merchants", app.createMerchant)
+		mux.Get("/merchants/{merchantID}", app.getMerchant)
+		mux.Put("/merchants/{merchantID}", app.updateMerchant)
+		mux.Post("/merchants/{merchantID}/deactivate", app.deactivateMerchant)
+		mux.Post("/merchants/{merchantID}/disputes", app.openDispute)
+		mux.Post("/merchants/{merchantID}/disputes/{disputeID}/resolve", app.resolveDispute)
+		mux.Get("/merchants/{merchantID}/webhook-deliveries", app.listWebhookDeliveries)
+		mux.Get(
+			"/merchants/{merchantID}/webhook-deliveries/{deliveryID}",
+			app.getWebhookDelivery,
+		)
+		mux.Post(
+			"/merchants/{merchantID}/webhook-deliveries/{deliveryID}/replay",
+			app.replayWebhookDelivery,
+		)
 
-		mux.Post("/payments", app.createPayment)
-		mux.Get("/payments/{paymentID}", app.getPayment)
-		mux.Patch("/payments/{paymentID}/refund", app.refundPayment)
+		mux.Post("/payouts/sepa-export", app.exportSEPAPayouts)
+		mux.Get("/payouts/sepa-exports/{messageID}", app.getSEPAExport)
+		mux.Post("/payouts/sepa-status-reports", app.applySEPAStatusReport)
 	})
 
 	return mux
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/domain/service"
+)
+
+// Payouts are either transferred through the bank client or exported by the treasury in SEPA
+// credit transfer files
+const (
+	payoutTransfersBank = "bank"
+	payoutTransfersSEPA = "sepa"
+)
+
+// subscriptionActor is recorded in the audit log for the subscription payments and updates of the
+// billing scheduler
+var subscriptionActor = entities.Actor{Type: entities.ActorTypeSystem, ID: "subscription-billing"}
+
+// payoutActor is recorded in the audit log for payouts created and updated by the scheduler
+var payoutActor = entities.Actor{Type: entities.ActorTypeSystem, ID: "payout-scheduler"}
+
+// schedulePayouts processes payouts every payout interval until ctx is done, a run that is still
+// processing when the server shuts down is waited for
+func (app *application) schedulePayouts(ctx context.Context) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.payouts.interval)
+		defer ticker.Stop()
+
+		app.logger.Info("scheduling payouts", "interval", app.config.payouts.interval)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := app.processPayouts()
+				if err != nil {
+					app.logger.Error("error processing payouts", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+func (app *application) processPayouts() (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%s", recovered)
+		}
+	}()
+
+	return app.service.ProcessPayouts(payoutActor, service.PayoutOptions{
+		SettlementDelay: app.config.payouts.settlementDelay,
+		Transfer:        app.config.payouts.transfers == payoutTransfersBank,
+	})
+}
+
+// scheduleWebhookDeliveries attempts due webhook deliveries every delivery interval until ctx is
+// done, deliveries that are being attempted when the server shuts down are waited for
+func (app *application) scheduleWebhookDeliveries(ctx context.Context) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.webhooks.interval)
+		defer ticker.Stop()
+
+		app.logger.Info("scheduling webhook deliveries", "interval", app.config.webhooks.interval)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := app.deliverWebhooks()
+				if err != nil {
+					app.logger.Error("error delivering webhooks", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+func (app *application) deliverWebhooks() (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%s", recovered)
+		}
+	}()
+
+	return app.service.DeliverWebhooks()
+}
+
+// scheduleSubscriptionBilling charges due subscriptions every billing interval until ctx is done,
+// a run that is still charging when the server shuts down is waited for
+func (app *application) scheduleSubscriptionBilling(ctx context.Context) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(app.config.subscriptions.interval)
+		defer ticker.Stop()
+
+		app.logger.Info(
+			"scheduling subscription billing",
+			"interval", app.config.subscriptions.interval,
+		)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := app.billSubscriptions()
+				if err != nil {
+					app.logger.Error("error billing subscriptions", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+func (app *application) billSubscriptions() (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("%s", recovered)
+		}
+	}()
+
+	return app.service.BillSubscriptions(subscriptionActor)
+}
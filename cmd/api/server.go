@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"log/slog"
@@ -31,11 +33,28 @@ func (app *application) serveHTTP() error {
 
 	shutdownErrorChan := make(chan error)
 
+	ctx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+
+	if app.config.payouts.enabled {
+		app.schedulePayouts(ctx)
+	}
+
+	if app.config.webhooks.enabled {
+		app.scheduleWebhookDeliveries(ctx)
+	}
+
+	if app.config.subscriptions.enabled {
+		app.scheduleSubscriptionBilling(ctx)
+	}
+
 	go func() {
 		quitChan := make(chan os.Signal, 1)
 		signal.Notify(quitChan, syscall.SIGINT, syscall.SIGTERM)
 		<-quitChan
 
+		stopScheduler()
+
 		ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownPeriod)
 		defer cancel()
 
@@ -44,7 +63,19 @@ func (app *application) serveHTTP() error {
 
 	app.logger.Info("starting server", slog.Group("server", "addr", srv.Addr))
 
-	err := srv.ListenAndServe()
+	var err error
+
+	if app.config.tls.certFile != "" {
+		srv.TLSConfig, err = app.tlsConfig()
+		if err != nil {
+			return err
+		}
+
+		err = srv.ListenAndServeTLS(app.config.tls.certFile, app.config.tls.keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+
 	if !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
@@ -59,3 +90,30 @@ func (app *application) serveHTTP() error {
 	app.wg.Wait()
 	return nil
 }
+
+// tlsConfig asks clients for a certificate when a CA bundle is configured, certificates that are
+// presented have to be signed by the bundle while requests without one fall back to bearer tokens
+func (app *application) tlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if app.config.tls.clientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	bundle, err := os.ReadFile(app.config.tls.clientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no certificates found in %s", app.config.tls.clientCAFile)
+	}
+
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+
+	return tlsConfig, nil
+}
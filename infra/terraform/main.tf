@@ -22,6 +22,24 @@ resource "aws_dynamodb_table" "this" {
     type = "S"
   }
 
+  attribute {
+    name = "DeliveryTime"
+    type = "S"
+  }
+
+  # webhook deliveries of a merchant by creation time, the latest first
+  global_secondary_index {
+    name            = "WebhookDeliveries"
+    hash_key        = "PK"
+    range_key       = "DeliveryTime"
+    projection_type = "ALL"
+  }
+
+  ttl {
+    attribute_name = "TTL"
+    enabled        = true
+  }
+
   server_side_encryption {
     enabled = true
   }
@@ -0,0 +1,40 @@
+package blobstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Store keeps binary objects under slash separated keys such as "merchantID/disputeID/fileID"
+type Store interface {
+	// Put stores the content of the reader under the key, replacing an existing blob, and
+	// returns the number of bytes written
+	Put(key string, content io.Reader) (int64, error)
+	// Get returns ErrNotFound for unknown keys, the reader has to be closed by the caller
+	Get(key string) (io.ReadCloser, error)
+	// Delete does not return an error for unknown keys
+	Delete(key string) error
+}
+
+// checkKey rejects keys that are not relative, clean paths so that blobs cannot be written
+// outside of the store
+func checkKey(key string) error {
+	if key == "" ||
+		path.Clean(key) != key ||
+		path.IsAbs(key) ||
+		key == ".." ||
+		strings.HasPrefix(key, "../") ||
+		strings.Contains(key, "\\") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package blobstore
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileSystem stores every blob in a file under the root directory, the key is the relative path
+// of the file
+type FileSystem struct {
+	root string
+}
+
+// NewFileSystem creates the root directory when it does not exist
+func NewFileSystem(root string) (*FileSystem, error) {
+	err := os.MkdirAll(root, 0o750)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileSystem{root: root}, nil
+}
+
+// Put NOTE: the content is written to a temporary file that is renamed once complete, so a
+// failed write does not leave a partial blob behind
+func (s *FileSystem) Put(key string, content io.Reader) (int64, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.MkdirAll(filepath.Dir(name), 0o750)
+	if err != nil {
+		return 0, err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+
+	size, err := io.Copy(file, content)
+	if err != nil {
+		file.Close()
+		return 0, err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	err = os.Rename(file.Name(), name)
+	if err != nil {
+		return 0, err
+	}
+
+	return size, nil
+}
+
+func (s *FileSystem) Get(key string) (io.ReadCloser, error) {
+	name, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	return file, nil
+}
+
+func (s *FileSystem) Delete(key string) error {
+	name, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(name)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileSystem) path(key string) (string, error) {
+	err := checkKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
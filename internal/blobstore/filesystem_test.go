@@ -0,0 +1,48 @@
+package blobstore
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSystem(t *testing.T) {
+	store, err := NewFileSystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should store and read blobs", func(t *testing.T) {
+		// tested function
+		size, err := store.Put("merchantID/disputeID/fileID", strings.NewReader("evidence"))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(8), size)
+
+		// tested function
+		blob, err := store.Get("merchantID/disputeID/fileID")
+		assert.NoError(t, err)
+
+		content, _ := io.ReadAll(blob)
+		blob.Close()
+		assert.Equal(t, "evidence", string(content))
+
+		// tested function
+		err = store.Delete("merchantID/disputeID/fileID")
+		assert.NoError(t, err)
+
+		_, err = store.Get("merchantID/disputeID/fileID")
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.NoError(t, store.Delete("merchantID/disputeID/fileID"))
+	})
+
+	t.Run("should reject keys outside of the root", func(t *testing.T) {
+		for _, key := range []string{"", "/etc/passwd", "../secret", "a/../../b", "a//b", "a\\b"} {
+			// tested function
+			_, err := store.Put(key, strings.NewReader("evidence"))
+
+			assert.ErrorIs(t, err, ErrInvalidKey, key)
+		}
+	})
+}
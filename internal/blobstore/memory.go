@@ -0,0 +1,57 @@
+package blobstore
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// Memory keeps blobs in memory, it is meant for tests
+type Memory struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func NewMemory() *Memory {
+	return &Memory{blobs: make(map[string][]byte)}
+}
+
+func (s *Memory) Put(key string, content io.Reader) (int64, error) {
+	err := checkKey(key)
+	if err != nil {
+		return 0, err
+	}
+
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blobs[key] = data
+
+	return int64(len(data)), nil
+}
+
+func (s *Memory) Get(key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *Memory) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.blobs, key)
+
+	return nil
+}
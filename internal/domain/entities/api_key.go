@@ -0,0 +1,66 @@
+package entities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+)
+
+const (
+	ScopePaymentsRead       = "payments:read"
+	ScopePaymentsWrite      = "payments:write"
+	ScopeRefundsWrite       = "refunds:write"
+	ScopeAPIKeysRead        = "api_keys:read"
+	ScopeAPIKeysWrite       = "api_keys:write"
+	ScopeAuditRead          = "audit:read"
+	ScopeBalanceRead        = "balance:read"
+	ScopePayoutsRead        = "payouts:read"
+	ScopeDisputesRead       = "disputes:read"
+	ScopeDisputesWrite      = "disputes:write"
+	ScopeWebhooksRead       = "webhooks:read"
+	ScopeWebhooksWrite      = "webhooks:write"
+	ScopeSubscriptionsRead  = "subscriptions:read"
+	ScopeSubscriptionsWrite = "subscriptions:write"
+)
+
+// Scopes lists every scope that can be granted to an API key
+var Scopes = []string{
+	ScopePaymentsRead,
+	ScopePaymentsWrite,
+	ScopeRefundsWrite,
+	ScopeAPIKeysRead,
+	ScopeAPIKeysWrite,
+	ScopeAuditRead,
+	ScopeBalanceRead,
+	ScopePayoutsRead,
+	ScopeDisputesRead,
+	ScopeDisputesWrite,
+	ScopeWebhooksRead,
+	ScopeWebhooksWrite,
+	ScopeSubscriptionsRead,
+	ScopeSubscriptionsWrite,
+}
+
+func IsScope(scope string) bool {
+	return slices.Contains(Scopes, scope)
+}
+
+// APIKey is a merchant credential exchanged for authentication tokens,
+// only the hash of the secret is ever stored. Keys with a SigningSecret
+// require every request made with their tokens to be signed.
+type APIKey struct {
+	ID               string
+	MerchantID       string
+	Name             string
+	SecretHash       string
+	Scopes           []string
+	SigningSecret    string
+	Timestamp        int64
+	Revoked          bool
+	RevokedTimestamp int64
+}
+
+func HashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
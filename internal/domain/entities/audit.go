@@ -0,0 +1,113 @@
+package entities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+const (
+	AuditActionPaymentCreate         = "payment.create"
+	AuditActionPaymentRefund         = "payment.refund"
+	AuditActionPaymentMethodCreate   = "payment_method.create"
+	AuditActionPaymentMethodDelete   = "payment_method.delete"
+	AuditActionAPIKeyCreate          = "api_key.create"
+	AuditActionAPIKeyRevoke          = "api_key.revoke"
+	AuditActionTokenRevoke           = "token.revoke"
+	AuditActionMerchantCreate        = "merchant.create"
+	AuditActionMerchantUpdate        = "merchant.update"
+	AuditActionMerchantDeactivate    = "merchant.deactivate"
+	AuditActionPayoutCreate          = "payout.create"
+	AuditActionPayoutUpdate          = "payout.update"
+	AuditActionDisputeCreate         = "dispute.create"
+	AuditActionDisputeRespond        = "dispute.respond"
+	AuditActionDisputeResolve        = "dispute.resolve"
+	AuditActionWebhookEndpointCreate = "webhook_endpoint.create"
+	AuditActionWebhookEndpointDelete = "webhook_endpoint.delete"
+	AuditActionWebhookDeliveryReplay = "webhook_delivery.replay"
+	AuditActionPlanCreate            = "plan.create"
+	AuditActionSubscriptionCreate    = "subscription.create"
+	AuditActionSubscriptionUpdate    = "subscription.update"
+	AuditActionSubscriptionCancel    = "subscription.cancel"
+)
+
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+const (
+	ActorTypeAPIKey      = "api_key"
+	ActorTypeOIDC        = "oidc"
+	ActorTypeCertificate = "certificate"
+	ActorTypeSystem      = "system"
+	ActorTypeAdmin       = "admin"
+)
+
+// Actor identifies who performed an action and the request it was performed in
+type Actor struct {
+	Type      string
+	ID        string
+	IPAddress string
+	RequestID string
+}
+
+// AuditEvent records a mutating action. Events of a merchant are numbered by Sequence and each
+// event hash covers the hash of the previous one, so that changing or removing an event breaks
+// the chain from that event on.
+type AuditEvent struct {
+	MerchantID   string
+	Sequence     int64
+	Action       string
+	Actor        Actor
+	ResourceID   string
+	Before       json.RawMessage
+	After        json.RawMessage
+	Outcome      string
+	Error        string
+	Timestamp    int64
+	PreviousHash string
+	Hash         string
+}
+
+// ComputeHash returns the hex encoded SHA-256 of the event content, excluding Hash itself
+func (e AuditEvent) ComputeHash() string {
+	e.Hash = ""
+
+	// NOTE: struct fields are always encoded in the same order so the encoding is stable
+	data, err := json.Marshal(e)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAuditChain checks the hash of every event and the link of every event to the previous
+// one. The events have to be the contiguous range of the chain following the event with the
+// sequence afterSequence, a missing event breaks the chain.
+func VerifyAuditChain(events []AuditEvent, afterSequence int64) bool {
+	for i, event := range events {
+		if event.Hash == "" || event.ComputeHash() != event.Hash {
+			return false
+		}
+
+		if i == 0 {
+			if event.Sequence != afterSequence+1 ||
+				(afterSequence == 0 && event.PreviousHash != "") {
+				return false
+			}
+
+			continue
+		}
+
+		previous := events[i-1]
+		if event.Sequence != previous.Sequence+1 || event.PreviousHash != previous.Hash {
+			return false
+		}
+	}
+
+	return true
+}
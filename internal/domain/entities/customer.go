@@ -11,3 +11,72 @@ type CardDetails struct {
 	SecurityCode   int
 	ExpirationDate string
 }
+
+func (c CardDetails) Last4() string {
+	if len(c.Number) < 4 {
+		return c.Number
+	}
+
+	return c.Number[len(c.Number)-4:]
+}
+
+const (
+	CardBrandVisa       = "visa"
+	CardBrandMastercard = "mastercard"
+	CardBrandAmex       = "amex"
+	CardBrandDiscover   = "discover"
+	CardBrandJCB        = "jcb"
+	CardBrandDiners     = "diners"
+	CardBrandUnionPay   = "unionpay"
+	CardBrandUnknown    = "unknown"
+)
+
+var CardBrands = []string{
+	CardBrandVisa,
+	CardBrandMastercard,
+	CardBrandAmex,
+	CardBrandDiscover,
+	CardBrandJCB,
+	CardBrandDiners,
+	CardBrandUnionPay,
+	CardBrandUnknown,
+}
+
+// Brand detects the card scheme from the issuer identification number at the start of the
+// card number
+func (c CardDetails) Brand() string {
+	prefix := func(digits int) int {
+		if len(c.Number) < digits {
+			return -1
+		}
+
+		value := 0
+		for _, r := range c.Number[:digits] {
+			if r < '0' || r > '9' {
+				return -1
+			}
+			value = value*10 + int(r-'0')
+		}
+
+		return value
+	}
+
+	switch p2, p3, p4 := prefix(2), prefix(3), prefix(4); {
+	case prefix(1) == 4:
+		return CardBrandVisa
+	case p2 >= 51 && p2 <= 55, p4 >= 2221 && p4 <= 2720:
+		return CardBrandMastercard
+	case p2 == 34, p2 == 37:
+		return CardBrandAmex
+	case p4 == 6011, p2 == 65, p3 >= 644 && p3 <= 649:
+		return CardBrandDiscover
+	case p4 >= 3528 && p4 <= 3589:
+		return CardBrandJCB
+	case p2 == 36, p2 == 38, p3 >= 300 && p3 <= 305:
+		return CardBrandDiners
+	case p2 == 62:
+		return CardBrandUnionPay
+	default:
+		return CardBrandUnknown
+	}
+}
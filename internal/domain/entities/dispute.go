@@ -0,0 +1,86 @@
+package entities
+
+// Dispute statuses, disputes are opened needing a response from the merchant, are under review
+// once evidence was submitted and end up won or lost
+const (
+	DisputeStatusNeedsResponse = "needs_response"
+	DisputeStatusUnderReview   = "under_review"
+	DisputeStatusWon           = "won"
+	DisputeStatusLost          = "lost"
+)
+
+var DisputeStatuses = []string{
+	DisputeStatusNeedsResponse,
+	DisputeStatusUnderReview,
+	DisputeStatusWon,
+	DisputeStatusLost,
+}
+
+// Reasons given by the card issuer for disputing a payment
+const (
+	DisputeReasonFraudulent          = "fraudulent"
+	DisputeReasonDuplicate           = "duplicate"
+	DisputeReasonProductNotReceived  = "product_not_received"
+	DisputeReasonProductUnacceptable = "product_unacceptable"
+	DisputeReasonCreditNotProcessed  = "credit_not_processed"
+	DisputeReasonSubscriptionEnded   = "subscription_canceled"
+	DisputeReasonGeneral             = "general"
+)
+
+var DisputeReasons = []string{
+	DisputeReasonFraudulent,
+	DisputeReasonDuplicate,
+	DisputeReasonProductNotReceived,
+	DisputeReasonProductUnacceptable,
+	DisputeReasonCreditNotProcessed,
+	DisputeReasonSubscriptionEnded,
+	DisputeReasonGeneral,
+}
+
+// Dispute is a payment disputed by the cardholder. The amount is in the currency of the payment
+// price and the merchant has to submit evidence before the deadline, in milliseconds.
+type Dispute struct {
+	ID               string
+	MerchantID       string
+	PaymentID        string
+	Reason           string
+	Amount           Money
+	Status           string
+	Deadline         int64
+	Evidence         *DisputeEvidence // nil until the merchant responds
+	Timestamp        int64
+	UpdatedTimestamp int64
+}
+
+// Closed reports whether the dispute was decided
+func (d Dispute) Closed() bool {
+	return d.Status == DisputeStatusWon || d.Status == DisputeStatusLost
+}
+
+type DisputeEvidence struct {
+	Text      string
+	Files     []EvidenceFile
+	Timestamp int64
+}
+
+// EvidenceFile is a file uploaded by the merchant, its content is kept in the blob store under
+// the key
+type EvidenceFile struct {
+	ID          string
+	Name        string
+	ContentType string
+	Size        int64
+	Key         string
+}
+
+const AdjustmentChargeback = "chargeback"
+
+// Adjustment changes the amount the merchant is paid for a payment after it was captured, the
+// amount is in the settlement currency and negative when funds are taken from the merchant
+type Adjustment struct {
+	ID        string
+	Type      string
+	DisputeID string
+	Amount    Money
+	Timestamp int64
+}
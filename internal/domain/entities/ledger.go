@@ -0,0 +1,182 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrUnbalancedEntry = errors.New("journal entry is not balanced")
+
+// Ledger accounts kept for every merchant. The merchant accounts hold what the platform owes the
+// merchant, funds of captured payments are pending until they are released to available.
+const (
+	AccountMerchantAvailable = "merchant_available"
+	AccountMerchantPending   = "merchant_pending"
+	AccountPlatformFees      = "platform_fees"
+	AccountBankClearing      = "bank_clearing"
+)
+
+const (
+	JournalEntryCharge        = "charge"
+	JournalEntryFee           = "fee"
+	JournalEntryRefund        = "refund"
+	JournalEntryFeeRefund     = "fee_refund"
+	JournalEntryRelease       = "release"
+	JournalEntryPayout        = "payout"
+	JournalEntryPayoutFailure = "payout_failure"
+	JournalEntryChargeback    = "chargeback"
+)
+
+// JournalEntry moves funds between the ledger accounts of a merchant. Postings are positive for
+// debits and negative for credits, so the postings of a balanced entry add up to zero in every
+// currency.
+type JournalEntry struct {
+	ID         string
+	MerchantID string
+	Type       string
+	PaymentID  string
+	PayoutID   string
+	Postings   []Posting
+	Timestamp  int64
+}
+
+type Posting struct {
+	Account string
+	Amount  Money
+}
+
+// AccountBalance is the sum of the postings to an account in one currency
+type AccountBalance struct {
+	Account string
+	Balance Money
+}
+
+// Balance is what the platform owes the merchant in every currency, amounts are positive when
+// the merchant is owed funds
+type Balance struct {
+	Available []Money
+	Pending   []Money
+}
+
+// NewJournalEntry moves amount from the credited to the debited account, the entry ID is derived
+// from the payment so that the same entry cannot be posted twice
+func NewJournalEntry(
+	payment Payment,
+	entryType, debit, credit string,
+	amount Money,
+	timestamp int64,
+) JournalEntry {
+	entry := newJournalEntry(payment.Merchant.ID, entryType, debit, credit, amount, timestamp)
+	entry.ID = entryType + "_" + payment.ID
+	entry.PaymentID = payment.ID
+
+	return entry
+}
+
+// ReleaseJournalEntryID is the ID of the entry releasing the pending funds of a payment, a
+// payment is released once
+func ReleaseJournalEntryID(paymentID string) string {
+	return JournalEntryRelease + "_" + paymentID
+}
+
+// NewReleaseJournalEntry makes the pending funds of a payment available to the merchant
+func NewReleaseJournalEntry(
+	merchantID, paymentID string,
+	amount Money,
+	timestamp int64,
+) JournalEntry {
+	entry := newJournalEntry(
+		merchantID,
+		JournalEntryRelease,
+		AccountMerchantPending,
+		AccountMerchantAvailable,
+		amount,
+		timestamp,
+	)
+	entry.ID = ReleaseJournalEntryID(paymentID)
+	entry.PaymentID = paymentID
+
+	return entry
+}
+
+// NewPayoutJournalEntry moves amount between the accounts for the payout, like payment entries
+// the entry ID is derived from the payout
+func NewPayoutJournalEntry(
+	payout Payout,
+	entryType, debit, credit string,
+	amount Money,
+	timestamp int64,
+) JournalEntry {
+	entry := newJournalEntry(payout.MerchantID, entryType, debit, credit, amount, timestamp)
+	entry.ID = entryType + "_" + payout.ID
+	entry.PayoutID = payout.ID
+
+	return entry
+}
+
+// NewDisputeJournalEntry moves amount between the accounts for the dispute of a payment, the
+// entry ID is derived from the dispute as a payment can be disputed more than once
+func NewDisputeJournalEntry(
+	dispute Dispute,
+	entryType, debit, credit string,
+	amount Money,
+	timestamp int64,
+) JournalEntry {
+	entry := newJournalEntry(dispute.MerchantID, entryType, debit, credit, amount, timestamp)
+	entry.ID = entryType + "_" + dispute.ID
+	entry.PaymentID = dispute.PaymentID
+
+	return entry
+}
+
+func newJournalEntry(
+	merchantID, entryType, debit, credit string,
+	amount Money,
+	timestamp int64,
+) JournalEntry {
+	return JournalEntry{
+		MerchantID: merchantID,
+		Type:       entryType,
+		Postings: []Posting{
+			{Account: debit, Amount: amount},
+			{Account: credit, Amount: Money{Amount: -amount.Amount, Currency: amount.Currency}},
+		},
+		Timestamp: timestamp,
+	}
+}
+
+func (e JournalEntry) Validate() error {
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("%w: %s has less than two postings", ErrUnbalancedEntry, e.ID)
+	}
+
+	totals := make(map[string]Money)
+
+	for _, posting := range e.Postings {
+		total, ok := totals[posting.Amount.Currency]
+		if !ok {
+			total = Money{Currency: posting.Amount.Currency}
+		}
+
+		total, err := total.Add(posting.Amount)
+		if err != nil {
+			return err
+		}
+
+		totals[posting.Amount.Currency] = total
+	}
+
+	for currency, total := range totals {
+		if !total.IsZero() {
+			return fmt.Errorf(
+				"%w: %s is off by %d %s",
+				ErrUnbalancedEntry,
+				e.ID,
+				total.Amount,
+				currency,
+			)
+		}
+	}
+
+	return nil
+}
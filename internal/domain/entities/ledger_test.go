@@ -0,0 +1,89 @@
+package entities
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalEntry(t *testing.T) {
+	payment := Payment{ID: "paymentID", Merchant: Merchant{ID: "merchantID"}}
+
+	t.Run("should create a balanced entry", func(t *testing.T) {
+		// tested function
+		entry := NewJournalEntry(
+			payment,
+			JournalEntryCharge,
+			AccountBankClearing,
+			AccountMerchantPending,
+			Money{Amount: 1000, Currency: "EUR"},
+			123,
+		)
+
+		assert.Equal(t, JournalEntry{
+			ID:         "charge_paymentID",
+			MerchantID: "merchantID",
+			Type:       JournalEntryCharge,
+			PaymentID:  "paymentID",
+			Postings: []Posting{
+				{Account: AccountBankClearing, Amount: Money{Amount: 1000, Currency: "EUR"}},
+				{Account: AccountMerchantPending, Amount: Money{Amount: -1000, Currency: "EUR"}},
+			},
+			Timestamp: 123,
+		}, entry)
+		assert.NoError(t, entry.Validate())
+	})
+
+	t.Run("should derive entries from their resource", func(t *testing.T) {
+		amount := Money{Amount: 970, Currency: "EUR"}
+
+		// tested function
+		release := NewReleaseJournalEntry("merchantID", "paymentID", amount, 123)
+		payout := NewPayoutJournalEntry(
+			Payout{ID: "payoutID", MerchantID: "merchantID"},
+			JournalEntryPayout,
+			AccountMerchantAvailable,
+			AccountBankClearing,
+			amount,
+			123,
+		)
+		chargeback := NewDisputeJournalEntry(
+			Dispute{ID: "disputeID", MerchantID: "merchantID", PaymentID: "paymentID"},
+			JournalEntryChargeback,
+			AccountMerchantAvailable,
+			AccountBankClearing,
+			amount,
+			123,
+		)
+
+		assert.Equal(t, "release_paymentID", release.ID)
+		assert.Equal(t, "paymentID", release.PaymentID)
+		assert.Equal(t, AccountMerchantPending, release.Postings[0].Account)
+		assert.NoError(t, release.Validate())
+
+		assert.Equal(t, "payout_payoutID", payout.ID)
+		assert.Equal(t, "payoutID", payout.PayoutID)
+		assert.Empty(t, payout.PaymentID)
+		assert.NoError(t, payout.Validate())
+
+		assert.Equal(t, "chargeback_disputeID", chargeback.ID)
+		assert.Equal(t, "paymentID", chargeback.PaymentID)
+		assert.NoError(t, chargeback.Validate())
+	})
+
+	t.Run("should reject unbalanced entries", func(t *testing.T) {
+		entry := JournalEntry{
+			ID: "entryID",
+			Postings: []Posting{
+				{Account: AccountBankClearing, Amount: Money{Amount: 1000, Currency: "EUR"}},
+				{Account: AccountMerchantPending, Amount: Money{Amount: -1000, Currency: "USD"}},
+			},
+		}
+
+		// tested function
+		err := entry.Validate()
+
+		assert.ErrorIs(t, err, ErrUnbalancedEntry)
+		assert.ErrorIs(t, JournalEntry{ID: "entryID"}.Validate(), ErrUnbalancedEntry)
+	})
+}
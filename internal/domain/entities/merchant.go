@@ -1,8 +1,25 @@
 package entities
 
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+var ErrInvalidAccountDetails = errors.New("invalid account details")
+
+// Merchant is an account accepting payments, deactivated merchants are kept so that their
+// payments can still be read and refunded but cannot accept new payments
 type Merchant struct {
-	ID             string
-	AccountDetails AccountDetails
+	ID                   string
+	AccountDetails       AccountDetails
+	Limits               Limits
+	PricingPlan          PricingPlan
+	Deactivated          bool
+	DeactivatedTimestamp int64
+	Timestamp            int64
+	UpdatedTimestamp     int64
 }
 
 type AccountDetails struct {
@@ -11,3 +28,50 @@ type AccountDetails struct {
 	BIC      string
 	Currency string
 }
+
+// Normalize returns the account details with the IBAN in electronic format and the BIC in
+// upper case
+func (d AccountDetails) Normalize() AccountDetails {
+	d.IBAN = validator.NormalizeIBAN(d.IBAN)
+	d.BIC = validator.NormalizeBIC(d.BIC)
+
+	return d
+}
+
+// Validate checks the IBAN and BIC of normalized account details and that they belong to the
+// same country
+func (d AccountDetails) Validate() error {
+	if !validator.IsIBAN(d.IBAN) {
+		return fmt.Errorf("%w: IBAN %q", ErrInvalidAccountDetails, d.IBAN)
+	}
+
+	if !validator.IsBIC(d.BIC) {
+		return fmt.Errorf("%w: BIC %q", ErrInvalidAccountDetails, d.BIC)
+	}
+
+	if !validator.IBANMatchesBIC(d.IBAN, d.BIC) {
+		return fmt.Errorf("%w: BIC %q is not in the IBAN country", ErrInvalidAccountDetails, d.BIC)
+	}
+
+	if !IsCurrency(d.Currency) {
+		return fmt.Errorf("%w: %w", ErrInvalidAccountDetails, ErrUnknownCurrency)
+	}
+
+	return nil
+}
+
+const (
+	LimitMaxPaymentAmount = "max_payment_amount"
+	LimitDailyVolume      = "daily_volume"
+	LimitMonthlyVolume    = "monthly_volume"
+	LimitMaxRefundsPerDay = "max_refunds_per_day"
+)
+
+// Limits caps the exposure for a merchant, missing or zero values mean no limit.
+// Amounts are in minor units and keyed by currency.
+type Limits struct {
+	MaxPaymentAmount map[string]int64
+	DailyVolume      map[string]int64
+	MonthlyVolume    map[string]int64
+	MaxRefundsPerDay int64
+}
@@ -1,6 +1,98 @@
 package entities
 
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrOverflow         = errors.New("amount overflow")
+)
+
 type Money struct {
 	Amount   int64 // storing as int to avoid floating point precision issues
 	Currency string
 }
+
+// ParseMoney converts a decimal amount in major units, e.g. "12.34", into minor units of the
+// currency. More fractional digits than the currency's exponent are rejected.
+func ParseMoney(amount, currencyCode string) (Money, error) {
+	currency, ok := LookupCurrency(currencyCode)
+	if !ok {
+		return Money{}, ErrUnknownCurrency
+	}
+
+	negative := strings.HasPrefix(amount, "-")
+	amount = strings.TrimPrefix(amount, "-")
+
+	whole, fraction, hasFraction := strings.Cut(amount, ".")
+	if whole == "" || (hasFraction && fraction == "") || len(fraction) > currency.Exponent {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+	}
+
+	fraction += strings.Repeat("0", currency.Exponent-len(fraction))
+
+	var minor int64
+	for _, digit := range whole + fraction {
+		if digit < '0' || digit > '9' {
+			return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, amount)
+		}
+
+		if minor > (math.MaxInt64-int64(digit-'0'))/10 {
+			return Money{}, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, amount)
+		}
+
+		minor = minor*10 + int64(digit-'0')
+	}
+
+	if negative {
+		minor = -minor
+	}
+
+	return Money{Amount: minor, Currency: currency.Code}, nil
+}
+
+// MajorUnits formats the amount as a decimal string in major units, e.g. 1234 EUR is "12.34".
+// Amounts in currencies missing from the registry are formatted with two decimal places.
+func (m Money) MajorUnits() string {
+	exponent := 2
+	if currency, ok := LookupCurrency(m.Currency); ok {
+		exponent = currency.Exponent
+	}
+
+	sign := ""
+	digits := fmt.Sprintf("%d", m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		digits = digits[1:]
+	}
+
+	if exponent == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+// Validate checks that the currency is known and the amount is positive and within range
+func (m Money) Validate() error {
+	currency, ok := LookupCurrency(m.Currency)
+	if !ok {
+		return ErrUnknownCurrency
+	}
+
+	if m.Amount <= 0 || m.Amount > currency.MaxAmount() {
+		return ErrInvalidAmount
+	}
+
+	return nil
+}
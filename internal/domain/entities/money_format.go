@@ -0,0 +1,85 @@
+package entities
+
+import "strings"
+
+type numberFormat struct {
+	decimalSeparator string
+	groupSeparator   string
+	symbolAfter      bool // places the symbol after the amount, separated by a space
+}
+
+// numberFormats is keyed by the language part of a BCP 47 locale tag
+var numberFormats = map[string]numberFormat{
+	"en": {decimalSeparator: ".", groupSeparator: ","},
+	"ja": {decimalSeparator: ".", groupSeparator: ","},
+	"zh": {decimalSeparator: ".", groupSeparator: ","},
+	"de": {decimalSeparator: ",", groupSeparator: ".", symbolAfter: true},
+	"es": {decimalSeparator: ",", groupSeparator: ".", symbolAfter: true},
+	"it": {decimalSeparator: ",", groupSeparator: ".", symbolAfter: true},
+	"nl": {decimalSeparator: ",", groupSeparator: "."},
+	"fr": {decimalSeparator: ",", groupSeparator: " ", symbolAfter: true},
+	"pl": {decimalSeparator: ",", groupSeparator: " ", symbolAfter: true},
+}
+
+var currencySymbols = map[string]string{
+	"CHF": "CHF",
+	"CNY": "CN¥",
+	"CZK": "Kč",
+	"EUR": "€",
+	"GBP": "£",
+	"INR": "₹",
+	"JPY": "¥",
+	"KRW": "₩",
+	"PLN": "zł",
+	"USD": "$",
+}
+
+// Format renders the amount for display in the given locale, e.g. "€12.34" for en-US
+// or "12,34 €" for de-DE. Unknown locales fall back to English formatting and currencies
+// without a symbol are shown with their ISO code.
+func (m Money) Format(locale string) string {
+	language, _, _ := strings.Cut(strings.ReplaceAll(locale, "_", "-"), "-")
+
+	format, ok := numberFormats[strings.ToLower(language)]
+	if !ok {
+		format = numberFormats["en"]
+	}
+
+	symbol, ok := currencySymbols[m.Currency]
+	if !ok {
+		symbol = m.Currency
+	}
+
+	major := m.MajorUnits()
+
+	sign := ""
+	if strings.HasPrefix(major, "-") {
+		sign = "-"
+		major = major[1:]
+	}
+
+	whole, fraction, hasFraction := strings.Cut(major, ".")
+
+	var grouped strings.Builder
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteString(format.groupSeparator)
+		}
+		grouped.WriteRune(digit)
+	}
+
+	number := grouped.String()
+	if hasFraction {
+		number += format.decimalSeparator + fraction
+	}
+
+	if format.symbolAfter {
+		return sign + number + " " + symbol
+	}
+
+	if symbol == m.Currency {
+		return sign + symbol + " " + number
+	}
+
+	return sign + symbol + number
+}
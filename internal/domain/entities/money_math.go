@@ -0,0 +1,234 @@
+package entities
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+)
+
+type RoundingMode int
+
+const (
+	RoundHalfUp   RoundingMode = iota // ties away from zero
+	RoundHalfEven                     // ties to the even neighbour, also known as banker's rounding
+	RoundDown                         // towards zero
+	RoundUp                           // away from zero
+)
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+func (m Money) Negate() (Money, error) {
+	if m.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+
+	return Money{Amount: -m.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, mismatch(m, o)
+	}
+
+	if (o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount) ||
+		(o.Amount < 0 && m.Amount < math.MinInt64-o.Amount) {
+		return Money{}, ErrOverflow
+	}
+
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+func (m Money) Subtract(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, mismatch(m, o)
+	}
+
+	negated, err := o.Negate()
+	if err != nil {
+		return Money{}, err
+	}
+
+	return m.Add(negated)
+}
+
+func (m Money) Multiply(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Amount: 0, Currency: m.Currency}, nil
+	}
+
+	result := m.Amount * n
+	if result/n != m.Amount || (m.Amount == -1 && n == math.MinInt64) ||
+		(n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrOverflow
+	}
+
+	return Money{Amount: result, Currency: m.Currency}, nil
+}
+
+// MultiplyRat multiplies the amount by an arbitrary rational factor, such as an exchange rate or
+// a percentage, rounding the result to minor units with the given mode
+func (m Money) MultiplyRat(factor *big.Rat, mode RoundingMode) (Money, error) {
+	product := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), factor)
+
+	amount := round(product, mode)
+	if !amount.IsInt64() {
+		return Money{}, ErrOverflow
+	}
+
+	return Money{Amount: amount.Int64(), Currency: m.Currency}, nil
+}
+
+// Convert exchanges the amount into another currency at rate units of the target currency per
+// unit of m's currency, minor units are rescaled when the currency exponents differ
+func (m Money) Convert(currencyCode string, rate *big.Rat, mode RoundingMode) (Money, error) {
+	from, ok := LookupCurrency(m.Currency)
+	if !ok {
+		return Money{}, ErrUnknownCurrency
+	}
+
+	to, ok := LookupCurrency(currencyCode)
+	if !ok {
+		return Money{}, ErrUnknownCurrency
+	}
+
+	factor := new(big.Rat).Set(rate)
+	for range to.Exponent {
+		factor.Mul(factor, big.NewRat(10, 1))
+	}
+	for range from.Exponent {
+		factor.Quo(factor, big.NewRat(10, 1))
+	}
+
+	converted, err := m.MultiplyRat(factor, mode)
+	if err != nil {
+		return Money{}, err
+	}
+
+	converted.Currency = to.Code
+
+	return converted, nil
+}
+
+// Compare returns -1, 0 or +1 when m is less than, equal to or greater than o
+func (m Money) Compare(o Money) (int, error) {
+	if m.Currency != o.Currency {
+		return 0, mismatch(m, o)
+	}
+
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// Split divides the amount into n parts that differ by at most one minor unit and add up to the
+// original amount
+func (m Money) Split(n int) ([]Money, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("cannot split into %d parts", n)
+	}
+
+	ratios := make([]int64, n)
+	for i := range ratios {
+		ratios[i] = 1
+	}
+
+	return m.Allocate(ratios...)
+}
+
+// Allocate divides the amount proportionally to the ratios without losing minor units, the
+// remainder is handed out one unit at a time starting with the first part
+func (m Money) Allocate(ratios ...int64) ([]Money, error) {
+	var total int64
+	for _, ratio := range ratios {
+		if ratio < 0 {
+			return nil, fmt.Errorf("ratios cannot be negative")
+		}
+
+		total += ratio
+		if total < 0 {
+			return nil, ErrOverflow
+		}
+	}
+
+	if total == 0 {
+		return nil, fmt.Errorf("ratios must add up to more than zero")
+	}
+
+	parts := make([]Money, len(ratios))
+	remainder := new(big.Int).SetInt64(m.Amount)
+	amount := big.NewInt(m.Amount)
+
+	for i, ratio := range ratios {
+		share := new(big.Int).Mul(amount, big.NewInt(ratio))
+		share.Quo(share, big.NewInt(total))
+
+		parts[i] = Money{Amount: share.Int64(), Currency: m.Currency}
+		remainder.Sub(remainder, share)
+	}
+
+	unit := int64(1)
+	if remainder.Sign() < 0 {
+		unit = -1
+	}
+
+	for i := 0; remainder.Sign() != 0; i++ {
+		if ratios[i%len(ratios)] == 0 {
+			continue
+		}
+
+		parts[i%len(ratios)].Amount += unit
+		remainder.Sub(remainder, big.NewInt(unit))
+	}
+
+	return parts, nil
+}
+
+func round(r *big.Rat, mode RoundingMode) *big.Int {
+	quotient, remainder := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if remainder.Sign() == 0 {
+		return quotient
+	}
+
+	// compares twice the remainder with the denominator to detect ties
+	twice := new(big.Int).Abs(remainder)
+	twice.Lsh(twice, 1)
+	half := twice.Cmp(r.Denom())
+
+	awayFromZero := false
+
+	switch mode {
+	case RoundHalfUp:
+		awayFromZero = half >= 0
+	case RoundHalfEven:
+		awayFromZero = half > 0 || (half == 0 && quotient.Bit(0) == 1)
+	case RoundUp:
+		awayFromZero = true
+	case RoundDown:
+		awayFromZero = false
+	}
+
+	if awayFromZero {
+		quotient.Add(quotient, big.NewInt(int64(r.Sign())))
+	}
+
+	return quotient
+}
+
+func mismatch(m, o Money) error {
+	return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+}
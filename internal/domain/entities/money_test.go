@@ -0,0 +1,290 @@
+package entities
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   string
+		currency string
+		want     Money
+		wantErr  error
+	}{
+		{"two decimal places", "12.34", "EUR", Money{Amount: 1234, Currency: "EUR"}, nil},
+		{"whole amount", "12", "EUR", Money{Amount: 1200, Currency: "EUR"}, nil},
+		{"single decimal place", "12.3", "EUR", Money{Amount: 1230, Currency: "EUR"}, nil},
+		{"negative amount", "-0.05", "USD", Money{Amount: -5, Currency: "USD"}, nil},
+		{"zero exponent", "1234", "JPY", Money{Amount: 1234, Currency: "JPY"}, nil},
+		{"three decimal places", "1.005", "BHD", Money{Amount: 1005, Currency: "BHD"}, nil},
+		{"too many decimal places", "12.345", "EUR", Money{}, ErrInvalidAmount},
+		{"fraction for zero exponent", "12.3", "JPY", Money{}, ErrInvalidAmount},
+		{"empty fraction", "12.", "EUR", Money{}, ErrInvalidAmount},
+		{"not a number", "12a", "EUR", Money{}, ErrInvalidAmount},
+		{"overflow", "99999999999999999999", "EUR", Money{}, ErrInvalidAmount},
+		{"unknown currency", "12.34", "XXX", Money{}, ErrUnknownCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// tested function
+			got, err := ParseMoney(tt.amount, tt.currency)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMajorUnits(t *testing.T) {
+	tests := []struct {
+		money Money
+		want  string
+	}{
+		{Money{Amount: 1234, Currency: "EUR"}, "12.34"},
+		{Money{Amount: 5, Currency: "EUR"}, "0.05"},
+		{Money{Amount: -5, Currency: "EUR"}, "-0.05"},
+		{Money{Amount: 1234, Currency: "JPY"}, "1234"},
+		{Money{Amount: 1005, Currency: "BHD"}, "1.005"},
+		{Money{Amount: 0, Currency: "USD"}, "0.00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			// tested function
+			got := tt.money.MajorUnits()
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Money{Amount: 100, Currency: "EUR"}.Validate())
+	assert.NoError(t, Money{Amount: 100_000_000_000, Currency: "EUR"}.Validate())
+	assert.ErrorIs(t, Money{Amount: 100_000_000_001, Currency: "EUR"}.Validate(), ErrInvalidAmount)
+	assert.ErrorIs(t, Money{Amount: 0, Currency: "EUR"}.Validate(), ErrInvalidAmount)
+	assert.ErrorIs(t, Money{Amount: -100, Currency: "EUR"}.Validate(), ErrInvalidAmount)
+	assert.ErrorIs(t, Money{Amount: 100, Currency: "eur"}.Validate(), ErrUnknownCurrency)
+}
+
+func TestAddSubtract(t *testing.T) {
+	a := Money{Amount: 1000, Currency: "EUR"}
+	b := Money{Amount: 250, Currency: "EUR"}
+
+	sum, err := a.Add(b)
+	assert.NoError(t, err)
+	assert.Equal(t, Money{Amount: 1250, Currency: "EUR"}, sum)
+
+	difference, err := b.Subtract(a)
+	assert.NoError(t, err)
+	assert.Equal(t, Money{Amount: -750, Currency: "EUR"}, difference)
+
+	_, err = a.Add(Money{Amount: 1, Currency: "USD"})
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	_, err = a.Subtract(Money{Amount: 1, Currency: "USD"})
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+
+	_, err = Money{Amount: math.MaxInt64, Currency: "EUR"}.Add(Money{Amount: 1, Currency: "EUR"})
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	_, err = Money{Amount: math.MinInt64, Currency: "EUR"}.Subtract(Money{Amount: 1, Currency: "EUR"})
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestMultiply(t *testing.T) {
+	got, err := Money{Amount: 1234, Currency: "EUR"}.Multiply(3)
+	assert.NoError(t, err)
+	assert.Equal(t, Money{Amount: 3702, Currency: "EUR"}, got)
+
+	_, err = Money{Amount: math.MaxInt64 / 2, Currency: "EUR"}.Multiply(3)
+	assert.ErrorIs(t, err, ErrOverflow)
+
+	_, err = Money{Amount: math.MinInt64, Currency: "EUR"}.Multiply(-1)
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestMultiplyRat(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		factor string
+		mode   RoundingMode
+		want   int64
+	}{
+		{"half up rounds tie away from zero", 25, "1/10", RoundHalfUp, 3},
+		{"half up rounds negative tie away from zero", -25, "1/10", RoundHalfUp, -3},
+		{"half even rounds tie to even below", 25, "1/10", RoundHalfEven, 2},
+		{"half even rounds tie to even above", 35, "1/10", RoundHalfEven, 4},
+		{"half even rounds negative tie to even", -25, "1/10", RoundHalfEven, -2},
+		{"half even rounds above tie up", 26, "1/10", RoundHalfEven, 3},
+		{"half up rounds below tie down", 24, "1/10", RoundHalfUp, 2},
+		{"down truncates", 29, "1/10", RoundDown, 2},
+		{"down truncates negative", -29, "1/10", RoundDown, -2},
+		{"up rounds away from zero", 21, "1/10", RoundUp, 3},
+		{"half even rounds rate tie to even", 1000, "1.0825", RoundHalfEven, 1082},
+		{"half up rounds rate tie up", 1000, "1.0825", RoundHalfUp, 1083},
+		{"exchange rate", 10000, "0.92345", RoundHalfEven, 9234},
+		{"percentage fee", 1999, "0.029", RoundHalfUp, 58},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			factor, ok := new(big.Rat).SetString(tt.factor)
+			assert.True(t, ok)
+
+			// tested function
+			got, err := Money{Amount: tt.amount, Currency: "EUR"}.MultiplyRat(factor, tt.mode)
+
+			assert.NoError(t, err)
+			assert.Equal(t, Money{Amount: tt.want, Currency: "EUR"}, got)
+		})
+	}
+
+	_, err := Money{Amount: math.MaxInt64, Currency: "EUR"}.MultiplyRat(big.NewRat(2, 1), RoundHalfUp)
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestCompare(t *testing.T) {
+	got, err := Money{Amount: 1, Currency: "EUR"}.Compare(Money{Amount: 2, Currency: "EUR"})
+	assert.NoError(t, err)
+	assert.Equal(t, -1, got)
+
+	got, err = Money{Amount: 2, Currency: "EUR"}.Compare(Money{Amount: 2, Currency: "EUR"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, got)
+
+	got, err = Money{Amount: 3, Currency: "EUR"}.Compare(Money{Amount: 2, Currency: "EUR"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, got)
+
+	_, err = Money{Amount: 1, Currency: "EUR"}.Compare(Money{Amount: 1, Currency: "USD"})
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name   string
+		amount int64
+		ratios []int64
+		want   []int64
+	}{
+		{"even split", 100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{"negative split", -100, []int64{1, 1, 1}, []int64{-34, -33, -33}},
+		{"weighted", 5, []int64{3, 7}, []int64{2, 3}},
+		{"zero ratio keeps nothing", 10, []int64{0, 1, 2}, []int64{0, 4, 6}},
+		{"single part", 99, []int64{5}, []int64{99}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// tested function
+			got, err := Money{Amount: tt.amount, Currency: "EUR"}.Allocate(tt.ratios...)
+			assert.NoError(t, err)
+
+			var amounts []int64
+			var total int64
+			for _, part := range got {
+				amounts = append(amounts, part.Amount)
+				total += part.Amount
+			}
+
+			assert.Equal(t, tt.want, amounts)
+			assert.Equal(t, tt.amount, total)
+		})
+	}
+
+	_, err := Money{Amount: 100, Currency: "EUR"}.Allocate(0, 0)
+	assert.Error(t, err)
+
+	parts, err := Money{Amount: 10, Currency: "JPY"}.Split(4)
+	assert.NoError(t, err)
+	assert.Equal(t, []Money{
+		{Amount: 3, Currency: "JPY"},
+		{Amount: 3, Currency: "JPY"},
+		{Amount: 2, Currency: "JPY"},
+		{Amount: 2, Currency: "JPY"},
+	}, parts)
+
+	_, err = Money{Amount: 10, Currency: "JPY"}.Split(0)
+	assert.Error(t, err)
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		money  Money
+		locale string
+		want   string
+	}{
+		{Money{Amount: 1234, Currency: "EUR"}, "en-US", "€12.34"},
+		{Money{Amount: 1234, Currency: "JPY"}, "en-US", "¥1,234"},
+		{Money{Amount: 123456789, Currency: "USD"}, "en", "$1,234,567.89"},
+		{Money{Amount: -1234, Currency: "GBP"}, "en-GB", "-£12.34"},
+		{Money{Amount: 123456, Currency: "EUR"}, "de-DE", "1.234,56 €"},
+		{Money{Amount: 123456, Currency: "PLN"}, "pl_PL", "1 234,56 zł"},
+		{Money{Amount: 1005, Currency: "BHD"}, "en", "BHD 1.005"},
+		{Money{Amount: 1234, Currency: "EUR"}, "xx", "€12.34"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			// tested function
+			got := tt.money.Format(tt.locale)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name     string
+		amount   Money
+		currency string
+		rate     string
+		want     Money
+	}{
+		{
+			"same exponent",
+			Money{Amount: 10000, Currency: "USD"}, "EUR", "0.92345",
+			Money{Amount: 9234, Currency: "EUR"},
+		},
+		{
+			"to lower exponent",
+			Money{Amount: 1050, Currency: "EUR"}, "JPY", "161.37",
+			Money{Amount: 1694, Currency: "JPY"},
+		},
+		{
+			"to higher exponent",
+			Money{Amount: 1694, Currency: "JPY"}, "EUR", "0.0062",
+			Money{Amount: 1050, Currency: "EUR"},
+		},
+		{
+			"to three decimals",
+			Money{Amount: 100, Currency: "EUR"}, "KWD", "0.33",
+			Money{Amount: 330, Currency: "KWD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, ok := new(big.Rat).SetString(tt.rate)
+			assert.True(t, ok)
+
+			// tested function
+			got, err := tt.amount.Convert(tt.currency, rate, RoundHalfEven)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := Money{Amount: 100, Currency: "EUR"}.Convert("XXX", big.NewRat(1, 1), RoundHalfEven)
+	assert.ErrorIs(t, err, ErrUnknownCurrency)
+}
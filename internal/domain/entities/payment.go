@@ -4,11 +4,32 @@ type Payment struct {
 	ID                string
 	Merchant          Merchant
 	Customer          Customer
+	PaymentMethodID   string
+	CardLast4         string
+	CardBrand         string
+	IPAddress         string
 	Price             Money
+	Settlement        Money   // Price in the currency of the merchant account
+	FX                *FXRate // nil when the merchant settles in the currency of the Price
+	Fees              Fees
+	Risk              RiskAssessment
 	BankTransactionID string
 	Timestamp         int64
 	Refunded          bool
 	RefundTimestamp   int64
+	Adjustments       []Adjustment
+	DisputedAmount    int64 // part of the Price disputed by the disputes that were not won
+	OpenDisputes      int64 // number of disputes of the payment that were not decided yet
+}
+
+// FXRate is the exchange rate locked when the payment was created. Rates are decimal strings in
+// settlement currency units per unit of the presentment currency.
+type FXRate struct {
+	Provider    string
+	MidRate     string // rate quoted by the provider
+	Markup      string // fraction of the mid rate kept by the platform, "0.01" is 1%
+	AppliedRate string // mid rate less the markup, the settlement amount is computed with it
+	Timestamp   int64  // time the provider quoted the mid rate, in milliseconds
 }
 
 // PaymentDetails without sensitive information
@@ -16,10 +37,17 @@ type PaymentDetails struct {
 	ID              string
 	MerchantID      string
 	CustomerID      string
+	CardLast4       string
+	CardBrand       string
 	Price           Money
+	Settlement      Money
+	FX              *FXRate
+	Fees            Fees
+	Risk            RiskAssessment
 	Timestamp       int64
 	Refunded        bool
 	RefundTimestamp int64
+	Adjustments     []Adjustment
 }
 
 func NewPaymentDetailsFromPayment(payment Payment) PaymentDetails {
@@ -27,9 +55,16 @@ func NewPaymentDetailsFromPayment(payment Payment) PaymentDetails {
 		ID:              payment.ID,
 		MerchantID:      payment.Merchant.ID,
 		CustomerID:      payment.Customer.ID,
+		CardLast4:       payment.CardLast4,
+		CardBrand:       payment.CardBrand,
 		Price:           payment.Price,
+		Settlement:      payment.Settlement,
+		FX:              payment.FX,
+		Fees:            payment.Fees,
+		Risk:            payment.Risk,
 		Timestamp:       payment.Timestamp,
 		Refunded:        payment.Refunded,
 		RefundTimestamp: payment.RefundTimestamp,
+		Adjustments:     payment.Adjustments,
 	}
 }
@@ -0,0 +1,35 @@
+package entities
+
+// PaymentMethod is a card stored on file for a merchant's customer, the card number is kept by
+// the bank and only the token to charge the card with is stored
+type PaymentMethod struct {
+	ID             string
+	MerchantID     string
+	CustomerID     string
+	CardToken      string
+	CardName       string
+	CardLast4      string
+	CardExpiryDate string
+	Timestamp      int64
+}
+
+// PaymentMethodDetails without sensitive information
+type PaymentMethodDetails struct {
+	ID             string
+	CustomerID     string
+	CardName       string
+	CardLast4      string
+	CardExpiryDate string
+	Timestamp      int64
+}
+
+func NewPaymentMethodDetailsFromPaymentMethod(method PaymentMethod) PaymentMethodDetails {
+	return PaymentMethodDetails{
+		ID:             method.ID,
+		CustomerID:     method.CustomerID,
+		CardName:       method.CardName,
+		CardLast4:      method.CardLast4,
+		CardExpiryDate: method.CardExpiryDate,
+		Timestamp:      method.Timestamp,
+	}
+}
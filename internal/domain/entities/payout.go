@@ -0,0 +1,36 @@
+package entities
+
+// Payout statuses, payouts are created pending, sent to the bank in transit and end up paid or
+// failed, in which case the amount is returned to the available balance of the merchant
+const (
+	PayoutStatusPending   = "pending"
+	PayoutStatusInTransit = "in_transit"
+	PayoutStatusPaid      = "paid"
+	PayoutStatusFailed    = "failed"
+)
+
+var PayoutStatuses = []string{
+	PayoutStatusPending,
+	PayoutStatusInTransit,
+	PayoutStatusPaid,
+	PayoutStatusFailed,
+}
+
+// Payout transfers the available balance of a merchant in one currency to the merchant account
+// the balance was batched for
+type Payout struct {
+	ID               string
+	MerchantID       string
+	Amount           Money
+	Status           string
+	Destination      AccountDetails
+	BankTransferID   string
+	FailureReason    string
+	Timestamp        int64
+	UpdatedTimestamp int64
+}
+
+// Settled reports whether the payout reached a final status
+func (p Payout) Settled() bool {
+	return p.Status == PayoutStatusPaid || p.Status == PayoutStatusFailed
+}
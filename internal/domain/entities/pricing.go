@@ -0,0 +1,158 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+)
+
+var ErrInvalidPricingPlan = errors.New("invalid pricing plan")
+
+const (
+	RefundFeeRetain      = "retain"       // the platform keeps the whole fee
+	RefundFeeReturn      = "return"       // the whole fee is returned to the merchant
+	RefundFeeRetainFixed = "retain_fixed" // the platform keeps the fixed part of the fee only
+)
+
+var RefundFeePolicies = []string{RefundFeeRetain, RefundFeeReturn, RefundFeeRetainFixed}
+
+// PricingPlan sets the fees charged to a merchant per payment. The first rule matching the
+// currency the customer paid in and the card brand applies, a plan without a matching rule
+// charges no fees.
+type PricingPlan struct {
+	Rules        []FeeRule
+	RefundPolicy string // one of RefundFeePolicies, RefundFeeRetain when empty
+}
+
+// FeeRule charges Percentage of the settlement amount plus Fixed, and at least Minimum.
+// Fixed and Minimum are in minor units of the merchant settlement currency.
+type FeeRule struct {
+	Currency   string // currency the customer paid in, empty matches any
+	CardBrand  string // one of CardBrands, empty matches any
+	Percentage string // decimal fraction, "0.029" is 2.9%
+	Fixed      int64
+	Minimum    int64
+}
+
+// Fees are the amounts of a payment in the merchant settlement currency, fixed when the payment
+// is captured together with the refund policy of the plan
+type Fees struct {
+	Gross        Money
+	Fee          Money
+	Net          Money // Gross less Fee
+	FixedFee     Money // part of Fee that does not depend on the amount
+	RefundPolicy string
+	RefundedFee  Money // part of Fee returned to the merchant when the payment is refunded
+}
+
+func (p PricingPlan) Validate() error {
+	if p.RefundPolicy != "" && !slices.Contains(RefundFeePolicies, p.RefundPolicy) {
+		return fmt.Errorf("%w: refund policy %q", ErrInvalidPricingPlan, p.RefundPolicy)
+	}
+
+	for _, rule := range p.Rules {
+		if rule.Currency != "" && !IsCurrency(rule.Currency) {
+			return fmt.Errorf("%w: currency %q", ErrInvalidPricingPlan, rule.Currency)
+		}
+
+		if rule.CardBrand != "" && !slices.Contains(CardBrands, rule.CardBrand) {
+			return fmt.Errorf("%w: card brand %q", ErrInvalidPricingPlan, rule.CardBrand)
+		}
+
+		_, err := rule.percentage()
+		if err != nil {
+			return err
+		}
+
+		if rule.Fixed < 0 || rule.Minimum < 0 {
+			return fmt.Errorf("%w: fees cannot be negative", ErrInvalidPricingPlan)
+		}
+	}
+
+	return nil
+}
+
+// Calculate computes the fees of a payment settled for gross, which the customer paid in
+// currency with a card of the brand. The fee never exceeds the gross amount.
+func (p PricingPlan) Calculate(gross Money, currency, brand string) (Fees, error) {
+	policy := p.RefundPolicy
+	if policy == "" {
+		policy = RefundFeeRetain
+	}
+
+	fees := Fees{
+		Gross:        gross,
+		Fee:          Money{Currency: gross.Currency},
+		Net:          gross,
+		FixedFee:     Money{Currency: gross.Currency},
+		RefundPolicy: policy,
+		RefundedFee:  Money{Currency: gross.Currency},
+	}
+
+	index := slices.IndexFunc(p.Rules, func(rule FeeRule) bool {
+		return (rule.Currency == "" || rule.Currency == currency) &&
+			(rule.CardBrand == "" || rule.CardBrand == brand)
+	})
+	if index < 0 {
+		return fees, nil
+	}
+
+	rule := p.Rules[index]
+
+	percentage, err := rule.percentage()
+	if err != nil {
+		return Fees{}, err
+	}
+
+	fee, err := gross.MultiplyRat(percentage, RoundHalfUp)
+	if err != nil {
+		return Fees{}, err
+	}
+
+	fee, err = fee.Add(Money{Amount: rule.Fixed, Currency: gross.Currency})
+	if err != nil {
+		return Fees{}, err
+	}
+
+	fee.Amount = min(max(fee.Amount, rule.Minimum), gross.Amount)
+
+	net, err := gross.Subtract(fee)
+	if err != nil {
+		return Fees{}, err
+	}
+
+	fees.Fee = fee
+	fees.Net = net
+	fees.FixedFee = Money{Amount: min(rule.Fixed, fee.Amount), Currency: gross.Currency}
+
+	return fees, nil
+}
+
+// Refund returns the fees with the part of the fee returned to the merchant set according to
+// the refund policy
+func (f Fees) Refund() Fees {
+	switch f.RefundPolicy {
+	case RefundFeeReturn:
+		f.RefundedFee = f.Fee
+	case RefundFeeRetainFixed:
+		f.RefundedFee = Money{Amount: f.Fee.Amount - f.FixedFee.Amount, Currency: f.Fee.Currency}
+	default:
+		f.RefundedFee = Money{Amount: 0, Currency: f.Fee.Currency}
+	}
+
+	return f
+}
+
+func (r FeeRule) percentage() (*big.Rat, error) {
+	if r.Percentage == "" {
+		return new(big.Rat), nil
+	}
+
+	percentage, ok := new(big.Rat).SetString(r.Percentage)
+	if !ok || percentage.Sign() < 0 || percentage.Cmp(big.NewRat(1, 1)) > 0 {
+		return nil, fmt.Errorf("%w: percentage %q", ErrInvalidPricingPlan, r.Percentage)
+	}
+
+	return percentage, nil
+}
@@ -0,0 +1,123 @@
+package entities
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalculateFees(t *testing.T) {
+	plan := PricingPlan{
+		Rules: []FeeRule{
+			{Currency: "USD", CardBrand: CardBrandAmex, Percentage: "0.035", Fixed: 30},
+			{Currency: "USD", Percentage: "0.029", Fixed: 30},
+			{Percentage: "0.014", Fixed: 25, Minimum: 50},
+		},
+		RefundPolicy: RefundFeeRetainFixed,
+	}
+
+	tests := []struct {
+		name     string
+		gross    int64
+		currency string
+		brand    string
+		fee      int64
+		fixedFee int64
+	}{
+		{"currency and brand rule", 10000, "USD", CardBrandAmex, 380, 30},
+		{"currency rule", 10000, "USD", CardBrandVisa, 320, 30},
+		{"default rule", 10000, "EUR", CardBrandVisa, 165, 25},
+		{"minimum fee", 1000, "EUR", CardBrandVisa, 50, 25},
+		{"fee capped at the gross amount", 40, "EUR", CardBrandVisa, 40, 25},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gross := Money{Amount: tt.gross, Currency: "EUR"}
+
+			// tested function
+			got, err := plan.Calculate(gross, tt.currency, tt.brand)
+
+			assert.NoError(t, err)
+			assert.Equal(t, Fees{
+				Gross:        Money{Amount: tt.gross, Currency: "EUR"},
+				Fee:          Money{Amount: tt.fee, Currency: "EUR"},
+				Net:          Money{Amount: tt.gross - tt.fee, Currency: "EUR"},
+				FixedFee:     Money{Amount: tt.fixedFee, Currency: "EUR"},
+				RefundPolicy: RefundFeeRetainFixed,
+				RefundedFee:  Money{Amount: 0, Currency: "EUR"},
+			}, got)
+		})
+	}
+
+	t.Run("should charge no fees without a matching rule", func(t *testing.T) {
+		// tested function
+		got, err := PricingPlan{}.Calculate(Money{Amount: 100, Currency: "EUR"}, "EUR", "visa")
+
+		assert.NoError(t, err)
+		assert.Equal(t, Money{Amount: 0, Currency: "EUR"}, got.Fee)
+		assert.Equal(t, Money{Amount: 100, Currency: "EUR"}, got.Net)
+		assert.Equal(t, RefundFeeRetain, got.RefundPolicy)
+	})
+}
+
+func TestRefundFees(t *testing.T) {
+	fees := Fees{
+		Fee:      Money{Amount: 320, Currency: "EUR"},
+		FixedFee: Money{Amount: 30, Currency: "EUR"},
+	}
+
+	tests := []struct {
+		policy string
+		want   int64
+	}{
+		{RefundFeeRetain, 0},
+		{RefundFeeReturn, 320},
+		{RefundFeeRetainFixed, 290},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			fees.RefundPolicy = tt.policy
+
+			// tested function
+			got := fees.Refund()
+
+			assert.Equal(t, Money{Amount: tt.want, Currency: "EUR"}, got.RefundedFee)
+		})
+	}
+}
+
+func TestValidatePricingPlan(t *testing.T) {
+	assert.NoError(t, PricingPlan{Rules: []FeeRule{{Percentage: "0.029", Fixed: 30}}}.Validate())
+
+	invalid := []PricingPlan{
+		{RefundPolicy: "unknown"},
+		{Rules: []FeeRule{{Currency: "XXX"}}},
+		{Rules: []FeeRule{{CardBrand: "unknown brand"}}},
+		{Rules: []FeeRule{{Percentage: "1.5"}}},
+		{Rules: []FeeRule{{Fixed: -1}}},
+	}
+
+	for _, plan := range invalid {
+		assert.ErrorIs(t, plan.Validate(), ErrInvalidPricingPlan)
+	}
+}
+
+func TestCardBrand(t *testing.T) {
+	tests := map[string]string{
+		"4111111111111111": CardBrandVisa,
+		"5555555555554444": CardBrandMastercard,
+		"2223003122003222": CardBrandMastercard,
+		"378282246310005":  CardBrandAmex,
+		"6011111111111117": CardBrandDiscover,
+		"3530111333300000": CardBrandJCB,
+		"30569309025904":   CardBrandDiners,
+		"6200000000000005": CardBrandUnionPay,
+		"1234123412341234": CardBrandUnknown,
+	}
+
+	for number, want := range tests {
+		assert.Equal(t, want, CardDetails{Number: number}.Brand(), number)
+	}
+}
@@ -0,0 +1,14 @@
+package entities
+
+const (
+	RiskDecisionAllow  = "Allow"
+	RiskDecisionReview = "Review"
+	RiskDecisionBlock  = "Block"
+)
+
+// RiskAssessment is the outcome of scoring a payment before it is charged
+type RiskAssessment struct {
+	Score    int
+	Decision string
+	Rules    []string // names of the rules that contributed to the score
+}
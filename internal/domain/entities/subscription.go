@@ -0,0 +1,103 @@
+package entities
+
+import "time"
+
+// Billing intervals of subscription plans
+const (
+	PlanIntervalDay   = "day"
+	PlanIntervalWeek  = "week"
+	PlanIntervalMonth = "month"
+	PlanIntervalYear  = "year"
+)
+
+var PlanIntervals = []string{
+	PlanIntervalDay,
+	PlanIntervalWeek,
+	PlanIntervalMonth,
+	PlanIntervalYear,
+}
+
+// Subscription statuses, subscriptions are active while their periods are paid, past due after
+// a failed charge and cancelled by the merchant or once the charge retries are exhausted
+const (
+	SubscriptionStatusActive    = "active"
+	SubscriptionStatusPastDue   = "past_due"
+	SubscriptionStatusCancelled = "cancelled"
+)
+
+var SubscriptionStatuses = []string{
+	SubscriptionStatusActive,
+	SubscriptionStatusPastDue,
+	SubscriptionStatusCancelled,
+}
+
+// Plan is what the customers of a merchant subscribe to, the price is charged at the start of
+// every interval after the trial days
+type Plan struct {
+	ID         string
+	MerchantID string
+	Name       string
+	Price      Money
+	Interval   string
+	TrialDays  int
+	Timestamp  int64
+}
+
+// PeriodStart returns the start of the period of the plan the number of intervals after the
+// anchor, the day of the anchor is kept so that monthly periods anchored on the 31st start on the
+// last day of shorter months instead of drifting into the next one
+func (p Plan) PeriodStart(anchor time.Time, period int) time.Time {
+	switch p.Interval {
+	case PlanIntervalDay:
+		return anchor.AddDate(0, 0, period)
+	case PlanIntervalWeek:
+		return anchor.AddDate(0, 0, 7*period)
+	case PlanIntervalYear:
+		return addMonths(anchor, 12*period)
+	default:
+		return addMonths(anchor, period)
+	}
+}
+
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	hour, minute, second := t.Clock()
+
+	// NOTE: day 0 of the month after is the last day of the month
+	last := time.Date(year, month+time.Month(months)+1, 0, 0, 0, 0, 0, t.Location()).Day()
+
+	return time.Date(
+		year,
+		month+time.Month(months),
+		min(day, last),
+		hour,
+		minute,
+		second,
+		t.Nanosecond(),
+		t.Location(),
+	)
+}
+
+// Subscription charges the stored payment method of the customer for the plan in advance of
+// every period. Timestamps are in milliseconds, the billing anchor is the start of the first
+// period after the trial and the current period ends when the next period is charged.
+type Subscription struct {
+	ID                 string
+	MerchantID         string
+	PlanID             string
+	CustomerID         string
+	PaymentMethodID    string
+	Status             string
+	TrialEnd           int64
+	BillingAnchor      int64
+	PeriodsBilled      int
+	CurrentPeriodStart int64
+	CurrentPeriodEnd   int64
+	NextAttempt        int64
+	FailedAttempts     int
+	LastPaymentID      string
+	LastError          string
+	CancelledTimestamp int64
+	Timestamp          int64
+	UpdatedTimestamp   int64
+}
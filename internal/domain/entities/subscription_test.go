@@ -0,0 +1,41 @@
+package entities
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanPeriodStart(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 12, 0, 0, 0, time.UTC)
+	}
+
+	anchor := date(2024, time.January, 31)
+
+	tests := []struct {
+		name     string
+		interval string
+		period   int
+		want     time.Time
+	}{
+		{"anchor", PlanIntervalMonth, 0, anchor},
+		{"day", PlanIntervalDay, 2, date(2024, time.February, 2)},
+		{"week", PlanIntervalWeek, 1, date(2024, time.February, 7)},
+		{"short month", PlanIntervalMonth, 1, date(2024, time.February, 29)},
+		{"long month", PlanIntervalMonth, 2, date(2024, time.March, 31)},
+		{"year", PlanIntervalYear, 1, date(2025, time.January, 31)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := Plan{Interval: tt.interval}
+
+			// tested function
+			got := plan.PeriodStart(anchor, tt.period)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
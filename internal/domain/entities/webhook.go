@@ -0,0 +1,89 @@
+package entities
+
+import "slices"
+
+// Webhook event types merchants can subscribe their endpoints to
+const (
+	WebhookEventPaymentCreated     = "payment.created"
+	WebhookEventPaymentRefunded    = "payment.refunded"
+	WebhookEventPaymentChargedBack = "payment.charged_back"
+)
+
+var WebhookEventTypes = []string{
+	WebhookEventPaymentCreated,
+	WebhookEventPaymentRefunded,
+	WebhookEventPaymentChargedBack,
+}
+
+// Webhook delivery statuses, deliveries are pending until the endpoint accepts the event or the
+// retries are exhausted
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+var WebhookDeliveryStatuses = []string{
+	WebhookDeliveryPending,
+	WebhookDeliverySucceeded,
+	WebhookDeliveryFailed,
+}
+
+// WebhookEndpoint receives the events of the subscribed types, deliveries are signed with the
+// secret shared with the merchant when the endpoint was registered
+type WebhookEndpoint struct {
+	ID         string
+	MerchantID string
+	URL        string
+	EventTypes []string
+	Secret     string
+	Timestamp  int64
+}
+
+// Subscribed reports whether the endpoint receives events of the type
+func (e WebhookEndpoint) Subscribed(eventType string) bool {
+	return slices.Contains(e.EventTypes, eventType)
+}
+
+// WebhookDelivery is an event queued for delivery to an endpoint, the payload is the JSON body
+// sent on every attempt and timestamps are in milliseconds. Replayed deliveries reference the
+// delivery they were replayed from.
+type WebhookDelivery struct {
+	ID               string
+	MerchantID       string
+	EndpointID       string
+	EventID          string
+	EventType        string
+	Payload          []byte
+	Status           string
+	Attempts         int
+	NextAttempt      int64
+	LastError        string
+	ReplayOf         string
+	Timestamp        int64
+	UpdatedTimestamp int64
+}
+
+// WebhookAttempt records a single attempt of a delivery, the response status is 0 when no
+// response was received and the latency is in milliseconds
+type WebhookAttempt struct {
+	DeliveryID     string
+	MerchantID     string
+	Number         int
+	URL            string
+	RequestBody    []byte
+	ResponseStatus int
+	Latency        int64
+	Error          string
+	Timestamp      int64
+}
+
+// WebhookEvent is the body of a webhook delivery, the data is the state of the resource the
+// event is about at the time of the event
+type WebhookEvent struct {
+	ID         string
+	Type       string
+	MerchantID string
+	Timestamp  int64
+	Data       any
+}
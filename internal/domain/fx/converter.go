@@ -0,0 +1,92 @@
+package fx
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+)
+
+// rateDecimals is the precision of the applied rate, settlement amounts are computed with the
+// rounded rate so that they can be reproduced from the stored one
+const rateDecimals = 8
+
+type Converter interface {
+	Convert(amount entities.Money, currency string) (entities.Money, *entities.FXRate, error)
+}
+
+// MarkupConverter converts amounts at the provider rate less a markup kept by the platform
+type MarkupConverter struct {
+	provider Provider
+	markup   *big.Rat
+}
+
+func NewMarkupConverter(provider Provider, markup *big.Rat) *MarkupConverter {
+	return &MarkupConverter{
+		provider: provider,
+		markup:   markup,
+	}
+}
+
+// ParseMarkup reads a markup given as a decimal fraction, e.g. "0.015" for 1.5%
+func ParseMarkup(value string) (*big.Rat, error) {
+	markup, ok := new(big.Rat).SetString(value)
+	if !ok || markup.Sign() < 0 || markup.Cmp(big.NewRat(1, 1)) >= 0 {
+		return nil, fmt.Errorf("invalid markup %q, must be a fraction between 0 and 1", value)
+	}
+
+	return markup, nil
+}
+
+// Convert locks the current rate and returns the amount in the currency together with the
+// rate that was applied, amounts already in the currency are returned unchanged without a rate
+func (c *MarkupConverter) Convert(
+	amount entities.Money,
+	currency string,
+) (entities.Money, *entities.FXRate, error) {
+	if amount.Currency == currency {
+		return amount, nil, nil
+	}
+
+	rate, err := c.provider.Rate(amount.Currency, currency)
+	if err != nil {
+		return entities.Money{}, nil, err
+	}
+
+	applied := new(big.Rat).Sub(big.NewRat(1, 1), c.markup)
+	applied.Mul(applied, rate.Rate)
+	applied = truncate(applied, rateDecimals)
+
+	converted, err := amount.Convert(currency, applied, entities.RoundHalfEven)
+	if err != nil {
+		return entities.Money{}, nil, err
+	}
+
+	return converted, &entities.FXRate{
+		Provider:    rate.Provider,
+		MidRate:     decimal(rate.Rate),
+		Markup:      decimal(c.markup),
+		AppliedRate: decimal(applied),
+		Timestamp:   rate.Timestamp.UnixNano() / int64(time.Millisecond),
+	}, nil
+}
+
+// truncate rounds the positive rate down to the given number of decimals
+func truncate(rate *big.Rat, decimals int) *big.Rat {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+
+	scaled := new(big.Int).Mul(rate.Num(), scale)
+	scaled.Quo(scaled, rate.Denom())
+
+	return new(big.Rat).SetFrac(scaled, scale)
+}
+
+// decimal formats the rate with up to rateDecimals decimals and no trailing zeros
+func decimal(rate *big.Rat) string {
+	value := rate.FloatString(rateDecimals)
+	value = strings.TrimRight(value, "0")
+
+	return strings.TrimSuffix(value, ".")
+}
@@ -0,0 +1,227 @@
+package fx
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+)
+
+func TestStaticProvider(t *testing.T) {
+	provider, err := NewStaticProvider(Rates{
+		Base:      "EUR",
+		Timestamp: time.Unix(1000, 0),
+		Rates:     map[string]string{"USD": "1.25", "PLN": "4.5"},
+	})
+	assert.NoError(t, err)
+
+	t.Run("should quote against the base currency", func(t *testing.T) {
+		// tested function
+		got, err := provider.Rate("USD", "EUR")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "4/5", got.Rate.String())
+		assert.Equal(t, "static", got.Provider)
+		assert.Equal(t, time.Unix(1000, 0), got.Timestamp)
+	})
+
+	t.Run("should cross rates through the base currency", func(t *testing.T) {
+		// tested function
+		got, err := provider.Rate("USD", "PLN")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "18/5", got.Rate.String())
+	})
+
+	t.Run("should reject an unknown currency", func(t *testing.T) {
+		// tested function
+		_, err := provider.Rate("USD", "GBP")
+
+		assert.ErrorIs(t, err, ErrUnsupportedCurrency)
+	})
+
+	t.Run("should reject invalid rates", func(t *testing.T) {
+		// tested function
+		_, err := NewStaticProvider(Rates{
+			Base:      "EUR",
+			Timestamp: time.Unix(1000, 0),
+			Rates:     map[string]string{"USD": "-1"},
+		})
+
+		assert.Error(t, err)
+	})
+
+	t.Run("should require the time the rates were quoted", func(t *testing.T) {
+		// tested function
+		_, err := NewStaticProvider(Rates{Base: "EUR", Rates: map[string]string{"USD": "1.25"}})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestNoProvider(t *testing.T) {
+	converter := NewMarkupConverter(NoProvider{}, big.NewRat(1, 100))
+
+	t.Run("should reject conversions", func(t *testing.T) {
+		// tested function
+		_, _, err := converter.Convert(entities.Money{Amount: 100, Currency: "USD"}, "EUR")
+
+		assert.ErrorIs(t, err, ErrUnsupportedCurrency)
+	})
+
+	t.Run("should keep amounts in the same currency", func(t *testing.T) {
+		// tested function
+		got, rate, err := converter.Convert(entities.Money{Amount: 100, Currency: "EUR"}, "EUR")
+
+		assert.NoError(t, err)
+		assert.Nil(t, rate)
+		assert.Equal(t, entities.Money{Amount: 100, Currency: "EUR"}, got)
+	})
+}
+
+func TestFeedProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+
+	writeFeed := func(timestamp, usd string) {
+		feed := `{"Base": "EUR", "Timestamp": "` + timestamp + `", "Rates": {"USD": "` + usd + `"}}`
+		assert.NoError(t, os.WriteFile(path, []byte(feed), 0o600))
+	}
+
+	current := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		return current
+	}
+
+	writeFeed("2024-10-01T12:00:00Z", "1.25")
+
+	provider, err := NewFeedProvider(FeedConfig{
+		Path:            path,
+		RefreshInterval: time.Minute,
+		MaxAge:          time.Hour,
+	})
+	assert.NoError(t, err)
+
+	t.Run("should quote the feed rates", func(t *testing.T) {
+		// tested function
+		got, err := provider.Rate("EUR", "USD")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "5/4", got.Rate.String())
+		assert.Equal(t, "feed", got.Provider)
+	})
+
+	t.Run("should read the feed again after the refresh interval", func(t *testing.T) {
+		writeFeed("2024-10-01T12:01:00Z", "1.5")
+
+		got, err := provider.Rate("EUR", "USD")
+		assert.NoError(t, err)
+		assert.Equal(t, "5/4", got.Rate.String())
+
+		current = current.Add(time.Minute)
+
+		// tested function
+		got, err = provider.Rate("EUR", "USD")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "3/2", got.Rate.String())
+	})
+
+	t.Run("should keep the last rates when the feed is broken", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+		current = current.Add(time.Minute)
+
+		// tested function
+		got, err := provider.Rate("EUR", "USD")
+
+		assert.NoError(t, err)
+		assert.Equal(t, "3/2", got.Rate.String())
+	})
+
+	t.Run("should reject rates older than the max age", func(t *testing.T) {
+		current = current.Add(2 * time.Hour)
+
+		// tested function
+		_, err := provider.Rate("EUR", "USD")
+
+		assert.ErrorIs(t, err, ErrStaleRates)
+	})
+
+	t.Run("should fail on startup without a feed", func(t *testing.T) {
+		// tested function
+		_, err := NewFeedProvider(FeedConfig{Path: filepath.Join(t.TempDir(), "missing.json")})
+
+		assert.Error(t, err)
+	})
+}
+
+func TestConvert(t *testing.T) {
+	now = func() time.Time {
+		return time.Unix(1000, 0)
+	}
+
+	provider, err := NewStaticProvider(Rates{
+		Base:      "EUR",
+		Timestamp: time.Unix(1000, 0),
+		Rates:     map[string]string{"USD": "1.08", "JPY": "161.5"},
+	})
+	assert.NoError(t, err)
+
+	converter := NewMarkupConverter(provider, big.NewRat(1, 100))
+
+	t.Run("should convert at the rate less the markup", func(t *testing.T) {
+		// tested function
+		got, rate, err := converter.Convert(entities.Money{Amount: 10000, Currency: "USD"}, "EUR")
+
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Money{Amount: 9167, Currency: "EUR"}, got)
+		assert.Equal(t, &entities.FXRate{
+			Provider:    "static",
+			MidRate:     "0.92592593",
+			Markup:      "0.01",
+			AppliedRate: "0.91666666",
+			Timestamp:   1_000_000,
+		}, rate)
+	})
+
+	t.Run("should rescale minor units", func(t *testing.T) {
+		// tested function
+		got, rate, err := converter.Convert(entities.Money{Amount: 1000, Currency: "EUR"}, "JPY")
+
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Money{Amount: 1599, Currency: "JPY"}, got)
+		assert.Equal(t, "159.885", rate.AppliedRate)
+	})
+
+	t.Run("should not convert the same currency", func(t *testing.T) {
+		// tested function
+		got, rate, err := converter.Convert(entities.Money{Amount: 1000, Currency: "EUR"}, "EUR")
+
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Money{Amount: 1000, Currency: "EUR"}, got)
+		assert.Nil(t, rate)
+	})
+
+	t.Run("should reject an unsupported currency", func(t *testing.T) {
+		// tested function
+		_, _, err := converter.Convert(entities.Money{Amount: 1000, Currency: "GBP"}, "EUR")
+
+		assert.ErrorIs(t, err, ErrUnsupportedCurrency)
+	})
+}
+
+func TestParseMarkup(t *testing.T) {
+	got, err := ParseMarkup("0.015")
+	assert.NoError(t, err)
+	assert.Equal(t, "3/200", got.String())
+
+	_, err = ParseMarkup("1")
+	assert.Error(t, err)
+
+	_, err = ParseMarkup("abc")
+	assert.Error(t, err)
+}
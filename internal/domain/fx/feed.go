@@ -0,0 +1,94 @@
+package fx
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+type FeedConfig struct {
+	Path            string        // JSON file in the Rates format, rewritten by the feed
+	RefreshInterval time.Duration // how often the file is read again
+	MaxAge          time.Duration // rates with an older Timestamp are not quoted
+}
+
+// FeedProvider quotes the rates of a local JSON feed. The file is read again on the first quote
+// after RefreshInterval, so a feed that fails to refresh keeps serving the last rates read until
+// they are older than MaxAge.
+type FeedProvider struct {
+	config FeedConfig
+
+	mu        sync.Mutex
+	table     table
+	loaded    bool
+	refreshed time.Time
+}
+
+// NewFeedProvider reads the feed once so that a missing or malformed file is reported on startup
+func NewFeedProvider(config FeedConfig) (*FeedProvider, error) {
+	p := &FeedProvider{config: config}
+
+	err := p.refresh(now())
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (p *FeedProvider) Rate(base, quote string) (Rate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current := now()
+
+	if current.Sub(p.refreshed) >= p.config.RefreshInterval {
+		// NOTE: a failed refresh is retried on the next quote, the previous rates stay in use
+		_ = p.refresh(current)
+	}
+
+	if !p.loaded {
+		return Rate{}, ErrStaleRates
+	}
+
+	if p.config.MaxAge > 0 && current.Sub(p.table.timestamp) > p.config.MaxAge {
+		return Rate{}, fmt.Errorf("%w: quoted at %s", ErrStaleRates, p.table.timestamp)
+	}
+
+	rate, err := p.table.rate(base, quote)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	return Rate{
+		Base:      base,
+		Quote:     quote,
+		Rate:      rate,
+		Provider:  "feed",
+		Timestamp: p.table.timestamp,
+	}, nil
+}
+
+func (p *FeedProvider) refresh(current time.Time) error {
+	p.refreshed = current
+
+	data, err := os.ReadFile(p.config.Path)
+	if err != nil {
+		return err
+	}
+
+	t, err := parseRates(data)
+	if err != nil {
+		return err
+	}
+
+	if t.timestamp.IsZero() {
+		return fmt.Errorf("rates feed %s has no timestamp", p.config.Path)
+	}
+
+	p.table = t
+	p.loaded = true
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package fx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+)
+
+var now = time.Now
+
+var (
+	ErrUnsupportedCurrency = errors.New("no exchange rate for the currency")
+	ErrStaleRates          = errors.New("exchange rates are out of date")
+)
+
+// Rate is the price of one unit of Base in units of Quote
+type Rate struct {
+	Base      string
+	Quote     string
+	Rate      *big.Rat
+	Provider  string
+	Timestamp time.Time
+}
+
+type Provider interface {
+	Rate(base, quote string) (Rate, error)
+}
+
+// Rates is the JSON document read by the providers, every entry of Rates is the decimal price
+// of one unit of Base in that currency. Rates between two other currencies are crossed through
+// Base.
+type Rates struct {
+	Base      string            `json:"Base"`
+	Timestamp time.Time         `json:"Timestamp"`
+	Rates     map[string]string `json:"Rates"`
+}
+
+// table holds parsed rates keyed by currency, the base currency is always present with rate 1
+type table struct {
+	base      string
+	timestamp time.Time
+	rates     map[string]*big.Rat
+}
+
+func parseRates(data []byte) (table, error) {
+	var rates Rates
+
+	err := json.Unmarshal(data, &rates)
+	if err != nil {
+		return table{}, err
+	}
+
+	return newTable(rates)
+}
+
+func newTable(rates Rates) (table, error) {
+	if !entities.IsCurrency(rates.Base) {
+		return table{}, fmt.Errorf("invalid base currency %q", rates.Base)
+	}
+
+	t := table{
+		base:      rates.Base,
+		timestamp: rates.Timestamp,
+		rates:     map[string]*big.Rat{rates.Base: big.NewRat(1, 1)},
+	}
+
+	for currency, value := range rates.Rates {
+		if !entities.IsCurrency(currency) {
+			return table{}, fmt.Errorf("invalid currency %q", currency)
+		}
+
+		rate, ok := new(big.Rat).SetString(value)
+		if !ok || rate.Sign() <= 0 {
+			return table{}, fmt.Errorf("invalid rate %q for %s", value, currency)
+		}
+
+		t.rates[currency] = rate
+	}
+
+	return t, nil
+}
+
+func (t table) rate(base, quote string) (*big.Rat, error) {
+	from, ok := t.rates[base]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnsupportedCurrency, base)
+	}
+
+	to, ok := t.rates[quote]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnsupportedCurrency, quote)
+	}
+
+	return new(big.Rat).Quo(to, from), nil
+}
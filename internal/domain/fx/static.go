@@ -0,0 +1,69 @@
+package fx
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// StaticProvider quotes a fixed set of rates for the lifetime of the process
+type StaticProvider struct {
+	table table
+}
+
+// NewStaticProvider requires the time the rates were quoted, it is stored with every payment
+// converted at them
+func NewStaticProvider(rates Rates) (*StaticProvider, error) {
+	t, err := newTable(rates)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.timestamp.IsZero() {
+		return nil, errors.New("static rates have no timestamp")
+	}
+
+	return &StaticProvider{table: t}, nil
+}
+
+// LoadStaticProvider reads the rates from a JSON file once
+func LoadStaticProvider(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := parseRates(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.timestamp.IsZero() {
+		return nil, fmt.Errorf("rates file %s has no timestamp", path)
+	}
+
+	return &StaticProvider{table: t}, nil
+}
+
+// Rate quotes the rate with the time the rates were quoted
+func (p *StaticProvider) Rate(base, quote string) (Rate, error) {
+	rate, err := p.table.rate(base, quote)
+	if err != nil {
+		return Rate{}, err
+	}
+
+	return Rate{
+		Base:      base,
+		Quote:     quote,
+		Rate:      rate,
+		Provider:  "static",
+		Timestamp: p.table.timestamp,
+	}, nil
+}
+
+// NoProvider quotes no rates, every conversion fails with ErrUnsupportedCurrency
+type NoProvider struct{}
+
+func (NoProvider) Rate(base, quote string) (Rate, error) {
+	return Rate{}, fmt.Errorf("%w %s to %s", ErrUnsupportedCurrency, base, quote)
+}
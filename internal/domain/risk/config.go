@@ -0,0 +1,142 @@
+package risk
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Config describes the scoring rules and the score thresholds for the decisions.
+// Every rule that matches adds its Score to the payment's total score.
+type Config struct {
+	ReviewScore       int                     `json:"ReviewScore"`
+	BlockScore        int                     `json:"BlockScore"`
+	AmountThresholds  []AmountThresholdRule   `json:"AmountThresholds"`
+	Velocity          []VelocityRule          `json:"Velocity"`
+	NameMismatch      *NameMismatchRule       `json:"NameMismatch"`
+	NewCardHighAmount []NewCardHighAmountRule `json:"NewCardHighAmount"`
+	// HistorySeconds is how long seen cards and customer names are remembered after they were
+	// last used, DefaultHistorySeconds when zero
+	HistorySeconds int64 `json:"HistorySeconds"`
+}
+
+// DefaultHistorySeconds remembers seen cards and customer names for 90 days
+const DefaultHistorySeconds = 90 * 24 * 3600
+
+// AmountThresholdRule matches payments above Amount (in minor units) in the given currency
+type AmountThresholdRule struct {
+	Currency string `json:"Currency"`
+	Amount   int64  `json:"Amount"`
+	Score    int    `json:"Score"`
+}
+
+// VelocityRule matches when more than MaxCount payments were attempted with the same
+// card, customer or IP address within the window
+type VelocityRule struct {
+	Key           string `json:"Key"` // one of VelocityKeyCard, VelocityKeyCustomer, VelocityKeyIP
+	WindowSeconds int64  `json:"WindowSeconds"`
+	MaxCount      int    `json:"MaxCount"`
+	Score         int    `json:"Score"`
+}
+
+// NameMismatchRule matches when the cardholder name differs from the name previously
+// used by the same customer
+type NameMismatchRule struct {
+	Score int `json:"Score"`
+}
+
+// NewCardHighAmountRule matches a card that has not been seen before when it is charged
+// more than Amount (in minor units) in the given currency
+type NewCardHighAmountRule struct {
+	Currency string `json:"Currency"`
+	Amount   int64  `json:"Amount"`
+	Score    int    `json:"Score"`
+}
+
+const (
+	VelocityKeyCard     = "card"
+	VelocityKeyCustomer = "customer"
+	VelocityKeyIP       = "ip"
+)
+
+func DefaultConfig() Config {
+	return Config{
+		ReviewScore: 50,
+		BlockScore:  100,
+		AmountThresholds: []AmountThresholdRule{
+			{Currency: "EUR", Amount: 1_000_000, Score: 50},
+			{Currency: "USD", Amount: 1_000_000, Score: 50},
+		},
+		Velocity: []VelocityRule{
+			{Key: VelocityKeyCard, WindowSeconds: 3600, MaxCount: 10, Score: 60},
+			{Key: VelocityKeyCustomer, WindowSeconds: 3600, MaxCount: 20, Score: 40},
+			{Key: VelocityKeyIP, WindowSeconds: 600, MaxCount: 30, Score: 40},
+		},
+		NameMismatch: &NameMismatchRule{Score: 30},
+		NewCardHighAmount: []NewCardHighAmountRule{
+			{Currency: "EUR", Amount: 500_000, Score: 30},
+			{Currency: "USD", Amount: 500_000, Score: 30},
+		},
+		HistorySeconds: DefaultHistorySeconds,
+	}
+}
+
+// LoadConfig reads the rule configuration from a JSON file
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("parsing risk rules file %s: %w", path, err)
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid risk rules file %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+func (c Config) Validate() error {
+	if c.ReviewScore <= 0 || c.BlockScore <= 0 {
+		return fmt.Errorf("ReviewScore and BlockScore must be positive")
+	}
+
+	if c.ReviewScore > c.BlockScore {
+		return fmt.Errorf("ReviewScore cannot be greater than BlockScore")
+	}
+
+	for _, rule := range c.Velocity {
+		switch rule.Key {
+		case VelocityKeyCard, VelocityKeyCustomer, VelocityKeyIP:
+		default:
+			return fmt.Errorf("unknown velocity key %q", rule.Key)
+		}
+
+		if rule.WindowSeconds <= 0 {
+			return fmt.Errorf("velocity rule %q must have a positive window", rule.Key)
+		}
+	}
+
+	if c.HistorySeconds < 0 {
+		return fmt.Errorf("HistorySeconds cannot be negative")
+	}
+
+	return nil
+}
+
+// history is how long seen cards and customer names are remembered
+func (c Config) history() time.Duration {
+	if c.HistorySeconds == 0 {
+		return DefaultHistorySeconds * time.Second
+	}
+
+	return time.Duration(c.HistorySeconds) * time.Second
+}
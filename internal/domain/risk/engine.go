@@ -0,0 +1,214 @@
+package risk
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+)
+
+var now = time.Now
+
+type Assessor interface {
+	Assess(payment entities.Payment) entities.RiskAssessment
+}
+
+// customerKey identifies a customer, customer IDs are chosen by the merchant so they are only
+// unique per merchant
+type customerKey struct {
+	merchantID string
+	customerID string
+}
+
+type attempt struct {
+	card      string
+	customer  customerKey
+	ip        string
+	timestamp time.Time
+}
+
+// customerName is the cardholder name the customer paid with first and when the customer last
+// paid
+type customerName struct {
+	name      string
+	timestamp time.Time
+}
+
+// Engine scores payments against the configured rules.
+// NOTE: the payment history is kept in memory, so velocity counters are per API instance
+// and are lost on restart. Attempts are forgotten after the longest velocity window, seen cards
+// and customer names once they were not used within the configured history.
+type Engine struct {
+	config Config
+
+	mu            sync.Mutex
+	attempts      []attempt
+	uses          []attempt // payments that updated the seen cards and customer names
+	seenCards     map[string]time.Time
+	customerNames map[customerKey]customerName
+}
+
+func NewEngine(config Config) *Engine {
+	return &Engine{
+		config:        config,
+		seenCards:     make(map[string]time.Time),
+		customerNames: make(map[customerKey]customerName),
+	}
+}
+
+// Assess scores the payment and records it as an attempt for the velocity rules
+func (e *Engine) Assess(payment entities.Payment) entities.RiskAssessment {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	current := attempt{
+		card:      fingerprint(payment.Customer.CardDetails.Number),
+		customer:  customerKey{merchantID: payment.Merchant.ID, customerID: payment.Customer.ID},
+		ip:        payment.IPAddress,
+		timestamp: now(),
+	}
+
+	e.prune(current.timestamp)
+
+	var assessment entities.RiskAssessment
+
+	match := func(rule string, score int) {
+		assessment.Score += score
+		assessment.Rules = append(assessment.Rules, rule)
+	}
+
+	for _, rule := range e.config.AmountThresholds {
+		if payment.Price.Currency == rule.Currency && payment.Price.Amount > rule.Amount {
+			match(fmt.Sprintf("amount_threshold_%s", strings.ToLower(rule.Currency)), rule.Score)
+		}
+	}
+
+	for _, rule := range e.config.Velocity {
+		if e.count(rule, current) >= rule.MaxCount {
+			match(fmt.Sprintf("velocity_%s", rule.Key), rule.Score)
+		}
+	}
+
+	name := normalizeName(payment.Customer.CardDetails.Name)
+	previous, known := e.customerNames[current.customer]
+	if e.config.NameMismatch != nil && known && previous.name != name {
+		match("name_mismatch", e.config.NameMismatch.Score)
+	}
+
+	if _, seen := e.seenCards[current.card]; !seen {
+		for _, rule := range e.config.NewCardHighAmount {
+			if payment.Price.Currency == rule.Currency && payment.Price.Amount > rule.Amount {
+				match("new_card_high_amount", rule.Score)
+			}
+		}
+	}
+
+	switch {
+	case assessment.Score >= e.config.BlockScore:
+		assessment.Decision = entities.RiskDecisionBlock
+	case assessment.Score >= e.config.ReviewScore:
+		assessment.Decision = entities.RiskDecisionReview
+	default:
+		assessment.Decision = entities.RiskDecisionAllow
+	}
+
+	e.attempts = append(e.attempts, current)
+	if assessment.Decision != entities.RiskDecisionBlock {
+		e.uses = append(e.uses, current)
+		e.seenCards[current.card] = current.timestamp
+
+		switch {
+		case known:
+			previous.timestamp = current.timestamp
+			e.customerNames[current.customer] = previous
+		case name != "":
+			e.customerNames[current.customer] = customerName{
+				name:      name,
+				timestamp: current.timestamp,
+			}
+		}
+	}
+
+	return assessment
+}
+
+func (e *Engine) count(rule VelocityRule, current attempt) int {
+	since := current.timestamp.Add(-time.Duration(rule.WindowSeconds) * time.Second)
+	count := 0
+
+	for _, a := range e.attempts {
+		if a.timestamp.Before(since) {
+			continue
+		}
+
+		switch rule.Key {
+		case VelocityKeyCard:
+			if a.card == current.card {
+				count++
+			}
+		case VelocityKeyCustomer:
+			if a.customer == current.customer {
+				count++
+			}
+		case VelocityKeyIP:
+			if current.ip != "" && a.ip == current.ip {
+				count++
+			}
+		}
+	}
+
+	return count
+}
+
+// prune drops attempts that are older than the longest velocity window, and the cards and
+// customer names that were not used within the history
+func (e *Engine) prune(t time.Time) {
+	var longest int64
+	for _, rule := range e.config.Velocity {
+		longest = max(longest, rule.WindowSeconds)
+	}
+
+	since := t.Add(-time.Duration(longest) * time.Second)
+
+	i := 0
+	for i < len(e.attempts) && e.attempts[i].timestamp.Before(since) {
+		i++
+	}
+
+	e.attempts = e.attempts[i:]
+
+	since = t.Add(-e.config.history())
+
+	i = 0
+	for i < len(e.uses) && e.uses[i].timestamp.Before(since) {
+		// NOTE: cards and names are only kept for their uses, so they are checked when the
+		// uses are dropped
+		u := e.uses[i]
+
+		if seen, ok := e.seenCards[u.card]; ok && seen.Before(since) {
+			delete(e.seenCards, u.card)
+		}
+
+		if name, ok := e.customerNames[u.customer]; ok && name.timestamp.Before(since) {
+			delete(e.customerNames, u.customer)
+		}
+
+		i++
+	}
+
+	e.uses = e.uses[i:]
+}
+
+// fingerprint avoids keeping card numbers in memory
+func fingerprint(cardNumber string) string {
+	sum := sha256.Sum256([]byte(cardNumber))
+	return hex.EncodeToString(sum[:])
+}
+
+func normalizeName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
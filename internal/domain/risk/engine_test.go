@@ -0,0 +1,227 @@
+package risk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+)
+
+func testPayment(customerID, name, number string, amount int64) entities.Payment {
+	return entities.Payment{
+		Customer: entities.Customer{
+			ID: customerID,
+			CardDetails: entities.CardDetails{
+				Name:   name,
+				Number: number,
+			},
+		},
+		IPAddress: "127.0.0.1",
+		Price:     entities.Money{Amount: amount, Currency: "EUR"},
+	}
+}
+
+func TestAssess(t *testing.T) {
+	now = func() time.Time {
+		return time.Unix(1000, 0)
+	}
+
+	config := Config{
+		ReviewScore: 50,
+		BlockScore:  100,
+		AmountThresholds: []AmountThresholdRule{
+			{Currency: "EUR", Amount: 10_000, Score: 50},
+		},
+		Velocity: []VelocityRule{
+			{Key: VelocityKeyCard, WindowSeconds: 60, MaxCount: 2, Score: 100},
+		},
+		NameMismatch: &NameMismatchRule{Score: 30},
+		NewCardHighAmount: []NewCardHighAmountRule{
+			{Currency: "EUR", Amount: 5_000, Score: 20},
+		},
+	}
+
+	t.Run("should allow a regular payment", func(t *testing.T) {
+		engine := NewEngine(config)
+
+		// tested function
+		got := engine.Assess(testPayment("customer", "Test Customer", "1234123412341234", 100))
+
+		assert.Equal(t, entities.RiskAssessment{Decision: entities.RiskDecisionAllow}, got)
+	})
+
+	t.Run("should review a high amount on a new card", func(t *testing.T) {
+		engine := NewEngine(config)
+
+		// tested function
+		got := engine.Assess(testPayment("customer", "Test Customer", "1234123412341234", 20_000))
+
+		assert.Equal(t, entities.RiskAssessment{
+			Score:    70,
+			Decision: entities.RiskDecisionReview,
+			Rules:    []string{"amount_threshold_eur", "new_card_high_amount"},
+		}, got)
+	})
+
+	t.Run("should flag a mismatched name", func(t *testing.T) {
+		engine := NewEngine(config)
+		engine.Assess(testPayment("customer", "Test Customer", "1234123412341234", 100))
+
+		// tested function
+		got := engine.Assess(testPayment("customer", "Other Name", "1234123412341234", 100))
+
+		assert.Equal(t, entities.RiskAssessment{
+			Score:    30,
+			Decision: entities.RiskDecisionAllow,
+			Rules:    []string{"name_mismatch"},
+		}, got)
+	})
+
+	t.Run("should block after exceeding card velocity", func(t *testing.T) {
+		engine := NewEngine(config)
+		engine.Assess(testPayment("customer", "Test Customer", "1234123412341234", 100))
+		engine.Assess(testPayment("customer", "Test Customer", "1234123412341234", 100))
+
+		// tested function
+		got := engine.Assess(testPayment("customer", "Test Customer", "1234123412341234", 100))
+
+		assert.Equal(t, entities.RiskDecisionBlock, got.Decision)
+		assert.Equal(t, []string{"velocity_card"}, got.Rules)
+
+		now = func() time.Time {
+			return time.Unix(1061, 0)
+		}
+
+		got = engine.Assess(testPayment("customer", "Test Customer", "1234123412341234", 100))
+
+		assert.Equal(t, entities.RiskDecisionAllow, got.Decision)
+	})
+
+	t.Run("should keep the customers of merchants apart", func(t *testing.T) {
+		now = func() time.Time {
+			return time.Unix(1000, 0)
+		}
+
+		engine := NewEngine(config)
+
+		payment := testPayment("customer", "Test Customer", "1234123412341234", 100)
+		payment.Merchant.ID = "merchant"
+		engine.Assess(payment)
+
+		payment = testPayment("customer", "Other Name", "4321432143214321", 100)
+		payment.Merchant.ID = "otherMerchant"
+
+		// tested function
+		got := engine.Assess(payment)
+
+		assert.Equal(t, entities.RiskAssessment{Decision: entities.RiskDecisionAllow}, got)
+	})
+
+	t.Run("should remember cards and names after the velocity window", func(t *testing.T) {
+		now = func() time.Time {
+			return time.Unix(1000, 0)
+		}
+
+		engine := NewEngine(config)
+		engine.Assess(testPayment("customer", "Test Customer", "1234123412341234", 100))
+
+		now = func() time.Time {
+			return time.Unix(1061, 0)
+		}
+
+		// tested function
+		got := engine.Assess(testPayment("customer", "Other Name", "1234123412341234", 6_000))
+
+		assert.Equal(t, []string{"name_mismatch"}, got.Rules)
+		assert.Len(t, engine.attempts, 1)
+	})
+
+	t.Run("should forget cards and names after the history", func(t *testing.T) {
+		history := config
+		history.HistorySeconds = 3600
+
+		now = func() time.Time {
+			return time.Unix(1000, 0)
+		}
+
+		engine := NewEngine(history)
+		engine.Assess(testPayment("customer", "Test Customer", "1234123412341234", 100))
+
+		now = func() time.Time {
+			return time.Unix(4601, 0)
+		}
+
+		// tested function
+		got := engine.Assess(testPayment("customer", "Other Name", "1234123412341234", 6_000))
+
+		assert.Equal(t, []string{"new_card_high_amount"}, got.Rules)
+		assert.Len(t, engine.seenCards, 1)
+		assert.Len(t, engine.customerNames, 1)
+	})
+
+	t.Run("should remember cards and names without velocity rules", func(t *testing.T) {
+		noVelocity := config
+		noVelocity.Velocity = nil
+
+		now = func() time.Time {
+			return time.Unix(1000, 0)
+		}
+
+		engine := NewEngine(noVelocity)
+		engine.Assess(testPayment("customer", "Test Customer", "1234123412341234", 100))
+
+		now = func() time.Time {
+			return time.Unix(1001, 0)
+		}
+
+		// tested function
+		got := engine.Assess(testPayment("customer", "Other Name", "1234123412341234", 6_000))
+
+		assert.Equal(t, []string{"name_mismatch"}, got.Rules)
+		assert.Len(t, engine.attempts, 1)
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+
+	t.Run("should load rules from file", func(t *testing.T) {
+		err := os.WriteFile(path, []byte(`{
+			"ReviewScore": 10,
+			"BlockScore": 20,
+			"Velocity": [{"Key": "ip", "WindowSeconds": 60, "MaxCount": 5, "Score": 10}]
+		}`), 0o600)
+		assert.NoError(t, err)
+
+		// tested function
+		got, err := LoadConfig(path)
+		assert.NoError(t, err)
+
+		want := Config{
+			ReviewScore: 10,
+			BlockScore:  20,
+			Velocity: []VelocityRule{
+				{Key: VelocityKeyIP, WindowSeconds: 60, MaxCount: 5, Score: 10},
+			},
+		}
+
+		assert.Equal(t, want, got)
+	})
+
+	t.Run("should reject unknown velocity keys", func(t *testing.T) {
+		err := os.WriteFile(path, []byte(`{
+			"ReviewScore": 10,
+			"BlockScore": 20,
+			"Velocity": [{"Key": "email", "WindowSeconds": 60, "MaxCount": 5, "Score": 10}]
+		}`), 0o600)
+		assert.NoError(t, err)
+
+		// tested function
+		_, err = LoadConfig(path)
+		assert.Error(t, err)
+	})
+}
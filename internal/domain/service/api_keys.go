@@ -0,0 +1,251 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/signing"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid API key credentials")
+	ErrNonceReused        = errors.New("request signature nonce was already used")
+)
+
+var newSecret = func() (string, error) {
+	b := make([]byte, 32)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateAPIKey generates a new key pair for the merchant granted the given scopes, the returned
+// secret is not stored and cannot be retrieved again. Keys requiring signed requests also get
+// a signing secret shared with the merchant.
+func (s *Service) CreateAPIKey(
+	actor entities.Actor,
+	merchantID, name string,
+	scopes []string,
+	requireSignedRequests bool,
+) (entities.APIKey, string, error) {
+	key, secret, err := s.createAPIKey(merchantID, name, scopes, requireSignedRequests)
+
+	var after any
+	if err == nil {
+		after = newAPIKeySnapshot(key)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionAPIKeyCreate,
+		key.ID,
+		nil,
+		after,
+		err,
+	)
+
+	return key, secret, err
+}
+
+func (s *Service) createAPIKey(
+	merchantID, name string,
+	scopes []string,
+	requireSignedRequests bool,
+) (entities.APIKey, string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		s.logger.Error("error generating API key secret", "error", err)
+		return entities.APIKey{}, "", err
+	}
+
+	var signingSecret string
+	if requireSignedRequests {
+		signingSecret, err = newSecret()
+		if err != nil {
+			s.logger.Error("error generating API key signing secret", "error", err)
+			return entities.APIKey{}, "", err
+		}
+	}
+
+	key := entities.APIKey{
+		ID:            newUUID().String(),
+		MerchantID:    merchantID,
+		Name:          name,
+		SecretHash:    entities.HashAPIKeySecret(secret),
+		Scopes:        scopes,
+		SigningSecret: signingSecret,
+		Timestamp:     now().UnixNano() / int64(time.Millisecond),
+	}
+
+	err = s.storage.CreateAPIKey(key)
+	if err != nil {
+		s.logger.Error("error creating API key", "error", err)
+		return entities.APIKey{}, "", err
+	}
+
+	s.logger.Info("API key created", "keyID", key.ID)
+
+	return key, secret, nil
+}
+
+func (s *Service) ListAPIKeys(merchantID string) ([]entities.APIKey, error) {
+	keys, err := s.storage.ListAPIKeys(merchantID)
+	if err != nil {
+		s.logger.Error("error listing API keys", "error", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (s *Service) RevokeAPIKey(actor entities.Actor, merchantID, keyID string) error {
+	before, after, err := s.revokeAPIKey(merchantID, keyID)
+
+	var beforeState, afterState any
+	if before.ID != "" {
+		beforeState = newAPIKeySnapshot(before)
+	}
+	if err == nil {
+		afterState = newAPIKeySnapshot(after)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionAPIKeyRevoke,
+		keyID,
+		beforeState,
+		afterState,
+		err,
+	)
+
+	return err
+}
+
+// revokeAPIKey returns the key before and after the revocation
+func (s *Service) revokeAPIKey(merchantID, keyID string) (entities.APIKey, entities.APIKey, error) {
+	key, err := s.storage.GetAPIKey(keyID)
+	if err != nil {
+		s.logger.Error("error getting API key", "error", err)
+		return entities.APIKey{}, entities.APIKey{}, err
+	}
+
+	if key.MerchantID != merchantID {
+		return entities.APIKey{}, entities.APIKey{}, storage.ErrNotFound
+	}
+
+	before := key
+
+	if key.Revoked {
+		return before, key, nil
+	}
+
+	key.Revoked = true
+	key.RevokedTimestamp = now().UnixNano() / int64(time.Millisecond)
+
+	err = s.storage.UpdateAPIKey(key)
+	if err != nil {
+		s.logger.Error("error updating API key", "error", err)
+		return before, entities.APIKey{}, err
+	}
+
+	s.keyRevocations.set(key.ID, true, now().Add(revocationCacheTTL))
+
+	s.logger.Info("API key revoked", "keyID", key.ID)
+
+	return before, key, nil
+}
+
+// AuthenticateAPIKey checks the key credentials and returns the key they belong to
+func (s *Service) AuthenticateAPIKey(keyID, secret string) (entities.APIKey, error) {
+	key, err := s.storage.GetAPIKey(keyID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return entities.APIKey{}, ErrInvalidCredentials
+		}
+
+		s.logger.Error("error getting API key", "error", err)
+		return entities.APIKey{}, err
+	}
+
+	hash := entities.HashAPIKeySecret(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(key.SecretHash)) != 1 || key.Revoked {
+		return entities.APIKey{}, ErrInvalidCredentials
+	}
+
+	return key, nil
+}
+
+// IsAPIKeyRevoked checks whether the key of the merchant that a token was exchanged from was
+// revoked, unknown keys and keys of other merchants count as revoked. Answers are cached like
+// token revocations.
+func (s *Service) IsAPIKeyRevoked(merchantID, keyID string) (bool, error) {
+	if revoked, ok := s.keyRevocations.get(keyID); ok {
+		return revoked, nil
+	}
+
+	key, err := s.storage.GetAPIKey(keyID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		s.logger.Error("error getting API key", "error", err)
+		return false, err
+	}
+
+	revoked := err != nil || key.Revoked || key.MerchantID != merchantID
+
+	s.keyRevocations.set(keyID, revoked, now().Add(revocationCacheTTL))
+
+	return revoked, nil
+}
+
+// VerifyRequestSignature checks the request was signed with the signing secret of the key within
+// maxSkew of now and that its nonce was not used before
+func (s *Service) VerifyRequestSignature(
+	keyID string,
+	request signing.Request,
+	signature string,
+	maxSkew time.Duration,
+) error {
+	key, err := s.storage.GetAPIKey(keyID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return ErrInvalidCredentials
+		}
+
+		s.logger.Error("error getting API key", "error", err)
+		return err
+	}
+
+	if key.Revoked || key.SigningSecret == "" {
+		return ErrInvalidCredentials
+	}
+
+	t := now()
+
+	err = signing.Verify(key.SigningSecret, request, signature, t, maxSkew)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: nonces only need to be kept while their timestamp is accepted
+	unused, err := s.storage.UseNonce(keyID, request.Nonce, t.Add(2*maxSkew).Unix())
+	if err != nil {
+		s.logger.Error("error recording request nonce", "error", err)
+		return err
+	}
+
+	if !unused {
+		return ErrNonceReused
+	}
+
+	return nil
+}
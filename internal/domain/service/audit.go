@@ -0,0 +1,182 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+)
+
+// auditAppendAttempts bounds the retries when another instance appended to the chain first
+const auditAppendAttempts = 5
+
+// apiKeySnapshot is the audited state of an API key, without its secrets
+type apiKeySnapshot struct {
+	ID                    string
+	Name                  string
+	Scopes                []string
+	RequireSignedRequests bool
+	Revoked               bool
+	RevokedTimestamp      int64
+}
+
+func newAPIKeySnapshot(key entities.APIKey) apiKeySnapshot {
+	return apiKeySnapshot{
+		ID:                    key.ID,
+		Name:                  key.Name,
+		Scopes:                key.Scopes,
+		RequireSignedRequests: key.SigningSecret != "",
+		Revoked:               key.Revoked,
+		RevokedTimestamp:      key.RevokedTimestamp,
+	}
+}
+
+// webhookEndpointSnapshot is the audited state of a webhook endpoint, without its secret
+type webhookEndpointSnapshot struct {
+	ID         string
+	URL        string
+	EventTypes []string
+}
+
+func newWebhookEndpointSnapshot(endpoint entities.WebhookEndpoint) webhookEndpointSnapshot {
+	return webhookEndpointSnapshot{
+		ID:         endpoint.ID,
+		URL:        endpoint.URL,
+		EventTypes: endpoint.EventTypes,
+	}
+}
+
+// webhookDeliverySnapshot is the audited state of a webhook delivery, without its payload
+type webhookDeliverySnapshot struct {
+	ID         string
+	EndpointID string
+	EventID    string
+	EventType  string
+	Status     string
+	ReplayOf   string
+}
+
+func newWebhookDeliverySnapshot(delivery entities.WebhookDelivery) webhookDeliverySnapshot {
+	return webhookDeliverySnapshot{
+		ID:         delivery.ID,
+		EndpointID: delivery.EndpointID,
+		EventID:    delivery.EventID,
+		EventType:  delivery.EventType,
+		Status:     delivery.Status,
+		ReplayOf:   delivery.ReplayOf,
+	}
+}
+
+// revokedTokenSnapshot is the audited state of a revoked token
+type revokedTokenSnapshot struct {
+	TokenID string
+	Expires int64
+}
+
+// recordAuditEvent appends the outcome of an action to the merchant's audit chain, before and
+// after are the states of the resource and are left out when nil. Failing to record the event
+// is logged and does not fail the action, which has already been performed.
+func (s *Service) recordAuditEvent(
+	actor entities.Actor,
+	merchantID, action, resourceID string,
+	before, after any,
+	actionErr error,
+) {
+	event := entities.AuditEvent{
+		MerchantID: merchantID,
+		Action:     action,
+		Actor:      actor,
+		ResourceID: resourceID,
+		Outcome:    entities.AuditOutcomeSuccess,
+		Timestamp:  now().UnixNano() / int64(time.Millisecond),
+	}
+
+	if actionErr != nil {
+		event.Outcome = entities.AuditOutcomeFailure
+		event.Error = actionErr.Error()
+	}
+
+	var err error
+
+	event.Before, err = auditState(before)
+	if err != nil {
+		s.logger.Error("error encoding audit state", "error", err)
+		return
+	}
+
+	event.After, err = auditState(after)
+	if err != nil {
+		s.logger.Error("error encoding audit state", "error", err)
+		return
+	}
+
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+
+	for range auditAppendAttempts {
+		err = s.appendAuditEvent(event)
+		if !errors.Is(err, storage.ErrConflict) {
+			break
+		}
+	}
+
+	if err != nil {
+		s.logger.Error("error recording audit event", "action", action, "error", err)
+	}
+}
+
+func (s *Service) appendAuditEvent(event entities.AuditEvent) error {
+	latest, err := s.storage.GetLatestAuditEvent(event.MerchantID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+
+	event.Sequence = latest.Sequence + 1
+	event.PreviousHash = latest.Hash
+	event.Hash = event.ComputeHash()
+
+	return s.storage.CreateAuditEvent(event)
+}
+
+func auditState(state any) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(state)
+}
+
+// ListAuditEvents returns the matching events of the merchant and whether the chain is intact
+// from the first requested sequence up to the last returned event. The chain is verified over
+// all events of that range, not only the matching ones.
+func (s *Service) ListAuditEvents(
+	merchantID string,
+	filter storage.AuditEventFilter,
+) ([]entities.AuditEvent, bool, error) {
+	events, err := s.storage.ListAuditEvents(merchantID, filter)
+	if err != nil {
+		s.logger.Error("error listing audit events", "error", err)
+		return nil, false, err
+	}
+
+	if filter.Action == "" && filter.ResourceID == "" {
+		return events, entities.VerifyAuditChain(events, filter.AfterSequence), nil
+	}
+
+	if len(events) == 0 {
+		return events, true, nil
+	}
+
+	chain, err := s.storage.ListAuditEvents(merchantID, storage.AuditEventFilter{
+		AfterSequence: filter.AfterSequence,
+		Limit:         int(events[len(events)-1].Sequence - filter.AfterSequence),
+	})
+	if err != nil {
+		s.logger.Error("error listing audit events", "error", err)
+		return nil, false, err
+	}
+
+	return events, entities.VerifyAuditChain(chain, filter.AfterSequence), nil
+}
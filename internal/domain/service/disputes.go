@@ -0,0 +1,438 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+)
+
+// disputeResponseWindow is how long merchants have to submit evidence when the card issuer
+// does not set a deadline
+const disputeResponseWindow = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidDisputeAmount  = errors.New("dispute amount is not a part of the undisputed price")
+	ErrDisputeResponded      = errors.New("dispute does not need a response")
+	ErrDisputeDeadlinePassed = errors.New("dispute response deadline has passed")
+	ErrDisputeClosed         = errors.New("dispute was already decided")
+	ErrPaymentDisputed       = errors.New("payment has an open dispute or was charged back in full")
+)
+
+// EvidenceUpload is a file submitted as evidence, the content is read once when it is stored
+type EvidenceUpload struct {
+	Name        string
+	ContentType string
+	Content     io.Reader
+}
+
+// OpenDispute records the dispute of a captured payment reported by the card issuer. Disputes of
+// a payment that were not won cannot exceed its price together, the remaining undisputed part is
+// disputed when no amount is given and the merchant has the default response window when no
+// deadline is given.
+func (s *Service) OpenDispute(
+	actor entities.Actor,
+	dispute entities.Dispute,
+) (entities.Dispute, error) {
+	created, err := s.openDispute(dispute)
+
+	var after any
+	if err == nil {
+		after = created
+	}
+
+	s.recordAuditEvent(
+		actor,
+		dispute.MerchantID,
+		entities.AuditActionDisputeCreate,
+		created.ID,
+		nil,
+		after,
+		err,
+	)
+
+	return created, err
+}
+
+func (s *Service) openDispute(dispute entities.Dispute) (entities.Dispute, error) {
+	payment, err := s.storage.GetPayment(dispute.MerchantID, dispute.PaymentID)
+	if err != nil {
+		s.logger.Error("error getting payment", "error", err)
+		return entities.Dispute{}, err
+	}
+
+	if payment.Refunded {
+		return entities.Dispute{}, ErrPaymentRefunded
+	}
+
+	undisputed := payment.Price
+	undisputed.Amount -= payment.DisputedAmount
+
+	if dispute.Amount.Currency == "" {
+		dispute.Amount = undisputed
+	}
+
+	if dispute.Amount.Currency != payment.Price.Currency ||
+		!dispute.Amount.IsPositive() ||
+		dispute.Amount.Amount > undisputed.Amount {
+		return entities.Dispute{}, ErrInvalidDisputeAmount
+	}
+
+	timestamp := now().UnixNano() / int64(time.Millisecond)
+
+	dispute.ID = newUUID().String()
+	dispute.Status = entities.DisputeStatusNeedsResponse
+	dispute.Evidence = nil
+	dispute.Timestamp = timestamp
+	dispute.UpdatedTimestamp = timestamp
+
+	if dispute.Deadline == 0 {
+		dispute.Deadline = timestamp + disputeResponseWindow.Milliseconds()
+	}
+
+	err = s.storage.CreateDispute(dispute, payment.Price)
+	if err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			return entities.Dispute{}, s.disputeConflict(dispute)
+		}
+
+		s.logger.Error("error creating dispute", "error", err)
+		return entities.Dispute{}, err
+	}
+
+	s.logger.Info("dispute opened", "disputeID", dispute.ID, "paymentID", dispute.PaymentID)
+
+	return dispute, nil
+}
+
+// disputeConflict explains why the dispute could not be reserved on its payment, the payment was
+// refunded or disputed by another request since it was read
+func (s *Service) disputeConflict(dispute entities.Dispute) error {
+	payment, err := s.storage.GetPayment(dispute.MerchantID, dispute.PaymentID)
+	if err != nil {
+		s.logger.Error("error getting payment", "error", err)
+		return err
+	}
+
+	if payment.Refunded {
+		return ErrPaymentRefunded
+	}
+
+	return ErrInvalidDisputeAmount
+}
+
+// SubmitDisputeEvidence stores the evidence files in the blob store and puts the dispute under
+// review, evidence can be submitted once before the deadline
+func (s *Service) SubmitDisputeEvidence(
+	actor entities.Actor,
+	merchantID, disputeID, text string,
+	files []EvidenceUpload,
+) (entities.Dispute, error) {
+	before, after, err := s.submitDisputeEvidence(merchantID, disputeID, text, files)
+
+	var beforeState, afterState any
+	if before.ID != "" {
+		beforeState = before
+	}
+	if err == nil {
+		afterState = after
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionDisputeRespond,
+		disputeID,
+		beforeState,
+		afterState,
+		err,
+	)
+
+	return after, err
+}
+
+func (s *Service) submitDisputeEvidence(
+	merchantID, disputeID, text string,
+	files []EvidenceUpload,
+) (entities.Dispute, entities.Dispute, error) {
+	dispute, err := s.storage.GetDispute(merchantID, disputeID)
+	if err != nil {
+		return entities.Dispute{}, entities.Dispute{}, err
+	}
+
+	before := dispute
+
+	if dispute.Status != entities.DisputeStatusNeedsResponse {
+		return before, entities.Dispute{}, ErrDisputeResponded
+	}
+
+	timestamp := now().UnixNano() / int64(time.Millisecond)
+
+	if timestamp > dispute.Deadline {
+		return before, entities.Dispute{}, ErrDisputeDeadlinePassed
+	}
+
+	evidence := &entities.DisputeEvidence{
+		Text:      text,
+		Files:     []entities.EvidenceFile{},
+		Timestamp: timestamp,
+	}
+
+	for _, upload := range files {
+		file := entities.EvidenceFile{
+			ID:          newUUID().String(),
+			Name:        upload.Name,
+			ContentType: upload.ContentType,
+		}
+		file.Key = merchantID + "/" + disputeID + "/" + file.ID
+
+		file.Size, err = s.blobs.Put(file.Key, upload.Content)
+		if err != nil {
+			s.logger.Error("error storing evidence file", "error", err)
+			s.deleteEvidenceFiles(evidence.Files)
+			return before, entities.Dispute{}, err
+		}
+
+		evidence.Files = append(evidence.Files, file)
+	}
+
+	dispute.Status = entities.DisputeStatusUnderReview
+	dispute.Evidence = evidence
+	dispute.UpdatedTimestamp = timestamp
+
+	// NOTE: the dispute may have been decided while the files were uploaded, it is only put
+	// under review when it was not changed since it was read
+	err = s.storage.UpdateDispute(before, dispute, storage.PaymentChange{})
+	if err != nil {
+		if !errors.Is(err, storage.ErrConflict) {
+			s.logger.Error("error updating dispute", "error", err)
+		}
+		s.deleteEvidenceFiles(evidence.Files)
+		return before, entities.Dispute{}, err
+	}
+
+	s.logger.Info("dispute evidence submitted", "disputeID", dispute.ID)
+
+	return before, dispute, nil
+}
+
+// deleteEvidenceFiles removes the files of evidence that could not be submitted
+func (s *Service) deleteEvidenceFiles(files []entities.EvidenceFile) {
+	for _, file := range files {
+		err := s.blobs.Delete(file.Key)
+		if err != nil {
+			s.logger.Error("error deleting evidence file", "key", file.Key, "error", err)
+		}
+	}
+}
+
+// ResolveDispute records the decision of the card issuer. A lost dispute adds a negative
+// chargeback adjustment to the payment and takes the disputed part of the settlement amount
+// from the available funds of the merchant. A dispute decided or answered by another request
+// since it was read returns storage.ErrConflict.
+func (s *Service) ResolveDispute(
+	actor entities.Actor,
+	merchantID, disputeID string,
+	won bool,
+) (entities.Dispute, error) {
+	before, after, err := s.resolveDispute(merchantID, disputeID, won)
+
+	var beforeState, afterState any
+	if before.ID != "" {
+		beforeState = before
+	}
+	if err == nil {
+		afterState = after
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionDisputeResolve,
+		disputeID,
+		beforeState,
+		afterState,
+		err,
+	)
+
+	if err == nil && after.Status == entities.DisputeStatusLost {
+		s.publishChargeback(after)
+	}
+
+	return after, err
+}
+
+func (s *Service) resolveDispute(
+	merchantID, disputeID string,
+	won bool,
+) (entities.Dispute, entities.Dispute, error) {
+	dispute, err := s.storage.GetDispute(merchantID, disputeID)
+	if err != nil {
+		return entities.Dispute{}, entities.Dispute{}, err
+	}
+
+	before := dispute
+
+	if dispute.Closed() {
+		return before, entities.Dispute{}, ErrDisputeClosed
+	}
+
+	dispute.UpdatedTimestamp = now().UnixNano() / int64(time.Millisecond)
+
+	if won {
+		dispute.Status = entities.DisputeStatusWon
+
+		// NOTE: the amount of a won dispute can be disputed again
+		err = s.storage.UpdateDispute(
+			before,
+			dispute,
+			storage.PaymentChange{Disputed: -dispute.Amount.Amount, Open: -1},
+		)
+		if err != nil {
+			if !errors.Is(err, storage.ErrConflict) {
+				s.logger.Error("error updating dispute", "error", err)
+			}
+			return before, entities.Dispute{}, err
+		}
+
+		s.logger.Info("dispute won", "disputeID", dispute.ID)
+
+		return before, dispute, nil
+	}
+
+	dispute.Status = entities.DisputeStatusLost
+
+	adjustment, err := s.chargebackAdjustment(dispute)
+	if err != nil {
+		return before, entities.Dispute{}, err
+	}
+
+	chargeback, err := adjustment.Amount.Negate()
+	if err != nil {
+		return before, entities.Dispute{}, err
+	}
+
+	err = s.storage.UpdateDispute(
+		before,
+		dispute,
+		storage.PaymentChange{Adjustment: &adjustment, Open: -1},
+		entities.NewDisputeJournalEntry(
+			dispute,
+			entities.JournalEntryChargeback,
+			entities.AccountMerchantAvailable,
+			entities.AccountBankClearing,
+			chargeback,
+			dispute.UpdatedTimestamp,
+		),
+	)
+	if err != nil {
+		if !errors.Is(err, storage.ErrConflict) {
+			s.logger.Error("error updating dispute", "error", err)
+		}
+		return before, entities.Dispute{}, err
+	}
+
+	s.logger.Info("dispute lost", "disputeID", dispute.ID, "chargeback", chargeback.MajorUnits())
+
+	return before, dispute, nil
+}
+
+// publishChargeback publishes the payment with the chargeback adjustment of the lost dispute
+func (s *Service) publishChargeback(dispute entities.Dispute) {
+	payment, err := s.storage.GetPayment(dispute.MerchantID, dispute.PaymentID)
+	if err != nil {
+		s.logger.Error("error getting payment", "error", err)
+		return
+	}
+
+	s.publishPaymentEvent(entities.WebhookEventPaymentChargedBack, payment)
+}
+
+// chargebackAdjustment returns the negative adjustment of the payment for the lost dispute, the
+// share of the settlement amount that was disputed is taken from the merchant
+func (s *Service) chargebackAdjustment(dispute entities.Dispute) (entities.Adjustment, error) {
+	payment, err := s.storage.GetPayment(dispute.MerchantID, dispute.PaymentID)
+	if err != nil {
+		s.logger.Error("error getting payment", "error", err)
+		return entities.Adjustment{}, err
+	}
+
+	amount, err := grossAmount(payment).MultiplyRat(
+		big.NewRat(dispute.Amount.Amount, payment.Price.Amount),
+		entities.RoundHalfEven,
+	)
+	if err != nil {
+		return entities.Adjustment{}, err
+	}
+
+	negative, err := amount.Negate()
+	if err != nil {
+		return entities.Adjustment{}, err
+	}
+
+	return entities.Adjustment{
+		ID:        entities.AdjustmentChargeback + "_" + dispute.ID,
+		Type:      entities.AdjustmentChargeback,
+		DisputeID: dispute.ID,
+		Amount:    negative,
+		Timestamp: dispute.UpdatedTimestamp,
+	}, nil
+}
+
+// ListDisputes returns the disputes of the merchant, the latest first, only those with the
+// status when it is not empty
+func (s *Service) ListDisputes(merchantID, status string) ([]entities.Dispute, error) {
+	disputes, err := s.storage.ListDisputes(merchantID)
+	if err != nil {
+		s.logger.Error("error listing disputes", "error", err)
+		return nil, err
+	}
+
+	if status == "" {
+		return disputes, nil
+	}
+
+	return slices.DeleteFunc(disputes, func(dispute entities.Dispute) bool {
+		return dispute.Status != status
+	}), nil
+}
+
+func (s *Service) GetDispute(merchantID, disputeID string) (entities.Dispute, error) {
+	return s.storage.GetDispute(merchantID, disputeID)
+}
+
+// GetEvidenceFile returns the evidence file of the dispute with its content, which has to be
+// closed by the caller
+func (s *Service) GetEvidenceFile(
+	merchantID, disputeID, fileID string,
+) (entities.EvidenceFile, io.ReadCloser, error) {
+	dispute, err := s.storage.GetDispute(merchantID, disputeID)
+	if err != nil {
+		return entities.EvidenceFile{}, nil, err
+	}
+
+	if dispute.Evidence == nil {
+		return entities.EvidenceFile{}, nil, storage.ErrNotFound
+	}
+
+	index := slices.IndexFunc(dispute.Evidence.Files, func(file entities.EvidenceFile) bool {
+		return file.ID == fileID
+	})
+	if index < 0 {
+		return entities.EvidenceFile{}, nil, storage.ErrNotFound
+	}
+
+	file := dispute.Evidence.Files[index]
+
+	content, err := s.blobs.Get(file.Key)
+	if err != nil {
+		s.logger.Error("error getting evidence file", "key", file.Key, "error", err)
+		return entities.EvidenceFile{}, nil, err
+	}
+
+	return file, content, nil
+}
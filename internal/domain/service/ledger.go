@@ -0,0 +1,194 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+)
+
+var ErrPaymentRefunded = errors.New("payment was already refunded")
+
+// GetBalance returns the available and pending funds the platform owes the merchant
+func (s *Service) GetBalance(merchantID string) (entities.Balance, error) {
+	balances, err := s.storage.GetAccountBalances(merchantID)
+	if err != nil {
+		s.logger.Error("error getting account balances", "error", err)
+		return entities.Balance{}, err
+	}
+
+	balance := entities.Balance{
+		Available: []entities.Money{},
+		Pending:   []entities.Money{},
+	}
+
+	for _, account := range balances {
+		// NOTE: the merchant accounts are liabilities of the platform so their credit balance
+		// is what the merchant is owed
+		owed := entities.Money{Amount: -account.Balance.Amount, Currency: account.Balance.Currency}
+
+		switch account.Account {
+		case entities.AccountMerchantAvailable:
+			balance.Available = append(balance.Available, owed)
+		case entities.AccountMerchantPending:
+			balance.Pending = append(balance.Pending, owed)
+		}
+	}
+
+	byCurrency := func(a, b entities.Money) int {
+		return strings.Compare(a.Currency, b.Currency)
+	}
+
+	slices.SortFunc(balance.Available, byCurrency)
+	slices.SortFunc(balance.Pending, byCurrency)
+
+	return balance, nil
+}
+
+// chargeEntries owe the merchant the settlement amount of a captured payment, pending until it
+// is released, less the platform fee
+func chargeEntries(payment entities.Payment) []entities.JournalEntry {
+	entries := []entities.JournalEntry{
+		entities.NewJournalEntry(
+			payment,
+			entities.JournalEntryCharge,
+			entities.AccountBankClearing,
+			entities.AccountMerchantPending,
+			grossAmount(payment),
+			payment.Timestamp,
+		),
+	}
+
+	if payment.Fees.Fee.IsPositive() {
+		entries = append(entries, entities.NewJournalEntry(
+			payment,
+			entities.JournalEntryFee,
+			entities.AccountMerchantPending,
+			entities.AccountPlatformFees,
+			payment.Fees.Fee,
+			payment.Timestamp,
+		))
+	}
+
+	return entries
+}
+
+// refundEntries take the refunded settlement amount from the merchant account that holds the
+// funds of the payment and return the part of the fee given back by the refund policy. Funds of
+// a payment that was not released yet are taken from the pending funds and what remains of them,
+// the retained fee and the charged back amount already taken from the available funds, is
+// released together with the refund so that nothing stays pending.
+func refundEntries(payment entities.Payment, released bool) []entities.JournalEntry {
+	account := entities.AccountMerchantAvailable
+	if !released {
+		account = entities.AccountMerchantPending
+	}
+
+	gross := grossAmount(payment)
+	refunded := refundedAmount(payment)
+
+	entries := []entities.JournalEntry{
+		entities.NewJournalEntry(
+			payment,
+			entities.JournalEntryRefund,
+			account,
+			entities.AccountBankClearing,
+			refunded,
+			payment.RefundTimestamp,
+		),
+	}
+
+	if payment.Fees.RefundedFee.IsPositive() {
+		entries = append(entries, entities.NewJournalEntry(
+			payment,
+			entities.JournalEntryFeeRefund,
+			entities.AccountPlatformFees,
+			account,
+			payment.Fees.RefundedFee,
+			payment.RefundTimestamp,
+		))
+	}
+
+	if !released {
+		entries = append(entries, entities.NewReleaseJournalEntry(
+			payment.Merchant.ID,
+			payment.ID,
+			entities.Money{
+				Amount: payment.Fees.RefundedFee.Amount - payment.Fees.Fee.Amount +
+					gross.Amount - refunded.Amount,
+				Currency: gross.Currency,
+			},
+			payment.RefundTimestamp,
+		))
+	}
+
+	return entries
+}
+
+// postRefundEntries posts the refund entries of a payment whose refund was claimed.
+//
+// NOTE: the release entry of an unreleased payment has the ID of the one posted by releaseFunds,
+// a payment released meanwhile fails the entries with ErrConflict and they are posted again
+// against the available funds
+func (s *Service) postRefundEntries(payment entities.Payment) error {
+	released, err := s.paymentReleased(payment.Merchant.ID, payment.ID)
+	if err != nil {
+		return err
+	}
+
+	err = s.storage.PostJournalEntries(refundEntries(payment, released)...)
+	if !errors.Is(err, storage.ErrConflict) || released {
+		return err
+	}
+
+	released, err = s.paymentReleased(payment.Merchant.ID, payment.ID)
+	if err != nil {
+		return err
+	}
+
+	if !released {
+		return storage.ErrConflict
+	}
+
+	return s.storage.PostJournalEntries(refundEntries(payment, released)...)
+}
+
+// paymentReleased reports whether the pending funds of the payment were released
+func (s *Service) paymentReleased(merchantID, paymentID string) (bool, error) {
+	_, err := s.storage.GetJournalEntry(merchantID, entities.ReleaseJournalEntryID(paymentID))
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// refundedAmount is the part of the settlement amount returned by the refund, the chargebacks of
+// lost disputes were already taken from the merchant
+func refundedAmount(payment entities.Payment) entities.Money {
+	refunded := grossAmount(payment)
+	for _, adjustment := range payment.Adjustments {
+		refunded.Amount += adjustment.Amount.Amount
+	}
+
+	return refunded
+}
+
+// grossAmount is the amount settled for the payment, payments created before settlement amounts
+// and fees were stored settle their price
+func grossAmount(payment entities.Payment) entities.Money {
+	switch {
+	case payment.Fees.Gross.Currency != "":
+		return payment.Fees.Gross
+	case payment.Settlement.Currency != "":
+		return payment.Settlement
+	default:
+		return payment.Price
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+)
+
+type LimitExceededError struct {
+	Limit string
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("merchant limit exceeded: %s", e.Limit)
+}
+
+type counterReservation struct {
+	counter   string
+	delta     int64
+	expiresAt int64
+}
+
+// reservePaymentLimits checks the payment against the merchant limits and adds it to the
+// running volume counters. The returned function gives the reserved volume back and has to
+// be called when the payment does not go through.
+func (s *Service) reservePaymentLimits(
+	merchant entities.Merchant,
+	price entities.Money,
+) (func(), error) {
+	limits := merchant.Limits
+
+	if limit := limits.MaxPaymentAmount[price.Currency]; limit > 0 && price.Amount > limit {
+		return nil, &LimitExceededError{Limit: entities.LimitMaxPaymentAmount}
+	}
+
+	t := now().UTC()
+	day := t.Truncate(24 * time.Hour)
+	month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	var reserved []counterReservation
+
+	release := func() {
+		for _, reservation := range reserved {
+			_, err := s.storage.IncrementCounter(
+				merchant.ID,
+				reservation.counter,
+				-reservation.delta,
+				reservation.expiresAt,
+			)
+			if err != nil {
+				s.logger.Error("error releasing merchant limit", "error", err)
+			}
+		}
+	}
+
+	checks := []struct {
+		name      string
+		limit     int64
+		counter   string
+		expiresAt int64
+	}{
+		{
+			name:      entities.LimitDailyVolume,
+			limit:     limits.DailyVolume[price.Currency],
+			counter:   counterName(entities.LimitDailyVolume, price.Currency, day.Format(time.DateOnly)),
+			expiresAt: day.AddDate(0, 0, 2).Unix(),
+		},
+		{
+			name:      entities.LimitMonthlyVolume,
+			limit:     limits.MonthlyVolume[price.Currency],
+			counter:   counterName(entities.LimitMonthlyVolume, price.Currency, month.Format("2006-01")),
+			expiresAt: month.AddDate(0, 2, 0).Unix(),
+		},
+	}
+
+	for _, check := range checks {
+		if check.limit <= 0 {
+			continue
+		}
+
+		value, err := s.storage.IncrementCounter(
+			merchant.ID,
+			check.counter,
+			price.Amount,
+			check.expiresAt,
+		)
+		if err != nil {
+			release()
+			return nil, err
+		}
+
+		reserved = append(reserved, counterReservation{
+			counter:   check.counter,
+			delta:     price.Amount,
+			expiresAt: check.expiresAt,
+		})
+
+		if value > check.limit {
+			release()
+			return nil, &LimitExceededError{Limit: check.name}
+		}
+	}
+
+	return release, nil
+}
+
+// reserveRefundLimits counts the refund against the merchant's daily refund limit, the returned
+// function gives the reserved refund back
+func (s *Service) reserveRefundLimits(merchant entities.Merchant) (func(), error) {
+	limit := merchant.Limits.MaxRefundsPerDay
+	if limit <= 0 {
+		return func() {}, nil
+	}
+
+	day := now().UTC().Truncate(24 * time.Hour)
+	counter := counterName(entities.LimitMaxRefundsPerDay, day.Format(time.DateOnly))
+	expiresAt := day.AddDate(0, 0, 2).Unix()
+
+	release := func() {
+		_, err := s.storage.IncrementCounter(merchant.ID, counter, -1, expiresAt)
+		if err != nil {
+			s.logger.Error("error releasing merchant limit", "error", err)
+		}
+	}
+
+	value, err := s.storage.IncrementCounter(merchant.ID, counter, 1, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if value > limit {
+		release()
+		return nil, &LimitExceededError{Limit: entities.LimitMaxRefundsPerDay}
+	}
+
+	return release, nil
+}
+
+func counterName(parts ...string) string {
+	return strings.Join(parts, "#")
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+)
+
+var ErrMerchantInactive = errors.New("merchant does not exist or is deactivated")
+
+// CreateMerchant onboards a new merchant, an ID is generated when the merchant has none.
+// Account details failing validation return entities.ErrInvalidAccountDetails, an invalid
+// pricing plan entities.ErrInvalidPricingPlan and storage.ErrConflict is returned when the ID is
+// already taken.
+func (s *Service) CreateMerchant(
+	actor entities.Actor,
+	merchant entities.Merchant,
+) (entities.Merchant, error) {
+	if merchant.ID == "" {
+		merchant.ID = newUUID().String()
+	}
+
+	merchant.AccountDetails = merchant.AccountDetails.Normalize()
+
+	err := merchant.AccountDetails.Validate()
+	if err != nil {
+		return entities.Merchant{}, err
+	}
+
+	err = merchant.PricingPlan.Validate()
+	if err != nil {
+		return entities.Merchant{}, err
+	}
+
+	merchant.Deactivated = false
+	merchant.DeactivatedTimestamp = 0
+	merchant.Timestamp = now().UnixNano() / int64(time.Millisecond)
+
+	err = s.storage.CreateMerchant(merchant)
+	if err != nil && !errors.Is(err, storage.ErrConflict) {
+		s.logger.Error("error creating merchant", "error", err)
+	}
+
+	var after any
+	if err == nil {
+		after = merchant
+		s.logger.Info("merchant created", "merchantID", merchant.ID)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchant.ID,
+		entities.AuditActionMerchantCreate,
+		merchant.ID,
+		nil,
+		after,
+		err,
+	)
+
+	if err != nil {
+		return entities.Merchant{}, err
+	}
+
+	return merchant, nil
+}
+
+func (s *Service) GetMerchant(merchantID string) (entities.Merchant, error) {
+	merchant, err := s.storage.GetMerchantDetails(merchantID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Error("error getting merchant details", "error", err)
+		}
+		return entities.Merchant{}, err
+	}
+
+	return merchant, nil
+}
+
+// UpdateMerchant replaces the account details, limits and pricing plan of the merchant, they are
+// validated as in CreateMerchant. Payments already captured keep the fees of the previous plan.
+func (s *Service) UpdateMerchant(
+	actor entities.Actor,
+	merchantID string,
+	accountDetails entities.AccountDetails,
+	limits entities.Limits,
+	pricingPlan entities.PricingPlan,
+) (entities.Merchant, error) {
+	accountDetails = accountDetails.Normalize()
+
+	err := accountDetails.Validate()
+	if err != nil {
+		return entities.Merchant{}, err
+	}
+
+	err = pricingPlan.Validate()
+	if err != nil {
+		return entities.Merchant{}, err
+	}
+
+	return s.changeMerchant(
+		actor,
+		merchantID,
+		entities.AuditActionMerchantUpdate,
+		func(merchant *entities.Merchant) {
+			merchant.AccountDetails = accountDetails
+			merchant.Limits = limits
+			merchant.PricingPlan = pricingPlan
+		},
+	)
+}
+
+// DeactivateMerchant stops the merchant from accepting new payments, deactivating a merchant
+// twice keeps the original deactivation time
+func (s *Service) DeactivateMerchant(
+	actor entities.Actor,
+	merchantID string,
+) (entities.Merchant, error) {
+	return s.changeMerchant(
+		actor,
+		merchantID,
+		entities.AuditActionMerchantDeactivate,
+		func(merchant *entities.Merchant) {
+			if merchant.Deactivated {
+				return
+			}
+
+			merchant.Deactivated = true
+			merchant.DeactivatedTimestamp = now().UnixNano() / int64(time.Millisecond)
+		},
+	)
+}
+
+// changeMerchant applies change to the stored merchant and records it as action,
+// storage.ErrConflict is returned when the merchant was changed concurrently
+func (s *Service) changeMerchant(
+	actor entities.Actor,
+	merchantID, action string,
+	change func(merchant *entities.Merchant),
+) (entities.Merchant, error) {
+	before, err := s.GetMerchant(merchantID)
+	if err != nil {
+		// NOTE: there is no chain to record changes of unknown merchants in
+		return entities.Merchant{}, err
+	}
+
+	merchant := before
+	change(&merchant)
+	merchant.UpdatedTimestamp = now().UnixNano() / int64(time.Millisecond)
+
+	err = s.storage.UpdateMerchant(before, merchant)
+	if err != nil && !errors.Is(err, storage.ErrConflict) {
+		s.logger.Error("error updating merchant", "error", err)
+	}
+
+	var after any
+	if err == nil {
+		after = merchant
+		s.logger.Info("merchant updated", "merchantID", merchant.ID, "action", action)
+	}
+
+	s.recordAuditEvent(actor, merchantID, action, merchantID, before, after, err)
+
+	if err != nil {
+		return entities.Merchant{}, err
+	}
+
+	return merchant, nil
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+)
+
+// releaseBatchSize NOTE: every release entry takes one item of the DynamoDB transaction, which
+// is limited to 100 items together with the balance updates
+const releaseBatchSize = 25
+
+// PayoutOptions control a payout run
+type PayoutOptions struct {
+	// SettlementDelay is how long the funds of captured payments stay pending
+	SettlementDelay time.Duration
+	// Transfer sends pending payouts through the bank client and checks the transfers in
+	// transit, otherwise payouts are left to be exported in SEPA credit transfer files
+	Transfer bool
+}
+
+// ProcessPayouts releases the pending funds of payments captured more than the settlement delay
+// ago, batches the available balances of every merchant into payouts and sends them to the bank.
+// Processing continues with the next merchant when one fails, the errors are returned joined.
+//
+// NOTE: concurrent runs are safe, a payout is only created while the available balance still
+// covers it and transfers are idempotent by payout ID
+func (s *Service) ProcessPayouts(actor entities.Actor, options PayoutOptions) error {
+	merchants, err := s.storage.ListMerchants()
+	if err != nil {
+		s.logger.Error("error listing merchants", "error", err)
+		return err
+	}
+
+	var errs []error
+
+	for _, merchant := range merchants {
+		err := s.processMerchantPayouts(actor, merchant, options)
+		if err != nil {
+			s.logger.Error(
+				"error processing merchant payouts",
+				"merchantID", merchant.ID,
+				"error", err,
+			)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) processMerchantPayouts(
+	actor entities.Actor,
+	merchant entities.Merchant,
+	options PayoutOptions,
+) error {
+	err := s.releaseFunds(merchant.ID, options.SettlementDelay)
+	if err != nil {
+		return err
+	}
+
+	err = s.createPayouts(actor, merchant)
+	if err != nil {
+		return err
+	}
+
+	if !options.Transfer {
+		return nil
+	}
+
+	payouts, err := s.storage.ListPayouts(merchant.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, payout := range payouts {
+		switch payout.Status {
+		case entities.PayoutStatusPending:
+			err = s.transferPayout(actor, payout)
+		case entities.PayoutStatusInTransit:
+			err = s.checkPayout(actor, payout)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseFunds moves what is still pending for payments captured before the settlement delay
+// to the available balance of the merchant
+func (s *Service) releaseFunds(merchantID string, settlementDelay time.Duration) error {
+	entries, err := s.storage.ListJournalEntries(merchantID)
+	if err != nil {
+		return err
+	}
+
+	timestamp := now().UnixNano() / int64(time.Millisecond)
+	cutoff := now().Add(-settlementDelay).UnixNano() / int64(time.Millisecond)
+
+	var captured []entities.JournalEntry
+	released := make(map[string]bool)
+	pending := make(map[string]entities.Money)
+
+	for _, entry := range entries {
+		if entry.PaymentID == "" {
+			continue
+		}
+
+		switch entry.Type {
+		case entities.JournalEntryCharge:
+			captured = append(captured, entry)
+		case entities.JournalEntryRelease:
+			released[entry.PaymentID] = true
+		}
+
+		for _, posting := range entry.Postings {
+			if posting.Account != entities.AccountMerchantPending {
+				continue
+			}
+
+			owed := pending[entry.PaymentID]
+			owed.Amount -= posting.Amount.Amount
+			owed.Currency = posting.Amount.Currency
+			pending[entry.PaymentID] = owed
+		}
+	}
+
+	var releases []entities.JournalEntry
+
+	for _, charge := range captured {
+		owed := pending[charge.PaymentID]
+
+		if released[charge.PaymentID] || charge.Timestamp > cutoff || !owed.IsPositive() {
+			continue
+		}
+
+		releases = append(
+			releases,
+			entities.NewReleaseJournalEntry(merchantID, charge.PaymentID, owed, timestamp),
+		)
+	}
+
+	for batch := range slices.Chunk(releases, releaseBatchSize) {
+		err = s.storage.PostJournalEntries(batch...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(releases) > 0 {
+		s.logger.Info("funds released", "merchantID", merchantID, "payments", len(releases))
+	}
+
+	return nil
+}
+
+// createPayouts batches the available balance of the merchant in every currency into a payout,
+// the balance is taken from the merchant together with creating the payout
+func (s *Service) createPayouts(actor entities.Actor, merchant entities.Merchant) error {
+	balance, err := s.GetBalance(merchant.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, available := range balance.Available {
+		if !available.IsPositive() {
+			continue
+		}
+
+		if merchant.AccountDetails.IBAN == "" {
+			s.logger.Warn("merchant has no account to pay out to", "merchantID", merchant.ID)
+			return nil
+		}
+
+		timestamp := now().UnixNano() / int64(time.Millisecond)
+
+		payout := entities.Payout{
+			ID:               newUUID().String(),
+			MerchantID:       merchant.ID,
+			Amount:           available,
+			Status:           entities.PayoutStatusPending,
+			Destination:      merchant.AccountDetails,
+			Timestamp:        timestamp,
+			UpdatedTimestamp: timestamp,
+		}
+
+		err = s.storage.CreatePayout(payout, entities.NewPayoutJournalEntry(
+			payout,
+			entities.JournalEntryPayout,
+			entities.AccountMerchantAvailable,
+			entities.AccountBankClearing,
+			payout.Amount,
+			timestamp,
+		))
+		if errors.Is(err, storage.ErrConflict) {
+			s.logger.Info(
+				"available balance was paid out by another run",
+				"merchantID", merchant.ID,
+				"currency", available.Currency,
+			)
+			continue
+		}
+
+		var after any
+		if err == nil {
+			after = payout
+		}
+
+		s.recordAuditEvent(
+			actor,
+			merchant.ID,
+			entities.AuditActionPayoutCreate,
+			payout.ID,
+			nil,
+			after,
+			err,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		s.logger.Info("payout created", "payoutID", payout.ID, "merchantID", merchant.ID)
+	}
+
+	return nil
+}
+
+// transferPayout asks the bank to transfer a pending payout, payouts the bank refuses fail. The
+// payout ID is the idempotency key of the transfer so that a payout left pending after its
+// transfer is not transferred again.
+func (s *Service) transferPayout(actor entities.Actor, payout entities.Payout) error {
+	transferID, err := s.bankClient.TransferFunds(payout.ID, payout.Destination, payout.Amount)
+	if err != nil {
+		s.logger.Error("error transferring payout", "payoutID", payout.ID, "error", err)
+		return s.failPayout(actor, payout, err.Error())
+	}
+
+	updated := payout
+	updated.Status = entities.PayoutStatusInTransit
+	updated.BankTransferID = transferID
+
+	return s.updatePayout(actor, payout, updated)
+}
+
+// checkPayout settles a payout in transit once the bank reports the transfer paid or failed
+func (s *Service) checkPayout(actor entities.Actor, payout entities.Payout) error {
+	status, err := s.bankClient.GetTransferStatus(payout.BankTransferID)
+	if err != nil {
+		s.logger.Error("error getting transfer status", "payoutID", payout.ID, "error", err)
+		return err
+	}
+
+	switch status {
+	case entities.PayoutStatusPaid:
+		updated := payout
+		updated.Status = entities.PayoutStatusPaid
+
+		return s.updatePayout(actor, payout, updated)
+	case entities.PayoutStatusFailed:
+		return s.failPayout(actor, payout, "transfer was rejected by the bank")
+	}
+
+	return nil
+}
+
+// failPayout returns the amount of the payout to the available balance of the merchant
+func (s *Service) failPayout(actor entities.Actor, payout entities.Payout, reason string) error {
+	updated := payout
+	updated.Status = entities.PayoutStatusFailed
+	updated.FailureReason = reason
+
+	return s.updatePayout(actor, payout, updated, entities.NewPayoutJournalEntry(
+		updated,
+		entities.JournalEntryPayoutFailure,
+		entities.AccountBankClearing,
+		entities.AccountMerchantAvailable,
+		payout.Amount,
+		now().UnixNano()/int64(time.Millisecond),
+	))
+}
+
+func (s *Service) updatePayout(
+	actor entities.Actor,
+	before, after entities.Payout,
+	entries ...entities.JournalEntry,
+) error {
+	after.UpdatedTimestamp = now().UnixNano() / int64(time.Millisecond)
+
+	err := s.storage.UpdatePayout(after, entries...)
+	if err != nil {
+		s.logger.Error("error updating payout", "payoutID", after.ID, "error", err)
+	}
+
+	var afterState any
+	if err == nil {
+		afterState = after
+		s.logger.Info("payout updated", "payoutID", after.ID, "status", after.Status)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		after.MerchantID,
+		entities.AuditActionPayoutUpdate,
+		after.ID,
+		before,
+		afterState,
+		err,
+	)
+
+	return err
+}
+
+// ListPayouts returns the payouts of the merchant, the latest first, with the given status only
+// when one is given
+func (s *Service) ListPayouts(merchantID, status string) ([]entities.Payout, error) {
+	payouts, err := s.storage.ListPayouts(merchantID)
+	if err != nil {
+		s.logger.Error("error listing payouts", "error", err)
+		return nil, err
+	}
+
+	if status != "" {
+		payouts = slices.DeleteFunc(payouts, func(payout entities.Payout) bool {
+			return payout.Status != status
+		})
+	}
+
+	return payouts, nil
+}
+
+// GetPayout returns storage.ErrNotFound when the merchant has no such payout
+func (s *Service) GetPayout(merchantID, payoutID string) (entities.Payout, error) {
+	payout, err := s.storage.GetPayout(merchantID, payoutID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Error("error getting payout", "error", err)
+		}
+		return entities.Payout{}, err
+	}
+
+	return payout, nil
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/blobstore"
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/sepa"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+)
+
+var ErrNoPayoutsToExport = errors.New("there are no pending payouts to export")
+
+// SEPAExport is a pain.001 credit transfer file of pending payouts
+type SEPAExport struct {
+	MessageID string
+	Document  []byte
+	Payouts   []entities.Payout
+}
+
+// SEPAStatusResult counts the payouts settled by a pain.002 status report, Unmatched lists the
+// end to end IDs of reported transactions that are not payouts in transit
+type SEPAStatusResult struct {
+	Paid      int
+	Failed    int
+	Unmatched []string
+}
+
+// ExportSEPAPayouts batches the pending EUR payouts of all merchants into a pain.001 credit
+// transfer from the debtor account, executed on executionDate. The exported payouts are in
+// transit from then on, referenced by the message ID and their end to end ID. Payouts whose
+// account details cannot be used in a SEPA transfer are left pending.
+//
+// NOTE: the document is stored under the message ID before any payout is marked in transit so
+// that it can be downloaded again with GetSEPAExport, payouts marked before an error are put
+// back to pending and the document is discarded when all of them were reverted
+func (s *Service) ExportSEPAPayouts(
+	actor entities.Actor,
+	debtor sepa.Party,
+	initiatingParty string,
+	executionDate time.Time,
+) (SEPAExport, error) {
+	merchants, err := s.storage.ListMerchants()
+	if err != nil {
+		s.logger.Error("error listing merchants", "error", err)
+		return SEPAExport{}, err
+	}
+
+	transfer := sepa.CreditTransfer{
+		MessageID:       sepaReference(newUUID().String()),
+		CreationTime:    now(),
+		InitiatingParty: initiatingParty,
+		ExecutionDate:   executionDate,
+		Debtor:          debtor,
+	}
+
+	var payouts []entities.Payout
+
+	for _, merchant := range merchants {
+		pending, err := s.ListPayouts(merchant.ID, entities.PayoutStatusPending)
+		if err != nil {
+			return SEPAExport{}, err
+		}
+
+		for _, payout := range pending {
+			if payout.Amount.Currency != sepa.Currency {
+				continue
+			}
+
+			transaction := sepa.Transaction{
+				EndToEndID: sepaReference(payout.ID),
+				Amount:     payout.Amount.Amount,
+				Creditor: sepa.Party{
+					Name: sepa.Text(payout.Destination.Name, sepa.MaxNameLength),
+					IBAN: payout.Destination.IBAN,
+					BIC:  payout.Destination.BIC,
+				},
+				RemittanceInformation: "Payout " + payout.ID,
+			}
+
+			err = transaction.Validate()
+			if err != nil {
+				s.logger.Warn("payout cannot be exported", "payoutID", payout.ID, "error", err)
+				continue
+			}
+
+			transfer.Transactions = append(transfer.Transactions, transaction)
+			payouts = append(payouts, payout)
+		}
+	}
+
+	if len(payouts) == 0 {
+		return SEPAExport{}, ErrNoPayoutsToExport
+	}
+
+	document, err := sepa.Generate(transfer)
+	if err != nil {
+		s.logger.Error("error generating credit transfer", "error", err)
+		return SEPAExport{}, err
+	}
+
+	_, err = s.blobs.Put(sepaExportKey(transfer.MessageID), bytes.NewReader(document))
+	if err != nil {
+		s.logger.Error("error storing credit transfer", "error", err)
+		return SEPAExport{}, err
+	}
+
+	export := SEPAExport{MessageID: transfer.MessageID, Document: document}
+
+	for i, payout := range payouts {
+		updated := payout
+		updated.Status = entities.PayoutStatusInTransit
+		updated.BankTransferID = transfer.MessageID + "/" + transfer.Transactions[i].EndToEndID
+
+		err = s.updatePayout(actor, payout, updated)
+		if err != nil {
+			s.revertSEPAExport(actor, transfer.MessageID, payouts[:i], export.Payouts)
+			return SEPAExport{}, err
+		}
+
+		export.Payouts = append(export.Payouts, updated)
+	}
+
+	s.logger.Info(
+		"payouts exported",
+		"messageID", export.MessageID,
+		"payouts", len(export.Payouts),
+	)
+
+	return export, nil
+}
+
+// revertSEPAExport puts the payouts marked in transit by an export that failed back to pending,
+// the stored document is kept when a payout could not be reverted as it is in transit with it
+func (s *Service) revertSEPAExport(
+	actor entities.Actor,
+	messageID string,
+	pending, inTransit []entities.Payout,
+) {
+	reverted := true
+
+	for i, payout := range inTransit {
+		err := s.updatePayout(actor, payout, pending[i])
+		if err != nil {
+			reverted = false
+		}
+	}
+
+	if !reverted {
+		s.logger.Error("exported payouts could not be reverted", "messageID", messageID)
+		return
+	}
+
+	err := s.blobs.Delete(sepaExportKey(messageID))
+	if err != nil {
+		s.logger.Error("error deleting credit transfer", "messageID", messageID, "error", err)
+	}
+}
+
+// GetSEPAExport returns the pain.001 document of an earlier export by its message ID
+func (s *Service) GetSEPAExport(messageID string) ([]byte, error) {
+	// NOTE: message IDs are alphanumeric, anything else could address other blobs
+	if messageID == "" || strings.ContainsFunc(messageID, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9')
+	}) {
+		return nil, storage.ErrNotFound
+	}
+
+	content, err := s.blobs.Get(sepaExportKey(messageID))
+	if err != nil {
+		if errors.Is(err, blobstore.ErrNotFound) {
+			return nil, storage.ErrNotFound
+		}
+
+		s.logger.Error("error getting credit transfer", "messageID", messageID, "error", err)
+		return nil, err
+	}
+	defer content.Close()
+
+	return io.ReadAll(content)
+}
+
+// ApplySEPAStatusReport settles the payouts in transit of the credit transfer the pain.002 report
+// is about, payouts whose transfer was completed are paid and rejected payouts fail
+func (s *Service) ApplySEPAStatusReport(
+	actor entities.Actor,
+	report sepa.StatusReport,
+) (SEPAStatusResult, error) {
+	merchants, err := s.storage.ListMerchants()
+	if err != nil {
+		s.logger.Error("error listing merchants", "error", err)
+		return SEPAStatusResult{}, err
+	}
+
+	result := SEPAStatusResult{Unmatched: []string{}}
+	matched := make(map[string]bool)
+	prefix := report.OriginalMessageID + "/"
+
+	for _, merchant := range merchants {
+		inTransit, err := s.ListPayouts(merchant.ID, entities.PayoutStatusInTransit)
+		if err != nil {
+			return result, err
+		}
+
+		for _, payout := range inTransit {
+			endToEndID, ok := strings.CutPrefix(payout.BankTransferID, prefix)
+			if !ok {
+				continue
+			}
+
+			status, ok := report.TransactionStatus(endToEndID)
+			if !ok {
+				continue
+			}
+
+			matched[endToEndID] = true
+
+			switch status.Status {
+			case sepa.StatusAcceptedSettlementCompleted:
+				updated := payout
+				updated.Status = entities.PayoutStatusPaid
+
+				err = s.updatePayout(actor, payout, updated)
+				if err != nil {
+					return result, err
+				}
+
+				result.Paid++
+			case sepa.StatusRejected:
+				reason := "transfer was rejected by the bank"
+				if status.Reason != "" {
+					reason += ": " + status.Reason
+				}
+
+				err = s.failPayout(actor, payout, reason)
+				if err != nil {
+					return result, err
+				}
+
+				result.Failed++
+			}
+		}
+	}
+
+	for _, transaction := range report.Transactions {
+		if !matched[transaction.EndToEndID] {
+			result.Unmatched = append(result.Unmatched, transaction.EndToEndID)
+		}
+	}
+
+	s.logger.Info(
+		"status report applied",
+		"originalMessageID", report.OriginalMessageID,
+		"paid", result.Paid,
+		"failed", result.Failed,
+		"unmatched", len(result.Unmatched),
+	)
+
+	return result, nil
+}
+
+// sepaExportKey is the blob key of the exported document
+func sepaExportKey(messageID string) string {
+	return "sepa-exports/" + messageID + ".xml"
+}
+
+// sepaReference NOTE: IDs are UUIDs, which are one character too long for a SEPA reference with
+// their hyphens
+func sepaReference(id string) string {
+	return strings.ReplaceAll(id, "-", "")
+}
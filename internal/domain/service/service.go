@@ -1,13 +1,20 @@
 package service
 
 import (
+	"errors"
 	"log/slog"
+	"math/big"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mgajewskik/payment-platform/internal/blobstore"
 	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/domain/fx"
+	"github.com/mgajewskik/payment-platform/internal/domain/risk"
 	"github.com/mgajewskik/payment-platform/internal/domain/simulator"
 	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/webhook"
 )
 
 var (
@@ -15,45 +22,192 @@ var (
 	newUUID = uuid.New
 )
 
+var (
+	ErrPaymentBlocked       = errors.New("payment was blocked by risk assessment")
+	ErrUnknownPaymentMethod = errors.New("payment method of the customer does not exist")
+)
+
 type Service struct {
-	storage    storage.DBRepository
-	bankClient simulator.BankClient
-	logger     *slog.Logger
+	storage        storage.DBRepository
+	bankClient     simulator.BankClient
+	risk           risk.Assessor
+	fx             fx.Converter
+	blobs          blobstore.Store
+	webhooks       webhook.Sender
+	revocations    *revocationCache
+	keyRevocations *revocationCache
+	logger         *slog.Logger
+
+	// auditMu serialises appending to the audit chains of this instance
+	auditMu sync.Mutex
 }
 
 func NewService(
 	storage storage.DBRepository,
 	bankClient simulator.BankClient,
+	risk risk.Assessor,
+	fx fx.Converter,
+	blobs blobstore.Store,
+	webhooks webhook.Sender,
 	logger *slog.Logger,
 ) *Service {
 	return &Service{
-		storage:    storage,
-		bankClient: bankClient,
-		logger:     logger,
+		storage:        storage,
+		bankClient:     bankClient,
+		risk:           risk,
+		fx:             fx,
+		blobs:          blobs,
+		webhooks:       webhooks,
+		revocations:    newRevocationCache(),
+		keyRevocations: newRevocationCache(),
+		logger:         logger,
 	}
 }
 
-func (s *Service) CreateNewPayment(payment entities.Payment) (string, error) {
-	err := s.bankClient.ValidateCardInformation(payment.Customer.CardDetails)
+func (s *Service) CreateNewPayment(actor entities.Actor, payment entities.Payment) (string, error) {
+	created, err := s.createNewPayment(payment)
+
+	var after any
+	if err == nil {
+		after = entities.NewPaymentDetailsFromPayment(created)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		payment.Merchant.ID,
+		entities.AuditActionPaymentCreate,
+		created.ID,
+		nil,
+		after,
+		err,
+	)
+
+	if err == nil {
+		s.publishPaymentEvent(entities.WebhookEventPaymentCreated, created)
+	}
+
+	return created.ID, err
+}
+
+func (s *Service) createNewPayment(payment entities.Payment) (entities.Payment, error) {
+	err := payment.Price.Validate()
 	if err != nil {
-		s.logger.Error("error validating card information", "error", err)
-		return "", err
+		s.logger.Error("error validating payment price", "error", err)
+		return entities.Payment{}, err
 	}
 
 	merchant, err := s.storage.GetMerchantDetails(payment.Merchant.ID)
 	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return entities.Payment{}, ErrMerchantInactive
+		}
+
 		s.logger.Error("error getting merchant details", "error", err)
-		return "", err
+		return entities.Payment{}, err
+	}
+
+	if merchant.Deactivated {
+		s.logger.Warn("payment rejected for deactivated merchant", "merchantID", merchant.ID)
+		return entities.Payment{}, ErrMerchantInactive
+	}
+
+	card := payment.Customer.CardDetails
+
+	if payment.PaymentMethodID != "" {
+		method, err := s.storage.GetPaymentMethod(
+			payment.Merchant.ID,
+			payment.Customer.ID,
+			payment.PaymentMethodID,
+		)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return entities.Payment{}, ErrUnknownPaymentMethod
+			}
+
+			s.logger.Error("error getting payment method", "error", err)
+			return entities.Payment{}, err
+		}
+
+		card, err = s.bankClient.ResolveCardToken(method.CardToken)
+		if err != nil {
+			s.logger.Error("error resolving card token", "error", err)
+			return entities.Payment{}, err
+		}
+
+		// NOTE: the card resolved from the token is only used to charge it, the payment keeps
+		// the details of the card the payment method shows
+		payment.Customer.CardDetails = entities.CardDetails{ExpirationDate: card.ExpirationDate}
+	}
+
+	payment.CardLast4 = card.Last4()
+	payment.CardBrand = card.Brand()
+
+	err = s.bankClient.ValidateCardInformation(card)
+	if err != nil {
+		s.logger.Error("error validating card information", "error", err)
+		return entities.Payment{}, err
+	}
+
+	assessed := payment
+	assessed.Customer.CardDetails = card
+	payment.Risk = s.risk.Assess(assessed)
+
+	switch payment.Risk.Decision {
+	case entities.RiskDecisionBlock:
+		s.logger.Warn(
+			"payment blocked by risk assessment",
+			"score", payment.Risk.Score,
+			"rules", payment.Risk.Rules,
+		)
+		return entities.Payment{}, ErrPaymentBlocked
+	case entities.RiskDecisionReview:
+		s.logger.Warn(
+			"payment flagged for review by risk assessment",
+			"score", payment.Risk.Score,
+			"rules", payment.Risk.Rules,
+		)
+	}
+
+	payment.Settlement = payment.Price
+
+	// NOTE: the rate is locked before the card is charged so the merchant is credited at the
+	// rate quoted when the customer paid, the settlement amount is not recomputed later
+	if merchant.AccountDetails.Currency != "" {
+		payment.Settlement, payment.FX, err = s.fx.Convert(
+			payment.Price,
+			merchant.AccountDetails.Currency,
+		)
+		if err != nil {
+			s.logger.Error("error converting payment to settlement currency", "error", err)
+			return entities.Payment{}, err
+		}
+	}
+
+	payment.Fees, err = merchant.PricingPlan.Calculate(
+		payment.Settlement,
+		payment.Price.Currency,
+		payment.CardBrand,
+	)
+	if err != nil {
+		s.logger.Error("error calculating payment fees", "error", err)
+		return entities.Payment{}, err
+	}
+
+	releaseLimits, err := s.reservePaymentLimits(merchant, payment.Price)
+	if err != nil {
+		s.logger.Error("error reserving merchant limits", "error", err)
+		return entities.Payment{}, err
 	}
 
 	transactionID, err := s.bankClient.ProcessTransaction(
 		merchant.AccountDetails,
-		payment.Customer.CardDetails,
+		card,
 		payment.Price,
 	)
 	if err != nil {
 		s.logger.Error("error processing transaction", "error", err)
-		return "", err
+		releaseLimits()
+		return entities.Payment{}, err
 	}
 
 	payment.ID = newUUID().String()
@@ -61,13 +215,13 @@ func (s *Service) CreateNewPayment(payment entities.Payment) (string, error) {
 	payment.Merchant.AccountDetails = merchant.AccountDetails
 	payment.Timestamp = now().UnixNano() / int64(time.Millisecond)
 
-	err = s.storage.CreateNewPayment(payment)
+	err = s.storage.CreateNewPayment(payment, chargeEntries(payment)...)
 	if err != nil {
 		s.logger.Error("error creating new payment", "error", err)
-		return "", err
+		return entities.Payment{}, err
 	}
 
-	return payment.ID, nil
+	return payment, nil
 }
 
 func (s *Service) GetPaymentDetails(merchantID, paymentID string) (entities.PaymentDetails, error) {
@@ -82,29 +236,248 @@ func (s *Service) GetPaymentDetails(merchantID, paymentID string) (entities.Paym
 	return entities.NewPaymentDetailsFromPayment(payment), nil
 }
 
-func (s *Service) RefundPayment(merchantID, paymentID string) error {
+// RefundPayment returns the payment to the customer. Payments with an open dispute cannot be
+// refunded and a payment charged back in part refunds what the chargebacks left.
+func (s *Service) RefundPayment(actor entities.Actor, merchantID, paymentID string) error {
+	before, after, err := s.refundPayment(merchantID, paymentID)
+
+	var beforeState, afterState any
+	if before.ID != "" {
+		beforeState = entities.NewPaymentDetailsFromPayment(before)
+	}
+	if err == nil {
+		afterState = entities.NewPaymentDetailsFromPayment(after)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionPaymentRefund,
+		paymentID,
+		beforeState,
+		afterState,
+		err,
+	)
+
+	if err == nil {
+		s.publishPaymentEvent(entities.WebhookEventPaymentRefunded, after)
+	}
+
+	return err
+}
+
+// refundPayment returns the payment before and after the refund
+func (s *Service) refundPayment(
+	merchantID, paymentID string,
+) (entities.Payment, entities.Payment, error) {
 	payment, err := s.storage.GetPayment(merchantID, paymentID)
 	if err != nil {
 		s.logger.Error("error getting payment", "error", err)
-		return err
+		return entities.Payment{}, entities.Payment{}, err
+	}
+
+	before := payment
+
+	if payment.Refunded {
+		return before, entities.Payment{}, ErrPaymentRefunded
 	}
 
-	err = s.bankClient.RevertTransaction(payment.BankTransactionID)
+	// NOTE: a payment charged back in part refunds the undisputed part of its price only
+	refund := payment.Price
+	refund.Amount -= payment.DisputedAmount
+
+	if payment.OpenDisputes > 0 || !refund.IsPositive() {
+		return before, entities.Payment{}, ErrPaymentDisputed
+	}
+
+	merchant, err := s.storage.GetMerchantDetails(merchantID)
 	if err != nil {
-		s.logger.Error("error reverting transaction", "error", err)
-		return err
+		s.logger.Error("error getting merchant details", "error", err)
+		return before, entities.Payment{}, err
+	}
+
+	releaseLimits, err := s.reserveRefundLimits(merchant)
+	if err != nil {
+		s.logger.Error("error reserving merchant limits", "error", err)
+		return before, entities.Payment{}, err
 	}
 
 	payment.Refunded = true
 	payment.RefundTimestamp = now().UnixNano() / int64(time.Millisecond)
+	payment.Fees = payment.Fees.Refund()
+
+	if payment.DisputedAmount > 0 {
+		payment.Fees.RefundedFee, err = payment.Fees.RefundedFee.MultiplyRat(
+			big.NewRat(refund.Amount, payment.Price.Amount),
+			entities.RoundHalfEven,
+		)
+		if err != nil {
+			releaseLimits()
+			return before, entities.Payment{}, err
+		}
+	}
 
-	err = s.storage.UpdatePayment(payment)
+	// NOTE: the refund is claimed before the transaction is reverted so that concurrent refunds
+	// of the payment cannot revert it twice
+	err = s.storage.UpdatePayment(before, payment)
 	if err != nil {
-		s.logger.Error("error updating payment", "error", err)
-		return err
+		if !errors.Is(err, storage.ErrConflict) {
+			s.logger.Error("error updating payment", "error", err)
+		}
+		releaseLimits()
+		return before, entities.Payment{}, err
+	}
+
+	err = s.bankClient.RevertTransaction(payment.BankTransactionID, refund)
+	if err != nil {
+		s.logger.Error("error reverting transaction", "error", err)
+		releaseLimits()
+
+		rollbackErr := s.storage.UpdatePayment(payment, before)
+		if rollbackErr != nil {
+			s.logger.Error("error rolling back payment refund", "error", rollbackErr)
+		}
+
+		return before, entities.Payment{}, err
+	}
+
+	err = s.postRefundEntries(payment)
+	if err != nil {
+		s.logger.Error(
+			"error posting refund journal entries",
+			"paymentID", payment.ID,
+			"error", err,
+		)
+		return before, entities.Payment{}, err
 	}
 
 	s.logger.Info("payment refunded", "paymentID", payment.ID)
 
-	return nil
+	return before, payment, nil
+}
+
+// CreatePaymentMethod stores the card of the customer with the bank and keeps the token of the
+// card on file with the details that can be shown to the merchant
+func (s *Service) CreatePaymentMethod(
+	actor entities.Actor,
+	method entities.PaymentMethod,
+	card entities.CardDetails,
+) (string, error) {
+	created, err := s.createPaymentMethod(method, card)
+
+	var after any
+	if err == nil {
+		after = entities.NewPaymentMethodDetailsFromPaymentMethod(created)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		method.MerchantID,
+		entities.AuditActionPaymentMethodCreate,
+		created.ID,
+		nil,
+		after,
+		err,
+	)
+
+	return created.ID, err
+}
+
+func (s *Service) createPaymentMethod(
+	method entities.PaymentMethod,
+	card entities.CardDetails,
+) (entities.PaymentMethod, error) {
+	err := s.bankClient.ValidateCardInformation(card)
+	if err != nil {
+		s.logger.Error("error validating card information", "error", err)
+		return entities.PaymentMethod{}, err
+	}
+
+	// NOTE: the security code must not be kept once the card has been validated
+	card.SecurityCode = 0
+
+	token, err := s.bankClient.TokenizeCard(card)
+	if err != nil {
+		s.logger.Error("error tokenizing card", "error", err)
+		return entities.PaymentMethod{}, err
+	}
+
+	method.ID = newUUID().String()
+	method.CardToken = token
+	method.CardName = card.Name
+	method.CardLast4 = card.Last4()
+	method.CardExpiryDate = card.ExpirationDate
+	method.Timestamp = now().UnixNano() / int64(time.Millisecond)
+
+	err = s.storage.CreatePaymentMethod(method)
+	if err != nil {
+		s.logger.Error("error creating payment method", "error", err)
+		return entities.PaymentMethod{}, err
+	}
+
+	s.logger.Info("payment method created", "paymentMethodID", method.ID)
+
+	return method, nil
+}
+
+func (s *Service) ListPaymentMethods(
+	merchantID, customerID string,
+) ([]entities.PaymentMethodDetails, error) {
+	methods, err := s.storage.ListPaymentMethods(merchantID, customerID)
+	if err != nil {
+		s.logger.Error("error listing payment methods", "error", err)
+		return nil, err
+	}
+
+	details := make([]entities.PaymentMethodDetails, 0, len(methods))
+	for _, method := range methods {
+		details = append(details, entities.NewPaymentMethodDetailsFromPaymentMethod(method))
+	}
+
+	return details, nil
+}
+
+func (s *Service) DeletePaymentMethod(
+	actor entities.Actor,
+	merchantID, customerID, paymentMethodID string,
+) error {
+	before, err := s.deletePaymentMethod(merchantID, customerID, paymentMethodID)
+
+	var beforeState any
+	if before.ID != "" {
+		beforeState = entities.NewPaymentMethodDetailsFromPaymentMethod(before)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionPaymentMethodDelete,
+		paymentMethodID,
+		beforeState,
+		nil,
+		err,
+	)
+
+	return err
+}
+
+// deletePaymentMethod returns the deleted payment method
+func (s *Service) deletePaymentMethod(
+	merchantID, customerID, paymentMethodID string,
+) (entities.PaymentMethod, error) {
+	method, err := s.storage.GetPaymentMethod(merchantID, customerID, paymentMethodID)
+	if err != nil {
+		s.logger.Error("error getting payment method", "error", err)
+		return entities.PaymentMethod{}, err
+	}
+
+	err = s.storage.DeletePaymentMethod(merchantID, customerID, paymentMethodID)
+	if err != nil {
+		s.logger.Error("error deleting payment method", "error", err)
+		return method, err
+	}
+
+	s.logger.Info("payment method deleted", "paymentMethodID", paymentMethodID)
+
+	return method, nil
 }
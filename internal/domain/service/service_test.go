@@ -1,22 +1,98 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"math"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/mgajewskik/payment-platform/internal/blobstore"
 	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/domain/fx"
+	"github.com/mgajewskik/payment-platform/internal/domain/risk"
 	"github.com/mgajewskik/payment-platform/internal/domain/simulator"
+	"github.com/mgajewskik/payment-platform/internal/sepa"
 	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/webhook"
 	"github.com/stretchr/testify/assert"
 )
 
 // NOTE: business logic tests
 
+var testActor = entities.Actor{Type: entities.ActorTypeSystem, ID: "test"}
+
+var testMerchant = entities.Merchant{
+	ID: "testMerchantID",
+	AccountDetails: entities.AccountDetails{
+		Name:     "Test Merchant",
+		IBAN:     "DE89370400440532013000",
+		BIC:      "COBADEFFXXX",
+		Currency: "EUR",
+	},
+}
+
+// newTestRepository returns a memory repository holding the test merchant
+func newTestRepository() *storage.MemoryRepository {
+	repository := storage.NewMemoryRepository()
+	_ = repository.CreateMerchant(testMerchant)
+
+	return repository
+}
+
+// newTestConverter converts with indicative rates against EUR and a 1% markup
+func newTestConverter() *fx.MarkupConverter {
+	provider, _ := fx.NewStaticProvider(fx.Rates{
+		Base:      "EUR",
+		Timestamp: time.Unix(100, 0),
+		Rates: map[string]string{
+			"CHF": "0.94",
+			"GBP": "0.85",
+			"JPY": "161.50",
+			"PLN": "4.30",
+			"SEK": "11.40",
+			"USD": "1.08",
+		},
+	})
+	return fx.NewMarkupConverter(provider, big.NewRat(1, 100))
+}
+
+// testSender records the webhook deliveries sent and responds with the status
+type testSender struct {
+	status int
+	sent   []sentWebhook
+}
+
+type sentWebhook struct {
+	url    string
+	header http.Header
+	body   []byte
+}
+
+func (s *testSender) Send(url string, header http.Header, body []byte) (int, error) {
+	s.sent = append(s.sent, sentWebhook{url: url, header: header, body: body})
+	return s.status, nil
+}
+
 func TestCreateNewPayment(t *testing.T) {
 	logger := slog.Default()
-	service := NewService(storage.NewMemoryRepository(), simulator.NewBankSimulator(logger), logger)
+	service := NewService(
+		newTestRepository(),
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
 	now = func() time.Time {
 		return time.Unix(100, 100)
 	}
@@ -45,50 +121,1852 @@ func TestCreateNewPayment(t *testing.T) {
 		Timestamp: now().UnixNano() / int64(time.Millisecond),
 	}
 
-	// tested function
-	_, err := service.CreateNewPayment(input)
-	if err != nil {
-		t.Errorf("error creating new payment: %v", err)
+	// tested function
+	_, err := service.CreateNewPayment(testActor, input)
+	if err != nil {
+		t.Errorf("error creating new payment: %v", err)
+	}
+
+	got, err := service.storage.GetPayment(input.Merchant.ID, newUUID().String())
+	if err != nil {
+		t.Errorf("error getting payment: %v", err)
+	}
+
+	want := entities.Payment{
+		ID: "00000000-0000-0000-0000-000000000000",
+		Merchant: entities.Merchant{
+			ID: "testMerchantID",
+			AccountDetails: entities.AccountDetails{
+				Name:     "Test Merchant",
+				IBAN:     "DE89370400440532013000",
+				BIC:      "COBADEFFXXX",
+				Currency: "EUR",
+			},
+		},
+		Customer: entities.Customer{
+			ID: "testCustomerID",
+			CardDetails: entities.CardDetails{
+				Name:           "Test Customer",
+				Number:         "1234567890123456",
+				SecurityCode:   123,
+				ExpirationDate: "12/23",
+			},
+		},
+		CardLast4:  "3456",
+		CardBrand:  entities.CardBrandUnknown,
+		Price:      entities.Money{Amount: 100, Currency: "USD"},
+		Settlement: entities.Money{Amount: 92, Currency: "EUR"},
+		FX: &entities.FXRate{
+			Provider:    "static",
+			MidRate:     "0.92592593",
+			Markup:      "0.01",
+			AppliedRate: "0.91666666",
+			Timestamp:   100000,
+		},
+		Fees: entities.Fees{
+			Gross:        entities.Money{Amount: 92, Currency: "EUR"},
+			Fee:          entities.Money{Amount: 0, Currency: "EUR"},
+			Net:          entities.Money{Amount: 92, Currency: "EUR"},
+			FixedFee:     entities.Money{Amount: 0, Currency: "EUR"},
+			RefundPolicy: entities.RefundFeeRetain,
+			RefundedFee:  entities.Money{Amount: 0, Currency: "EUR"},
+		},
+		Risk:              entities.RiskAssessment{Decision: entities.RiskDecisionAllow},
+		BankTransactionID: "simulatedTransactionID",
+		Timestamp:         100000,
+		Refunded:          false,
+		RefundTimestamp:   0,
+	}
+
+	assert.Equal(t, got, want)
+}
+
+func TestPaymentFees(t *testing.T) {
+	logger := slog.Default()
+	repository := storage.NewMemoryRepository()
+
+	merchant := testMerchant
+	merchant.PricingPlan = entities.PricingPlan{
+		Rules: []entities.FeeRule{
+			{Currency: "EUR", CardBrand: entities.CardBrandVisa, Percentage: "0.014", Fixed: 25},
+			{Percentage: "0.029", Fixed: 30},
+		},
+		RefundPolicy: entities.RefundFeeRetainFixed,
+	}
+	_ = repository.CreateMerchant(merchant)
+
+	service := NewService(
+		repository,
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
+	now = func() time.Time {
+		return time.Unix(100, 100)
+	}
+
+	var sequence int
+	newUUID = func() uuid.UUID {
+		sequence++
+		return uuid.MustParse(fmt.Sprintf("00000000-0000-0000-0000-%012d", sequence))
+	}
+
+	input := entities.Payment{
+		Merchant: entities.Merchant{ID: "testMerchantID"},
+		Customer: entities.Customer{
+			ID: "testCustomerID",
+			CardDetails: entities.CardDetails{
+				Number:         "4111111111111111",
+				Name:           "Test Customer",
+				SecurityCode:   123,
+				ExpirationDate: "12/23",
+			},
+		},
+		Price: entities.Money{Amount: 10000, Currency: "EUR"},
+	}
+
+	t.Run("should charge the fee of the matching rule", func(t *testing.T) {
+		// tested function
+		paymentID, err := service.CreateNewPayment(testActor, input)
+		assert.NoError(t, err)
+
+		got, _ := service.storage.GetPayment("testMerchantID", paymentID)
+
+		assert.Equal(t, entities.Fees{
+			Gross:        entities.Money{Amount: 10000, Currency: "EUR"},
+			Fee:          entities.Money{Amount: 165, Currency: "EUR"},
+			Net:          entities.Money{Amount: 9835, Currency: "EUR"},
+			FixedFee:     entities.Money{Amount: 25, Currency: "EUR"},
+			RefundPolicy: entities.RefundFeeRetainFixed,
+			RefundedFee:  entities.Money{Amount: 0, Currency: "EUR"},
+		}, got.Fees)
+	})
+
+	t.Run("should charge the fee on the settlement amount", func(t *testing.T) {
+		payment := input
+		payment.Price = entities.Money{Amount: 10800, Currency: "USD"}
+
+		// tested function
+		paymentID, err := service.CreateNewPayment(testActor, payment)
+		assert.NoError(t, err)
+
+		got, _ := service.storage.GetPayment("testMerchantID", paymentID)
+
+		assert.Equal(t, entities.Money{Amount: 9900, Currency: "EUR"}, got.Fees.Gross)
+		assert.Equal(t, entities.Money{Amount: 317, Currency: "EUR"}, got.Fees.Fee)
+		assert.Equal(t, entities.Money{Amount: 9583, Currency: "EUR"}, got.Fees.Net)
+	})
+
+	t.Run("should return the fee according to the refund policy", func(t *testing.T) {
+		paymentID, err := service.CreateNewPayment(testActor, input)
+		assert.NoError(t, err)
+
+		// tested function
+		err = service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.NoError(t, err)
+
+		got, _ := service.storage.GetPayment("testMerchantID", paymentID)
+
+		assert.Equal(t, entities.Money{Amount: 140, Currency: "EUR"}, got.Fees.RefundedFee)
+	})
+}
+
+func TestLedger(t *testing.T) {
+	logger := slog.Default()
+	repository := storage.NewMemoryRepository()
+
+	merchant := testMerchant
+	merchant.PricingPlan = entities.PricingPlan{
+		Rules:        []entities.FeeRule{{Percentage: "0.02", Fixed: 20}},
+		RefundPolicy: entities.RefundFeeReturn,
+	}
+	_ = repository.CreateMerchant(merchant)
+
+	service := NewService(
+		repository,
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
+	now = func() time.Time {
+		return time.Unix(100, 100)
+	}
+
+	var sequence int
+	newUUID = func() uuid.UUID {
+		sequence++
+		return uuid.MustParse(fmt.Sprintf("00000000-0000-0000-0000-%012d", sequence))
+	}
+
+	input := entities.Payment{
+		Merchant: entities.Merchant{ID: "testMerchantID"},
+		Customer: entities.Customer{
+			ID: "testCustomerID",
+			CardDetails: entities.CardDetails{
+				Number:         "4111111111111111",
+				Name:           "Test Customer",
+				SecurityCode:   123,
+				ExpirationDate: "12/23",
+			},
+		},
+		Price: entities.Money{Amount: 10000, Currency: "EUR"},
+	}
+
+	var paymentID string
+
+	t.Run("should post the charge and the fee", func(t *testing.T) {
+		var err error
+
+		// tested function
+		paymentID, err = service.CreateNewPayment(testActor, input)
+		assert.NoError(t, err)
+
+		entries, _ := repository.ListJournalEntries("testMerchantID")
+		assert.Len(t, entries, 2)
+		for _, entry := range entries {
+			assert.NoError(t, entry.Validate())
+			assert.Equal(t, paymentID, entry.PaymentID)
+		}
+
+		balance, err := service.GetBalance("testMerchantID")
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Balance{
+			Available: []entities.Money{},
+			Pending:   []entities.Money{{Amount: 9780, Currency: "EUR"}},
+		}, balance)
+
+		balances, _ := repository.GetAccountBalances("testMerchantID")
+		assert.Contains(t, balances, entities.AccountBalance{
+			Account: entities.AccountPlatformFees,
+			Balance: entities.Money{Amount: -220, Currency: "EUR"},
+		})
+		assert.Contains(t, balances, entities.AccountBalance{
+			Account: entities.AccountBankClearing,
+			Balance: entities.Money{Amount: 10000, Currency: "EUR"},
+		})
+	})
+
+	t.Run("should post the refund and the returned fee", func(t *testing.T) {
+		// tested function
+		err := service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.NoError(t, err)
+
+		entries, _ := repository.ListJournalEntries("testMerchantID")
+		assert.Len(t, entries, 5)
+
+		// NOTE: the funds were still pending so the refund is taken from them
+		balance, err := service.GetBalance("testMerchantID")
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Balance{
+			Available: []entities.Money{{Amount: 0, Currency: "EUR"}},
+			Pending:   []entities.Money{{Amount: 0, Currency: "EUR"}},
+		}, balance)
+	})
+
+	t.Run("should not refund a payment twice", func(t *testing.T) {
+		// tested function
+		err := service.RefundPayment(testActor, "testMerchantID", paymentID)
+
+		assert.ErrorIs(t, err, ErrPaymentRefunded)
+
+		entries, _ := repository.ListJournalEntries("testMerchantID")
+		assert.Len(t, entries, 5)
+	})
+
+	t.Run("should take refunds of released payments from the available funds", func(t *testing.T) {
+		paymentID, err := service.CreateNewPayment(testActor, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now = func() time.Time {
+			return time.Unix(100, 100).Add(72 * time.Hour)
+		}
+
+		err = service.releaseFunds("testMerchantID", 48*time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// tested function
+		err = service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.NoError(t, err)
+
+		balance, err := service.GetBalance("testMerchantID")
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Balance{
+			Available: []entities.Money{{Amount: 0, Currency: "EUR"}},
+			Pending:   []entities.Money{{Amount: 0, Currency: "EUR"}},
+		}, balance)
+	})
+}
+
+func TestRefundClaims(t *testing.T) {
+	logger := slog.Default()
+
+	now = func() time.Time { return time.Unix(100, 0) }
+	defer func() { now = time.Now }()
+
+	input := entities.Payment{
+		Merchant: entities.Merchant{ID: "testMerchantID"},
+		Customer: entities.Customer{
+			ID: "testCustomerID",
+			CardDetails: entities.CardDetails{
+				Number:         "4111111111111111",
+				Name:           "Test Customer",
+				SecurityCode:   123,
+				ExpirationDate: "12/23",
+			},
+		},
+		Price: entities.Money{Amount: 10000, Currency: "EUR"},
+	}
+
+	merchant := testMerchant
+	merchant.PricingPlan = entities.PricingPlan{
+		Rules:        []entities.FeeRule{{Percentage: "0.02", Fixed: 20}},
+		RefundPolicy: entities.RefundFeeReturn,
+	}
+
+	setup := func(t *testing.T) (*Service, *racingPaymentRepository, *revertingBank, string) {
+		repository := &racingPaymentRepository{MemoryRepository: storage.NewMemoryRepository()}
+		_ = repository.CreateMerchant(merchant)
+
+		bank := &revertingBank{BankSimulator: simulator.NewBankSimulator(logger)}
+
+		service := NewService(
+			repository,
+			bank,
+			risk.NewEngine(risk.DefaultConfig()),
+			newTestConverter(),
+			blobstore.NewMemory(),
+			&testSender{},
+			logger,
+		)
+
+		paymentID, err := service.CreateNewPayment(testActor, input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return service, repository, bank, paymentID
+	}
+
+	t.Run("should not revert payments refunded concurrently", func(t *testing.T) {
+		service, repository, bank, paymentID := setup(t)
+
+		repository.onGet = func(payment entities.Payment) {
+			refunded := payment
+			refunded.Refunded = true
+			refunded.RefundTimestamp = 1
+			_ = repository.UpdatePayment(payment, refunded)
+		}
+
+		// tested function
+		err := service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.ErrorIs(t, err, storage.ErrConflict)
+		assert.Equal(t, 0, bank.reverts)
+	})
+
+	t.Run("should roll the refund back when the bank fails", func(t *testing.T) {
+		service, _, bank, paymentID := setup(t)
+
+		bank.fail = true
+
+		// tested function
+		err := service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.Error(t, err)
+
+		payment, err := service.storage.GetPayment("testMerchantID", paymentID)
+		assert.NoError(t, err)
+		assert.False(t, payment.Refunded)
+
+		bank.fail = false
+
+		// tested function
+		err = service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, bank.reverts)
+	})
+
+	t.Run("should post refunds of payments released meanwhile", func(t *testing.T) {
+		service, _, bank, paymentID := setup(t)
+
+		bank.onRevert = func() {
+			err := service.releaseFunds("testMerchantID", 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// tested function
+		err := service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.NoError(t, err)
+		assert.Equal(t, 1, bank.reverts)
+
+		balance, err := service.GetBalance("testMerchantID")
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Balance{
+			Available: []entities.Money{{Amount: 0, Currency: "EUR"}},
+			Pending:   []entities.Money{{Amount: 0, Currency: "EUR"}},
+		}, balance)
+	})
+
+	dispute := func(t *testing.T, service *Service, paymentID string, amount int64) string {
+		dispute, err := service.OpenDispute(testActor, entities.Dispute{
+			MerchantID: "testMerchantID",
+			PaymentID:  paymentID,
+			Reason:     entities.DisputeReasonFraudulent,
+			Amount:     entities.Money{Amount: amount, Currency: "EUR"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return dispute.ID
+	}
+
+	t.Run("should refund the undisputed part after a lost dispute", func(t *testing.T) {
+		service, _, bank, paymentID := setup(t)
+
+		disputeID := dispute(t, service, paymentID, 2500)
+
+		// tested function
+		err := service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.ErrorIs(t, err, ErrPaymentDisputed)
+		assert.Equal(t, 0, bank.reverts)
+
+		_, err = service.ResolveDispute(testActor, "testMerchantID", disputeID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// tested function
+		err = service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Money{Amount: 7500, Currency: "EUR"}, bank.reverted)
+
+		payment, _ := service.storage.GetPayment("testMerchantID", paymentID)
+		assert.Equal(t, entities.Money{Amount: 165, Currency: "EUR"}, payment.Fees.RefundedFee)
+
+		// the fee of the charged back part is retained
+		balance, err := service.GetBalance("testMerchantID")
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Balance{
+			Available: []entities.Money{{Amount: -55, Currency: "EUR"}},
+			Pending:   []entities.Money{{Amount: 0, Currency: "EUR"}},
+		}, balance)
+	})
+
+	t.Run("should not refund payments charged back in full", func(t *testing.T) {
+		service, _, bank, paymentID := setup(t)
+
+		disputeID := dispute(t, service, paymentID, 10000)
+
+		_, err := service.ResolveDispute(testActor, "testMerchantID", disputeID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// tested function
+		err = service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.ErrorIs(t, err, ErrPaymentDisputed)
+		assert.Equal(t, 0, bank.reverts)
+	})
+
+	t.Run("should not refund payments disputed concurrently", func(t *testing.T) {
+		service, repository, bank, paymentID := setup(t)
+
+		repository.onGet = func(payment entities.Payment) {
+			repository.onGet = nil
+			dispute(t, service, payment.ID, 2500)
+		}
+
+		// tested function
+		err := service.RefundPayment(testActor, "testMerchantID", paymentID)
+		assert.ErrorIs(t, err, storage.ErrConflict)
+		assert.Equal(t, 0, bank.reverts)
+	})
+}
+
+// racingPaymentRepository calls onGet with every payment read, as a concurrent request would
+type racingPaymentRepository struct {
+	*storage.MemoryRepository
+	onGet func(payment entities.Payment)
+}
+
+func (r *racingPaymentRepository) GetPayment(
+	merchantID, paymentID string,
+) (entities.Payment, error) {
+	payment, err := r.MemoryRepository.GetPayment(merchantID, paymentID)
+	if err == nil && r.onGet != nil {
+		r.onGet(payment)
+	}
+
+	return payment, err
+}
+
+// revertingBank counts reverted transactions and keeps the last reverted amount, calls onRevert
+// after reverting one and fails to revert while fail is set
+type revertingBank struct {
+	*simulator.BankSimulator
+	fail     bool
+	reverts  int
+	reverted entities.Money
+	onRevert func()
+}
+
+func (b *revertingBank) RevertTransaction(transactionID string, money entities.Money) error {
+	b.reverts++
+
+	if b.fail {
+		return errors.New("revert failed")
+	}
+
+	b.reverted = money
+
+	err := b.BankSimulator.RevertTransaction(transactionID, money)
+	if err == nil && b.onRevert != nil {
+		b.onRevert()
+	}
+
+	return err
+}
+
+// rejectingBank refuses transfers to the merchant account
+type rejectingBank struct {
+	*simulator.BankSimulator
+}
+
+func (b rejectingBank) TransferFunds(
+	_ string,
+	_ entities.AccountDetails,
+	_ entities.Money,
+) (string, error) {
+	return "", errors.New("account closed")
+}
+
+// recordingBank records the idempotency keys of the transfers
+type recordingBank struct {
+	*simulator.BankSimulator
+	keys []string
+}
+
+func (b *recordingBank) TransferFunds(
+	idempotencyKey string,
+	account entities.AccountDetails,
+	money entities.Money,
+) (string, error) {
+	b.keys = append(b.keys, idempotencyKey)
+	return b.BankSimulator.TransferFunds(idempotencyKey, account, money)
+}
+
+var testPayoutOptions = PayoutOptions{SettlementDelay: 48 * time.Hour, Transfer: true}
+
+func TestProcessPayouts(t *testing.T) {
+	logger := slog.Default()
+
+	newUUID = func() uuid.UUID {
+		return uuid.New()
+	}
+
+	setup := func(bank simulator.BankClient) (*Service, *storage.MemoryRepository) {
+		repository := newTestRepository()
+		service := NewService(
+			repository,
+			bank,
+			risk.NewEngine(risk.DefaultConfig()),
+			newTestConverter(),
+			blobstore.NewMemory(),
+			&testSender{},
+			logger,
+		)
+
+		now = func() time.Time {
+			return time.Unix(1000, 0)
+		}
+
+		_, err := service.CreateNewPayment(testActor, entities.Payment{
+			Merchant: entities.Merchant{ID: "testMerchantID"},
+			Customer: entities.Customer{
+				ID: "testCustomerID",
+				CardDetails: entities.CardDetails{
+					Number:         "4111111111111111",
+					Name:           "Test Customer",
+					SecurityCode:   123,
+					ExpirationDate: "12/23",
+				},
+			},
+			Price: entities.Money{Amount: 10000, Currency: "EUR"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return service, repository
+	}
+
+	at := func(d time.Duration) {
+		now = func() time.Time {
+			return time.Unix(1000, 0).Add(d)
+		}
+	}
+
+	t.Run("should keep funds pending until the settlement delay", func(t *testing.T) {
+		service, _ := setup(simulator.NewBankSimulator(logger))
+		at(time.Hour)
+
+		// tested function
+		err := service.ProcessPayouts(testActor, testPayoutOptions)
+		assert.NoError(t, err)
+
+		payouts, _ := service.ListPayouts("testMerchantID", "")
+		assert.Empty(t, payouts)
+
+		balance, _ := service.GetBalance("testMerchantID")
+		assert.Equal(t, []entities.Money{{Amount: 10000, Currency: "EUR"}}, balance.Pending)
+	})
+
+	t.Run("should pay out released funds", func(t *testing.T) {
+		service, _ := setup(simulator.NewBankSimulator(logger))
+		at(72 * time.Hour)
+
+		// tested function
+		err := service.ProcessPayouts(testActor, testPayoutOptions)
+		assert.NoError(t, err)
+
+		payouts, _ := service.ListPayouts("testMerchantID", "")
+		assert.Len(t, payouts, 1)
+
+		payout := payouts[0]
+		assert.Equal(t, entities.Money{Amount: 10000, Currency: "EUR"}, payout.Amount)
+		assert.Equal(t, entities.PayoutStatusInTransit, payout.Status)
+		assert.Equal(t, "simulatedTransferID", payout.BankTransferID)
+		assert.Equal(t, testMerchant.AccountDetails, payout.Destination)
+
+		balance, _ := service.GetBalance("testMerchantID")
+		assert.Equal(t, entities.Balance{
+			Available: []entities.Money{{Amount: 0, Currency: "EUR"}},
+			Pending:   []entities.Money{{Amount: 0, Currency: "EUR"}},
+		}, balance)
+
+		at(73 * time.Hour)
+
+		// tested function
+		err = service.ProcessPayouts(testActor, testPayoutOptions)
+		assert.NoError(t, err)
+
+		payout, err = service.GetPayout("testMerchantID", payout.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, entities.PayoutStatusPaid, payout.Status)
+
+		paid, _ := service.ListPayouts("testMerchantID", entities.PayoutStatusPaid)
+		assert.Len(t, paid, 1)
+
+		events, _, _ := service.ListAuditEvents(
+			"testMerchantID",
+			storage.AuditEventFilter{Action: entities.AuditActionPayoutUpdate},
+		)
+		assert.Len(t, events, 2)
+	})
+
+	t.Run("should return funds of failed payouts", func(t *testing.T) {
+		service, repository := setup(rejectingBank{simulator.NewBankSimulator(logger)})
+		at(72 * time.Hour)
+
+		// tested function
+		err := service.ProcessPayouts(testActor, testPayoutOptions)
+		assert.NoError(t, err)
+
+		payouts, _ := service.ListPayouts("testMerchantID", "")
+		assert.Len(t, payouts, 1)
+		assert.Equal(t, entities.PayoutStatusFailed, payouts[0].Status)
+		assert.Equal(t, "account closed", payouts[0].FailureReason)
+
+		balance, _ := service.GetBalance("testMerchantID")
+		assert.Equal(t, []entities.Money{{Amount: 10000, Currency: "EUR"}}, balance.Available)
+
+		entries, _ := repository.ListJournalEntries("testMerchantID")
+		for _, entry := range entries {
+			assert.NoError(t, entry.Validate())
+		}
+	})
+
+	t.Run("should transfer payouts once per payout", func(t *testing.T) {
+		bank := &recordingBank{BankSimulator: simulator.NewBankSimulator(logger)}
+		service, _ := setup(bank)
+		at(72 * time.Hour)
+
+		// tested function
+		err := service.ProcessPayouts(testActor, testPayoutOptions)
+		assert.NoError(t, err)
+
+		payouts, _ := service.ListPayouts("testMerchantID", "")
+		assert.Len(t, payouts, 1)
+		assert.Equal(t, []string{payouts[0].ID}, bank.keys)
+	})
+
+	t.Run("should not pay out funds taken by another run", func(t *testing.T) {
+		service, repository := setup(simulator.NewBankSimulator(logger))
+		at(72 * time.Hour)
+
+		err := service.ProcessPayouts(testActor, PayoutOptions{SettlementDelay: 48 * time.Hour})
+		assert.NoError(t, err)
+
+		payout := entities.Payout{
+			ID:         "staleRunPayoutID",
+			MerchantID: "testMerchantID",
+			Amount:     entities.Money{Amount: 10000, Currency: "EUR"},
+			Status:     entities.PayoutStatusPending,
+		}
+
+		// tested function
+		err = repository.CreatePayout(payout, entities.NewPayoutJournalEntry(
+			payout,
+			entities.JournalEntryPayout,
+			entities.AccountMerchantAvailable,
+			entities.AccountBankClearing,
+			payout.Amount,
+			0,
+		))
+		assert.ErrorIs(t, err, storage.ErrConflict)
+
+		payouts, _ := service.ListPayouts("testMerchantID", "")
+		assert.Len(t, payouts, 1)
+	})
+
+	t.Run("should report unknown payouts", func(t *testing.T) {
+		service, _ := setup(simulator.NewBankSimulator(logger))
+
+		// tested function
+		_, err := service.GetPayout("testMerchantID", "unknownPayoutID")
+
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+	})
+}
+
+func TestSEPAPayouts(t *testing.T) {
+	logger := slog.Default()
+	debtor := sepa.Party{Name: "Payment Platform", IBAN: "NL91ABNA0417164300", BIC: "ABNANL2A"}
+	executionDate := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	newUUID = func() uuid.UUID {
+		return uuid.New()
+	}
+
+	// setup creates a pending payout of a released payment
+	setup := func(repository storage.DBRepository) (*Service, entities.Payout) {
+		service := NewService(
+			repository,
+			simulator.NewBankSimulator(logger),
+			risk.NewEngine(risk.DefaultConfig()),
+			newTestConverter(),
+			blobstore.NewMemory(),
+			&testSender{},
+			logger,
+		)
+
+		now = func() time.Time {
+			return time.Unix(1000, 0)
+		}
+
+		_, err := service.CreateNewPayment(testActor, entities.Payment{
+			Merchant: entities.Merchant{ID: "testMerchantID"},
+			Customer: entities.Customer{
+				ID: "testCustomerID",
+				CardDetails: entities.CardDetails{
+					Number:         "4111111111111111",
+					Name:           "Test Customer",
+					SecurityCode:   123,
+					ExpirationDate: "12/23",
+				},
+			},
+			Price: entities.Money{Amount: 10000, Currency: "EUR"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		now = func() time.Time {
+			return time.Unix(1000, 0).Add(72 * time.Hour)
+		}
+
+		err = service.ProcessPayouts(testActor, PayoutOptions{SettlementDelay: 48 * time.Hour})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		payouts, _ := service.ListPayouts("testMerchantID", entities.PayoutStatusPending)
+		if len(payouts) != 1 {
+			t.Fatalf("expected one pending payout, got %d", len(payouts))
+		}
+
+		return service, payouts[0]
+	}
+
+	t.Run("should export payouts and settle them from status reports", func(t *testing.T) {
+		service, payout := setup(newTestRepository())
+
+		// tested function
+		export, err := service.ExportSEPAPayouts(testActor, debtor, debtor.Name, executionDate)
+		assert.NoError(t, err)
+		assert.NoError(t, sepa.VerifyControlSums(export.Document))
+		assert.Contains(t, string(export.Document), "<IBAN>DE89370400440532013000</IBAN>")
+		assert.Contains(t, string(export.Document), "<ReqdExctnDt>2024-01-02</ReqdExctnDt>")
+
+		endToEndID := sepaReference(payout.ID)
+		assert.Len(t, export.Payouts, 1)
+		assert.Equal(t, entities.PayoutStatusInTransit, export.Payouts[0].Status)
+		assert.Equal(t, export.MessageID+"/"+endToEndID, export.Payouts[0].BankTransferID)
+
+		// tested function
+		document, err := service.GetSEPAExport(export.MessageID)
+		assert.NoError(t, err)
+		assert.Equal(t, export.Document, document)
+
+		// tested function
+		_, err = service.ExportSEPAPayouts(testActor, debtor, debtor.Name, executionDate)
+		assert.ErrorIs(t, err, ErrNoPayoutsToExport)
+
+		// tested function
+		result, err := service.ApplySEPAStatusReport(testActor, sepa.StatusReport{
+			OriginalMessageID: export.MessageID,
+			Transactions: []sepa.TransactionStatus{
+				{EndToEndID: endToEndID, Status: sepa.StatusAcceptedSettlementCompleted},
+				{EndToEndID: "unknownEndToEndID", Status: sepa.StatusAcceptedSettlementCompleted},
+			},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, SEPAStatusResult{
+			Paid:      1,
+			Unmatched: []string{"unknownEndToEndID"},
+		}, result)
+
+		payout, _ = service.GetPayout("testMerchantID", payout.ID)
+		assert.Equal(t, entities.PayoutStatusPaid, payout.Status)
+	})
+
+	t.Run("should return funds of rejected transfers", func(t *testing.T) {
+		service, payout := setup(newTestRepository())
+
+		export, err := service.ExportSEPAPayouts(testActor, debtor, debtor.Name, executionDate)
+		assert.NoError(t, err)
+
+		// tested function
+		result, err := service.ApplySEPAStatusReport(testActor, sepa.StatusReport{
+			OriginalMessageID: export.MessageID,
+			Status:            sepa.StatusRejected,
+			Reason:            "AC04: closed account",
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, SEPAStatusResult{Failed: 1, Unmatched: []string{}}, result)
+
+		payout, _ = service.GetPayout("testMerchantID", payout.ID)
+		assert.Equal(t, entities.PayoutStatusFailed, payout.Status)
+		assert.Equal(
+			t,
+			"transfer was rejected by the bank: AC04: closed account",
+			payout.FailureReason,
+		)
+
+		balance, _ := service.GetBalance("testMerchantID")
+		assert.Equal(t, []entities.Money{{Amount: 10000, Currency: "EUR"}}, balance.Available)
+	})
+
+	t.Run("should revert exported payouts when the export fails", func(t *testing.T) {
+		repository := &failingPayoutRepository{MemoryRepository: newTestRepository()}
+		service, payout := setup(repository)
+
+		failing := entities.Payout{
+			ID:          "failingPayoutID",
+			MerchantID:  "testMerchantID",
+			Amount:      entities.Money{Amount: 100, Currency: "EUR"},
+			Status:      entities.PayoutStatusPending,
+			Destination: testMerchant.AccountDetails,
+			Timestamp:   1,
+		}
+		_ = repository.CreatePayout(failing)
+		repository.failID = failing.ID
+
+		// tested function
+		_, err := service.ExportSEPAPayouts(testActor, debtor, debtor.Name, executionDate)
+		assert.Error(t, err)
+
+		payout, _ = service.GetPayout("testMerchantID", payout.ID)
+		assert.Equal(t, entities.PayoutStatusPending, payout.Status)
+		assert.Empty(t, payout.BankTransferID)
+
+		repository.failID = ""
+
+		// tested function
+		export, err := service.ExportSEPAPayouts(testActor, debtor, debtor.Name, executionDate)
+		assert.NoError(t, err)
+		assert.Len(t, export.Payouts, 2)
+	})
+
+	t.Run("should not return unknown exports", func(t *testing.T) {
+		service, _ := setup(newTestRepository())
+
+		for _, messageID := range []string{"unknownMessageID", "../evidence", ""} {
+			// tested function
+			_, err := service.GetSEPAExport(messageID)
+			assert.ErrorIs(t, err, storage.ErrNotFound, messageID)
+		}
+	})
+}
+
+// failingPayoutRepository fails to update the payout with failID
+type failingPayoutRepository struct {
+	*storage.MemoryRepository
+	failID string
+}
+
+func (r *failingPayoutRepository) UpdatePayout(
+	payout entities.Payout,
+	entries ...entities.JournalEntry,
+) error {
+	if payout.ID == r.failID {
+		return errors.New("payout update failed")
+	}
+
+	return r.MemoryRepository.UpdatePayout(payout, entries...)
+}
+
+func TestDisputes(t *testing.T) {
+	logger := slog.Default()
+	blobs := blobstore.NewMemory()
+	repository := newTestRepository()
+	service := NewService(
+		repository,
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobs,
+		&testSender{},
+		logger,
+	)
+
+	now = func() time.Time {
+		return time.Unix(1000, 0)
+	}
+
+	newUUID = func() uuid.UUID {
+		return uuid.New()
+	}
+
+	pay := func(t *testing.T) string {
+		paymentID, err := service.CreateNewPayment(testActor, entities.Payment{
+			Merchant: entities.Merchant{ID: "testMerchantID"},
+			Customer: entities.Customer{
+				ID: "testCustomerID",
+				CardDetails: entities.CardDetails{
+					Number:         "4111111111111111",
+					Name:           "Test Customer",
+					SecurityCode:   123,
+					ExpirationDate: "12/23",
+				},
+			},
+			Price: entities.Money{Amount: 10000, Currency: "EUR"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return paymentID
+	}
+
+	paymentID := pay(t)
+
+	open := func(t *testing.T, amount entities.Money) entities.Dispute {
+		dispute, err := service.OpenDispute(testActor, entities.Dispute{
+			MerchantID: "testMerchantID",
+			PaymentID:  pay(t),
+			Reason:     entities.DisputeReasonFraudulent,
+			Amount:     amount,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return dispute
+	}
+
+	t.Run("should open disputes for the payment price", func(t *testing.T) {
+		// tested function
+		dispute, err := service.OpenDispute(testActor, entities.Dispute{
+			MerchantID: "testMerchantID",
+			PaymentID:  paymentID,
+			Reason:     entities.DisputeReasonFraudulent,
+		})
+		assert.NoError(t, err)
+
+		assert.Equal(t, entities.DisputeStatusNeedsResponse, dispute.Status)
+		assert.Equal(t, entities.Money{Amount: 10000, Currency: "EUR"}, dispute.Amount)
+		assert.Equal(t, int64(1000000+7*24*3600*1000), dispute.Deadline)
+
+		_, err = service.OpenDispute(testActor, entities.Dispute{
+			MerchantID: "testMerchantID",
+			PaymentID:  paymentID,
+			Amount:     entities.Money{Amount: 10001, Currency: "EUR"},
+		})
+		assert.ErrorIs(t, err, ErrInvalidDisputeAmount)
+	})
+
+	t.Run("should store evidence and put the dispute under review", func(t *testing.T) {
+		dispute := open(t, entities.Money{})
+
+		// tested function
+		dispute, err := service.SubmitDisputeEvidence(
+			testActor,
+			"testMerchantID",
+			dispute.ID,
+			"The customer received the goods",
+			[]EvidenceUpload{{
+				Name:        "receipt.pdf",
+				ContentType: "application/pdf",
+				Content:     strings.NewReader("receipt"),
+			}},
+		)
+		assert.NoError(t, err)
+
+		assert.Equal(t, entities.DisputeStatusUnderReview, dispute.Status)
+		assert.Equal(t, "The customer received the goods", dispute.Evidence.Text)
+		assert.Len(t, dispute.Evidence.Files, 1)
+
+		file, content, err := service.GetEvidenceFile(
+			"testMerchantID",
+			dispute.ID,
+			dispute.Evidence.Files[0].ID,
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(7), file.Size)
+
+		data, _ := io.ReadAll(content)
+		assert.Equal(t, "receipt", string(data))
+
+		// tested function
+		_, err = service.SubmitDisputeEvidence(testActor, "testMerchantID", dispute.ID, "", nil)
+		assert.ErrorIs(t, err, ErrDisputeResponded)
+	})
+
+	t.Run("should reject evidence after the deadline", func(t *testing.T) {
+		dispute := open(t, entities.Money{})
+		now = func() time.Time {
+			return time.Unix(1000, 0).Add(8 * 24 * time.Hour)
+		}
+		defer func() {
+			now = func() time.Time {
+				return time.Unix(1000, 0)
+			}
+		}()
+
+		// tested function
+		_, err := service.SubmitDisputeEvidence(testActor, "testMerchantID", dispute.ID, "", nil)
+
+		assert.ErrorIs(t, err, ErrDisputeDeadlinePassed)
+	})
+
+	t.Run("should leave the payment of won disputes", func(t *testing.T) {
+		dispute := open(t, entities.Money{})
+
+		// tested function
+		dispute, err := service.ResolveDispute(testActor, "testMerchantID", dispute.ID, true)
+		assert.NoError(t, err)
+		assert.Equal(t, entities.DisputeStatusWon, dispute.Status)
+
+		payment, _ := repository.GetPayment("testMerchantID", dispute.PaymentID)
+		assert.Empty(t, payment.Adjustments)
+	})
+
+	t.Run("should charge back the disputed amount of lost disputes", func(t *testing.T) {
+		dispute := open(t, entities.Money{Amount: 2500, Currency: "EUR"})
+
+		// tested function
+		dispute, err := service.ResolveDispute(testActor, "testMerchantID", dispute.ID, false)
+		assert.NoError(t, err)
+		assert.Equal(t, entities.DisputeStatusLost, dispute.Status)
+
+		payment, _ := repository.GetPayment("testMerchantID", dispute.PaymentID)
+		assert.Equal(t, []entities.Adjustment{{
+			ID:        "chargeback_" + dispute.ID,
+			Type:      entities.AdjustmentChargeback,
+			DisputeID: dispute.ID,
+			Amount:    entities.Money{Amount: -2500, Currency: "EUR"},
+			Timestamp: 1000000,
+		}}, payment.Adjustments)
+
+		balance, _ := service.GetBalance("testMerchantID")
+		assert.Equal(t, []entities.Money{{Amount: -2500, Currency: "EUR"}}, balance.Available)
+
+		// tested function
+		_, err = service.ResolveDispute(testActor, "testMerchantID", dispute.ID, false)
+		assert.ErrorIs(t, err, ErrDisputeClosed)
+
+		events, _, _ := service.ListAuditEvents(
+			"testMerchantID",
+			storage.AuditEventFilter{Action: entities.AuditActionDisputeResolve},
+		)
+		assert.Len(t, events, 3)
+	})
+
+	t.Run("should list disputes by status", func(t *testing.T) {
+		// tested function
+		disputes, err := service.ListDisputes("testMerchantID", entities.DisputeStatusLost)
+
+		assert.NoError(t, err)
+		assert.Len(t, disputes, 1)
+	})
+
+	t.Run("should not dispute more than the undisputed price", func(t *testing.T) {
+		paymentID := pay(t)
+
+		dispute := func(amount entities.Money) (entities.Dispute, error) {
+			return service.OpenDispute(testActor, entities.Dispute{
+				MerchantID: "testMerchantID",
+				PaymentID:  paymentID,
+				Reason:     entities.DisputeReasonDuplicate,
+				Amount:     amount,
+			})
+		}
+
+		first, err := dispute(entities.Money{Amount: 6000, Currency: "EUR"})
+		assert.NoError(t, err)
+
+		// tested function
+		_, err = dispute(entities.Money{Amount: 4001, Currency: "EUR"})
+		assert.ErrorIs(t, err, ErrInvalidDisputeAmount)
+
+		// tested function
+		rest, err := dispute(entities.Money{})
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Money{Amount: 4000, Currency: "EUR"}, rest.Amount)
+
+		_, err = service.ResolveDispute(testActor, "testMerchantID", first.ID, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// tested function
+		_, err = dispute(entities.Money{Amount: 6000, Currency: "EUR"})
+		assert.NoError(t, err)
+	})
+
+	t.Run("should not put disputes decided meanwhile under review", func(t *testing.T) {
+		dispute := open(t, entities.Money{})
+
+		content := &racingReader{
+			Reader: strings.NewReader("receipt"),
+			onRead: func() {
+				_, err := service.ResolveDispute(testActor, "testMerchantID", dispute.ID, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+		}
+
+		// tested function
+		_, err := service.SubmitDisputeEvidence(
+			testActor,
+			"testMerchantID",
+			dispute.ID,
+			"The customer received the goods",
+			[]EvidenceUpload{{Name: "receipt.pdf", Content: content}},
+		)
+		assert.ErrorIs(t, err, storage.ErrConflict)
+
+		dispute, err = service.GetDispute("testMerchantID", dispute.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, entities.DisputeStatusLost, dispute.Status)
+		assert.Nil(t, dispute.Evidence)
+
+		// tested function
+		_, err = service.ResolveDispute(testActor, "testMerchantID", dispute.ID, true)
+		assert.ErrorIs(t, err, ErrDisputeClosed)
+	})
+}
+
+func TestConcurrentDisputes(t *testing.T) {
+	logger := slog.Default()
+	repository := &racingPaymentRepository{MemoryRepository: newTestRepository()}
+	service := NewService(
+		repository,
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
+
+	now = func() time.Time { return time.Unix(1000, 0) }
+	defer func() { now = time.Now }()
+
+	paymentID, err := service.CreateNewPayment(testActor, entities.Payment{
+		Merchant: entities.Merchant{ID: "testMerchantID"},
+		Customer: entities.Customer{
+			ID: "testCustomerID",
+			CardDetails: entities.CardDetails{
+				Number:         "4111111111111111",
+				Name:           "Test Customer",
+				SecurityCode:   123,
+				ExpirationDate: "12/23",
+			},
+		},
+		Price: entities.Money{Amount: 10000, Currency: "EUR"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispute := entities.Dispute{
+		MerchantID: "testMerchantID",
+		PaymentID:  paymentID,
+		Reason:     entities.DisputeReasonDuplicate,
+		Amount:     entities.Money{Amount: 6000, Currency: "EUR"},
+	}
+
+	t.Run("should not dispute more than the price concurrently", func(t *testing.T) {
+		repository.onGet = func(payment entities.Payment) {
+			repository.onGet = nil
+
+			concurrent := dispute
+			concurrent.ID = "concurrentDisputeID"
+			_ = repository.CreateDispute(concurrent, payment.Price)
+		}
+
+		// tested function
+		_, err := service.OpenDispute(testActor, dispute)
+		assert.ErrorIs(t, err, ErrInvalidDisputeAmount)
+
+		payment, _ := repository.GetPayment("testMerchantID", paymentID)
+		assert.Equal(t, int64(6000), payment.DisputedAmount)
+	})
+
+	t.Run("should release the amount of won disputes", func(t *testing.T) {
+		_, err := service.ResolveDispute(testActor, "testMerchantID", "concurrentDisputeID", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// tested function
+		_, err = service.OpenDispute(testActor, dispute)
+		assert.NoError(t, err)
+
+		payment, _ := repository.GetPayment("testMerchantID", paymentID)
+		assert.Equal(t, int64(6000), payment.DisputedAmount)
+	})
+}
+
+// racingReader calls onRead before it is first read, as a concurrent request would
+type racingReader struct {
+	io.Reader
+	onRead func()
+}
+
+func (r *racingReader) Read(p []byte) (int, error) {
+	if r.onRead != nil {
+		r.onRead()
+		r.onRead = nil
+	}
+
+	return r.Reader.Read(p)
+}
+
+func TestWebhooks(t *testing.T) {
+	logger := slog.Default()
+	sender := &testSender{status: http.StatusOK}
+	repository := newTestRepository()
+	service := NewService(
+		repository,
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		sender,
+		logger,
+	)
+
+	start := time.Unix(1000, 0)
+	now = func() time.Time {
+		return start
+	}
+
+	newUUID = func() uuid.UUID {
+		return uuid.New()
+	}
+
+	endpoint, err := service.CreateWebhookEndpoint(
+		testActor,
+		"testMerchantID",
+		"https://merchant.example/webhooks",
+		[]string{entities.WebhookEventPaymentCreated, entities.WebhookEventPaymentRefunded},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.CreateWebhookEndpoint(
+		testActor,
+		"testMerchantID",
+		"https://merchant.example/chargebacks",
+		[]string{entities.WebhookEventPaymentChargedBack},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pay := func(t *testing.T) string {
+		paymentID, err := service.CreateNewPayment(testActor, entities.Payment{
+			Merchant: entities.Merchant{ID: "testMerchantID"},
+			Customer: entities.Customer{
+				ID: "testCustomerID",
+				CardDetails: entities.CardDetails{
+					Number:         "4111111111111111",
+					Name:           "Test Customer",
+					SecurityCode:   123,
+					ExpirationDate: "12/23",
+				},
+			},
+			Price: entities.Money{Amount: 10000, Currency: "EUR"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return paymentID
+	}
+
+	paymentID := pay(t)
+
+	pending := func() []entities.WebhookDelivery {
+		deliveries, _ := repository.ListDueWebhookDeliveries(math.MaxInt64, 10)
+		return deliveries
+	}
+
+	t.Run("should deliver signed events to subscribed endpoints", func(t *testing.T) {
+		// tested function
+		err := service.DeliverWebhooks()
+		assert.NoError(t, err)
+
+		assert.Len(t, sender.sent, 1)
+		assert.Empty(t, pending())
+
+		sent := sender.sent[0]
+		assert.Equal(t, endpoint.URL, sent.url)
+		assert.Equal(t, entities.WebhookEventPaymentCreated, sent.header.Get(webhook.HeaderEvent))
+
+		err = webhook.Verify(
+			endpoint.Secret,
+			sent.header.Get(webhook.HeaderTimestamp),
+			sent.body,
+			sent.header.Get(webhook.HeaderSignature),
+			start,
+			5*time.Minute,
+		)
+		assert.NoError(t, err)
+
+		var event struct {
+			ID   string
+			Type string
+			Data entities.PaymentDetails
+		}
+		err = json.Unmarshal(sent.body, &event)
+		assert.NoError(t, err)
+		assert.Equal(t, sent.header.Get(webhook.HeaderID), event.ID)
+		assert.Equal(t, paymentID, event.Data.ID)
+	})
+
+	t.Run("should retry failed deliveries with backoff for 3 days", func(t *testing.T) {
+		sender.sent = nil
+		sender.status = http.StatusInternalServerError
+		defer func() {
+			sender.status = http.StatusOK
+			now = func() time.Time {
+				return start
+			}
+		}()
+
+		err := service.RefundPayment(testActor, "testMerchantID", paymentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// tested function
+		err = service.DeliverWebhooks()
+		assert.NoError(t, err)
+
+		deliveries := pending()
+		assert.Len(t, deliveries, 1)
+		assert.Equal(t, 1, deliveries[0].Attempts)
+		assert.Equal(t, "endpoint responded with status 500", deliveries[0].LastError)
+		assert.Equal(t, int64(1000000+60000), deliveries[0].NextAttempt)
+
+		// NOTE: the delivery is not attempted again before its next attempt
+		err = service.DeliverWebhooks()
+		assert.NoError(t, err)
+		assert.Len(t, sender.sent, 1)
+
+		var attempts []time.Time
+		for delivery := deliveries[0]; delivery.Status == entities.WebhookDeliveryPending; {
+			next := time.UnixMilli(delivery.NextAttempt)
+			now = func() time.Time {
+				return next
+			}
+			attempts = append(attempts, next)
+
+			// tested function
+			err = service.DeliverWebhooks()
+			assert.NoError(t, err)
+
+			delivery, _ = repository.GetWebhookDelivery("testMerchantID", delivery.ID)
+		}
+
+		assert.Equal(t, 2*time.Minute, attempts[1].Sub(attempts[0]))
+		assert.Equal(t, 4*time.Minute, attempts[2].Sub(attempts[1]))
+		assert.Equal(t, 6*time.Hour, attempts[len(attempts)-1].Sub(attempts[len(attempts)-2]))
+		assert.False(t, attempts[len(attempts)-1].After(start.Add(72*time.Hour)))
+
+		// tested function
+		delivery, log, err := service.GetWebhookDelivery("testMerchantID", deliveries[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, entities.WebhookDeliveryFailed, delivery.Status)
+		assert.Equal(t, len(attempts)+1, delivery.Attempts)
+		assert.Len(t, sender.sent, delivery.Attempts)
+
+		assert.Len(t, log, delivery.Attempts)
+		for i, attempt := range log {
+			assert.Equal(t, i+1, attempt.Number)
+			assert.Equal(t, http.StatusInternalServerError, attempt.ResponseStatus)
+			assert.Equal(t, "endpoint responded with status 500", attempt.Error)
+			assert.Equal(t, delivery.Payload, attempt.RequestBody)
+		}
+	})
+
+	t.Run("should replay finished deliveries", func(t *testing.T) {
+		sender.sent = nil
+
+		failed, err := service.ListWebhookDeliveries(
+			"testMerchantID",
+			storage.WebhookDeliveryFilter{
+				Status:    entities.WebhookDeliveryFailed,
+				EventType: entities.WebhookEventPaymentRefunded,
+			},
+		)
+		assert.NoError(t, err)
+		assert.Len(t, failed, 1)
+
+		// tested function
+		replay, err := service.ReplayWebhookDelivery(testActor, "testMerchantID", failed[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, failed[0].ID, replay.ReplayOf)
+		assert.Equal(t, failed[0].EventID, replay.EventID)
+
+		// tested function
+		_, err = service.ReplayWebhookDelivery(testActor, "testMerchantID", replay.ID)
+		assert.ErrorIs(t, err, ErrWebhookDeliveryPending)
+
+		err = service.DeliverWebhooks()
+		assert.NoError(t, err)
+
+		assert.Len(t, sender.sent, 1)
+		assert.Equal(t, failed[0].EventID, sender.sent[0].header.Get(webhook.HeaderID))
+
+		delivery, _ := repository.GetWebhookDelivery("testMerchantID", replay.ID)
+		assert.Equal(t, entities.WebhookDeliverySucceeded, delivery.Status)
+	})
+
+	t.Run("should fail deliveries of deleted endpoints", func(t *testing.T) {
+		disputedID := pay(t)
+
+		err := service.DeliverWebhooks()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sender.sent = nil
+
+		dispute, err := service.OpenDispute(testActor, entities.Dispute{
+			MerchantID: "testMerchantID",
+			PaymentID:  disputedID,
+			Reason:     entities.DisputeReasonFraudulent,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = service.ResolveDispute(testActor, "testMerchantID", dispute.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		deliveries := pending()
+		assert.Len(t, deliveries, 1)
+		assert.Equal(t, entities.WebhookEventPaymentChargedBack, deliveries[0].EventType)
+
+		err = service.DeleteWebhookEndpoint(
+			testActor,
+			"testMerchantID",
+			deliveries[0].EndpointID,
+		)
+		assert.NoError(t, err)
+
+		// tested function
+		err = service.DeliverWebhooks()
+		assert.NoError(t, err)
+
+		assert.Empty(t, sender.sent)
+
+		delivery, _ := repository.GetWebhookDelivery("testMerchantID", deliveries[0].ID)
+		assert.Equal(t, entities.WebhookDeliveryFailed, delivery.Status)
+		assert.Equal(t, 0, delivery.Attempts)
+
+		// tested function
+		_, err = service.ReplayWebhookDelivery(testActor, "testMerchantID", delivery.ID)
+		assert.ErrorIs(t, err, ErrWebhookEndpointDeleted)
+	})
+}
+
+// decliningBank declines card transactions while decline is set, keeps the last charged card and
+// calls onCharge before every transaction
+type decliningBank struct {
+	*simulator.BankSimulator
+	decline  bool
+	charged  entities.CardDetails
+	onCharge func()
+}
+
+func (b *decliningBank) ProcessTransaction(
+	account entities.AccountDetails,
+	card entities.CardDetails,
+	amount entities.Money,
+) (string, error) {
+	b.charged = card
+
+	if b.onCharge != nil {
+		b.onCharge()
+	}
+
+	if b.decline {
+		return "", errors.New("card declined")
+	}
+
+	return b.BankSimulator.ProcessTransaction(account, card, amount)
+}
+
+func TestSubscriptions(t *testing.T) {
+	logger := slog.Default()
+
+	newUUID = func() uuid.UUID {
+		return uuid.New()
+	}
+
+	start := time.Date(2024, time.January, 31, 12, 0, 0, 0, time.UTC)
+
+	at := func(at time.Time) {
+		now = func() time.Time {
+			return at
+		}
 	}
 
-	got, err := service.storage.GetPayment(input.Merchant.ID, newUUID().String())
-	if err != nil {
-		t.Errorf("error getting payment: %v", err)
+	ms := func(t time.Time) int64 {
+		return t.UnixNano() / int64(time.Millisecond)
 	}
 
-	want := entities.Payment{
-		ID: "00000000-0000-0000-0000-000000000000",
-		Merchant: entities.Merchant{
-			ID: "testMerchantID",
-			AccountDetails: entities.AccountDetails{
-				Name:     "Test Merchant",
-				IBAN:     "DE89370400440532013000",
-				BIC:      "COBADEFFXXX",
-				Currency: "EUR",
-			},
-		},
-		Customer: entities.Customer{
-			ID: "testCustomerID",
-			CardDetails: entities.CardDetails{
+	setup := func(trialDays int) (*Service, *decliningBank, entities.Subscription) {
+		bank := &decliningBank{BankSimulator: simulator.NewBankSimulator(logger)}
+		service := NewService(
+			newTestRepository(),
+			bank,
+			risk.NewEngine(risk.DefaultConfig()),
+			newTestConverter(),
+			blobstore.NewMemory(),
+			&testSender{},
+			logger,
+		)
+
+		at(start)
+
+		plan, err := service.CreatePlan(testActor, entities.Plan{
+			MerchantID: "testMerchantID",
+			Name:       "Pro",
+			Price:      entities.Money{Amount: 1500, Currency: "EUR"},
+			Interval:   entities.PlanIntervalMonth,
+			TrialDays:  trialDays,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		paymentMethodID, err := service.CreatePaymentMethod(
+			testActor,
+			entities.PaymentMethod{MerchantID: "testMerchantID", CustomerID: "testCustomerID"},
+			entities.CardDetails{
+				Number:         "4111111111111111",
 				Name:           "Test Customer",
-				Number:         "1234567890123456",
 				SecurityCode:   123,
-				ExpirationDate: "12/23",
+				ExpirationDate: "12/30",
 			},
-		},
-		Price:             entities.Money{Amount: 100, Currency: "USD"},
-		BankTransactionID: "simulatedTransactionID",
-		Timestamp:         100000,
-		Refunded:          false,
-		RefundTimestamp:   0,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		subscription, err := service.CreateSubscription(testActor, entities.Subscription{
+			MerchantID:      "testMerchantID",
+			PlanID:          plan.ID,
+			CustomerID:      "testCustomerID",
+			PaymentMethodID: paymentMethodID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return service, bank, subscription
 	}
 
-	assert.Equal(t, got, want)
+	t.Run("should charge after the trial", func(t *testing.T) {
+		service, _, subscription := setup(7)
+		trialEnd := start.AddDate(0, 0, 7)
+
+		assert.Equal(t, entities.SubscriptionStatusActive, subscription.Status)
+		assert.Equal(t, ms(trialEnd), subscription.TrialEnd)
+		assert.Equal(t, ms(trialEnd), subscription.NextAttempt)
+
+		at(start.Add(time.Hour))
+
+		// tested function
+		err := service.BillSubscriptions(testActor)
+		assert.NoError(t, err)
+
+		got, _ := service.GetSubscription("testMerchantID", subscription.ID)
+		assert.Equal(t, 0, got.PeriodsBilled)
+		assert.Empty(t, got.LastPaymentID)
+
+		at(trialEnd)
+
+		// tested function
+		err = service.BillSubscriptions(testActor)
+		assert.NoError(t, err)
+
+		got, _ = service.GetSubscription("testMerchantID", subscription.ID)
+		assert.Equal(t, entities.SubscriptionStatusActive, got.Status)
+		assert.Equal(t, 1, got.PeriodsBilled)
+		assert.Equal(t, ms(trialEnd), got.CurrentPeriodStart)
+		assert.Equal(t, ms(trialEnd.AddDate(0, 1, 0)), got.CurrentPeriodEnd)
+		assert.Equal(t, got.CurrentPeriodEnd, got.NextAttempt)
+
+		payment, err := service.storage.GetPayment("testMerchantID", got.LastPaymentID)
+		assert.NoError(t, err)
+		assert.Equal(t, entities.Money{Amount: 1500, Currency: "EUR"}, payment.Price)
+		assert.Equal(t, subscription.PaymentMethodID, payment.PaymentMethodID)
+	})
+
+	t.Run("should keep the billing day at the end of the month", func(t *testing.T) {
+		service, _, subscription := setup(0)
+
+		periods := []time.Time{
+			start,
+			time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC),
+			time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC),
+			time.Date(2024, time.April, 30, 12, 0, 0, 0, time.UTC),
+		}
+
+		for i, period := range periods[:len(periods)-1] {
+			at(period)
+
+			// tested function
+			err := service.BillSubscriptions(testActor)
+			assert.NoError(t, err)
+
+			got, _ := service.GetSubscription("testMerchantID", subscription.ID)
+			assert.Equal(t, i+1, got.PeriodsBilled)
+			assert.Equal(t, ms(period), got.CurrentPeriodStart)
+			assert.Equal(t, ms(periods[i+1]), got.CurrentPeriodEnd)
+		}
+	})
+
+	t.Run("should retry failed charges while past due", func(t *testing.T) {
+		service, bank, subscription := setup(0)
+
+		bank.decline = true
+
+		// tested function
+		err := service.BillSubscriptions(testActor)
+		assert.NoError(t, err)
+
+		got, _ := service.GetSubscription("testMerchantID", subscription.ID)
+		assert.Equal(t, entities.SubscriptionStatusPastDue, got.Status)
+		assert.Equal(t, 1, got.FailedAttempts)
+		assert.Equal(t, "card declined", got.LastError)
+		assert.Equal(t, ms(start.Add(24*time.Hour)), got.NextAttempt)
+
+		at(start.Add(time.Hour))
+
+		// tested function
+		err = service.BillSubscriptions(testActor)
+		assert.NoError(t, err)
+
+		got, _ = service.GetSubscription("testMerchantID", subscription.ID)
+		assert.Equal(t, 1, got.FailedAttempts)
+
+		bank.decline = false
+		at(start.Add(24 * time.Hour))
+
+		// tested function
+		err = service.BillSubscriptions(testActor)
+		assert.NoError(t, err)
+
+		got, _ = service.GetSubscription("testMerchantID", subscription.ID)
+		assert.Equal(t, entities.SubscriptionStatusActive, got.Status)
+		assert.Equal(t, 0, got.FailedAttempts)
+		assert.Empty(t, got.LastError)
+		assert.Equal(t, 1, got.PeriodsBilled)
+		assert.Equal(t, ms(start), got.CurrentPeriodStart)
+		assert.NotEmpty(t, got.LastPaymentID)
+
+		events, _, _ := service.ListAuditEvents(
+			"testMerchantID",
+			storage.AuditEventFilter{Action: entities.AuditActionSubscriptionUpdate},
+		)
+		assert.Len(t, events, 2)
+	})
+
+	t.Run("should cancel after the last failed charge", func(t *testing.T) {
+		service, bank, subscription := setup(0)
+
+		bank.decline = true
+
+		for i := range subscriptionMaxFailedAttempts {
+			at(start.Add(time.Duration(i) * subscriptionRetryDelay))
+
+			// tested function
+			err := service.BillSubscriptions(testActor)
+			assert.NoError(t, err)
+		}
+
+		got, _ := service.GetSubscription("testMerchantID", subscription.ID)
+		assert.Equal(t, entities.SubscriptionStatusCancelled, got.Status)
+		assert.Equal(t, subscriptionMaxFailedAttempts, got.FailedAttempts)
+		assert.NotZero(t, got.CancelledTimestamp)
+
+		bank.decline = false
+		at(start.Add(30 * 24 * time.Hour))
+
+		// tested function
+		err := service.BillSubscriptions(testActor)
+		assert.NoError(t, err)
+
+		got, _ = service.GetSubscription("testMerchantID", subscription.ID)
+		assert.Empty(t, got.LastPaymentID)
+	})
+
+	t.Run("should not charge cancelled subscriptions", func(t *testing.T) {
+		service, _, subscription := setup(0)
+
+		// tested function
+		cancelled, err := service.CancelSubscription(
+			testActor,
+			"testMerchantID",
+			subscription.ID,
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, entities.SubscriptionStatusCancelled, cancelled.Status)
+
+		// tested function
+		_, err = service.CancelSubscription(testActor, "testMerchantID", subscription.ID)
+		assert.ErrorIs(t, err, ErrSubscriptionCancelled)
+
+		// tested function
+		err = service.BillSubscriptions(testActor)
+		assert.NoError(t, err)
+
+		got, _ := service.GetSubscription("testMerchantID", subscription.ID)
+		assert.Equal(t, 0, got.PeriodsBilled)
+
+		active, _ := service.ListSubscriptions(
+			"testMerchantID",
+			entities.SubscriptionStatusActive,
+		)
+		assert.Empty(t, active)
+	})
+
+	t.Run("should not charge subscriptions claimed by another run", func(t *testing.T) {
+		service, _, subscription := setup(0)
+
+		// tested function
+		err := service.BillSubscriptions(testActor)
+		assert.NoError(t, err)
+
+		// tested function
+		err = service.billSubscription(testActor, subscription)
+		assert.NoError(t, err)
+
+		got, _ := service.GetSubscription("testMerchantID", subscription.ID)
+		assert.Equal(t, 1, got.PeriodsBilled)
+
+		events, _, _ := service.ListAuditEvents(
+			"testMerchantID",
+			storage.AuditEventFilter{Action: entities.AuditActionPaymentCreate},
+		)
+		assert.Len(t, events, 1)
+	})
+
+	t.Run("should keep subscriptions cancelled while they are charged", func(t *testing.T) {
+		service, bank, subscription := setup(0)
+
+		bank.onCharge = func() {
+			_, err := service.CancelSubscription(testActor, "testMerchantID", subscription.ID)
+			assert.NoError(t, err)
+		}
+
+		// tested function
+		err := service.BillSubscriptions(testActor)
+		assert.ErrorIs(t, err, storage.ErrConflict)
+
+		got, _ := service.GetSubscription("testMerchantID", subscription.ID)
+		assert.Equal(t, entities.SubscriptionStatusCancelled, got.Status)
+		assert.Equal(t, 0, got.PeriodsBilled)
+	})
+
+	t.Run("should reject unknown plans and payment methods", func(t *testing.T) {
+		service, _, subscription := setup(0)
+
+		// tested function
+		_, err := service.CreateSubscription(testActor, entities.Subscription{
+			MerchantID:      "testMerchantID",
+			PlanID:          "unknownPlanID",
+			CustomerID:      "testCustomerID",
+			PaymentMethodID: subscription.PaymentMethodID,
+		})
+		assert.ErrorIs(t, err, ErrUnknownPlan)
+
+		// tested function
+		_, err = service.CreateSubscription(testActor, entities.Subscription{
+			MerchantID:      "testMerchantID",
+			PlanID:          subscription.PlanID,
+			CustomerID:      "otherCustomerID",
+			PaymentMethodID: subscription.PaymentMethodID,
+		})
+		assert.ErrorIs(t, err, ErrUnknownPaymentMethod)
+	})
 }
 
 func TestGetPaymentDetails(t *testing.T) {
 	logger := slog.Default()
-	service := NewService(storage.NewMemoryRepository(), simulator.NewBankSimulator(logger), logger)
+	service := NewService(
+		storage.NewMemoryRepository(),
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
 	input := entities.Payment{
 		ID: "00000000-0000-0000-0000-000000000000",
 		Merchant: entities.Merchant{
@@ -140,7 +2018,15 @@ func TestGetPaymentDetails(t *testing.T) {
 
 func TestRefundPayment(t *testing.T) {
 	logger := slog.Default()
-	service := NewService(storage.NewMemoryRepository(), simulator.NewBankSimulator(logger), logger)
+	service := NewService(
+		newTestRepository(),
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
 	now = func() time.Time {
 		return time.Unix(100, 100)
 	}
@@ -176,7 +2062,7 @@ func TestRefundPayment(t *testing.T) {
 	_ = service.storage.CreateNewPayment(input)
 
 	// tested function
-	err := service.RefundPayment("testMerchantID", "00000000-0000-0000-0000-000000000000")
+	err := service.RefundPayment(testActor, "testMerchantID", "00000000-0000-0000-0000-000000000000")
 	if err != nil {
 		t.Errorf("error refunding payment: %v", err)
 	}
@@ -212,3 +2098,573 @@ func TestRefundPayment(t *testing.T) {
 
 	assert.Equal(t, got, want)
 }
+
+func TestCreateNewPaymentWithPaymentMethod(t *testing.T) {
+	logger := slog.Default()
+	bank := &decliningBank{BankSimulator: simulator.NewBankSimulator(logger)}
+	service := NewService(
+		newTestRepository(),
+		bank,
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
+	now = func() time.Time {
+		return time.Unix(100, 100)
+	}
+
+	newUUID = func() uuid.UUID {
+		return uuid.MustParse("00000000-0000-0000-0000-000000000000")
+	}
+
+	paymentMethodID, err := service.CreatePaymentMethod(
+		testActor,
+		entities.PaymentMethod{MerchantID: "testMerchantID", CustomerID: "testCustomerID"},
+		entities.CardDetails{
+			Number:         "1234567890123456",
+			Name:           "Test Customer",
+			SecurityCode:   123,
+			ExpirationDate: "12/23",
+		},
+	)
+	if err != nil {
+		t.Errorf("error creating payment method: %v", err)
+	}
+
+	stored, err := service.storage.GetPaymentMethod(
+		"testMerchantID",
+		"testCustomerID",
+		paymentMethodID,
+	)
+	if err != nil {
+		t.Errorf("error getting payment method: %v", err)
+	}
+
+	assert.NotEmpty(t, stored.CardToken)
+	assert.NotContains(t, stored.CardToken, "1234567890123456")
+	assert.Equal(t, "3456", stored.CardLast4)
+
+	newUUID = func() uuid.UUID {
+		return uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	}
+
+	input := entities.Payment{
+		Merchant:        entities.Merchant{ID: "testMerchantID"},
+		Customer:        entities.Customer{ID: "testCustomerID"},
+		PaymentMethodID: paymentMethodID,
+		Price:           entities.Money{Amount: 100, Currency: "USD"},
+	}
+
+	// tested function
+	paymentID, err := service.CreateNewPayment(testActor, input)
+	if err != nil {
+		t.Errorf("error creating new payment: %v", err)
+	}
+
+	got, err := service.storage.GetPayment("testMerchantID", paymentID)
+	if err != nil {
+		t.Errorf("error getting payment: %v", err)
+	}
+
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", got.PaymentMethodID)
+	assert.Equal(t, "3456", got.CardLast4)
+	assert.Equal(t, entities.CardBrandUnknown, got.CardBrand)
+	assert.Equal(t, entities.CardDetails{ExpirationDate: "12/23"}, got.Customer.CardDetails)
+
+	// the resolved card is only passed to the bank
+	assert.Equal(t, entities.CardDetails{
+		Name:           "Test Customer",
+		Number:         "1234567890123456",
+		ExpirationDate: "12/23",
+	}, bank.charged)
+
+	methods, err := service.ListPaymentMethods("testMerchantID", "testCustomerID")
+	if err != nil {
+		t.Errorf("error listing payment methods: %v", err)
+	}
+
+	assert.Equal(t, []entities.PaymentMethodDetails{
+		{
+			ID:             "00000000-0000-0000-0000-000000000000",
+			CustomerID:     "testCustomerID",
+			CardName:       "Test Customer",
+			CardLast4:      "3456",
+			CardExpiryDate: "12/23",
+			Timestamp:      100000,
+		},
+	}, methods)
+}
+
+func TestCreateNewPaymentBlocked(t *testing.T) {
+	logger := slog.Default()
+	service := NewService(
+		newTestRepository(),
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.Config{
+			ReviewScore: 10,
+			BlockScore:  10,
+			AmountThresholds: []risk.AmountThresholdRule{
+				{Currency: "USD", Amount: 50, Score: 10},
+			},
+		}),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
+
+	input := entities.Payment{
+		Merchant: entities.Merchant{ID: "testMerchantID"},
+		Customer: entities.Customer{
+			ID: "testCustomerID",
+			CardDetails: entities.CardDetails{
+				Number:         "1234567890123456",
+				Name:           "Test Customer",
+				SecurityCode:   123,
+				ExpirationDate: "12/23",
+			},
+		},
+		Price: entities.Money{Amount: 100, Currency: "USD"},
+	}
+
+	// tested function
+	_, err := service.CreateNewPayment(testActor, input)
+
+	assert.ErrorIs(t, err, ErrPaymentBlocked)
+}
+
+func TestCreateNewPaymentLimits(t *testing.T) {
+	logger := slog.Default()
+	repository := storage.NewMemoryRepository()
+	service := NewService(
+		repository,
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
+	now = func() time.Time {
+		return time.Unix(100, 100)
+	}
+
+	merchant := testMerchant
+	merchant.Limits = entities.Limits{
+		MaxPaymentAmount: map[string]int64{"USD": 500},
+		DailyVolume:      map[string]int64{"USD": 1000},
+		MaxRefundsPerDay: 1,
+	}
+
+	_ = repository.CreateMerchant(merchant)
+
+	payment := func(amount int64) entities.Payment {
+		return entities.Payment{
+			Merchant: entities.Merchant{ID: "testMerchantID"},
+			Customer: entities.Customer{
+				ID: "testCustomerID",
+				CardDetails: entities.CardDetails{
+					Number:         "1234567890123456",
+					Name:           "Test Customer",
+					SecurityCode:   123,
+					ExpirationDate: "12/23",
+				},
+			},
+			Price: entities.Money{Amount: amount, Currency: "USD"},
+		}
+	}
+
+	t.Run("should reject a payment above the single payment limit", func(t *testing.T) {
+		// tested function
+		_, err := service.CreateNewPayment(testActor, payment(600))
+
+		assert.Equal(t, &LimitExceededError{Limit: entities.LimitMaxPaymentAmount}, err)
+	})
+
+	t.Run("should reject a payment above the daily volume", func(t *testing.T) {
+		newUUID = func() uuid.UUID {
+			return uuid.MustParse("00000000-0000-0000-0000-000000000000")
+		}
+
+		_, err := service.CreateNewPayment(testActor, payment(500))
+		assert.NoError(t, err)
+
+		newUUID = func() uuid.UUID {
+			return uuid.MustParse("11111111-1111-1111-1111-111111111111")
+		}
+
+		_, err = service.CreateNewPayment(testActor, payment(400))
+		assert.NoError(t, err)
+
+		// tested function
+		_, err = service.CreateNewPayment(testActor, payment(200))
+
+		assert.Equal(t, &LimitExceededError{Limit: entities.LimitDailyVolume}, err)
+
+		newUUID = func() uuid.UUID {
+			return uuid.MustParse("22222222-2222-2222-2222-222222222222")
+		}
+
+		// the rejected payment must not count towards the volume
+		_, err = service.CreateNewPayment(testActor, payment(100))
+		assert.NoError(t, err)
+	})
+
+	t.Run("should reject refunds above the daily limit", func(t *testing.T) {
+		err := service.RefundPayment(
+			testActor,
+			"testMerchantID",
+			"00000000-0000-0000-0000-000000000000",
+		)
+		assert.NoError(t, err)
+
+		// tested function
+		err = service.RefundPayment(
+			testActor,
+			"testMerchantID",
+			"11111111-1111-1111-1111-111111111111",
+		)
+
+		assert.Equal(t, &LimitExceededError{Limit: entities.LimitMaxRefundsPerDay}, err)
+	})
+}
+
+func TestIsTokenRevoked(t *testing.T) {
+	logger := slog.Default()
+	repository := storage.NewMemoryRepository()
+	service := NewService(
+		repository,
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
+
+	t0 := time.Unix(1000, 0)
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	expires := t0.Add(time.Hour)
+
+	t.Run("should report revoked tokens", func(t *testing.T) {
+		err := service.RevokeToken(testActor, "testMerchantID", "revokedToken", expires)
+		assert.NoError(t, err)
+
+		revoked, err := service.IsTokenRevoked("revokedToken", expires)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+
+	t.Run("should cache active tokens until the cache TTL passes", func(t *testing.T) {
+		revoked, err := service.IsTokenRevoked("activeToken", expires)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+
+		// NOTE: revoked through the storage as another instance would
+		err = repository.RevokeToken("activeToken", "testMerchantID", expires.Unix())
+		assert.NoError(t, err)
+
+		revoked, err = service.IsTokenRevoked("activeToken", expires)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+
+		now = func() time.Time { return t0.Add(revocationCacheTTL + time.Second) }
+
+		revoked, err = service.IsTokenRevoked("activeToken", expires)
+		assert.NoError(t, err)
+		assert.True(t, revoked)
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	logger := slog.Default()
+	repository := storage.NewMemoryRepository()
+	service := NewService(
+		repository,
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
+
+	now = time.Now
+	newUUID = uuid.New
+
+	actor := entities.Actor{
+		Type:      entities.ActorTypeAPIKey,
+		ID:        "testKeyID",
+		IPAddress: "10.0.0.1",
+		RequestID: "testRequestID",
+	}
+
+	key, _, err := service.CreateAPIKey(actor, "testMerchantID", "key", entities.Scopes, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.RevokeAPIKey(actor, "testMerchantID", key.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.RevokeAPIKey(actor, "testMerchantID", "unknownKeyID")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	events, valid, err := service.ListAuditEvents("testMerchantID", storage.AuditEventFilter{})
+	assert.NoError(t, err)
+	assert.True(t, valid)
+	assert.Len(t, events, 3)
+
+	t.Run("should record actions with their actor and state", func(t *testing.T) {
+		created := events[0]
+		assert.Equal(t, int64(1), created.Sequence)
+		assert.Equal(t, entities.AuditActionAPIKeyCreate, created.Action)
+		assert.Equal(t, actor, created.Actor)
+		assert.Equal(t, key.ID, created.ResourceID)
+		assert.Equal(t, entities.AuditOutcomeSuccess, created.Outcome)
+		assert.Nil(t, created.Before)
+		assert.Contains(t, string(created.After), `"Revoked":false`)
+		assert.NotContains(t, string(created.After), key.SecretHash)
+
+		revoked := events[1]
+		assert.Equal(t, entities.AuditActionAPIKeyRevoke, revoked.Action)
+		assert.Contains(t, string(revoked.Before), `"Revoked":false`)
+		assert.Contains(t, string(revoked.After), `"Revoked":true`)
+	})
+
+	t.Run("should record failed actions", func(t *testing.T) {
+		failed := events[2]
+		assert.Equal(t, entities.AuditOutcomeFailure, failed.Outcome)
+		assert.Equal(t, storage.ErrNotFound.Error(), failed.Error)
+		assert.Equal(t, "unknownKeyID", failed.ResourceID)
+	})
+
+	t.Run("should chain event hashes", func(t *testing.T) {
+		assert.Empty(t, events[0].PreviousHash)
+		assert.Equal(t, events[0].Hash, events[1].PreviousHash)
+		assert.Equal(t, events[1].Hash, events[2].PreviousHash)
+	})
+
+	t.Run("should detect tampered events", func(t *testing.T) {
+		tampered := slices.Clone(events)
+		tampered[1].Actor.ID = "otherKeyID"
+		assert.False(t, entities.VerifyAuditChain(tampered, 0))
+
+		// NOTE: rehashing the changed event still breaks the link to the next one
+		tampered[1].Hash = tampered[1].ComputeHash()
+		assert.False(t, entities.VerifyAuditChain(tampered, 0))
+	})
+
+	t.Run("should detect removed events", func(t *testing.T) {
+		assert.True(t, entities.VerifyAuditChain(events[1:], 1))
+
+		// NOTE: a removed event breaks the chain even when the following events are rehashed
+		removed := slices.Delete(slices.Clone(events), 1, 2)
+		removed[1].PreviousHash = removed[0].Hash
+		removed[1].Hash = removed[1].ComputeHash()
+		assert.False(t, entities.VerifyAuditChain(removed, 0))
+
+		assert.False(t, entities.VerifyAuditChain(events[1:], 0))
+	})
+
+	t.Run("should filter events", func(t *testing.T) {
+		filtered, valid, err := service.ListAuditEvents(
+			"testMerchantID",
+			storage.AuditEventFilter{Action: entities.AuditActionAPIKeyRevoke, AfterSequence: 2},
+		)
+		assert.NoError(t, err)
+		assert.True(t, valid)
+		assert.Len(t, filtered, 1)
+		assert.Equal(t, int64(3), filtered[0].Sequence)
+	})
+
+	t.Run("should verify the whole range of filtered events", func(t *testing.T) {
+		// NOTE: the event skips a sequence number as if the event before it was removed
+		forged := entities.AuditEvent{
+			MerchantID:   "testMerchantID",
+			Sequence:     5,
+			Action:       entities.AuditActionAPIKeyRevoke,
+			Actor:        actor,
+			ResourceID:   key.ID,
+			Outcome:      entities.AuditOutcomeSuccess,
+			PreviousHash: events[2].Hash,
+		}
+		forged.Hash = forged.ComputeHash()
+
+		err := repository.CreateAuditEvent(forged)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// tested function
+		filtered, valid, err := service.ListAuditEvents(
+			"testMerchantID",
+			storage.AuditEventFilter{Action: entities.AuditActionAPIKeyRevoke},
+		)
+		assert.NoError(t, err)
+		assert.False(t, valid)
+		assert.Len(t, filtered, 3)
+	})
+}
+
+func TestManageMerchants(t *testing.T) {
+	logger := slog.Default()
+	service := NewService(
+		storage.NewMemoryRepository(),
+		simulator.NewBankSimulator(logger),
+		risk.NewEngine(risk.DefaultConfig()),
+		newTestConverter(),
+		blobstore.NewMemory(),
+		&testSender{},
+		logger,
+	)
+
+	now = func() time.Time { return time.Unix(100, 0) }
+	defer func() { now = time.Now }()
+
+	payment := entities.Payment{
+		Merchant: entities.Merchant{ID: "testMerchantID"},
+		Customer: entities.Customer{
+			ID: "testCustomerID",
+			CardDetails: entities.CardDetails{
+				Number:         "1234567890123456",
+				Name:           "Test Customer",
+				SecurityCode:   123,
+				ExpirationDate: "12/23",
+			},
+		},
+		Price: entities.Money{Amount: 100, Currency: "USD"},
+	}
+
+	t.Run("should reject payments for unknown merchants", func(t *testing.T) {
+		_, err := service.CreateNewPayment(testActor, payment)
+		assert.ErrorIs(t, err, ErrMerchantInactive)
+	})
+
+	t.Run("should create merchants", func(t *testing.T) {
+		merchant, err := service.CreateMerchant(testActor, testMerchant)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(100000), merchant.Timestamp)
+
+		_, err = service.CreateMerchant(testActor, testMerchant)
+		assert.ErrorIs(t, err, storage.ErrConflict)
+
+		_, err = service.CreateNewPayment(testActor, payment)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should update merchants", func(t *testing.T) {
+		details := testMerchant.AccountDetails
+		details.Name = "Renamed Merchant"
+
+		limits := entities.Limits{MaxRefundsPerDay: 5}
+		plan := entities.PricingPlan{Rules: []entities.FeeRule{{Percentage: "0.01"}}}
+
+		merchant, err := service.UpdateMerchant(testActor, "testMerchantID", details, limits, plan)
+		assert.NoError(t, err)
+		assert.Equal(t, details, merchant.AccountDetails)
+		assert.Equal(t, limits, merchant.Limits)
+		assert.Equal(t, plan, merchant.PricingPlan)
+
+		_, err = service.UpdateMerchant(testActor, "unknownMerchantID", details, limits, plan)
+		assert.ErrorIs(t, err, storage.ErrNotFound)
+
+		invalidPlan := entities.PricingPlan{RefundPolicy: "unknown"}
+
+		_, err = service.UpdateMerchant(testActor, "testMerchantID", details, limits, invalidPlan)
+		assert.ErrorIs(t, err, entities.ErrInvalidPricingPlan)
+
+		details.IBAN = "DE89370400440532013001"
+
+		_, err = service.UpdateMerchant(testActor, "testMerchantID", details, limits, plan)
+		assert.ErrorIs(t, err, entities.ErrInvalidAccountDetails)
+	})
+
+	t.Run("should reject payments for deactivated merchants", func(t *testing.T) {
+		merchant, err := service.DeactivateMerchant(testActor, "testMerchantID")
+		assert.NoError(t, err)
+		assert.True(t, merchant.Deactivated)
+		assert.Equal(t, int64(100000), merchant.DeactivatedTimestamp)
+
+		_, err = service.CreateNewPayment(testActor, payment)
+		assert.ErrorIs(t, err, ErrMerchantInactive)
+	})
+
+	t.Run("should audit merchant changes", func(t *testing.T) {
+		events, valid, err := service.ListAuditEvents(
+			"testMerchantID",
+			storage.AuditEventFilter{ResourceID: "testMerchantID"},
+		)
+		assert.NoError(t, err)
+		assert.True(t, valid)
+
+		actions := make([]string, 0, len(events))
+		for _, event := range events {
+			actions = append(actions, event.Action+" "+event.Outcome)
+		}
+
+		assert.Equal(t, []string{
+			"merchant.create success",
+			"merchant.create failure",
+			"merchant.update success",
+			"merchant.deactivate success",
+		}, actions)
+	})
+
+	t.Run("should reject changes of merchants changed since they were read", func(t *testing.T) {
+		repository := &racingMerchantRepository{MemoryRepository: storage.NewMemoryRepository()}
+		service := NewService(
+			repository,
+			simulator.NewBankSimulator(logger),
+			risk.NewEngine(risk.DefaultConfig()),
+			newTestConverter(),
+			blobstore.NewMemory(),
+			&testSender{},
+			logger,
+		)
+
+		_, err := service.CreateMerchant(testActor, testMerchant)
+		assert.NoError(t, err)
+
+		repository.race = true
+
+		// tested function
+		_, err = service.DeactivateMerchant(testActor, "testMerchantID")
+		assert.ErrorIs(t, err, storage.ErrConflict)
+
+		merchant, err := service.GetMerchant("testMerchantID")
+		assert.NoError(t, err)
+		assert.False(t, merchant.Deactivated)
+		assert.Equal(t, "Raced Merchant", merchant.AccountDetails.Name)
+	})
+}
+
+// racingMerchantRepository renames the merchant right after it is read when race is set, as a
+// concurrent update would
+type racingMerchantRepository struct {
+	*storage.MemoryRepository
+	race bool
+}
+
+func (r *racingMerchantRepository) GetMerchantDetails(
+	merchantID string,
+) (entities.Merchant, error) {
+	merchant, err := r.MemoryRepository.GetMerchantDetails(merchantID)
+	if err != nil || !r.race {
+		return merchant, err
+	}
+
+	r.race = false
+
+	raced := merchant
+	raced.AccountDetails.Name = "Raced Merchant"
+	raced.UpdatedTimestamp = merchant.UpdatedTimestamp + 1
+
+	return merchant, r.MemoryRepository.UpdateMerchant(merchant, raced)
+}
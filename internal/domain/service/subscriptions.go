@@ -0,0 +1,471 @@
+package service
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+)
+
+var (
+	ErrUnknownPlan           = errors.New("subscription plan does not exist")
+	ErrSubscriptionCancelled = errors.New("subscription was already cancelled")
+)
+
+const (
+	// subscriptionRetryDelay is how long after a failed charge the subscription is charged again
+	subscriptionRetryDelay = 24 * time.Hour
+	// subscriptionLease is how long a subscription claimed by a billing run is not charged by
+	// other runs, a run that stops before the subscription is updated is retried after it
+	subscriptionLease = 5 * time.Minute
+	// subscriptionUpdateRetries is how many times a cancellation is retried when the
+	// subscription is changed by a billing run in between
+	subscriptionUpdateRetries = 3
+	// subscriptionMaxFailedAttempts is how many charges of a period can fail in a row before the
+	// subscription is cancelled
+	subscriptionMaxFailedAttempts = 4
+)
+
+func (s *Service) CreatePlan(actor entities.Actor, plan entities.Plan) (entities.Plan, error) {
+	created, err := s.createPlan(plan)
+
+	var after any
+	if err == nil {
+		after = created
+	}
+
+	s.recordAuditEvent(
+		actor,
+		plan.MerchantID,
+		entities.AuditActionPlanCreate,
+		created.ID,
+		nil,
+		after,
+		err,
+	)
+
+	return created, err
+}
+
+func (s *Service) createPlan(plan entities.Plan) (entities.Plan, error) {
+	err := plan.Price.Validate()
+	if err != nil {
+		return entities.Plan{}, err
+	}
+
+	plan.ID = newUUID().String()
+	plan.Timestamp = now().UnixNano() / int64(time.Millisecond)
+
+	err = s.storage.CreatePlan(plan)
+	if err != nil {
+		s.logger.Error("error creating plan", "error", err)
+		return entities.Plan{}, err
+	}
+
+	s.logger.Info("plan created", "planID", plan.ID)
+
+	return plan, nil
+}
+
+func (s *Service) ListPlans(merchantID string) ([]entities.Plan, error) {
+	plans, err := s.storage.ListPlans(merchantID)
+	if err != nil {
+		s.logger.Error("error listing plans", "error", err)
+		return nil, err
+	}
+
+	return plans, nil
+}
+
+// GetPlan returns storage.ErrNotFound when the merchant has no such plan
+func (s *Service) GetPlan(merchantID, planID string) (entities.Plan, error) {
+	plan, err := s.storage.GetPlan(merchantID, planID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Error("error getting plan", "error", err)
+		}
+		return entities.Plan{}, err
+	}
+
+	return plan, nil
+}
+
+// CreateSubscription subscribes the customer to the plan with one of their stored payment
+// methods, the first period is charged by the next billing run once the trial days of the plan
+// are over
+func (s *Service) CreateSubscription(
+	actor entities.Actor,
+	subscription entities.Subscription,
+) (entities.Subscription, error) {
+	created, err := s.createSubscription(subscription)
+
+	var after any
+	if err == nil {
+		after = created
+	}
+
+	s.recordAuditEvent(
+		actor,
+		subscription.MerchantID,
+		entities.AuditActionSubscriptionCreate,
+		created.ID,
+		nil,
+		after,
+		err,
+	)
+
+	return created, err
+}
+
+func (s *Service) createSubscription(
+	subscription entities.Subscription,
+) (entities.Subscription, error) {
+	plan, err := s.storage.GetPlan(subscription.MerchantID, subscription.PlanID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return entities.Subscription{}, ErrUnknownPlan
+		}
+
+		s.logger.Error("error getting plan", "error", err)
+		return entities.Subscription{}, err
+	}
+
+	_, err = s.storage.GetPaymentMethod(
+		subscription.MerchantID,
+		subscription.CustomerID,
+		subscription.PaymentMethodID,
+	)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return entities.Subscription{}, ErrUnknownPaymentMethod
+		}
+
+		s.logger.Error("error getting payment method", "error", err)
+		return entities.Subscription{}, err
+	}
+
+	timestamp := now().UnixNano() / int64(time.Millisecond)
+	anchor := timestamp
+
+	if plan.TrialDays > 0 {
+		anchor = timestamp + (time.Duration(plan.TrialDays) * 24 * time.Hour).Milliseconds()
+		subscription.TrialEnd = anchor
+	}
+
+	subscription.ID = newUUID().String()
+	subscription.Status = entities.SubscriptionStatusActive
+	subscription.BillingAnchor = anchor
+	subscription.PeriodsBilled = 0
+	subscription.CurrentPeriodStart = timestamp
+	subscription.CurrentPeriodEnd = anchor
+	subscription.NextAttempt = anchor
+	subscription.Timestamp = timestamp
+	subscription.UpdatedTimestamp = timestamp
+
+	err = s.storage.CreateSubscription(subscription)
+	if err != nil {
+		s.logger.Error("error creating subscription", "error", err)
+		return entities.Subscription{}, err
+	}
+
+	s.logger.Info("subscription created", "subscriptionID", subscription.ID, "planID", plan.ID)
+
+	return subscription, nil
+}
+
+func (s *Service) ListSubscriptions(merchantID, status string) ([]entities.Subscription, error) {
+	subscriptions, err := s.storage.ListSubscriptions(merchantID)
+	if err != nil {
+		s.logger.Error("error listing subscriptions", "error", err)
+		return nil, err
+	}
+
+	if status != "" {
+		subscriptions = slices.DeleteFunc(
+			subscriptions,
+			func(subscription entities.Subscription) bool {
+				return subscription.Status != status
+			},
+		)
+	}
+
+	return subscriptions, nil
+}
+
+// GetSubscription returns storage.ErrNotFound when the merchant has no such subscription
+func (s *Service) GetSubscription(
+	merchantID, subscriptionID string,
+) (entities.Subscription, error) {
+	subscription, err := s.storage.GetSubscription(merchantID, subscriptionID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Error("error getting subscription", "error", err)
+		}
+		return entities.Subscription{}, err
+	}
+
+	return subscription, nil
+}
+
+// CancelSubscription stops charging the subscription immediately, the current period is not
+// refunded
+func (s *Service) CancelSubscription(
+	actor entities.Actor,
+	merchantID, subscriptionID string,
+) (entities.Subscription, error) {
+	before, after, err := s.cancelSubscription(merchantID, subscriptionID)
+
+	var beforeState, afterState any
+	if before.ID != "" {
+		beforeState = before
+	}
+	if err == nil {
+		afterState = after
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionSubscriptionCancel,
+		subscriptionID,
+		beforeState,
+		afterState,
+		err,
+	)
+
+	return after, err
+}
+
+func (s *Service) cancelSubscription(
+	merchantID, subscriptionID string,
+) (before, after entities.Subscription, err error) {
+	for range subscriptionUpdateRetries {
+		before, after, err = s.tryCancelSubscription(merchantID, subscriptionID)
+		if !errors.Is(err, storage.ErrConflict) {
+			break
+		}
+	}
+
+	return before, after, err
+}
+
+func (s *Service) tryCancelSubscription(
+	merchantID, subscriptionID string,
+) (entities.Subscription, entities.Subscription, error) {
+	subscription, err := s.storage.GetSubscription(merchantID, subscriptionID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Error("error getting subscription", "error", err)
+		}
+		return entities.Subscription{}, entities.Subscription{}, err
+	}
+
+	before := subscription
+
+	if subscription.Status == entities.SubscriptionStatusCancelled {
+		return before, entities.Subscription{}, ErrSubscriptionCancelled
+	}
+
+	timestamp := now().UnixNano() / int64(time.Millisecond)
+
+	subscription.Status = entities.SubscriptionStatusCancelled
+	subscription.CancelledTimestamp = timestamp
+	subscription.UpdatedTimestamp = timestamp
+
+	err = s.storage.UpdateSubscription(before, subscription)
+	if err != nil {
+		if !errors.Is(err, storage.ErrConflict) {
+			s.logger.Error("error updating subscription", "error", err)
+		}
+		return before, entities.Subscription{}, err
+	}
+
+	s.logger.Info("subscription cancelled", "subscriptionID", subscription.ID)
+
+	return before, subscription, nil
+}
+
+// BillSubscriptions charges the subscriptions of every merchant that are due, a subscription is
+// charged for at most one period per run
+func (s *Service) BillSubscriptions(actor entities.Actor) error {
+	merchants, err := s.storage.ListMerchants()
+	if err != nil {
+		s.logger.Error("error listing merchants", "error", err)
+		return err
+	}
+
+	timestamp := now().UnixNano() / int64(time.Millisecond)
+
+	var errs []error
+
+	for _, merchant := range merchants {
+		subscriptions, err := s.storage.ListSubscriptions(merchant.ID)
+		if err != nil {
+			s.logger.Error(
+				"error listing subscriptions",
+				"merchantID", merchant.ID,
+				"error", err,
+			)
+			errs = append(errs, err)
+			continue
+		}
+
+		for _, subscription := range subscriptions {
+			if subscription.Status == entities.SubscriptionStatusCancelled ||
+				subscription.NextAttempt > timestamp {
+				continue
+			}
+
+			err := s.billSubscription(actor, subscription)
+			if err != nil {
+				s.logger.Error(
+					"error billing subscription",
+					"subscriptionID", subscription.ID,
+					"error", err,
+				)
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) billSubscription(
+	actor entities.Actor,
+	subscription entities.Subscription,
+) error {
+	timestamp := now().UnixNano() / int64(time.Millisecond)
+
+	// NOTE: the subscription is claimed for the lease before it is charged so that concurrent
+	// billing runs do not charge the same period twice
+	claimed := subscription
+	claimed.NextAttempt = timestamp + subscriptionLease.Milliseconds()
+	claimed.UpdatedTimestamp = timestamp
+
+	err := s.storage.UpdateSubscription(subscription, claimed)
+	if err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			s.logger.Info(
+				"subscription changed by another request",
+				"subscriptionID", subscription.ID,
+			)
+			return nil
+		}
+
+		s.logger.Error("error claiming subscription", "error", err)
+		return err
+	}
+
+	after, err := s.chargeSubscription(actor, claimed)
+
+	var afterState any
+	if err == nil {
+		afterState = after
+	}
+
+	s.recordAuditEvent(
+		actor,
+		subscription.MerchantID,
+		entities.AuditActionSubscriptionUpdate,
+		subscription.ID,
+		subscription,
+		afterState,
+		err,
+	)
+
+	return err
+}
+
+// chargeSubscription creates the payment of the next period of the claimed subscription and
+// returns the subscription moved to the following period, a failed charge makes the
+// subscription past due and is retried after subscriptionRetryDelay until the subscription is
+// cancelled after subscriptionMaxFailedAttempts. The update fails with storage.ErrConflict when
+// the subscription was cancelled while it was charged.
+//
+// NOTE: the payment is created before the subscription is updated, a run stopped in between
+// charges the period again once the lease expires
+func (s *Service) chargeSubscription(
+	actor entities.Actor,
+	claimed entities.Subscription,
+) (entities.Subscription, error) {
+	plan, err := s.storage.GetPlan(claimed.MerchantID, claimed.PlanID)
+	if err != nil {
+		s.logger.Error("error getting plan", "error", err)
+		return entities.Subscription{}, err
+	}
+
+	paymentID, chargeErr := s.CreateNewPayment(actor, entities.Payment{
+		Merchant:        entities.Merchant{ID: claimed.MerchantID},
+		Customer:        entities.Customer{ID: claimed.CustomerID},
+		PaymentMethodID: claimed.PaymentMethodID,
+		Price:           plan.Price,
+	})
+
+	subscription := claimed
+	timestamp := now().UnixNano() / int64(time.Millisecond)
+	subscription.UpdatedTimestamp = timestamp
+
+	if chargeErr == nil {
+		anchor := time.UnixMilli(subscription.BillingAnchor).UTC()
+		start := plan.PeriodStart(anchor, subscription.PeriodsBilled)
+		end := plan.PeriodStart(anchor, subscription.PeriodsBilled+1)
+
+		subscription.Status = entities.SubscriptionStatusActive
+		subscription.PeriodsBilled++
+		subscription.CurrentPeriodStart = start.UnixNano() / int64(time.Millisecond)
+		subscription.CurrentPeriodEnd = end.UnixNano() / int64(time.Millisecond)
+		subscription.NextAttempt = subscription.CurrentPeriodEnd
+		subscription.FailedAttempts = 0
+		subscription.LastPaymentID = paymentID
+		subscription.LastError = ""
+	} else {
+		subscription.FailedAttempts++
+		subscription.LastError = chargeErr.Error()
+
+		if subscription.FailedAttempts >= subscriptionMaxFailedAttempts {
+			subscription.Status = entities.SubscriptionStatusCancelled
+			subscription.CancelledTimestamp = timestamp
+		} else {
+			subscription.Status = entities.SubscriptionStatusPastDue
+			subscription.NextAttempt = timestamp + subscriptionRetryDelay.Milliseconds()
+		}
+	}
+
+	err = s.storage.UpdateSubscription(claimed, subscription)
+	if err != nil {
+		s.logger.Error(
+			"error updating subscription",
+			"subscriptionID", subscription.ID,
+			"paymentID", paymentID,
+			"error", err,
+		)
+		return entities.Subscription{}, err
+	}
+
+	switch subscription.Status {
+	case entities.SubscriptionStatusActive:
+		s.logger.Info(
+			"subscription charged",
+			"subscriptionID", subscription.ID,
+			"paymentID", paymentID,
+		)
+	case entities.SubscriptionStatusPastDue:
+		s.logger.Warn(
+			"subscription charge failed",
+			"subscriptionID", subscription.ID,
+			"attempts", subscription.FailedAttempts,
+			"error", chargeErr,
+		)
+	case entities.SubscriptionStatusCancelled:
+		s.logger.Warn(
+			"subscription cancelled after failed charges",
+			"subscriptionID", subscription.ID,
+			"error", chargeErr,
+		)
+	}
+
+	return subscription, nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+)
+
+// revocationCacheTTL bounds how long a token known not to be revoked is trusted without
+// checking the storage again, a revocation made through another instance takes at most
+// this long to be enforced everywhere
+var revocationCacheTTL = 30 * time.Second
+
+// revocationCacheSize is the number of entries above which expired entries are pruned
+const revocationCacheSize = 10000
+
+type revocationCacheEntry struct {
+	revoked bool
+	until   time.Time
+}
+
+type revocationCache struct {
+	mu      sync.Mutex
+	entries map[string]revocationCacheEntry
+}
+
+func newRevocationCache() *revocationCache {
+	return &revocationCache{entries: make(map[string]revocationCacheEntry)}
+}
+
+func (c *revocationCache) get(tokenID string) (bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[tokenID]
+	if !ok || now().After(entry.until) {
+		return false, false
+	}
+
+	return entry.revoked, true
+}
+
+func (c *revocationCache) set(tokenID string, revoked bool, until time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.entries) >= revocationCacheSize {
+		t := now()
+		for id, entry := range c.entries {
+			if t.After(entry.until) {
+				delete(c.entries, id)
+			}
+		}
+	}
+
+	c.entries[tokenID] = revocationCacheEntry{revoked: revoked, until: until}
+}
+
+// RevokeToken rejects the token for the rest of its lifetime
+func (s *Service) RevokeToken(
+	actor entities.Actor,
+	merchantID, tokenID string,
+	expires time.Time,
+) error {
+	err := s.storage.RevokeToken(tokenID, merchantID, expires.Unix())
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionTokenRevoke,
+		tokenID,
+		nil,
+		revokedTokenSnapshot{TokenID: tokenID, Expires: expires.Unix()},
+		err,
+	)
+
+	if err != nil {
+		s.logger.Error("error revoking token", "error", err)
+		return err
+	}
+
+	s.revocations.set(tokenID, true, expires)
+
+	s.logger.Info("token revoked", "tokenID", tokenID)
+
+	return nil
+}
+
+// IsTokenRevoked checks whether the token was revoked, answers are cached locally so that
+// authenticating a request does not need a storage read every time
+func (s *Service) IsTokenRevoked(tokenID string, expires time.Time) (bool, error) {
+	if revoked, ok := s.revocations.get(tokenID); ok {
+		return revoked, nil
+	}
+
+	revoked, err := s.storage.IsTokenRevoked(tokenID)
+	if err != nil {
+		s.logger.Error("error checking token revocation", "error", err)
+		return false, err
+	}
+
+	until := now().Add(revocationCacheTTL)
+	if revoked || expires.Before(until) {
+		until = expires
+	}
+
+	s.revocations.set(tokenID, revoked, until)
+
+	return revoked, nil
+}
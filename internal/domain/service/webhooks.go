@@ -0,0 +1,498 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+	"github.com/mgajewskik/payment-platform/internal/storage"
+	"github.com/mgajewskik/payment-platform/internal/webhook"
+)
+
+var (
+	ErrWebhookDeliveryPending = errors.New("webhook delivery is still pending")
+	ErrWebhookEndpointDeleted = errors.New("webhook endpoint was deleted")
+)
+
+const (
+	// webhookRetryPeriod is how long after the event failed deliveries are retried for
+	webhookRetryPeriod = 72 * time.Hour
+	// webhookInitialBackoff doubles after every failed attempt up to webhookMaxBackoff
+	webhookInitialBackoff = time.Minute
+	webhookMaxBackoff     = 6 * time.Hour
+	// webhookDeliveryLease is how long a claimed delivery is left to the worker attempting it,
+	// the delivery is attempted again after the lease when the worker stopped mid-attempt
+	webhookDeliveryLease = 5 * time.Minute
+	// webhookDeliveryBatch is the most deliveries attempted in one run
+	webhookDeliveryBatch = 100
+)
+
+// CreateWebhookEndpoint registers the endpoint for the event types, the returned endpoint holds
+// the secret deliveries are signed with which is not returned when listing endpoints
+func (s *Service) CreateWebhookEndpoint(
+	actor entities.Actor,
+	merchantID, url string,
+	eventTypes []string,
+) (entities.WebhookEndpoint, error) {
+	endpoint, err := s.createWebhookEndpoint(merchantID, url, eventTypes)
+
+	var after any
+	if err == nil {
+		after = newWebhookEndpointSnapshot(endpoint)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionWebhookEndpointCreate,
+		endpoint.ID,
+		nil,
+		after,
+		err,
+	)
+
+	return endpoint, err
+}
+
+func (s *Service) createWebhookEndpoint(
+	merchantID, url string,
+	eventTypes []string,
+) (entities.WebhookEndpoint, error) {
+	secret, err := newSecret()
+	if err != nil {
+		s.logger.Error("error generating webhook secret", "error", err)
+		return entities.WebhookEndpoint{}, err
+	}
+
+	endpoint := entities.WebhookEndpoint{
+		ID:         newUUID().String(),
+		MerchantID: merchantID,
+		URL:        url,
+		EventTypes: eventTypes,
+		Secret:     secret,
+		Timestamp:  now().UnixNano() / int64(time.Millisecond),
+	}
+
+	err = s.storage.CreateWebhookEndpoint(endpoint)
+	if err != nil {
+		s.logger.Error("error creating webhook endpoint", "error", err)
+		return entities.WebhookEndpoint{}, err
+	}
+
+	s.logger.Info("webhook endpoint created", "endpointID", endpoint.ID)
+
+	return endpoint, nil
+}
+
+func (s *Service) ListWebhookEndpoints(merchantID string) ([]entities.WebhookEndpoint, error) {
+	endpoints, err := s.storage.ListWebhookEndpoints(merchantID)
+	if err != nil {
+		s.logger.Error("error listing webhook endpoints", "error", err)
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+// DeleteWebhookEndpoint returns storage.ErrNotFound when the merchant has no such endpoint,
+// deliveries still pending for the endpoint fail when they are attempted
+func (s *Service) DeleteWebhookEndpoint(actor entities.Actor, merchantID, endpointID string) error {
+	before, err := s.deleteWebhookEndpoint(merchantID, endpointID)
+
+	var beforeState any
+	if before.ID != "" {
+		beforeState = newWebhookEndpointSnapshot(before)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionWebhookEndpointDelete,
+		endpointID,
+		beforeState,
+		nil,
+		err,
+	)
+
+	return err
+}
+
+// deleteWebhookEndpoint returns the endpoint before it was deleted
+func (s *Service) deleteWebhookEndpoint(
+	merchantID, endpointID string,
+) (entities.WebhookEndpoint, error) {
+	endpoint, err := s.storage.GetWebhookEndpoint(merchantID, endpointID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Error("error getting webhook endpoint", "error", err)
+		}
+		return entities.WebhookEndpoint{}, err
+	}
+
+	err = s.storage.DeleteWebhookEndpoint(merchantID, endpointID)
+	if err != nil {
+		s.logger.Error("error deleting webhook endpoint", "error", err)
+		return endpoint, err
+	}
+
+	s.logger.Info("webhook endpoint deleted", "endpointID", endpointID)
+
+	return endpoint, nil
+}
+
+// ListWebhookDeliveries returns the deliveries of the merchant matching the filter, the latest
+// first, and storage.ErrNotFound when the merchant has no delivery to list them after
+func (s *Service) ListWebhookDeliveries(
+	merchantID string,
+	filter storage.WebhookDeliveryFilter,
+) ([]entities.WebhookDelivery, error) {
+	deliveries, err := s.storage.ListWebhookDeliveries(merchantID, filter)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Error("error listing webhook deliveries", "error", err)
+		}
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// GetWebhookDelivery returns the delivery with its attempts, the first first, and
+// storage.ErrNotFound when the merchant has no such delivery
+func (s *Service) GetWebhookDelivery(
+	merchantID, deliveryID string,
+) (entities.WebhookDelivery, []entities.WebhookAttempt, error) {
+	delivery, err := s.storage.GetWebhookDelivery(merchantID, deliveryID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Error("error getting webhook delivery", "error", err)
+		}
+		return entities.WebhookDelivery{}, nil, err
+	}
+
+	attempts, err := s.storage.ListWebhookAttempts(merchantID, deliveryID)
+	if err != nil {
+		s.logger.Error("error listing webhook attempts", "error", err)
+		return entities.WebhookDelivery{}, nil, err
+	}
+
+	return delivery, attempts, nil
+}
+
+// ReplayWebhookDelivery queues the event of a finished delivery again for the same endpoint,
+// the replay is a new delivery with a retry period of its own. The event keeps its ID so that
+// endpoints that already received it can ignore the replay.
+func (s *Service) ReplayWebhookDelivery(
+	actor entities.Actor,
+	merchantID, deliveryID string,
+) (entities.WebhookDelivery, error) {
+	replay, err := s.replayWebhookDelivery(merchantID, deliveryID)
+
+	var after any
+	if err == nil {
+		after = newWebhookDeliverySnapshot(replay)
+	}
+
+	s.recordAuditEvent(
+		actor,
+		merchantID,
+		entities.AuditActionWebhookDeliveryReplay,
+		deliveryID,
+		nil,
+		after,
+		err,
+	)
+
+	return replay, err
+}
+
+func (s *Service) replayWebhookDelivery(
+	merchantID, deliveryID string,
+) (entities.WebhookDelivery, error) {
+	delivery, err := s.storage.GetWebhookDelivery(merchantID, deliveryID)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			s.logger.Error("error getting webhook delivery", "error", err)
+		}
+		return entities.WebhookDelivery{}, err
+	}
+
+	if delivery.Status == entities.WebhookDeliveryPending {
+		return entities.WebhookDelivery{}, ErrWebhookDeliveryPending
+	}
+
+	_, err = s.storage.GetWebhookEndpoint(merchantID, delivery.EndpointID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return entities.WebhookDelivery{}, ErrWebhookEndpointDeleted
+		}
+
+		s.logger.Error("error getting webhook endpoint", "error", err)
+		return entities.WebhookDelivery{}, err
+	}
+
+	timestamp := now().UnixNano() / int64(time.Millisecond)
+
+	replay := entities.WebhookDelivery{
+		ID:               newUUID().String(),
+		MerchantID:       merchantID,
+		EndpointID:       delivery.EndpointID,
+		EventID:          delivery.EventID,
+		EventType:        delivery.EventType,
+		Payload:          delivery.Payload,
+		Status:           entities.WebhookDeliveryPending,
+		NextAttempt:      timestamp,
+		ReplayOf:         delivery.ID,
+		Timestamp:        timestamp,
+		UpdatedTimestamp: timestamp,
+	}
+
+	err = s.storage.CreateWebhookDelivery(replay)
+	if err != nil {
+		s.logger.Error("error queueing webhook delivery", "error", err)
+		return entities.WebhookDelivery{}, err
+	}
+
+	s.logger.Info("webhook delivery replayed", "deliveryID", deliveryID, "replayID", replay.ID)
+
+	return replay, nil
+}
+
+func (s *Service) publishPaymentEvent(eventType string, payment entities.Payment) {
+	s.publishEvent(payment.Merchant.ID, eventType, entities.NewPaymentDetailsFromPayment(payment))
+}
+
+// publishEvent queues a delivery of the event to every endpoint of the merchant subscribed to
+// its type
+//
+// NOTE: failing to queue a delivery is only logged as the change the event is about was made
+// already and must not be reported as failed
+func (s *Service) publishEvent(merchantID, eventType string, data any) {
+	endpoints, err := s.storage.ListWebhookEndpoints(merchantID)
+	if err != nil {
+		s.logger.Error("error listing webhook endpoints", "error", err)
+		return
+	}
+
+	event := entities.WebhookEvent{
+		ID:         newUUID().String(),
+		Type:       eventType,
+		MerchantID: merchantID,
+		Timestamp:  now().UnixNano() / int64(time.Millisecond),
+		Data:       data,
+	}
+
+	var payload []byte
+
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribed(eventType) {
+			continue
+		}
+
+		if payload == nil {
+			payload, err = json.Marshal(event)
+			if err != nil {
+				s.logger.Error("error encoding webhook event", "error", err)
+				return
+			}
+		}
+
+		delivery := entities.WebhookDelivery{
+			ID:               newUUID().String(),
+			MerchantID:       merchantID,
+			EndpointID:       endpoint.ID,
+			EventID:          event.ID,
+			EventType:        eventType,
+			Payload:          payload,
+			Status:           entities.WebhookDeliveryPending,
+			NextAttempt:      event.Timestamp,
+			Timestamp:        event.Timestamp,
+			UpdatedTimestamp: event.Timestamp,
+		}
+
+		err = s.storage.CreateWebhookDelivery(delivery)
+		if err != nil {
+			s.logger.Error(
+				"error queueing webhook delivery",
+				"eventID", event.ID,
+				"endpointID", endpoint.ID,
+				"error", err,
+			)
+		}
+	}
+}
+
+// DeliverWebhooks attempts the deliveries that are due, failed deliveries are retried with
+// exponential backoff until webhookRetryPeriod after the event
+func (s *Service) DeliverWebhooks() error {
+	deliveries, err := s.storage.ListDueWebhookDeliveries(
+		now().UnixNano()/int64(time.Millisecond),
+		webhookDeliveryBatch,
+	)
+	if err != nil {
+		s.logger.Error("error listing due webhook deliveries", "error", err)
+		return err
+	}
+
+	var errs []error
+
+	for _, delivery := range deliveries {
+		err := s.deliverWebhook(delivery)
+		if err != nil {
+			s.logger.Error(
+				"error delivering webhook",
+				"deliveryID", delivery.ID,
+				"error", err,
+			)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Service) deliverWebhook(delivery entities.WebhookDelivery) error {
+	attempted := now()
+	timestamp := attempted.UnixNano() / int64(time.Millisecond)
+
+	// NOTE: the delivery is claimed before it is sent so that it is not sent again by another
+	// worker listing it at the same time
+	claimed := delivery
+	claimed.Attempts++
+	claimed.NextAttempt = timestamp + webhookDeliveryLease.Milliseconds()
+	claimed.UpdatedTimestamp = timestamp
+
+	err := s.storage.UpdateWebhookDelivery(delivery, claimed)
+	if err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			return nil
+		}
+		return err
+	}
+
+	endpoint, err := s.storage.GetWebhookEndpoint(delivery.MerchantID, delivery.EndpointID)
+	if errors.Is(err, storage.ErrNotFound) {
+		failed := claimed
+		failed.Attempts = delivery.Attempts
+		failed.Status = entities.WebhookDeliveryFailed
+		failed.LastError = "webhook endpoint was deleted"
+		failed.UpdatedTimestamp = now().UnixNano() / int64(time.Millisecond)
+
+		err = s.storage.UpdateWebhookDelivery(claimed, failed)
+		if err != nil {
+			return err
+		}
+
+		s.logger.Warn("webhook endpoint of delivery was deleted", "deliveryID", delivery.ID)
+
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	updated, attempt := s.attemptWebhook(endpoint, claimed, attempted)
+
+	err = s.storage.UpdateWebhookDelivery(claimed, updated, attempt)
+	if err != nil {
+		return err
+	}
+
+	switch updated.Status {
+	case entities.WebhookDeliverySucceeded:
+		s.logger.Info("webhook delivered", "deliveryID", delivery.ID)
+	case entities.WebhookDeliveryFailed:
+		s.logger.Warn(
+			"webhook delivery failed",
+			"deliveryID", delivery.ID,
+			"attempts", updated.Attempts,
+			"error", updated.LastError,
+		)
+	}
+
+	return nil
+}
+
+// attemptWebhook sends the claimed delivery to the endpoint and returns the delivery updated
+// with the outcome and the record of the attempt
+func (s *Service) attemptWebhook(
+	endpoint entities.WebhookEndpoint,
+	claimed entities.WebhookDelivery,
+	attempted time.Time,
+) (entities.WebhookDelivery, entities.WebhookAttempt) {
+	timestamp := attempted.UnixNano() / int64(time.Millisecond)
+
+	status, err := s.sendWebhook(endpoint, claimed, attempted)
+
+	updated := claimed
+	updated.UpdatedTimestamp = now().UnixNano() / int64(time.Millisecond)
+
+	attempt := entities.WebhookAttempt{
+		DeliveryID:     claimed.ID,
+		MerchantID:     claimed.MerchantID,
+		Number:         claimed.Attempts,
+		URL:            endpoint.URL,
+		RequestBody:    claimed.Payload,
+		ResponseStatus: status,
+		Latency:        updated.UpdatedTimestamp - timestamp,
+		Timestamp:      timestamp,
+	}
+
+	if err == nil {
+		updated.Status = entities.WebhookDeliverySucceeded
+		updated.LastError = ""
+
+		return updated, attempt
+	}
+
+	attempt.Error = err.Error()
+	updated.LastError = err.Error()
+	updated.NextAttempt = timestamp + webhookBackoff(claimed.Attempts).Milliseconds()
+
+	if updated.NextAttempt > claimed.Timestamp+webhookRetryPeriod.Milliseconds() {
+		updated.Status = entities.WebhookDeliveryFailed
+	}
+
+	return updated, attempt
+}
+
+// sendWebhook returns the response status and why the endpoint did not accept the delivery,
+// any status other than 2xx is a failure
+func (s *Service) sendWebhook(
+	endpoint entities.WebhookEndpoint,
+	delivery entities.WebhookDelivery,
+	attempted time.Time,
+) (int, error) {
+	timestamp := strconv.FormatInt(attempted.Unix(), 10)
+
+	header := http.Header{}
+	header.Set(webhook.HeaderID, delivery.EventID)
+	header.Set(webhook.HeaderEvent, delivery.EventType)
+	header.Set(webhook.HeaderTimestamp, timestamp)
+	header.Set(webhook.HeaderSignature, webhook.Sign(endpoint.Secret, timestamp, delivery.Payload))
+
+	status, err := s.webhooks.Send(endpoint.URL, header, delivery.Payload)
+	if err != nil {
+		return 0, err
+	}
+
+	if status < 200 || status > 299 {
+		return status, fmt.Errorf("endpoint responded with status %d", status)
+	}
+
+	return status, nil
+}
+
+// webhookBackoff returns how long to wait after the failed attempt before the next one
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookInitialBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, webhookMaxBackoff)
+}
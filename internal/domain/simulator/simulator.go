@@ -1,8 +1,11 @@
 package simulator
 
 import (
+	"errors"
 	"log/slog"
+	"sync"
 
+	"github.com/google/uuid"
 	"github.com/mgajewskik/payment-platform/internal/domain/entities"
 )
 
@@ -15,15 +18,38 @@ type BankClient interface {
 		card entities.CardDetails,
 		money entities.Money,
 	) (string, error)
-	RevertTransaction(transactionID string) error
+	// RevertTransaction returns the money to the card charged by the transaction, which is less
+	// than the charged amount when a part of it was already charged back
+	RevertTransaction(transactionID string, money entities.Money) error
+	// TransferFunds sends money from the platform account to the given account and returns
+	// the ID of the transfer, the bank makes a single transfer per idempotency key and returns
+	// the same transfer when it is requested again
+	TransferFunds(
+		idempotencyKey string,
+		account entities.AccountDetails,
+		money entities.Money,
+	) (string, error)
+	// GetTransferStatus returns one of the payout statuses for the transfer
+	GetTransferStatus(transferID string) (string, error)
+	// TokenizeCard stores the card with the bank and returns the token to charge it with so that
+	// the platform does not keep the card number
+	TokenizeCard(card entities.CardDetails) (string, error)
+	// ResolveCardToken returns the card stored with the bank under the token
+	ResolveCardToken(token string) (entities.CardDetails, error)
 }
 
+var ErrUnknownCardToken = errors.New("card token is unknown to the bank")
+
 type BankSimulator struct {
 	logger *slog.Logger
+
+	// NOTE: the simulated vault is kept in memory, tokens do not survive a restart
+	mu    sync.Mutex
+	cards map[string]entities.CardDetails
 }
 
 func NewBankSimulator(logger *slog.Logger) *BankSimulator {
-	return &BankSimulator{logger: logger}
+	return &BankSimulator{logger: logger, cards: make(map[string]entities.CardDetails)}
 }
 
 func (b *BankSimulator) ValidateCardInformation(_ entities.CardDetails) error {
@@ -42,10 +68,52 @@ func (b *BankSimulator) ProcessTransaction(
 	return "simulatedTransactionID", nil
 }
 
-// RevertTransaction NOTE: assumes that the transaction can be reverted by ID withput passing in the exact details of a transaction
+// RevertTransaction NOTE: assumes that the transaction can be reverted by ID and amount withput passing in the exact details of a transaction
 func (b *BankSimulator) RevertTransaction(
 	_ string,
+	_ entities.Money,
 ) error {
 	b.logger.Info("requesting bank to revert transaction")
 	return nil
 }
+
+func (b *BankSimulator) TransferFunds(
+	_ string,
+	_ entities.AccountDetails,
+	_ entities.Money,
+) (string, error) {
+	b.logger.Info("requesting bank to transfer funds")
+	return "simulatedTransferID", nil
+}
+
+// GetTransferStatus NOTE: the simulated transfers are paid as soon as they are checked
+func (b *BankSimulator) GetTransferStatus(_ string) (string, error) {
+	b.logger.Info("requesting bank for transfer status")
+	return entities.PayoutStatusPaid, nil
+}
+
+func (b *BankSimulator) TokenizeCard(card entities.CardDetails) (string, error) {
+	b.logger.Info("requesting bank to tokenize card")
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	token := "tok_" + uuid.NewString()
+	b.cards[token] = card
+
+	return token, nil
+}
+
+func (b *BankSimulator) ResolveCardToken(token string) (entities.CardDetails, error) {
+	b.logger.Info("requesting bank to resolve card token")
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	card, ok := b.cards[token]
+	if !ok {
+		return entities.CardDetails{}, ErrUnknownCardToken
+	}
+
+	return card, nil
+}
@@ -0,0 +1,273 @@
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+var now = time.Now
+
+var (
+	ErrUnknownKey = errors.New("jwtkeys: unknown key ID")
+	ErrExpiredKey = errors.New("jwtkeys: verification key is past its grace period")
+)
+
+// Key is an asymmetric key used to sign or verify tokens. Verification keys kept after a
+// rotation stop being accepted once Expires has passed.
+type Key struct {
+	ID        string
+	Algorithm string
+	Expires   time.Time
+
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// KeySet signs tokens with a single signing key and verifies them with any of the keys
+// that are still within their grace period. Without asymmetric keys it falls back to
+// HS256 with a shared secret.
+type KeySet struct {
+	signing      *Key
+	verification map[string]*Key
+	secret       []byte
+}
+
+func NewHMACKeySet(secret []byte) *KeySet {
+	return &KeySet{
+		verification: make(map[string]*Key),
+		secret:       secret,
+	}
+}
+
+// VerificationKeyFile describes a previously used key that is still accepted until Expires,
+// a zero Expires accepts the key indefinitely
+type VerificationKeyFile struct {
+	ID      string
+	Path    string
+	Expires time.Time
+}
+
+// Load reads the signing private key and the additional verification keys from PEM files
+func Load(signingKeyID, signingKeyPath string, verification []VerificationKeyFile) (*KeySet, error) {
+	signing, err := loadKey(signingKeyID, signingKeyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if signing.private == nil {
+		return nil, fmt.Errorf("jwtkeys: signing key %s must be a private key", signingKeyPath)
+	}
+
+	keySet := &KeySet{
+		signing:      signing,
+		verification: map[string]*Key{signing.ID: signing},
+	}
+
+	for _, file := range verification {
+		if _, ok := keySet.verification[file.ID]; ok {
+			return nil, fmt.Errorf("jwtkeys: duplicate key ID %q", file.ID)
+		}
+
+		key, err := loadKey(file.ID, file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		key.Expires = file.Expires
+		keySet.verification[key.ID] = key
+	}
+
+	return keySet, nil
+}
+
+// Sign signs the claims with the current signing key and sets its ID in the token header
+func (k *KeySet) Sign(claims *jwt.Claims) ([]byte, error) {
+	if k.signing == nil {
+		return claims.HMACSign(jwt.HS256, k.secret)
+	}
+
+	header, err := json.Marshal(map[string]string{"kid": k.signing.ID})
+	if err != nil {
+		return nil, err
+	}
+
+	switch private := k.signing.private.(type) {
+	case *rsa.PrivateKey:
+		return claims.RSASign(k.signing.Algorithm, private, header)
+	case *ecdsa.PrivateKey:
+		return claims.ECDSASign(k.signing.Algorithm, private, header)
+	default:
+		return nil, fmt.Errorf("jwtkeys: unsupported signing key type %T", private)
+	}
+}
+
+// Check verifies the token signature with the key named in its header, the claims still have
+// to be validated by the caller
+func (k *KeySet) Check(token []byte) (*jwt.Claims, error) {
+	if k.signing == nil {
+		return jwt.HMACCheck(token, k.secret)
+	}
+
+	unverified, err := jwt.ParseWithoutCheck(token)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := k.verification[unverified.KeyID]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if !key.Expires.IsZero() && now().After(key.Expires) {
+		return nil, ErrExpiredKey
+	}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		return jwt.RSACheck(token, public)
+	case *ecdsa.PublicKey:
+		return jwt.ECDSACheck(token, public)
+	default:
+		return nil, fmt.Errorf("jwtkeys: unsupported verification key type %T", public)
+	}
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public keys that are currently accepted, in JSON Web Key Set format
+func (k *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	if k.signing != nil {
+		jwks.Keys = append(jwks.Keys, k.signing.jwk())
+	}
+
+	for _, key := range k.verification {
+		if key == k.signing || (!key.Expires.IsZero() && now().After(key.Expires)) {
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, key.jwk())
+	}
+
+	return jwks
+}
+
+func (key *Key) jwk() JWK {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	jwk := JWK{KeyID: key.ID, Use: "sig", Algorithm: key.Algorithm}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = encode(public.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		// NOTE: the uncompressed point encoding is 0x04 followed by the X and Y coordinates
+		point, err := public.ECDH()
+		if err != nil {
+			return jwk
+		}
+
+		coordinates := point.Bytes()[1:]
+		size := len(coordinates) / 2
+
+		jwk.KeyType = "EC"
+		jwk.Curve = public.Curve.Params().Name
+		jwk.X = encode(coordinates[:size])
+		jwk.Y = encode(coordinates[size:])
+	}
+
+	return jwk
+}
+
+func loadKey(id, path string) (*Key, error) {
+	if id == "" {
+		return nil, fmt.Errorf("jwtkeys: key %s has no ID", path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwtkeys: no PEM data in %s", path)
+	}
+
+	key := &Key{ID: id}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key.private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key.private, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var parsed any
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if signer, ok := parsed.(crypto.Signer); ok {
+			key.private = signer
+		}
+	case "PUBLIC KEY":
+		key.public, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("jwtkeys: unsupported PEM block %q in %s", block.Type, path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("jwtkeys: parsing %s: %w", path, err)
+	}
+
+	if key.private != nil {
+		key.public = key.private.Public()
+	}
+
+	switch public := key.public.(type) {
+	case *rsa.PublicKey:
+		key.Algorithm = jwt.RS256
+	case *ecdsa.PublicKey:
+		switch public.Curve {
+		case elliptic.P256():
+			key.Algorithm = jwt.ES256
+		case elliptic.P384():
+			key.Algorithm = jwt.ES384
+		case elliptic.P521():
+			key.Algorithm = jwt.ES512
+		default:
+			return nil, fmt.Errorf("jwtkeys: unsupported curve in %s", path)
+		}
+	default:
+		return nil, fmt.Errorf("jwtkeys: unsupported key type %T in %s", public, path)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,185 @@
+package jwtkeys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRSAKey(t *testing.T, dir, name string) string {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writePEM(t, dir, name, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+}
+
+func writeECKey(t *testing.T, dir, name string) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return writePEM(t, dir, name, "EC PRIVATE KEY", der)
+}
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func newClaims() *jwt.Claims {
+	var claims jwt.Claims
+	claims.Subject = "testMerchant"
+	claims.Expires = jwt.NewNumericTime(time.Now().Add(time.Hour))
+
+	return &claims
+}
+
+func TestSignAndCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("should sign with RS256 and set the key ID", func(t *testing.T) {
+		keySet, err := Load("rsa-1", writeRSAKey(t, dir, "rsa.pem"), nil)
+		assert.NoError(t, err)
+
+		token, err := keySet.Sign(newClaims())
+		assert.NoError(t, err)
+
+		claims, err := keySet.Check(token)
+		assert.NoError(t, err)
+		assert.Equal(t, "testMerchant", claims.Subject)
+		assert.Equal(t, "rsa-1", claims.KeyID)
+	})
+
+	t.Run("should sign with ES256", func(t *testing.T) {
+		keySet, err := Load("ec-1", writeECKey(t, dir, "ec.pem"), nil)
+		assert.NoError(t, err)
+
+		token, err := keySet.Sign(newClaims())
+		assert.NoError(t, err)
+
+		unverified, err := jwt.ParseWithoutCheck(token)
+		assert.NoError(t, err)
+
+		header := make(map[string]any)
+		assert.NoError(t, json.Unmarshal(unverified.RawHeader, &header))
+		assert.Equal(t, jwt.ES256, header["alg"])
+
+		_, err = keySet.Check(token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should fall back to HMAC", func(t *testing.T) {
+		keySet := NewHMACKeySet([]byte("secret"))
+
+		token, err := keySet.Sign(newClaims())
+		assert.NoError(t, err)
+
+		_, err = jwt.HMACCheck(token, []byte("secret"))
+		assert.NoError(t, err)
+
+		_, err = keySet.Check(token)
+		assert.NoError(t, err)
+	})
+
+	t.Run("should reject HMAC tokens when signing asymmetrically", func(t *testing.T) {
+		keySet, err := Load("rsa-1", filepath.Join(dir, "rsa.pem"), nil)
+		assert.NoError(t, err)
+
+		token, err := NewHMACKeySet([]byte("secret")).Sign(newClaims())
+		assert.NoError(t, err)
+
+		_, err = keySet.Check(token)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldPath := writeRSAKey(t, dir, "old.pem")
+	newPath := writeECKey(t, dir, "new.pem")
+
+	oldKeySet, err := Load("old", oldPath, nil)
+	assert.NoError(t, err)
+
+	token, err := oldKeySet.Sign(newClaims())
+	assert.NoError(t, err)
+
+	expires := time.Date(2024, 9, 10, 0, 0, 0, 0, time.UTC)
+
+	keySet, err := Load("new", newPath, []VerificationKeyFile{
+		{ID: "old", Path: oldPath, Expires: expires},
+	})
+	assert.NoError(t, err)
+
+	t.Run("should accept old keys within the grace period", func(t *testing.T) {
+		now = func() time.Time { return expires.Add(-time.Hour) }
+		defer func() { now = time.Now }()
+
+		_, err := keySet.Check(token)
+		assert.NoError(t, err)
+		assert.Len(t, keySet.JWKS().Keys, 2)
+	})
+
+	t.Run("should reject old keys after the grace period", func(t *testing.T) {
+		now = func() time.Time { return expires.Add(time.Hour) }
+		defer func() { now = time.Now }()
+
+		_, err := keySet.Check(token)
+		assert.ErrorIs(t, err, ErrExpiredKey)
+		assert.Len(t, keySet.JWKS().Keys, 1)
+	})
+
+	t.Run("should reject duplicate key IDs", func(t *testing.T) {
+		_, err := Load("new", newPath, []VerificationKeyFile{{ID: "new", Path: oldPath}})
+		assert.Error(t, err)
+	})
+}
+
+func TestJWKS(t *testing.T) {
+	dir := t.TempDir()
+
+	keySet, err := Load("ec-1", writeECKey(t, dir, "ec.pem"), []VerificationKeyFile{
+		{ID: "rsa-1", Path: writeRSAKey(t, dir, "rsa.pem")},
+	})
+	assert.NoError(t, err)
+
+	token, err := keySet.Sign(newClaims())
+	assert.NoError(t, err)
+
+	data, err := json.Marshal(keySet.JWKS())
+	assert.NoError(t, err)
+
+	var register jwt.KeyRegister
+	keys, err := register.LoadJWK(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, keys)
+
+	claims, err := register.Check(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "testMerchant", claims.Subject)
+}
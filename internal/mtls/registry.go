@@ -0,0 +1,157 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+)
+
+// Identity prefixes select the certificate field an identity is matched against
+const (
+	IdentitySubject = "subject:"
+	IdentityDNS     = "dns:"
+	IdentityURI     = "uri:"
+	IdentityEmail   = "email:"
+)
+
+// Binding maps client certificate identities to a merchant. Identities are prefixed with the
+// field they match, e.g. "subject:CN=api.merchant.com,O=Merchant" or "dns:api.merchant.com".
+type Binding struct {
+	MerchantID string   `json:"MerchantID"`
+	Identities []string `json:"Identities"`
+	// Scopes granted to requests authenticated with the certificate, all scopes when empty
+	Scopes []string `json:"Scopes"`
+	// Exclusive merchants cannot authenticate with bearer tokens alone
+	Exclusive bool `json:"Exclusive"`
+}
+
+type Registry struct {
+	identities map[string]Binding
+	merchants  map[string]Binding
+}
+
+func NewRegistry(bindings []Binding) (*Registry, error) {
+	r := &Registry{
+		identities: make(map[string]Binding),
+		merchants:  make(map[string]Binding),
+	}
+
+	for _, binding := range bindings {
+		if binding.MerchantID == "" {
+			return nil, fmt.Errorf("mtls: binding without merchant ID")
+		}
+
+		if _, ok := r.merchants[binding.MerchantID]; ok {
+			return nil, fmt.Errorf("mtls: duplicate binding for merchant %s", binding.MerchantID)
+		}
+
+		if len(binding.Scopes) == 0 {
+			binding.Scopes = entities.Scopes
+		}
+
+		for _, scope := range binding.Scopes {
+			if !entities.IsScope(scope) {
+				return nil, fmt.Errorf("mtls: unknown scope %q", scope)
+			}
+		}
+
+		for _, identity := range binding.Identities {
+			if !validIdentity(identity) {
+				return nil, fmt.Errorf("mtls: invalid identity %q", identity)
+			}
+
+			if other, ok := r.identities[identity]; ok {
+				return nil, fmt.Errorf(
+					"mtls: identity %q bound to both %s and %s",
+					identity,
+					other.MerchantID,
+					binding.MerchantID,
+				)
+			}
+
+			r.identities[identity] = binding
+		}
+
+		r.merchants[binding.MerchantID] = binding
+	}
+
+	return r, nil
+}
+
+// LoadRegistry reads the bindings from a JSON file holding a list of bindings
+func LoadRegistry(path string) (*Registry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var bindings []Binding
+
+	err = json.Unmarshal(data, &bindings)
+	if err != nil {
+		return nil, fmt.Errorf("mtls: decoding %s: %w", path, err)
+	}
+
+	return NewRegistry(bindings)
+}
+
+// Lookup returns the merchant binding of a verified client certificate, certificates matching
+// the identities of more than one merchant are not accepted
+func (r *Registry) Lookup(cert *x509.Certificate) (Binding, bool) {
+	var (
+		found Binding
+		ok    bool
+	)
+
+	for _, identity := range certificateIdentities(cert) {
+		binding, match := r.identities[identity]
+		if !match {
+			continue
+		}
+
+		if ok && found.MerchantID != binding.MerchantID {
+			return Binding{}, false
+		}
+
+		found, ok = binding, true
+	}
+
+	return found, ok
+}
+
+// RequiresCertificate reports whether the merchant may only authenticate with a client certificate
+func (r *Registry) RequiresCertificate(merchantID string) bool {
+	return r.merchants[merchantID].Exclusive
+}
+
+func certificateIdentities(cert *x509.Certificate) []string {
+	identities := []string{IdentitySubject + cert.Subject.String()}
+
+	for _, name := range cert.DNSNames {
+		identities = append(identities, IdentityDNS+name)
+	}
+
+	for _, uri := range cert.URIs {
+		identities = append(identities, IdentityURI+uri.String())
+	}
+
+	for _, email := range cert.EmailAddresses {
+		identities = append(identities, IdentityEmail+email)
+	}
+
+	return identities
+}
+
+func validIdentity(identity string) bool {
+	for _, prefix := range []string{IdentitySubject, IdentityDNS, IdentityURI, IdentityEmail} {
+		if value, ok := strings.CutPrefix(identity, prefix); ok && value != "" {
+			return true
+		}
+	}
+
+	return false
+}
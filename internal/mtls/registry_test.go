@@ -0,0 +1,147 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
+)
+
+func TestLookup(t *testing.T) {
+	registry, err := NewRegistry([]Binding{
+		{
+			MerchantID: "merchantA",
+			Identities: []string{"subject:CN=api.a.example.com,O=Merchant A"},
+			Exclusive:  true,
+		},
+		{
+			MerchantID: "merchantB",
+			Identities: []string{"dns:api.b.example.com", "uri:spiffe://b.example.com/api"},
+			Scopes:     []string{entities.ScopePaymentsRead},
+		},
+	})
+	assert.NoError(t, err)
+
+	spiffe, _ := url.Parse("spiffe://b.example.com/api")
+
+	tests := []struct {
+		name     string
+		cert     *x509.Certificate
+		merchant string
+		found    bool
+	}{
+		{
+			name: "should match the subject",
+			cert: &x509.Certificate{
+				Subject: pkix.Name{
+					CommonName:   "api.a.example.com",
+					Organization: []string{"Merchant A"},
+				},
+			},
+			merchant: "merchantA",
+			found:    true,
+		},
+		{
+			name: "should match a DNS SAN",
+			cert: &x509.Certificate{
+				Subject:  pkix.Name{CommonName: "unrelated"},
+				DNSNames: []string{"other.example.com", "api.b.example.com"},
+			},
+			merchant: "merchantB",
+			found:    true,
+		},
+		{
+			name:     "should match a URI SAN",
+			cert:     &x509.Certificate{URIs: []*url.URL{spiffe}},
+			merchant: "merchantB",
+			found:    true,
+		},
+		{
+			name: "should not match unknown certificates",
+			cert: &x509.Certificate{Subject: pkix.Name{CommonName: "api.a.example.com"}},
+		},
+		{
+			name: "should not match certificates of several merchants",
+			cert: &x509.Certificate{
+				Subject: pkix.Name{
+					CommonName:   "api.a.example.com",
+					Organization: []string{"Merchant A"},
+				},
+				DNSNames: []string{"api.b.example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			binding, found := registry.Lookup(tt.cert)
+			assert.Equal(t, tt.found, found)
+			assert.Equal(t, tt.merchant, binding.MerchantID)
+		})
+	}
+
+	t.Run("should report binding scopes and exclusivity", func(t *testing.T) {
+		binding, _ := registry.Lookup(&x509.Certificate{URIs: []*url.URL{spiffe}})
+		assert.Equal(t, []string{entities.ScopePaymentsRead}, binding.Scopes)
+
+		assert.True(t, registry.RequiresCertificate("merchantA"))
+		assert.False(t, registry.RequiresCertificate("merchantB"))
+		assert.False(t, registry.RequiresCertificate("unknown"))
+		assert.Equal(t, entities.Scopes, registry.merchants["merchantA"].Scopes)
+	})
+}
+
+func TestNewRegistryValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		bindings []Binding
+	}{
+		{
+			name:     "should reject identities without a prefix",
+			bindings: []Binding{{MerchantID: "m", Identities: []string{"api.example.com"}}},
+		},
+		{
+			name:     "should reject unknown scopes",
+			bindings: []Binding{{MerchantID: "m", Scopes: []string{"admin"}}},
+		},
+		{
+			name: "should reject identities bound to several merchants",
+			bindings: []Binding{
+				{MerchantID: "a", Identities: []string{"dns:api.example.com"}},
+				{MerchantID: "b", Identities: []string{"dns:api.example.com"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegistry(tt.bindings)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+
+	data := `[{"MerchantID":"merchantA","Identities":["dns:api.a.example.com"],"Exclusive":true}]`
+
+	err := os.WriteFile(path, []byte(data), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry, err := LoadRegistry(path)
+	assert.NoError(t, err)
+
+	binding, found := registry.Lookup(&x509.Certificate{DNSNames: []string{"api.a.example.com"}})
+	assert.True(t, found)
+	assert.Equal(t, "merchantA", binding.MerchantID)
+	assert.True(t, binding.Exclusive)
+}
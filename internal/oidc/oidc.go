@@ -0,0 +1,224 @@
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+)
+
+var now = time.Now
+
+// ErrInvalidToken is returned for any token that cannot be accepted, other errors mean the
+// identity provider could not be reached
+var ErrInvalidToken = errors.New("oidc: invalid token")
+
+const (
+	defaultCacheTTL = time.Hour
+	// minRefreshInterval protects the identity provider from being asked for its keys on every
+	// token signed with an unknown key
+	minRefreshInterval = time.Minute
+)
+
+type Config struct {
+	Issuer   string
+	Audience string
+	// MerchantClaim is the claim holding the merchant ID, "sub" when empty
+	MerchantClaim string
+	// CacheTTL is how long the discovery document and keys are used before being fetched again
+	CacheTTL   time.Duration
+	HTTPClient *http.Client
+}
+
+// Identity is the merchant authenticated by an identity provider token
+type Identity struct {
+	MerchantID string
+	Scopes     []string
+	Claims     *jwt.Claims
+}
+
+// Verifier validates tokens issued by an OpenID Connect identity provider against the keys
+// published through its discovery document
+type Verifier struct {
+	config Config
+
+	mu        sync.Mutex
+	keys      *jwt.KeyRegister
+	fetchedAt time.Time
+}
+
+func NewVerifier(config Config) *Verifier {
+	config.Issuer = strings.TrimSuffix(config.Issuer, "/")
+
+	if config.MerchantClaim == "" {
+		config.MerchantClaim = "sub"
+	}
+
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = defaultCacheTTL
+	}
+
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Verifier{config: config}
+}
+
+// Issued reports whether the token claims to be issued by the identity provider, the token is
+// not verified
+func (v *Verifier) Issued(token []byte) bool {
+	claims, err := jwt.ParseWithoutCheck(token)
+	if err != nil {
+		return false
+	}
+
+	return strings.TrimSuffix(claims.Issuer, "/") == v.config.Issuer
+}
+
+func (v *Verifier) Verify(token []byte) (Identity, error) {
+	keys, err := v.keyRegister(false)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	claims, err := keys.Check(token)
+	if errors.Is(err, jwt.ErrSigMiss) && !hasKeyID(keys, token) {
+		// NOTE: the identity provider may have rotated its keys since they were cached
+		keys, err = v.keyRegister(true)
+		if err != nil {
+			return Identity{}, err
+		}
+
+		claims, err = keys.Check(token)
+	}
+
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	if strings.TrimSuffix(claims.Issuer, "/") != v.config.Issuer {
+		return Identity{}, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+
+	if !claims.AcceptAudience(v.config.Audience) {
+		return Identity{}, fmt.Errorf("%w: audience not accepted", ErrInvalidToken)
+	}
+
+	if claims.Expires == nil || !claims.Valid(now()) {
+		return Identity{}, fmt.Errorf("%w: token expired or not yet valid", ErrInvalidToken)
+	}
+
+	merchantID, ok := claims.String(v.config.MerchantClaim)
+	if !ok || merchantID == "" {
+		return Identity{}, fmt.Errorf(
+			"%w: missing merchant claim %q",
+			ErrInvalidToken,
+			v.config.MerchantClaim,
+		)
+	}
+
+	scope, _ := claims.String("scope")
+
+	return Identity{
+		MerchantID: merchantID,
+		Scopes:     strings.Fields(scope),
+		Claims:     claims,
+	}, nil
+}
+
+// keyRegister returns the cached keys, fetching them when the cache expired or when a refresh
+// is forced and the keys were not fetched too recently
+func (v *Verifier) keyRegister(refresh bool) (*jwt.KeyRegister, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	age := now().Sub(v.fetchedAt)
+
+	if v.keys != nil && age < v.config.CacheTTL && (!refresh || age < minRefreshInterval) {
+		return v.keys, nil
+	}
+
+	keys, err := v.fetchKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	v.keys = keys
+	v.fetchedAt = now()
+
+	return keys, nil
+}
+
+type discoveryDocument struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+func (v *Verifier) fetchKeys() (*jwt.KeyRegister, error) {
+	var discovery discoveryDocument
+
+	data, err := v.get(v.config.Issuer + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: decoding discovery document: %w", err)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != v.config.Issuer {
+		return nil, fmt.Errorf("oidc: discovery document issued for %q", discovery.Issuer)
+	}
+
+	if discovery.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document has no jwks_uri")
+	}
+
+	data, err = v.get(discovery.JWKSURI)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys jwt.KeyRegister
+
+	_, err = keys.LoadJWK(data)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: loading JWKS: %w", err)
+	}
+
+	return &keys, nil
+}
+
+func (v *Verifier) get(url string) ([]byte, error) {
+	resp, err := v.config.HTTPClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetching %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: fetching %s: unexpected status %d", url, resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+func hasKeyID(keys *jwt.KeyRegister, token []byte) bool {
+	claims, err := jwt.ParseWithoutCheck(token)
+	if err != nil || claims.KeyID == "" {
+		return false
+	}
+
+	return slices.Contains(keys.RSAIDs, claims.KeyID) ||
+		slices.Contains(keys.ECDSAIDs, claims.KeyID) ||
+		slices.Contains(keys.EdDSAIDs, claims.KeyID)
+}
@@ -0,0 +1,216 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pascaldekloe/jwt"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubIssuer struct {
+	server      *httptest.Server
+	mu          sync.Mutex
+	keys        map[string]*rsa.PrivateKey
+	jwksFetches atomic.Int32
+}
+
+func newStubIssuer(t *testing.T) *stubIssuer {
+	issuer := &stubIssuer{keys: make(map[string]*rsa.PrivateKey)}
+	issuer.addKey(t, "key-1")
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer.server.URL,
+			"jwks_uri": issuer.server.URL + "/jwks",
+		})
+	})
+
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.jwksFetches.Add(1)
+
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+
+		keys := []map[string]string{}
+		for kid, key := range issuer.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"alg": jwt.RS256,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(
+					big.NewInt(int64(key.E)).Bytes(),
+				),
+			})
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	return issuer
+}
+
+func (s *stubIssuer) addKey(t *testing.T, kid string) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[kid] = key
+}
+
+func (s *stubIssuer) token(t *testing.T, kid string, modify func(claims *jwt.Claims)) []byte {
+	var claims jwt.Claims
+	claims.Issuer = s.server.URL
+	claims.Subject = "user-1"
+	claims.Audiences = []string{"payment-platform"}
+	claims.Expires = jwt.NewNumericTime(time.Now().Add(time.Hour))
+	claims.Set = map[string]any{
+		"merchant_id": "testMerchant",
+		"scope":       "payments:read refunds:write",
+	}
+
+	if modify != nil {
+		modify(&claims)
+	}
+
+	s.mu.Lock()
+	key := s.keys[kid]
+	s.mu.Unlock()
+
+	token, err := claims.RSASign(jwt.RS256, key, json.RawMessage(`{"kid":"`+kid+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	issuer := newStubIssuer(t)
+
+	verifier := NewVerifier(Config{
+		Issuer:        issuer.server.URL,
+		Audience:      "payment-platform",
+		MerchantClaim: "merchant_id",
+	})
+
+	t.Run("should map the merchant claim and scopes", func(t *testing.T) {
+		identity, err := verifier.Verify(issuer.token(t, "key-1", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, "testMerchant", identity.MerchantID)
+		assert.Equal(t, []string{"payments:read", "refunds:write"}, identity.Scopes)
+	})
+
+	tests := []struct {
+		name   string
+		modify func(claims *jwt.Claims)
+	}{
+		{
+			name:   "should reject other issuers",
+			modify: func(claims *jwt.Claims) { claims.Issuer = "https://other.example.com" },
+		},
+		{
+			name:   "should reject other audiences",
+			modify: func(claims *jwt.Claims) { claims.Audiences = []string{"other"} },
+		},
+		{
+			name: "should reject expired tokens",
+			modify: func(claims *jwt.Claims) {
+				claims.Expires = jwt.NewNumericTime(time.Now().Add(-time.Minute))
+			},
+		},
+		{
+			name:   "should reject tokens without expiry",
+			modify: func(claims *jwt.Claims) { claims.Expires = nil },
+		},
+		{
+			name:   "should reject tokens without the merchant claim",
+			modify: func(claims *jwt.Claims) { delete(claims.Set, "merchant_id") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := verifier.Verify(issuer.token(t, "key-1", tt.modify))
+			assert.ErrorIs(t, err, ErrInvalidToken)
+		})
+	}
+
+	t.Run("should reject tokens signed with unpublished keys", func(t *testing.T) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var claims jwt.Claims
+		claims.Issuer = issuer.server.URL
+		claims.Audiences = []string{"payment-platform"}
+		claims.Expires = jwt.NewNumericTime(time.Now().Add(time.Hour))
+		claims.Set = map[string]any{"merchant_id": "testMerchant"}
+
+		token, err := claims.RSASign(jwt.RS256, key, json.RawMessage(`{"kid":"key-1"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = verifier.Verify(token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestKeyCache(t *testing.T) {
+	issuer := newStubIssuer(t)
+
+	verifier := NewVerifier(Config{Issuer: issuer.server.URL, Audience: "payment-platform"})
+
+	t0 := time.Now()
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	t.Run("should cache the keys", func(t *testing.T) {
+		for range 3 {
+			identity, err := verifier.Verify(issuer.token(t, "key-1", nil))
+			assert.NoError(t, err)
+			assert.Equal(t, "user-1", identity.MerchantID)
+		}
+
+		assert.Equal(t, int32(1), issuer.jwksFetches.Load())
+	})
+
+	t.Run("should refetch the keys for an unknown key ID", func(t *testing.T) {
+		issuer.addKey(t, "key-2")
+		now = func() time.Time { return t0.Add(2 * minRefreshInterval) }
+
+		_, err := verifier.Verify(issuer.token(t, "key-2", nil))
+		assert.NoError(t, err)
+		assert.Equal(t, int32(2), issuer.jwksFetches.Load())
+	})
+
+	t.Run("should not refetch the keys too often", func(t *testing.T) {
+		issuer.addKey(t, "key-3")
+
+		_, err := verifier.Verify(issuer.token(t, "key-3", nil))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		assert.Equal(t, int32(2), issuer.jwksFetches.Load())
+	})
+}
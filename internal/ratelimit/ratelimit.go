@@ -0,0 +1,208 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+var now = time.Now
+
+// pruneSize is the number of buckets above which buckets that refilled completely are dropped
+const pruneSize = 10000
+
+// Limit is a token bucket refilled at RequestsPerMinute holding at most Burst requests,
+// a zero RequestsPerMinute disables the limit
+type Limit struct {
+	RequestsPerMinute int `json:"RequestsPerMinute"`
+	Burst             int `json:"Burst"`
+}
+
+func (l Limit) unlimited() bool {
+	return l.RequestsPerMinute <= 0
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst <= 0 {
+		return 1
+	}
+
+	return float64(l.Burst)
+}
+
+// Limits are the default limit and its overrides keyed by route, e.g. "POST /payments"
+type Limits struct {
+	Default Limit            `json:"Default"`
+	Routes  map[string]Limit `json:"Routes"`
+}
+
+// Config holds the limits of unauthenticated clients and merchants. Merchant limits are looked
+// up in order: the merchant's route limit, the route limit of all merchants, the merchant's
+// default and the default of all merchants.
+type Config struct {
+	Anonymous Limits            `json:"Anonymous"`
+	Merchant  Limits            `json:"Merchant"`
+	Merchants map[string]Limits `json:"Merchants"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Anonymous: Limits{Default: Limit{RequestsPerMinute: 60, Burst: 20}},
+		Merchant:  Limits{Default: Limit{RequestsPerMinute: 600, Burst: 100}},
+	}
+}
+
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	config := DefaultConfig()
+
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return Config{}, fmt.Errorf("ratelimit: decoding %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+// Result describes the state of the bucket after a request
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again
+	Reset time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when allowed
+	RetryAfter time.Duration
+	Unlimited  bool
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket will have refilled completely
+	full time.Time
+}
+
+type Limiter struct {
+	config Config
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func NewLimiter(config Config) *Limiter {
+	return &Limiter{
+		config:  config,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of the merchant, or of the client IP when merchantID is
+// empty, for the route pattern. Routes without their own limit share a bucket per client.
+func (l *Limiter) Allow(merchantID, ip, route string) Result {
+	limit, scoped := l.limit(merchantID, route)
+	if limit.unlimited() {
+		return Result{Allowed: true, Unlimited: true}
+	}
+
+	key := "ip#" + ip
+	if merchantID != "" {
+		key = "merchant#" + merchantID
+	}
+
+	if scoped {
+		key += "#" + route
+	} else {
+		key += "#*"
+	}
+
+	return l.take(key, limit)
+}
+
+func (l *Limiter) limit(merchantID, route string) (Limit, bool) {
+	if merchantID == "" {
+		return l.config.Anonymous.lookup(route)
+	}
+
+	overrides := l.config.Merchants[merchantID]
+
+	if limit, ok := overrides.Routes[route]; ok {
+		return limit, true
+	}
+
+	if limit, ok := l.config.Merchant.Routes[route]; ok {
+		return limit, true
+	}
+
+	if overrides.Default != (Limit{}) {
+		return overrides.Default, false
+	}
+
+	return l.config.Merchant.Default, false
+}
+
+func (l Limits) lookup(route string) (Limit, bool) {
+	if limit, ok := l.Routes[route]; ok {
+		return limit, true
+	}
+
+	return l.Default, false
+}
+
+func (l *Limiter) take(key string, limit Limit) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t := now()
+	capacity := limit.capacity()
+	rate := float64(limit.RequestsPerMinute) / 60
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= pruneSize {
+			l.prune(t)
+		}
+
+		b = &bucket{tokens: capacity, updated: t}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(capacity, b.tokens+t.Sub(b.updated).Seconds()*rate)
+	b.updated = t
+
+	result := Result{Limit: int(capacity)}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / rate)
+
+	b.full = t.Add(result.Reset)
+
+	return result
+}
+
+// prune drops the buckets that refilled completely, they are recreated full when needed
+func (l *Limiter) prune(t time.Time) {
+	for key, b := range l.buckets {
+		if !t.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s)) * time.Second
+}
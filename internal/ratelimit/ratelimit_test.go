@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAllow(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	now = func() time.Time { return t0 }
+	defer func() { now = time.Now }()
+
+	limiter := NewLimiter(Config{
+		Anonymous: Limits{Default: Limit{RequestsPerMinute: 60, Burst: 2}},
+		Merchant: Limits{
+			Default: Limit{RequestsPerMinute: 60, Burst: 3},
+			Routes:  map[string]Limit{"POST /payments": {RequestsPerMinute: 6, Burst: 1}},
+		},
+		Merchants: map[string]Limits{
+			"bigMerchant": {
+				Default: Limit{RequestsPerMinute: 600, Burst: 5},
+				Routes:  map[string]Limit{"POST /payments": {RequestsPerMinute: 60, Burst: 2}},
+			},
+			"unlimitedMerchant": {
+				Default: Limit{RequestsPerMinute: -1},
+			},
+		},
+	})
+
+	t.Run("should limit requests once the burst is used", func(t *testing.T) {
+		for i := range 3 {
+			result := limiter.Allow("merchant", "", "GET /payments/{paymentID}")
+			assert.True(t, result.Allowed)
+			assert.Equal(t, 3, result.Limit)
+			assert.Equal(t, 2-i, result.Remaining)
+		}
+
+		result := limiter.Allow("merchant", "", "GET /payments/{paymentID}")
+		assert.False(t, result.Allowed)
+		assert.Equal(t, time.Second, result.RetryAfter)
+		assert.Equal(t, 3*time.Second, result.Reset)
+	})
+
+	t.Run("should share the default bucket between routes", func(t *testing.T) {
+		result := limiter.Allow("merchant", "", "GET /api-keys")
+		assert.False(t, result.Allowed)
+	})
+
+	t.Run("should limit routes separately", func(t *testing.T) {
+		result := limiter.Allow("merchant", "", "POST /payments")
+		assert.True(t, result.Allowed)
+
+		result = limiter.Allow("merchant", "", "POST /payments")
+		assert.False(t, result.Allowed)
+		assert.Equal(t, 10*time.Second, result.RetryAfter)
+	})
+
+	t.Run("should refill the bucket over time", func(t *testing.T) {
+		now = func() time.Time { return t0.Add(time.Second) }
+
+		result := limiter.Allow("merchant", "", "GET /payments/{paymentID}")
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 0, result.Remaining)
+	})
+
+	t.Run("should apply merchant overrides", func(t *testing.T) {
+		for range 2 {
+			assert.True(t, limiter.Allow("bigMerchant", "", "POST /payments").Allowed)
+		}
+		assert.False(t, limiter.Allow("bigMerchant", "", "POST /payments").Allowed)
+
+		assert.Equal(t, 5, limiter.Allow("bigMerchant", "", "GET /api-keys").Limit)
+
+		result := limiter.Allow("unlimitedMerchant", "", "GET /api-keys")
+		assert.True(t, result.Allowed)
+		assert.True(t, result.Unlimited)
+	})
+
+	t.Run("should limit anonymous clients by IP", func(t *testing.T) {
+		assert.True(t, limiter.Allow("", "10.0.0.1", "POST /token").Allowed)
+		assert.True(t, limiter.Allow("", "10.0.0.1", "POST /token").Allowed)
+		assert.False(t, limiter.Allow("", "10.0.0.1", "POST /token").Allowed)
+
+		assert.True(t, limiter.Allow("", "10.0.0.2", "POST /token").Allowed)
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "limits.json")
+
+	data := `{"Merchant":{"Routes":{"POST /payments":{"RequestsPerMinute":30,"Burst":5}}}}`
+
+	err := os.WriteFile(path, []byte(data), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+
+	assert.Equal(t, DefaultConfig().Merchant.Default, config.Merchant.Default)
+	assert.Equal(t, DefaultConfig().Anonymous, config.Anonymous)
+	assert.Equal(t, Limit{RequestsPerMinute: 30, Burst: 5}, config.Merchant.Routes["POST /payments"])
+}
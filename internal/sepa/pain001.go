@@ -0,0 +1,365 @@
+package sepa
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mgajewskik/payment-platform/internal/validator"
+)
+
+const (
+	Pain001Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.001.001.03"
+
+	// Currency is the only currency of SEPA credit transfers
+	Currency = "EUR"
+
+	MaxIDLength          = 35
+	MaxNameLength        = 70
+	MaxRemittanceLength  = 140
+	MaxTransactionAmount = 99999999999 // 999999999.99 EUR in cents
+)
+
+var ErrInvalidMessage = errors.New("sepa: invalid message")
+
+var (
+	// rgxText is the Latin character set that SEPA banks have to accept
+	rgxText = regexp.MustCompile(`^[A-Za-z0-9/\-?:().,'+ ]*$`)
+	// rgxID is the character set of references, which cannot contain spaces
+	rgxID = regexp.MustCompile(`^[A-Za-z0-9/\-?:().,'+]+$`)
+)
+
+// Party is the holder of an account, the BIC is optional for creditors
+type Party struct {
+	Name string
+	IBAN string
+	BIC  string
+}
+
+// CreditTransfer is a batch of SEPA credit transfers from the debtor account, all executed on
+// the same date
+type CreditTransfer struct {
+	MessageID       string
+	CreationTime    time.Time
+	InitiatingParty string
+	ExecutionDate   time.Time
+	Debtor          Party
+	Transactions    []Transaction
+}
+
+type Transaction struct {
+	EndToEndID            string
+	Amount                int64 // euro cents
+	Creditor              Party
+	RemittanceInformation string
+}
+
+// ControlSum returns the sum of the transaction amounts in cents
+func (t CreditTransfer) ControlSum() int64 {
+	var sum int64
+	for _, transaction := range t.Transactions {
+		sum += transaction.Amount
+	}
+
+	return sum
+}
+
+// Validate checks the rules of the SEPA implementation guidelines that the pain.001.001.03
+// schema does not express on its own: lengths, the character set, account identifiers and
+// amounts
+func (t CreditTransfer) Validate() error {
+	var errs []error
+
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, invalid(format, args...))
+		}
+	}
+
+	check(IsID(t.MessageID), "message ID %q", t.MessageID)
+	check(!t.ExecutionDate.IsZero(), "missing execution date")
+	errs = append(errs, ValidateDebtor(t.Debtor, t.InitiatingParty))
+	check(len(t.Transactions) > 0, "no transactions")
+
+	seen := make(map[string]bool)
+
+	for _, transaction := range t.Transactions {
+		check(!seen[transaction.EndToEndID], "duplicate end to end ID %q", transaction.EndToEndID)
+		seen[transaction.EndToEndID] = true
+
+		errs = append(errs, transaction.Validate())
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateDebtor checks the account credit transfers are sent from, which requires a BIC, and
+// the name of the party initiating them
+func ValidateDebtor(debtor Party, initiatingParty string) error {
+	var errs []error
+
+	if !IsText(initiatingParty, MaxNameLength) {
+		errs = append(errs, invalid("initiating party %q", initiatingParty))
+	}
+
+	if debtor.BIC == "" || !isParty(debtor) {
+		errs = append(errs, invalid("debtor %q", debtor.Name))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (t Transaction) Validate() error {
+	var errs []error
+
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, invalid(format, args...))
+		}
+	}
+
+	check(IsID(t.EndToEndID), "end to end ID %q", t.EndToEndID)
+	check(t.Amount > 0 && t.Amount <= MaxTransactionAmount, "amount of %s", t.EndToEndID)
+	check(isParty(t.Creditor), "creditor %q of %s", t.Creditor.Name, t.EndToEndID)
+	check(
+		t.RemittanceInformation == "" || IsText(t.RemittanceInformation, MaxRemittanceLength),
+		"remittance information of %s",
+		t.EndToEndID,
+	)
+
+	return errors.Join(errs...)
+}
+
+// Generate validates the credit transfer and returns it as a pain.001.001.03 document with the
+// number of transactions and control sum computed from the transactions
+func Generate(t CreditTransfer) ([]byte, error) {
+	err := t.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	controlSum := formatAmount(t.ControlSum())
+
+	document := pain001Document{
+		Namespace: Pain001Namespace,
+		Initiation: customerCreditTransferInitiation{
+			GroupHeader: groupHeader{
+				MessageID:            t.MessageID,
+				CreationDateTime:     t.CreationTime.UTC().Format("2006-01-02T15:04:05"),
+				NumberOfTransactions: strconv.Itoa(len(t.Transactions)),
+				ControlSum:           controlSum,
+				InitiatingParty:      partyName{Name: t.InitiatingParty},
+			},
+			PaymentInformation: paymentInformation{
+				ID:                   t.MessageID,
+				Method:               "TRF",
+				BatchBooking:         true,
+				NumberOfTransactions: strconv.Itoa(len(t.Transactions)),
+				ControlSum:           controlSum,
+				ServiceLevel:         "SEPA",
+				ExecutionDate:        t.ExecutionDate.Format("2006-01-02"),
+				Debtor:               partyName{Name: t.Debtor.Name},
+				DebtorAccount:        t.Debtor.IBAN,
+				DebtorAgent:          t.Debtor.BIC,
+				ChargeBearer:         "SLEV",
+			},
+		},
+	}
+
+	for _, transaction := range t.Transactions {
+		document.Initiation.PaymentInformation.Transactions = append(
+			document.Initiation.PaymentInformation.Transactions,
+			creditTransferTransaction{
+				EndToEndID: transaction.EndToEndID,
+				Amount: instructedAmount{
+					Currency: Currency,
+					Value:    formatAmount(transaction.Amount),
+				},
+				CreditorAgent:   transaction.Creditor.BIC,
+				Creditor:        partyName{Name: transaction.Creditor.Name},
+				CreditorAccount: transaction.Creditor.IBAN,
+				Remittance:      transaction.RemittanceInformation,
+			},
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+
+	err = encoder.Encode(document)
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+
+	return buf.Bytes(), nil
+}
+
+// VerifyControlSums checks that the number of transactions and control sums of a pain.001
+// document match its transactions, for files that were edited before being uploaded
+func VerifyControlSums(data []byte) error {
+	var document pain001Document
+
+	err := xml.Unmarshal(data, &document)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+
+	header := document.Initiation.GroupHeader
+	info := document.Initiation.PaymentInformation
+
+	var sum int64
+	for _, transaction := range info.Transactions {
+		amount, err := parseAmount(transaction.Amount.Value)
+		if err != nil {
+			return err
+		}
+
+		sum += amount
+	}
+
+	count := strconv.Itoa(len(info.Transactions))
+
+	for _, counted := range []struct {
+		name, count, controlSum string
+	}{
+		{"group header", header.NumberOfTransactions, header.ControlSum},
+		{"payment information", info.NumberOfTransactions, info.ControlSum},
+	} {
+		if counted.count != count {
+			return fmt.Errorf(
+				"%w: %s counts %s transactions instead of %s",
+				ErrInvalidMessage,
+				counted.name,
+				counted.count,
+				count,
+			)
+		}
+
+		controlSum, err := parseAmount(counted.controlSum)
+		if err != nil {
+			return err
+		}
+
+		if controlSum != sum {
+			return fmt.Errorf(
+				"%w: %s control sum %s does not match %s",
+				ErrInvalidMessage,
+				counted.name,
+				counted.controlSum,
+				formatAmount(sum),
+			)
+		}
+	}
+
+	return nil
+}
+
+// IsID reports whether the value can be used as a message or end to end reference
+func IsID(value string) bool {
+	return validator.MaxRunes(value, MaxIDLength) &&
+		rgxID.MatchString(value) &&
+		!strings.HasPrefix(value, "/") &&
+		!strings.HasSuffix(value, "/") &&
+		!strings.Contains(value, "//")
+}
+
+// IsText reports whether the value is a non blank text of at most maxLength characters of the
+// SEPA character set
+func IsText(value string, maxLength int) bool {
+	return validator.NotBlank(value) &&
+		validator.MaxRunes(value, maxLength) &&
+		rgxText.MatchString(value)
+}
+
+func isParty(party Party) bool {
+	return IsText(party.Name, MaxNameLength) &&
+		validator.IsIBAN(party.IBAN) &&
+		(party.BIC == "" || validator.IsBIC(party.BIC))
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidMessage, fmt.Sprintf(format, args...))
+}
+
+// formatAmount formats cents as euros with two decimals
+func formatAmount(cents int64) string {
+	return fmt.Sprintf("%d.%02d", cents/100, cents%100)
+}
+
+// parseAmount parses euros with at most two decimals into cents
+func parseAmount(value string) (int64, error) {
+	units, fraction, _ := strings.Cut(strings.TrimSpace(value), ".")
+	if len(fraction) > 2 {
+		return 0, fmt.Errorf("%w: amount %q has more than two decimals", ErrInvalidMessage, value)
+	}
+
+	cents, err := strconv.ParseInt(units+fraction+strings.Repeat("0", 2-len(fraction)), 10, 64)
+	if err != nil || cents < 0 {
+		return 0, fmt.Errorf("%w: amount %q", ErrInvalidMessage, value)
+	}
+
+	return cents, nil
+}
+
+type pain001Document struct {
+	XMLName    xml.Name                         `xml:"Document"`
+	Namespace  string                           `xml:"xmlns,attr"`
+	Initiation customerCreditTransferInitiation `xml:"CstmrCdtTrfInitn"`
+}
+
+type customerCreditTransferInitiation struct {
+	GroupHeader        groupHeader        `xml:"GrpHdr"`
+	PaymentInformation paymentInformation `xml:"PmtInf"`
+}
+
+type groupHeader struct {
+	MessageID            string    `xml:"MsgId"`
+	CreationDateTime     string    `xml:"CreDtTm"`
+	NumberOfTransactions string    `xml:"NbOfTxs"`
+	ControlSum           string    `xml:"CtrlSum"`
+	InitiatingParty      partyName `xml:"InitgPty"`
+}
+
+type partyName struct {
+	Name string `xml:"Nm"`
+}
+
+// paymentInformation NOTE: the order of the fields follows the sequence of the schema
+type paymentInformation struct {
+	ID                   string                      `xml:"PmtInfId"`
+	Method               string                      `xml:"PmtMtd"`
+	BatchBooking         bool                        `xml:"BtchBookg"`
+	NumberOfTransactions string                      `xml:"NbOfTxs"`
+	ControlSum           string                      `xml:"CtrlSum"`
+	ServiceLevel         string                      `xml:"PmtTpInf>SvcLvl>Cd"`
+	ExecutionDate        string                      `xml:"ReqdExctnDt"`
+	Debtor               partyName                   `xml:"Dbtr"`
+	DebtorAccount        string                      `xml:"DbtrAcct>Id>IBAN"`
+	DebtorAgent          string                      `xml:"DbtrAgt>FinInstnId>BIC"`
+	ChargeBearer         string                      `xml:"ChrgBr"`
+	Transactions         []creditTransferTransaction `xml:"CdtTrfTxInf"`
+}
+
+type creditTransferTransaction struct {
+	EndToEndID      string           `xml:"PmtId>EndToEndId"`
+	Amount          instructedAmount `xml:"Amt>InstdAmt"`
+	CreditorAgent   string           `xml:"CdtrAgt>FinInstnId>BIC,omitempty"`
+	Creditor        partyName        `xml:"Cdtr"`
+	CreditorAccount string           `xml:"CdtrAcct>Id>IBAN"`
+	Remittance      string           `xml:"RmtInf>Ustrd,omitempty"`
+}
+
+type instructedAmount struct {
+	Currency string `xml:"Ccy,attr"`
+	Value    string `xml:",chardata"`
+}
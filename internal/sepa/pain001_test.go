@@ -0,0 +1,154 @@
+package sepa
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCreditTransfer() CreditTransfer {
+	return CreditTransfer{
+		MessageID:       "PAYOUTS-20241001",
+		CreationTime:    time.Date(2024, 10, 1, 12, 30, 0, 0, time.UTC),
+		InitiatingParty: "Payment Platform",
+		ExecutionDate:   time.Date(2024, 10, 2, 0, 0, 0, 0, time.UTC),
+		Debtor: Party{
+			Name: "Payment Platform",
+			IBAN: "DE89370400440532013000",
+			BIC:  "COBADEFFXXX",
+		},
+		Transactions: []Transaction{
+			{
+				EndToEndID: "payout1",
+				Amount:     12345,
+				Creditor: Party{
+					Name: "First Merchant",
+					IBAN: "FR1420041010050500013M02606",
+					BIC:  "PSSTFRPPPAR",
+				},
+				RemittanceInformation: "Payout payout1",
+			},
+			{
+				EndToEndID: "payout2",
+				Amount:     5,
+				Creditor:   Party{Name: "Second Merchant", IBAN: "NL91ABNA0417164300"},
+			},
+		},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Run("should generate a pain.001.001.03 document", func(t *testing.T) {
+		// tested function
+		document, err := Generate(newTestCreditTransfer())
+		assert.NoError(t, err)
+
+		xml := string(document)
+
+		assert.True(t, strings.HasPrefix(xml, `<?xml version="1.0" encoding="UTF-8"?>`))
+		assert.Contains(t, xml, `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">`)
+		assert.Contains(t, xml, "<CreDtTm>2024-10-01T12:30:00</CreDtTm>")
+		assert.Contains(t, xml, "<ReqdExctnDt>2024-10-02</ReqdExctnDt>")
+		assert.Equal(t, 2, strings.Count(xml, "<NbOfTxs>2</NbOfTxs>"))
+		assert.Equal(t, 2, strings.Count(xml, "<CtrlSum>123.50</CtrlSum>"))
+		assert.Contains(t, xml, `<InstdAmt Ccy="EUR">123.45</InstdAmt>`)
+		assert.Contains(t, xml, `<InstdAmt Ccy="EUR">0.05</InstdAmt>`)
+		assert.Contains(t, xml, "<BIC>PSSTFRPPPAR</BIC>")
+		assert.Equal(t, 2, strings.Count(xml, "<BIC>"), "creditor BIC is optional")
+		assert.Equal(t, 1, strings.Count(xml, "<Ustrd>"))
+
+		assert.NoError(t, VerifyControlSums(document))
+	})
+
+	tests := []struct {
+		name   string
+		modify func(*CreditTransfer)
+	}{
+		{"long message ID", func(c *CreditTransfer) { c.MessageID = strings.Repeat("A", 36) }},
+		{"message ID with spaces", func(c *CreditTransfer) { c.MessageID = "PAYOUTS 1" }},
+		{"message ID with double slash", func(c *CreditTransfer) { c.MessageID = "A//B" }},
+		{"debtor without BIC", func(c *CreditTransfer) { c.Debtor.BIC = "" }},
+		{"invalid debtor IBAN", func(c *CreditTransfer) {
+			c.Debtor.IBAN = "DE00370400440532013000"
+		}},
+		{"no transactions", func(c *CreditTransfer) { c.Transactions = nil }},
+		{"duplicate end to end ID", func(c *CreditTransfer) {
+			c.Transactions[1].EndToEndID = c.Transactions[0].EndToEndID
+		}},
+		{"zero amount", func(c *CreditTransfer) { c.Transactions[0].Amount = 0 }},
+		{"amount too large", func(c *CreditTransfer) {
+			c.Transactions[0].Amount = MaxTransactionAmount + 1
+		}},
+		{"creditor name outside character set", func(c *CreditTransfer) {
+			c.Transactions[0].Creditor.Name = "Müller & Söhne"
+		}},
+		{"long creditor name", func(c *CreditTransfer) {
+			c.Transactions[0].Creditor.Name = strings.Repeat("A", 71)
+		}},
+		{"long remittance information", func(c *CreditTransfer) {
+			c.Transactions[0].RemittanceInformation = strings.Repeat("A", 141)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run("should reject "+tt.name, func(t *testing.T) {
+			transfer := newTestCreditTransfer()
+			tt.modify(&transfer)
+
+			// tested function
+			_, err := Generate(transfer)
+
+			assert.ErrorIs(t, err, ErrInvalidMessage)
+		})
+	}
+}
+
+func TestVerifyControlSums(t *testing.T) {
+	document, _ := Generate(newTestCreditTransfer())
+
+	t.Run("should reject a changed amount", func(t *testing.T) {
+		changed := strings.Replace(string(document), ">123.45<", ">123.46<", 1)
+
+		// tested function
+		err := VerifyControlSums([]byte(changed))
+
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+	})
+
+	t.Run("should reject a wrong number of transactions", func(t *testing.T) {
+		changed := strings.Replace(string(document), "<NbOfTxs>2<", "<NbOfTxs>3<", 1)
+
+		// tested function
+		err := VerifyControlSums([]byte(changed))
+
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+	})
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Müller & Söhne GmbH", "Mueller + Soehne GmbH"},
+		{"Łódź  Café_Bar", "Lodz Cafe-Bar"},
+		{"Shop #1 <online>", "Shop 1 online"},
+		{"Łukasz Żółć", "Lukasz Zolc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			// tested function
+			got := Text(tt.value, MaxNameLength)
+
+			assert.Equal(t, tt.want, got)
+			assert.True(t, IsText(got, MaxNameLength))
+		})
+	}
+
+	t.Run("should truncate", func(t *testing.T) {
+		assert.Equal(t, "ABC", Text("ABC DEF", 4))
+	})
+}
@@ -0,0 +1,171 @@
+package sepa
+
+import (
+	"encoding/xml"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const Pain002Namespace = "urn:iso:std:iso:20022:tech:xsd:pain.002.001.03"
+
+// Payment status codes reported in pain.002 status reports
+const (
+	StatusAcceptedTechnicalValidation = "ACTC"
+	StatusAcceptedCustomerProfile     = "ACCP"
+	StatusAcceptedSettlementInProcess = "ACSP"
+	StatusAcceptedSettlementCompleted = "ACSC"
+	StatusAcceptedWithChange          = "ACWC"
+	StatusPartiallyAccepted           = "PART"
+	StatusPending                     = "PDNG"
+	StatusRejected                    = "RJCT"
+)
+
+// StatusReport is the status the bank reported for the transactions of a credit transfer
+// message
+type StatusReport struct {
+	MessageID         string
+	OriginalMessageID string
+	// Status applies to the transactions of the original message that are not listed
+	Status       string
+	Reason       string
+	Transactions []TransactionStatus
+}
+
+type TransactionStatus struct {
+	EndToEndID string
+	Status     string
+	Reason     string
+}
+
+// Final reports whether the transaction was either settled or rejected
+func (s TransactionStatus) Final() bool {
+	return s.Status == StatusAcceptedSettlementCompleted || s.Status == StatusRejected
+}
+
+// TransactionStatus returns the status of the transaction of the original message, the status
+// of the whole message applies to transactions that are not listed. False is returned when the
+// report says nothing about the transaction.
+func (r StatusReport) TransactionStatus(endToEndID string) (TransactionStatus, bool) {
+	index := slices.IndexFunc(r.Transactions, func(transaction TransactionStatus) bool {
+		return transaction.EndToEndID == endToEndID
+	})
+	if index >= 0 {
+		return r.Transactions[index], true
+	}
+
+	// NOTE: partial acceptance only holds for the listed transactions
+	if r.Status == "" || r.Status == StatusPartiallyAccepted {
+		return TransactionStatus{}, false
+	}
+
+	return TransactionStatus{EndToEndID: endToEndID, Status: r.Status, Reason: r.Reason}, true
+}
+
+// ParseStatusReport reads a pain.002.001.03 customer payment status report. Transactions without
+// a status of their own take the status of their payment information block, and blocks
+// reported without transactions set the status of the whole message.
+func ParseStatusReport(data []byte) (StatusReport, error) {
+	var document pain002Document
+
+	err := xml.Unmarshal(data, &document)
+	if err != nil {
+		return StatusReport{}, fmt.Errorf("%w: %w", ErrInvalidMessage, err)
+	}
+
+	if document.XMLName.Space != Pain002Namespace {
+		return StatusReport{}, fmt.Errorf(
+			"%w: unsupported namespace %q",
+			ErrInvalidMessage,
+			document.XMLName.Space,
+		)
+	}
+
+	body := document.Report
+	group := body.OriginalGroup
+
+	if group.OriginalMessageID == "" {
+		return StatusReport{}, fmt.Errorf("%w: missing original message ID", ErrInvalidMessage)
+	}
+
+	report := StatusReport{
+		MessageID:         body.GroupHeader.MessageID,
+		OriginalMessageID: group.OriginalMessageID,
+		Status:            group.Status,
+		Reason:            group.Reason.reason(),
+	}
+
+	for _, info := range body.PaymentInformation {
+		if len(info.Transactions) == 0 && info.Status != "" {
+			report.Status = info.Status
+			report.Reason = info.Reason.reason()
+		}
+
+		for _, transaction := range info.Transactions {
+			status := TransactionStatus{
+				EndToEndID: transaction.OriginalEndToEndID,
+				Status:     transaction.Status,
+				Reason:     transaction.Reason.reason(),
+			}
+
+			if status.Status == "" {
+				status.Status = info.Status
+				status.Reason = info.Reason.reason()
+			}
+
+			report.Transactions = append(report.Transactions, status)
+		}
+	}
+
+	return report, nil
+}
+
+type pain002Document struct {
+	XMLName xml.Name                    `xml:"Document"`
+	Report  customerPaymentStatusReport `xml:"CstmrPmtStsRpt"`
+}
+
+type customerPaymentStatusReport struct {
+	GroupHeader struct {
+		MessageID string `xml:"MsgId"`
+	} `xml:"GrpHdr"`
+	OriginalGroup struct {
+		OriginalMessageID string       `xml:"OrgnlMsgId"`
+		Status            string       `xml:"GrpSts"`
+		Reason            statusReason `xml:"StsRsnInf"`
+	} `xml:"OrgnlGrpInfAndSts"`
+	PaymentInformation []struct {
+		Status       string       `xml:"PmtInfSts"`
+		Reason       statusReason `xml:"StsRsnInf"`
+		Transactions []struct {
+			OriginalEndToEndID string       `xml:"OrgnlEndToEndId"`
+			Status             string       `xml:"TxSts"`
+			Reason             statusReason `xml:"StsRsnInf"`
+		} `xml:"TxInfAndSts"`
+	} `xml:"OrgnlPmtInfAndSts"`
+}
+
+type statusReason struct {
+	Code                  string   `xml:"Rsn>Cd"`
+	Proprietary           string   `xml:"Rsn>Prtry"`
+	AdditionalInformation []string `xml:"AddtlInf"`
+}
+
+// reason joins the reason code with the additional information given by the bank
+func (r statusReason) reason() string {
+	code := r.Code
+	if code == "" {
+		code = r.Proprietary
+	}
+
+	info := strings.Join(r.AdditionalInformation, " ")
+
+	switch {
+	case code == "":
+		return info
+	case info == "":
+		return code
+	default:
+		return code + ": " + info
+	}
+}
@@ -0,0 +1,104 @@
+package sepa
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testStatusReport = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.002.001.03">
+  <CstmrPmtStsRpt>
+    <GrpHdr>
+      <MsgId>STATUS-1</MsgId>
+      <CreDtTm>2024-10-02T08:00:00</CreDtTm>
+    </GrpHdr>
+    <OrgnlGrpInfAndSts>
+      <OrgnlMsgId>PAYOUTS-20241001</OrgnlMsgId>
+      <OrgnlMsgNmId>pain.001.001.03</OrgnlMsgNmId>
+      <GrpSts>PART</GrpSts>
+    </OrgnlGrpInfAndSts>
+    <OrgnlPmtInfAndSts>
+      <OrgnlPmtInfId>PAYOUTS-20241001</OrgnlPmtInfId>
+      <PmtInfSts>ACSC</PmtInfSts>
+      <TxInfAndSts>
+        <OrgnlEndToEndId>payout1</OrgnlEndToEndId>
+      </TxInfAndSts>
+      <TxInfAndSts>
+        <OrgnlEndToEndId>payout2</OrgnlEndToEndId>
+        <TxSts>RJCT</TxSts>
+        <StsRsnInf>
+          <Rsn><Cd>AC04</Cd></Rsn>
+          <AddtlInf>Account closed</AddtlInf>
+        </StsRsnInf>
+      </TxInfAndSts>
+    </OrgnlPmtInfAndSts>
+  </CstmrPmtStsRpt>
+</Document>`
+
+const testRejectedReport = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.002.001.03">
+  <CstmrPmtStsRpt>
+    <GrpHdr><MsgId>STATUS-2</MsgId></GrpHdr>
+    <OrgnlGrpInfAndSts>
+      <OrgnlMsgId>PAYOUTS-20241001</OrgnlMsgId>
+      <GrpSts>RJCT</GrpSts>
+      <StsRsnInf><Rsn><Prtry>FF01</Prtry></Rsn></StsRsnInf>
+    </OrgnlGrpInfAndSts>
+  </CstmrPmtStsRpt>
+</Document>`
+
+func TestParseStatusReport(t *testing.T) {
+	t.Run("should parse transaction statuses", func(t *testing.T) {
+		// tested function
+		report, err := ParseStatusReport([]byte(testStatusReport))
+		assert.NoError(t, err)
+
+		assert.Equal(t, StatusReport{
+			MessageID:         "STATUS-1",
+			OriginalMessageID: "PAYOUTS-20241001",
+			Status:            StatusPartiallyAccepted,
+			Transactions: []TransactionStatus{
+				{EndToEndID: "payout1", Status: StatusAcceptedSettlementCompleted},
+				{EndToEndID: "payout2", Status: StatusRejected, Reason: "AC04: Account closed"},
+			},
+		}, report)
+
+		status, ok := report.TransactionStatus("payout1")
+		assert.True(t, ok)
+		assert.True(t, status.Final())
+
+		_, ok = report.TransactionStatus("payout3")
+		assert.False(t, ok, "partial acceptance says nothing about unlisted transactions")
+	})
+
+	t.Run("should apply the group status to all transactions", func(t *testing.T) {
+		// tested function
+		report, err := ParseStatusReport([]byte(testRejectedReport))
+		assert.NoError(t, err)
+
+		status, ok := report.TransactionStatus("payout1")
+		assert.True(t, ok)
+		assert.Equal(t, TransactionStatus{
+			EndToEndID: "payout1",
+			Status:     StatusRejected,
+			Reason:     "FF01",
+		}, status)
+	})
+
+	t.Run("should reject other messages", func(t *testing.T) {
+		document, _ := Generate(newTestCreditTransfer())
+
+		// tested function
+		_, err := ParseStatusReport(document)
+
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+	})
+
+	t.Run("should reject malformed reports", func(t *testing.T) {
+		// tested function
+		_, err := ParseStatusReport([]byte("<Document"))
+
+		assert.ErrorIs(t, err, ErrInvalidMessage)
+	})
+}
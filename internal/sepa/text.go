@@ -0,0 +1,53 @@
+package sepa
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// transliterations maps the letters of European alphabets to the SEPA character set
+var transliterations = map[rune]string{
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "Ae", 'Å': "A", 'Ą': "A", 'Æ': "AE",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "ae", 'å': "a", 'ą': "a", 'æ': "ae",
+	'Ç': "C", 'Ć': "C", 'Č': "C", 'ç': "c", 'ć': "c", 'č': "c",
+	'Ď': "D", 'Đ': "D", 'ď': "d", 'đ': "d",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ę': "E", 'Ě': "E",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ę': "e", 'ě': "e",
+	'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I", 'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'Ł': "L", 'ł': "l",
+	'Ñ': "N", 'Ń': "N", 'Ň': "N", 'ñ': "n", 'ń': "n", 'ň': "n",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "Oe", 'Ø': "O", 'Œ': "OE",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "oe", 'ø': "o", 'œ': "oe",
+	'Ř': "R", 'ř': "r",
+	'Ś': "S", 'Š': "S", 'ś': "s", 'š': "s", 'ß': "ss",
+	'Ť': "T", 'ť': "t",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "Ue", 'Ů': "U",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "ue", 'ů': "u",
+	'Ý': "Y", 'ý': "y", 'ÿ': "y",
+	'Ź': "Z", 'Ż': "Z", 'Ž': "Z", 'ź': "z", 'ż': "z", 'ž': "z",
+	'&': "+", '_': "-", '"': "'",
+}
+
+// Text transliterates the value to the SEPA character set, replacing characters without a
+// transliteration with spaces, and truncates it to maxLength characters
+func Text(value string, maxLength int) string {
+	var b strings.Builder
+
+	for _, r := range value {
+		switch {
+		case r < utf8.RuneSelf && rgxText.MatchString(string(r)):
+			b.WriteRune(r)
+		case transliterations[r] != "":
+			b.WriteString(transliterations[r])
+		default:
+			b.WriteRune(' ')
+		}
+	}
+
+	text := strings.Join(strings.Fields(b.String()), " ")
+	if len(text) > maxLength {
+		text = strings.TrimSpace(text[:maxLength])
+	}
+
+	return text
+}
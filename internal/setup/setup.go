@@ -11,9 +11,16 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 
+	"github.com/mgajewskik/payment-platform/internal/domain/entities"
 	"github.com/mgajewskik/payment-platform/internal/storage"
 )
 
+// NOTE: credentials of the API key inserted with the test data, exchanged at POST /token
+const (
+	TestAPIKeyID     = "test-key-id"
+	TestAPIKeySecret = "test-key-secret"
+)
+
 type DBSetup struct {
 	client    *dynamodb.Client
 	tableName string
@@ -39,6 +46,11 @@ func (s *DBSetup) Setup() error {
 		}
 
 		time.Sleep(10 * time.Second) // wait for table to be created
+
+		err = s.EnableTTL()
+		if err != nil {
+			return err
+		}
 	}
 
 	err = s.InsertTestData()
@@ -102,6 +114,22 @@ func (s *DBSetup) CreateTable() error {
 	return nil
 }
 
+// EnableTTL lets DynamoDB remove expired items such as merchant limit counters
+func (s *DBSetup) EnableTTL() error {
+	_, err := s.client.UpdateTimeToLive(context.TODO(), &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(s.tableName),
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String("TTL"),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func (s *DBSetup) InsertTestData() error {
 	item := storage.MerchantItem{
 		PK: "test@merchant",
@@ -112,21 +140,39 @@ func (s *DBSetup) InsertTestData() error {
 			BIC:      "COBADEFFXXX",
 			Currency: "EUR",
 		},
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
 	}
 
-	av, err := attributevalue.MarshalMap(item)
-	if err != nil {
-		return err
+	apiKey := storage.APIKeyItem{
+		PK:         "test@merchant",
+		SK:         "APIKEY#" + TestAPIKeyID,
+		Name:       "Test API Key",
+		SecretHash: entities.HashAPIKeySecret(TestAPIKeySecret),
+		Scopes:     entities.Scopes,
+		Timestamp:  time.Now().UnixNano() / int64(time.Millisecond),
 	}
 
-	input := &dynamodb.PutItemInput{
-		Item:      av,
-		TableName: aws.String(s.tableName),
+	apiKeyLookup := storage.APIKeyLookupItem{
+		PK:         "APIKEY#" + TestAPIKeyID,
+		SK:         "APIKEY",
+		MerchantID: "test@merchant",
 	}
 
-	_, err = s.client.PutItem(context.TODO(), input)
-	if err != nil {
-		return err
+	for _, item := range []any{item, apiKey, apiKeyLookup} {
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			return err
+		}
+
+		input := &dynamodb.PutItemInput{
+			Item:      av,
+			TableName: aws.String(s.tableName),
+		}
+
+		_, err = s.client.PutItem(context.TODO(), input)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -0,0 +1,79 @@
+package signing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderSignature = "X-Signature"
+	HeaderTimestamp = "X-Signature-Timestamp"
+	HeaderNonce     = "X-Signature-Nonce"
+)
+
+var (
+	ErrMissingSignature = errors.New("signing: missing signature headers")
+	ErrInvalidTimestamp = errors.New("signing: timestamp outside the allowed window")
+	ErrInvalidSignature = errors.New("signing: signature mismatch")
+)
+
+// Request holds the signed parts of a request, Path includes the query string
+type Request struct {
+	Method    string
+	Path      string
+	Timestamp string
+	Nonce     string
+	Body      []byte
+}
+
+// StringToSign joins the method, path, timestamp, nonce and hex encoded SHA-256 of the body
+// with newlines
+func (r Request) StringToSign() string {
+	bodyHash := sha256.Sum256(r.Body)
+
+	return strings.Join([]string{
+		strings.ToUpper(r.Method),
+		r.Path,
+		r.Timestamp,
+		r.Nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// Sign returns the base64 encoded HMAC-SHA256 of the string to sign
+func Sign(secret string, r Request) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(r.StringToSign()))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and that the timestamp (unix seconds) is within maxSkew of now,
+// the nonce has to be checked for replays by the caller
+func Verify(secret string, r Request, signature string, now time.Time, maxSkew time.Duration) error {
+	if signature == "" || r.Timestamp == "" || r.Nonce == "" {
+		return ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(r.Timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew > maxSkew || skew < -maxSkew {
+		return ErrInvalidTimestamp
+	}
+
+	if !hmac.Equal([]byte(Sign(secret, r)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package signing
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStringToSign(t *testing.T) {
+	r := Request{
+		Method:    "post",
+		Path:      "/payments?expand=risk",
+		Timestamp: "1725000000",
+		Nonce:     "abc",
+		Body:      []byte(""),
+	}
+
+	want := "POST\n/payments?expand=risk\n1725000000\nabc\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	assert.Equal(t, want, r.StringToSign())
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1725000000, 0)
+
+	request := func() Request {
+		return Request{
+			Method:    "POST",
+			Path:      "/payments",
+			Timestamp: strconv.FormatInt(now.Unix(), 10),
+			Nonce:     "nonce",
+			Body:      []byte(`{"Amount":"10.00"}`),
+		}
+	}
+
+	signature := Sign("secret", request())
+
+	tests := []struct {
+		name      string
+		modify    func(r *Request)
+		signature string
+		now       time.Time
+		want      error
+	}{
+		{
+			name:      "should accept a valid signature",
+			signature: signature,
+			now:       now,
+		},
+		{
+			name:      "should accept timestamps within the window",
+			signature: signature,
+			now:       now.Add(-4 * time.Minute),
+		},
+		{
+			name:      "should reject old timestamps",
+			signature: signature,
+			now:       now.Add(6 * time.Minute),
+			want:      ErrInvalidTimestamp,
+		},
+		{
+			name:      "should reject a tampered body",
+			modify:    func(r *Request) { r.Body = []byte(`{"Amount":"1000.00"}`) },
+			signature: signature,
+			now:       now,
+			want:      ErrInvalidSignature,
+		},
+		{
+			name:      "should reject a different path",
+			modify:    func(r *Request) { r.Path = "/payments/1/refund" },
+			signature: signature,
+			now:       now,
+			want:      ErrInvalidSignature,
+		},
+		{
+			name:      "should reject a different nonce",
+			modify:    func(r *Request) { r.Nonce = "other" },
+			signature: signature,
+			now:       now,
+			want:      ErrInvalidSignature,
+		},
+		{
+			name: "should reject missing signatures",
+			now:  now,
+			want: ErrMissingSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := request()
+			if tt.modify != nil {
+				tt.modify(&r)
+			}
+
+			err := Verify("secret", r, tt.signature, tt.now, 5*time.Minute)
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"encoding/json"
+	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/mgajewskik/payment-platform/internal/domain/entities"
 )
@@ -12,9 +15,19 @@ type PaymentsItem struct {
 	DATA            string `dynamodbav:"DATA"`
 	CustomerID      string `dynamodbav:"CustomerID"`
 	CardDetails     CardDetails
-	Timestamp       int64 `dynamodbav:"Timestamp"`
-	Refunded        bool  `dynamodbav:"Refunded"`
-	RefundTimestamp int64 `dynamodbav:"RefundTimestamp"`
+	PaymentMethodID string      `dynamodbav:"PaymentMethodID,omitempty"`
+	CardLast4       string      `dynamodbav:"CardLast4,omitempty"`
+	CardBrand       string      `dynamodbav:"CardBrand,omitempty"`
+	IPAddress       string      `dynamodbav:"IPAddress,omitempty"`
+	Settlement      *Settlement `dynamodbav:"Settlement,omitempty"`
+	Fees            *Fees       `dynamodbav:"Fees,omitempty"`
+	Risk            RiskAssessment
+	Timestamp       int64        `dynamodbav:"Timestamp"`
+	Refunded        bool         `dynamodbav:"Refunded"`
+	RefundTimestamp int64        `dynamodbav:"RefundTimestamp"`
+	Adjustments     []Adjustment `dynamodbav:"Adjustments,omitempty"`
+	DisputedAmount  int64        `dynamodbav:"DisputedAmount,omitempty"`
+	OpenDisputes    int64        `dynamodbav:"OpenDisputes,omitempty"`
 }
 
 func NewPaymentsItemFromPayment(payment entities.Payment) PaymentsItem {
@@ -29,9 +42,150 @@ func NewPaymentsItemFromPayment(payment entities.Payment) PaymentsItem {
 			SecurityCode:   payment.Customer.CardDetails.SecurityCode,
 			ExpirationDate: payment.Customer.CardDetails.ExpirationDate,
 		},
+		PaymentMethodID: payment.PaymentMethodID,
+		CardLast4:       payment.CardLast4,
+		CardBrand:       payment.CardBrand,
+		IPAddress:       payment.IPAddress,
+		Settlement:      newSettlement(payment),
+		Fees:            newFees(payment.Fees),
+		Risk: RiskAssessment{
+			Score:    payment.Risk.Score,
+			Decision: payment.Risk.Decision,
+			Rules:    payment.Risk.Rules,
+		},
 		Timestamp:       payment.Timestamp,
 		Refunded:        payment.Refunded,
 		RefundTimestamp: payment.RefundTimestamp,
+		Adjustments:     newAdjustments(payment.Adjustments),
+		DisputedAmount:  payment.DisputedAmount,
+		OpenDisputes:    payment.OpenDisputes,
+	}
+}
+
+// Adjustment NOTE: the amount is in the settlement currency
+type Adjustment struct {
+	ID        string `dynamodbav:"id"`
+	Type      string `dynamodbav:"type"`
+	DisputeID string `dynamodbav:"disputeID,omitempty"`
+	Amount    int64  `dynamodbav:"amount"`
+	Currency  string `dynamodbav:"currency"`
+	Timestamp int64  `dynamodbav:"timestamp"`
+}
+
+func newAdjustments(adjustments []entities.Adjustment) []Adjustment {
+	var items []Adjustment
+	for _, adjustment := range adjustments {
+		items = append(items, Adjustment{
+			ID:        adjustment.ID,
+			Type:      adjustment.Type,
+			DisputeID: adjustment.DisputeID,
+			Amount:    adjustment.Amount.Amount,
+			Currency:  adjustment.Amount.Currency,
+			Timestamp: adjustment.Timestamp,
+		})
+	}
+
+	return items
+}
+
+func adjustments(items []Adjustment) []entities.Adjustment {
+	var adjustments []entities.Adjustment
+	for _, item := range items {
+		adjustments = append(adjustments, entities.Adjustment{
+			ID:        item.ID,
+			Type:      item.Type,
+			DisputeID: item.DisputeID,
+			Amount:    entities.Money{Amount: item.Amount, Currency: item.Currency},
+			Timestamp: item.Timestamp,
+		})
+	}
+
+	return adjustments
+}
+
+// Settlement NOTE: payments created before settlement amounts were stored have none, they were
+// settled in the currency of the price
+type Settlement struct {
+	Amount   int64   `dynamodbav:"amount"`
+	Currency string  `dynamodbav:"currency"`
+	FX       *FXRate `dynamodbav:"fx,omitempty"`
+}
+
+type FXRate struct {
+	Provider    string `dynamodbav:"provider"`
+	MidRate     string `dynamodbav:"midRate"`
+	Markup      string `dynamodbav:"markup"`
+	AppliedRate string `dynamodbav:"appliedRate"`
+	Timestamp   int64  `dynamodbav:"timestamp"`
+}
+
+func newSettlement(payment entities.Payment) *Settlement {
+	if payment.Settlement.Currency == "" {
+		return nil
+	}
+
+	settlement := &Settlement{
+		Amount:   payment.Settlement.Amount,
+		Currency: payment.Settlement.Currency,
+	}
+
+	if payment.FX != nil {
+		settlement.FX = &FXRate{
+			Provider:    payment.FX.Provider,
+			MidRate:     payment.FX.MidRate,
+			Markup:      payment.FX.Markup,
+			AppliedRate: payment.FX.AppliedRate,
+			Timestamp:   payment.FX.Timestamp,
+		}
+	}
+
+	return settlement
+}
+
+// Fees NOTE: all amounts are in the settlement currency, payments captured before fees were
+// calculated have none
+type Fees struct {
+	Currency     string `dynamodbav:"currency"`
+	Gross        int64  `dynamodbav:"gross"`
+	Fee          int64  `dynamodbav:"fee"`
+	Net          int64  `dynamodbav:"net"`
+	FixedFee     int64  `dynamodbav:"fixedFee"`
+	RefundPolicy string `dynamodbav:"refundPolicy"`
+	RefundedFee  int64  `dynamodbav:"refundedFee"`
+}
+
+func newFees(fees entities.Fees) *Fees {
+	if fees.Gross.Currency == "" {
+		return nil
+	}
+
+	return &Fees{
+		Currency:     fees.Gross.Currency,
+		Gross:        fees.Gross.Amount,
+		Fee:          fees.Fee.Amount,
+		Net:          fees.Net.Amount,
+		FixedFee:     fees.FixedFee.Amount,
+		RefundPolicy: fees.RefundPolicy,
+		RefundedFee:  fees.RefundedFee.Amount,
+	}
+}
+
+func (f *Fees) fees() entities.Fees {
+	if f == nil {
+		return entities.Fees{}
+	}
+
+	money := func(amount int64) entities.Money {
+		return entities.Money{Amount: amount, Currency: f.Currency}
+	}
+
+	return entities.Fees{
+		Gross:        money(f.Gross),
+		Fee:          money(f.Fee),
+		Net:          money(f.Net),
+		FixedFee:     money(f.FixedFee),
+		RefundPolicy: f.RefundPolicy,
+		RefundedFee:  money(f.RefundedFee),
 	}
 }
 
@@ -43,10 +197,69 @@ type CardDetails struct {
 	ExpirationDate string `dynamodbav:"expirationDate"`
 }
 
+type RiskAssessment struct {
+	Score    int      `dynamodbav:"score"`
+	Decision string   `dynamodbav:"decision"`
+	Rules    []string `dynamodbav:"rules,omitempty"`
+}
+
 type MerchantItem struct {
-	PK             string `dynamodbav:"PK"` // merchantID
-	SK             string `dynamodbav:"SK"` // MERCHANT
-	AccountDetails AccountDetails
+	PK                   string `dynamodbav:"PK"` // merchantID
+	SK                   string `dynamodbav:"SK"` // MERCHANT
+	AccountDetails       AccountDetails
+	Limits               Limits
+	PricingPlan          PricingPlan
+	Deactivated          bool  `dynamodbav:"Deactivated,omitempty"`
+	DeactivatedTimestamp int64 `dynamodbav:"DeactivatedTimestamp,omitempty"`
+	Timestamp            int64 `dynamodbav:"Timestamp"`
+	UpdatedTimestamp     int64 `dynamodbav:"UpdatedTimestamp,omitempty"`
+}
+
+func NewMerchantItemFromMerchant(merchant entities.Merchant) MerchantItem {
+	return MerchantItem{
+		PK: merchant.ID,
+		SK: "MERCHANT",
+		AccountDetails: AccountDetails{
+			Name:     merchant.AccountDetails.Name,
+			IBAN:     merchant.AccountDetails.IBAN,
+			BIC:      merchant.AccountDetails.BIC,
+			Currency: merchant.AccountDetails.Currency,
+		},
+		Limits: Limits{
+			MaxPaymentAmount: merchant.Limits.MaxPaymentAmount,
+			DailyVolume:      merchant.Limits.DailyVolume,
+			MonthlyVolume:    merchant.Limits.MonthlyVolume,
+			MaxRefundsPerDay: merchant.Limits.MaxRefundsPerDay,
+		},
+		PricingPlan:          newPricingPlan(merchant.PricingPlan),
+		Deactivated:          merchant.Deactivated,
+		DeactivatedTimestamp: merchant.DeactivatedTimestamp,
+		Timestamp:            merchant.Timestamp,
+		UpdatedTimestamp:     merchant.UpdatedTimestamp,
+	}
+}
+
+func (i MerchantItem) Merchant() entities.Merchant {
+	return entities.Merchant{
+		ID: i.PK,
+		AccountDetails: entities.AccountDetails{
+			Name:     i.AccountDetails.Name,
+			IBAN:     i.AccountDetails.IBAN,
+			BIC:      i.AccountDetails.BIC,
+			Currency: i.AccountDetails.Currency,
+		},
+		Limits: entities.Limits{
+			MaxPaymentAmount: i.Limits.MaxPaymentAmount,
+			DailyVolume:      i.Limits.DailyVolume,
+			MonthlyVolume:    i.Limits.MonthlyVolume,
+			MaxRefundsPerDay: i.Limits.MaxRefundsPerDay,
+		},
+		PricingPlan:          i.PricingPlan.pricingPlan(),
+		Deactivated:          i.Deactivated,
+		DeactivatedTimestamp: i.DeactivatedTimestamp,
+		Timestamp:            i.Timestamp,
+		UpdatedTimestamp:     i.UpdatedTimestamp,
+	}
 }
 
 type AccountDetails struct {
@@ -55,3 +268,736 @@ type AccountDetails struct {
 	BIC      string `dynamodbav:"bic"`
 	Currency string `dynamodbav:"currency"`
 }
+
+type Limits struct {
+	MaxPaymentAmount map[string]int64 `dynamodbav:"maxPaymentAmount,omitempty"`
+	DailyVolume      map[string]int64 `dynamodbav:"dailyVolume,omitempty"`
+	MonthlyVolume    map[string]int64 `dynamodbav:"monthlyVolume,omitempty"`
+	MaxRefundsPerDay int64            `dynamodbav:"maxRefundsPerDay,omitempty"`
+}
+
+type PricingPlan struct {
+	Rules        []FeeRule `dynamodbav:"rules,omitempty"`
+	RefundPolicy string    `dynamodbav:"refundPolicy,omitempty"`
+}
+
+type FeeRule struct {
+	Currency   string `dynamodbav:"currency,omitempty"`
+	CardBrand  string `dynamodbav:"cardBrand,omitempty"`
+	Percentage string `dynamodbav:"percentage,omitempty"`
+	Fixed      int64  `dynamodbav:"fixed,omitempty"`
+	Minimum    int64  `dynamodbav:"minimum,omitempty"`
+}
+
+func newPricingPlan(plan entities.PricingPlan) PricingPlan {
+	item := PricingPlan{RefundPolicy: plan.RefundPolicy}
+
+	for _, rule := range plan.Rules {
+		item.Rules = append(item.Rules, FeeRule{
+			Currency:   rule.Currency,
+			CardBrand:  rule.CardBrand,
+			Percentage: rule.Percentage,
+			Fixed:      rule.Fixed,
+			Minimum:    rule.Minimum,
+		})
+	}
+
+	return item
+}
+
+func (p PricingPlan) pricingPlan() entities.PricingPlan {
+	plan := entities.PricingPlan{RefundPolicy: p.RefundPolicy}
+
+	for _, rule := range p.Rules {
+		plan.Rules = append(plan.Rules, entities.FeeRule{
+			Currency:   rule.Currency,
+			CardBrand:  rule.CardBrand,
+			Percentage: rule.Percentage,
+			Fixed:      rule.Fixed,
+			Minimum:    rule.Minimum,
+		})
+	}
+
+	return plan
+}
+
+type CounterItem struct {
+	PK    string `dynamodbav:"PK"` // merchantID
+	SK    string `dynamodbav:"SK"` // COUNTER#counter
+	Value int64  `dynamodbav:"Value"`
+	TTL   int64  `dynamodbav:"TTL"`
+}
+
+type PaymentMethodItem struct {
+	PK             string `dynamodbav:"PK"` // merchantID
+	SK             string `dynamodbav:"SK"` // PAYMENT_METHOD#customerID#paymentMethodID
+	CardToken      string `dynamodbav:"CardToken"`
+	CardName       string `dynamodbav:"CardName"`
+	CardLast4      string `dynamodbav:"CardLast4"`
+	CardExpiryDate string `dynamodbav:"CardExpiryDate"`
+	Timestamp      int64  `dynamodbav:"Timestamp"`
+}
+
+func NewPaymentMethodItemFromPaymentMethod(method entities.PaymentMethod) PaymentMethodItem {
+	return PaymentMethodItem{
+		PK:             method.MerchantID,
+		SK:             paymentMethodSortKey(method.CustomerID, method.ID),
+		CardToken:      method.CardToken,
+		CardName:       method.CardName,
+		CardLast4:      method.CardLast4,
+		CardExpiryDate: method.CardExpiryDate,
+		Timestamp:      method.Timestamp,
+	}
+}
+
+func (i PaymentMethodItem) PaymentMethod() entities.PaymentMethod {
+	key := strings.TrimPrefix(i.SK, "PAYMENT_METHOD#")
+	separator := strings.LastIndex(key, "#")
+
+	return entities.PaymentMethod{
+		ID:             key[separator+1:],
+		MerchantID:     i.PK,
+		CustomerID:     key[:separator],
+		CardToken:      i.CardToken,
+		CardName:       i.CardName,
+		CardLast4:      i.CardLast4,
+		CardExpiryDate: i.CardExpiryDate,
+		Timestamp:      i.Timestamp,
+	}
+}
+
+func paymentMethodSortKey(customerID, paymentMethodID string) string {
+	return "PAYMENT_METHOD#" + customerID + "#" + paymentMethodID
+}
+
+type APIKeyItem struct {
+	PK               string   `dynamodbav:"PK"` // merchantID
+	SK               string   `dynamodbav:"SK"` // APIKEY#keyID
+	Name             string   `dynamodbav:"Name"`
+	SecretHash       string   `dynamodbav:"SecretHash"`
+	Scopes           []string `dynamodbav:"Scopes"`
+	SigningSecret    string   `dynamodbav:"SigningSecret"`
+	Timestamp        int64    `dynamodbav:"Timestamp"`
+	Revoked          bool     `dynamodbav:"Revoked"`
+	RevokedTimestamp int64    `dynamodbav:"RevokedTimestamp"`
+}
+
+func NewAPIKeyItemFromAPIKey(key entities.APIKey) APIKeyItem {
+	return APIKeyItem{
+		PK:               key.MerchantID,
+		SK:               "APIKEY#" + key.ID,
+		Name:             key.Name,
+		SecretHash:       key.SecretHash,
+		Scopes:           key.Scopes,
+		SigningSecret:    key.SigningSecret,
+		Timestamp:        key.Timestamp,
+		Revoked:          key.Revoked,
+		RevokedTimestamp: key.RevokedTimestamp,
+	}
+}
+
+func (i APIKeyItem) APIKey() entities.APIKey {
+	return entities.APIKey{
+		ID:               strings.TrimPrefix(i.SK, "APIKEY#"),
+		MerchantID:       i.PK,
+		Name:             i.Name,
+		SecretHash:       i.SecretHash,
+		Scopes:           i.Scopes,
+		SigningSecret:    i.SigningSecret,
+		Timestamp:        i.Timestamp,
+		Revoked:          i.Revoked,
+		RevokedTimestamp: i.RevokedTimestamp,
+	}
+}
+
+// APIKeyLookupItem points from a key ID to the merchant partition holding the key
+type APIKeyLookupItem struct {
+	PK         string `dynamodbav:"PK"` // APIKEY#keyID
+	SK         string `dynamodbav:"SK"` // APIKEY
+	MerchantID string `dynamodbav:"MerchantID"`
+}
+
+// RevokedTokenItem marks an authentication token as revoked until the token itself expires
+type RevokedTokenItem struct {
+	PK         string `dynamodbav:"PK"` // TOKEN#tokenID
+	SK         string `dynamodbav:"SK"` // REVOKED
+	MerchantID string `dynamodbav:"MerchantID"`
+	TTL        int64  `dynamodbav:"TTL"`
+}
+
+// NonceItem records a request signature nonce until the signature timestamp leaves the
+// allowed window
+type NonceItem struct {
+	PK  string `dynamodbav:"PK"` // NONCE#keyID#nonce
+	SK  string `dynamodbav:"SK"` // NONCE
+	TTL int64  `dynamodbav:"TTL"`
+}
+
+type AuditEventItem struct {
+	PK           string `dynamodbav:"PK"` // merchantID
+	SK           string `dynamodbav:"SK"` // AUDIT#sequence
+	Sequence     int64  `dynamodbav:"Sequence"`
+	Action       string `dynamodbav:"Action"`
+	ActorType    string `dynamodbav:"ActorType"`
+	ActorID      string `dynamodbav:"ActorID"`
+	IPAddress    string `dynamodbav:"IPAddress"`
+	RequestID    string `dynamodbav:"RequestID"`
+	ResourceID   string `dynamodbav:"ResourceID"`
+	Before       string `dynamodbav:"Before"`
+	After        string `dynamodbav:"After"`
+	Outcome      string `dynamodbav:"Outcome"`
+	Error        string `dynamodbav:"Error"`
+	Timestamp    int64  `dynamodbav:"Timestamp"`
+	PreviousHash string `dynamodbav:"PreviousHash"`
+	Hash         string `dynamodbav:"Hash"`
+}
+
+// auditSortKey zero pads the sequence so that events sort in sequence order
+func auditSortKey(sequence int64) string {
+	return fmt.Sprintf("AUDIT#%019d", sequence)
+}
+
+func NewAuditEventItemFromAuditEvent(event entities.AuditEvent) AuditEventItem {
+	return AuditEventItem{
+		PK:           event.MerchantID,
+		SK:           auditSortKey(event.Sequence),
+		Sequence:     event.Sequence,
+		Action:       event.Action,
+		ActorType:    event.Actor.Type,
+		ActorID:      event.Actor.ID,
+		IPAddress:    event.Actor.IPAddress,
+		RequestID:    event.Actor.RequestID,
+		ResourceID:   event.ResourceID,
+		Before:       string(event.Before),
+		After:        string(event.After),
+		Outcome:      event.Outcome,
+		Error:        event.Error,
+		Timestamp:    event.Timestamp,
+		PreviousHash: event.PreviousHash,
+		Hash:         event.Hash,
+	}
+}
+
+func (i AuditEventItem) AuditEvent() entities.AuditEvent {
+	event := entities.AuditEvent{
+		MerchantID: i.PK,
+		Sequence:   i.Sequence,
+		Action:     i.Action,
+		Actor: entities.Actor{
+			Type:      i.ActorType,
+			ID:        i.ActorID,
+			IPAddress: i.IPAddress,
+			RequestID: i.RequestID,
+		},
+		ResourceID:   i.ResourceID,
+		Outcome:      i.Outcome,
+		Error:        i.Error,
+		Timestamp:    i.Timestamp,
+		PreviousHash: i.PreviousHash,
+		Hash:         i.Hash,
+	}
+
+	if i.Before != "" {
+		event.Before = json.RawMessage(i.Before)
+	}
+
+	if i.After != "" {
+		event.After = json.RawMessage(i.After)
+	}
+
+	return event
+}
+
+type JournalEntryItem struct {
+	PK        string        `dynamodbav:"PK"` // merchantID
+	SK        string        `dynamodbav:"SK"` // JOURNAL#entryID
+	Type      string        `dynamodbav:"Type"`
+	PaymentID string        `dynamodbav:"PaymentID"`
+	PayoutID  string        `dynamodbav:"PayoutID,omitempty"`
+	Postings  []PostingItem `dynamodbav:"Postings"`
+	Timestamp int64         `dynamodbav:"Timestamp"`
+}
+
+type PostingItem struct {
+	Account  string `dynamodbav:"account"`
+	Amount   int64  `dynamodbav:"amount"`
+	Currency string `dynamodbav:"currency"`
+}
+
+func NewJournalEntryItemFromJournalEntry(entry entities.JournalEntry) JournalEntryItem {
+	item := JournalEntryItem{
+		PK:        entry.MerchantID,
+		SK:        "JOURNAL#" + entry.ID,
+		Type:      entry.Type,
+		PaymentID: entry.PaymentID,
+		PayoutID:  entry.PayoutID,
+		Timestamp: entry.Timestamp,
+	}
+
+	for _, posting := range entry.Postings {
+		item.Postings = append(item.Postings, PostingItem{
+			Account:  posting.Account,
+			Amount:   posting.Amount.Amount,
+			Currency: posting.Amount.Currency,
+		})
+	}
+
+	return item
+}
+
+func (i JournalEntryItem) JournalEntry() entities.JournalEntry {
+	entry := entities.JournalEntry{
+		ID:         strings.TrimPrefix(i.SK, "JOURNAL#"),
+		MerchantID: i.PK,
+		Type:       i.Type,
+		PaymentID:  i.PaymentID,
+		PayoutID:   i.PayoutID,
+		Timestamp:  i.Timestamp,
+	}
+
+	for _, posting := range i.Postings {
+		entry.Postings = append(entry.Postings, entities.Posting{
+			Account: posting.Account,
+			Amount:  entities.Money{Amount: posting.Amount, Currency: posting.Currency},
+		})
+	}
+
+	return entry
+}
+
+type AccountBalanceItem struct {
+	PK       string `dynamodbav:"PK"` // merchantID
+	SK       string `dynamodbav:"SK"` // BALANCE#account#currency
+	Account  string `dynamodbav:"Account"`
+	Currency string `dynamodbav:"Currency"`
+	Balance  int64  `dynamodbav:"Balance"`
+}
+
+func (i AccountBalanceItem) AccountBalance() entities.AccountBalance {
+	return entities.AccountBalance{
+		Account: i.Account,
+		Balance: entities.Money{Amount: i.Balance, Currency: i.Currency},
+	}
+}
+
+type balanceKey struct {
+	merchantID string
+	account    string
+	currency   string
+}
+
+func (k balanceKey) sortKey() string {
+	return "BALANCE#" + k.account + "#" + k.currency
+}
+
+// isMerchantAccount reports whether the account holds funds owed to the merchant
+func isMerchantAccount(account string) bool {
+	return account == entities.AccountMerchantAvailable ||
+		account == entities.AccountMerchantPending
+}
+
+type PayoutItem struct {
+	PK               string `dynamodbav:"PK"` // merchantID
+	SK               string `dynamodbav:"SK"` // PAYOUT#payoutID
+	Amount           int64  `dynamodbav:"Amount"`
+	Currency         string `dynamodbav:"Currency"`
+	Status           string `dynamodbav:"Status"`
+	Destination      AccountDetails
+	BankTransferID   string `dynamodbav:"BankTransferID,omitempty"`
+	FailureReason    string `dynamodbav:"FailureReason,omitempty"`
+	Timestamp        int64  `dynamodbav:"Timestamp"`
+	UpdatedTimestamp int64  `dynamodbav:"UpdatedTimestamp"`
+}
+
+func NewPayoutItemFromPayout(payout entities.Payout) PayoutItem {
+	return PayoutItem{
+		PK:       payout.MerchantID,
+		SK:       "PAYOUT#" + payout.ID,
+		Amount:   payout.Amount.Amount,
+		Currency: payout.Amount.Currency,
+		Status:   payout.Status,
+		Destination: AccountDetails{
+			Name:     payout.Destination.Name,
+			IBAN:     payout.Destination.IBAN,
+			BIC:      payout.Destination.BIC,
+			Currency: payout.Destination.Currency,
+		},
+		BankTransferID:   payout.BankTransferID,
+		FailureReason:    payout.FailureReason,
+		Timestamp:        payout.Timestamp,
+		UpdatedTimestamp: payout.UpdatedTimestamp,
+	}
+}
+
+func (i PayoutItem) Payout() entities.Payout {
+	return entities.Payout{
+		ID:         strings.TrimPrefix(i.SK, "PAYOUT#"),
+		MerchantID: i.PK,
+		Amount:     entities.Money{Amount: i.Amount, Currency: i.Currency},
+		Status:     i.Status,
+		Destination: entities.AccountDetails{
+			Name:     i.Destination.Name,
+			IBAN:     i.Destination.IBAN,
+			BIC:      i.Destination.BIC,
+			Currency: i.Destination.Currency,
+		},
+		BankTransferID:   i.BankTransferID,
+		FailureReason:    i.FailureReason,
+		Timestamp:        i.Timestamp,
+		UpdatedTimestamp: i.UpdatedTimestamp,
+	}
+}
+
+type DisputeItem struct {
+	PK               string           `dynamodbav:"PK"` // merchantID
+	SK               string           `dynamodbav:"SK"` // DISPUTE#disputeID
+	PaymentID        string           `dynamodbav:"PaymentID"`
+	Reason           string           `dynamodbav:"Reason"`
+	Amount           int64            `dynamodbav:"Amount"`
+	Currency         string           `dynamodbav:"Currency"`
+	Status           string           `dynamodbav:"Status"`
+	Deadline         int64            `dynamodbav:"Deadline"`
+	Evidence         *DisputeEvidence `dynamodbav:"Evidence,omitempty"`
+	Timestamp        int64            `dynamodbav:"Timestamp"`
+	UpdatedTimestamp int64            `dynamodbav:"UpdatedTimestamp"`
+}
+
+type DisputeEvidence struct {
+	Text      string         `dynamodbav:"text"`
+	Files     []EvidenceFile `dynamodbav:"files"`
+	Timestamp int64          `dynamodbav:"timestamp"`
+}
+
+type EvidenceFile struct {
+	ID          string `dynamodbav:"id"`
+	Name        string `dynamodbav:"name"`
+	ContentType string `dynamodbav:"contentType"`
+	Size        int64  `dynamodbav:"size"`
+	Key         string `dynamodbav:"key"`
+}
+
+func NewDisputeItemFromDispute(dispute entities.Dispute) DisputeItem {
+	item := DisputeItem{
+		PK:               dispute.MerchantID,
+		SK:               "DISPUTE#" + dispute.ID,
+		PaymentID:        dispute.PaymentID,
+		Reason:           dispute.Reason,
+		Amount:           dispute.Amount.Amount,
+		Currency:         dispute.Amount.Currency,
+		Status:           dispute.Status,
+		Deadline:         dispute.Deadline,
+		Timestamp:        dispute.Timestamp,
+		UpdatedTimestamp: dispute.UpdatedTimestamp,
+	}
+
+	if dispute.Evidence != nil {
+		item.Evidence = &DisputeEvidence{
+			Text:      dispute.Evidence.Text,
+			Files:     make([]EvidenceFile, 0, len(dispute.Evidence.Files)),
+			Timestamp: dispute.Evidence.Timestamp,
+		}
+
+		for _, file := range dispute.Evidence.Files {
+			item.Evidence.Files = append(item.Evidence.Files, EvidenceFile(file))
+		}
+	}
+
+	return item
+}
+
+func (i DisputeItem) Dispute() entities.Dispute {
+	dispute := entities.Dispute{
+		ID:               strings.TrimPrefix(i.SK, "DISPUTE#"),
+		MerchantID:       i.PK,
+		PaymentID:        i.PaymentID,
+		Reason:           i.Reason,
+		Amount:           entities.Money{Amount: i.Amount, Currency: i.Currency},
+		Status:           i.Status,
+		Deadline:         i.Deadline,
+		Timestamp:        i.Timestamp,
+		UpdatedTimestamp: i.UpdatedTimestamp,
+	}
+
+	if i.Evidence != nil {
+		dispute.Evidence = &entities.DisputeEvidence{
+			Text:      i.Evidence.Text,
+			Timestamp: i.Evidence.Timestamp,
+		}
+
+		for _, file := range i.Evidence.Files {
+			dispute.Evidence.Files = append(dispute.Evidence.Files, entities.EvidenceFile(file))
+		}
+	}
+
+	return dispute
+}
+
+type WebhookEndpointItem struct {
+	PK         string   `dynamodbav:"PK"` // merchantID
+	SK         string   `dynamodbav:"SK"` // WEBHOOK_ENDPOINT#endpointID
+	URL        string   `dynamodbav:"URL"`
+	EventTypes []string `dynamodbav:"EventTypes"`
+	Secret     string   `dynamodbav:"Secret"`
+	Timestamp  int64    `dynamodbav:"Timestamp"`
+}
+
+func NewWebhookEndpointItemFromWebhookEndpoint(
+	endpoint entities.WebhookEndpoint,
+) WebhookEndpointItem {
+	return WebhookEndpointItem{
+		PK:         endpoint.MerchantID,
+		SK:         "WEBHOOK_ENDPOINT#" + endpoint.ID,
+		URL:        endpoint.URL,
+		EventTypes: endpoint.EventTypes,
+		Secret:     endpoint.Secret,
+		Timestamp:  endpoint.Timestamp,
+	}
+}
+
+func (i WebhookEndpointItem) WebhookEndpoint() entities.WebhookEndpoint {
+	return entities.WebhookEndpoint{
+		ID:         strings.TrimPrefix(i.SK, "WEBHOOK_ENDPOINT#"),
+		MerchantID: i.PK,
+		URL:        i.URL,
+		EventTypes: i.EventTypes,
+		Secret:     i.Secret,
+		Timestamp:  i.Timestamp,
+	}
+}
+
+type WebhookDeliveryItem struct {
+	PK               string `dynamodbav:"PK"`           // merchantID
+	SK               string `dynamodbav:"SK"`           // WEBHOOK_DELIVERY#deliveryID
+	DeliveryTime     string `dynamodbav:"DeliveryTime"` // timestamp#deliveryID
+	EndpointID       string `dynamodbav:"EndpointID"`
+	EventID          string `dynamodbav:"EventID"`
+	EventType        string `dynamodbav:"EventType"`
+	Payload          []byte `dynamodbav:"Payload"`
+	Status           string `dynamodbav:"Status"`
+	Attempts         int    `dynamodbav:"Attempts"`
+	NextAttempt      int64  `dynamodbav:"NextAttempt"`
+	LastError        string `dynamodbav:"LastError"`
+	ReplayOf         string `dynamodbav:"ReplayOf,omitempty"`
+	Timestamp        int64  `dynamodbav:"Timestamp"`
+	UpdatedTimestamp int64  `dynamodbav:"UpdatedTimestamp"`
+}
+
+func NewWebhookDeliveryItemFromWebhookDelivery(
+	delivery entities.WebhookDelivery,
+) WebhookDeliveryItem {
+	return WebhookDeliveryItem{
+		PK:               delivery.MerchantID,
+		SK:               "WEBHOOK_DELIVERY#" + delivery.ID,
+		DeliveryTime:     webhookDeliveryTime(delivery),
+		EndpointID:       delivery.EndpointID,
+		EventID:          delivery.EventID,
+		EventType:        delivery.EventType,
+		Payload:          delivery.Payload,
+		Status:           delivery.Status,
+		Attempts:         delivery.Attempts,
+		NextAttempt:      delivery.NextAttempt,
+		LastError:        delivery.LastError,
+		ReplayOf:         delivery.ReplayOf,
+		Timestamp:        delivery.Timestamp,
+		UpdatedTimestamp: delivery.UpdatedTimestamp,
+	}
+}
+
+func (i WebhookDeliveryItem) WebhookDelivery() entities.WebhookDelivery {
+	return entities.WebhookDelivery{
+		ID:               strings.TrimPrefix(i.SK, "WEBHOOK_DELIVERY#"),
+		MerchantID:       i.PK,
+		EndpointID:       i.EndpointID,
+		EventID:          i.EventID,
+		EventType:        i.EventType,
+		Payload:          i.Payload,
+		Status:           i.Status,
+		Attempts:         i.Attempts,
+		NextAttempt:      i.NextAttempt,
+		LastError:        i.LastError,
+		ReplayOf:         i.ReplayOf,
+		Timestamp:        i.Timestamp,
+		UpdatedTimestamp: i.UpdatedTimestamp,
+	}
+}
+
+// webhookDeliveriesIndex lists the deliveries of a merchant by DeliveryTime, only deliveries have
+// the attribute so the index holds nothing else
+const webhookDeliveriesIndex = "WebhookDeliveries"
+
+// webhookDeliveryTime NOTE: the time is zero padded so that the deliveries sort chronologically,
+// the ID orders deliveries created at the same time
+func webhookDeliveryTime(delivery entities.WebhookDelivery) string {
+	return fmt.Sprintf("%013d#%s", max(delivery.Timestamp, 0), delivery.ID)
+}
+
+type WebhookAttemptItem struct {
+	PK             string `dynamodbav:"PK"` // merchantID
+	SK             string `dynamodbav:"SK"` // WEBHOOK_ATTEMPT#deliveryID#number
+	URL            string `dynamodbav:"URL"`
+	RequestBody    []byte `dynamodbav:"RequestBody"`
+	ResponseStatus int    `dynamodbav:"ResponseStatus"`
+	Latency        int64  `dynamodbav:"Latency"`
+	Error          string `dynamodbav:"Error"`
+	Timestamp      int64  `dynamodbav:"Timestamp"`
+}
+
+func NewWebhookAttemptItemFromWebhookAttempt(attempt entities.WebhookAttempt) WebhookAttemptItem {
+	return WebhookAttemptItem{
+		PK:             attempt.MerchantID,
+		SK:             fmt.Sprintf("WEBHOOK_ATTEMPT#%s#%06d", attempt.DeliveryID, attempt.Number),
+		URL:            attempt.URL,
+		RequestBody:    attempt.RequestBody,
+		ResponseStatus: attempt.ResponseStatus,
+		Latency:        attempt.Latency,
+		Error:          attempt.Error,
+		Timestamp:      attempt.Timestamp,
+	}
+}
+
+func (i WebhookAttemptItem) WebhookAttempt() entities.WebhookAttempt {
+	// NOTE: delivery IDs are UUIDs so the number follows the last separator
+	key := strings.TrimPrefix(i.SK, "WEBHOOK_ATTEMPT#")
+	separator := strings.LastIndex(key, "#")
+	number, _ := strconv.Atoi(key[separator+1:])
+
+	return entities.WebhookAttempt{
+		DeliveryID:     key[:max(separator, 0)],
+		MerchantID:     i.PK,
+		Number:         number,
+		URL:            i.URL,
+		RequestBody:    i.RequestBody,
+		ResponseStatus: i.ResponseStatus,
+		Latency:        i.Latency,
+		Error:          i.Error,
+		Timestamp:      i.Timestamp,
+	}
+}
+
+const webhookQueuePartitionKey = "WEBHOOK_QUEUE"
+
+// WebhookQueueItem points from the next attempt of a pending delivery to the merchant partition
+// holding the delivery
+type WebhookQueueItem struct {
+	PK         string `dynamodbav:"PK"` // WEBHOOK_QUEUE
+	SK         string `dynamodbav:"SK"` // DELIVERY#nextAttempt#deliveryID
+	MerchantID string `dynamodbav:"MerchantID"`
+	DeliveryID string `dynamodbav:"DeliveryID"`
+}
+
+func NewWebhookQueueItemFromWebhookDelivery(delivery entities.WebhookDelivery) WebhookQueueItem {
+	return WebhookQueueItem{
+		PK:         webhookQueuePartitionKey,
+		SK:         webhookQueueSortKey(delivery),
+		MerchantID: delivery.MerchantID,
+		DeliveryID: delivery.ID,
+	}
+}
+
+// webhookQueueSortKey NOTE: the time is zero padded so that the keys sort chronologically
+func webhookQueueSortKey(delivery entities.WebhookDelivery) string {
+	return fmt.Sprintf("DELIVERY#%013d#%s", max(delivery.NextAttempt, 0), delivery.ID)
+}
+
+type PlanItem struct {
+	PK        string `dynamodbav:"PK"` // merchantID
+	SK        string `dynamodbav:"SK"` // PLAN#planID
+	Name      string `dynamodbav:"Name"`
+	Amount    int64  `dynamodbav:"Amount"`
+	Currency  string `dynamodbav:"Currency"`
+	Interval  string `dynamodbav:"Interval"`
+	TrialDays int    `dynamodbav:"TrialDays"`
+	Timestamp int64  `dynamodbav:"Timestamp"`
+}
+
+func NewPlanItemFromPlan(plan entities.Plan) PlanItem {
+	return PlanItem{
+		PK:        plan.MerchantID,
+		SK:        "PLAN#" + plan.ID,
+		Name:      plan.Name,
+		Amount:    plan.Price.Amount,
+		Currency:  plan.Price.Currency,
+		Interval:  plan.Interval,
+		TrialDays: plan.TrialDays,
+		Timestamp: plan.Timestamp,
+	}
+}
+
+func (i PlanItem) Plan() entities.Plan {
+	return entities.Plan{
+		ID:         strings.TrimPrefix(i.SK, "PLAN#"),
+		MerchantID: i.PK,
+		Name:       i.Name,
+		Price:      entities.Money{Amount: i.Amount, Currency: i.Currency},
+		Interval:   i.Interval,
+		TrialDays:  i.TrialDays,
+		Timestamp:  i.Timestamp,
+	}
+}
+
+type SubscriptionItem struct {
+	PK                 string `dynamodbav:"PK"` // merchantID
+	SK                 string `dynamodbav:"SK"` // SUBSCRIPTION#subscriptionID
+	PlanID             string `dynamodbav:"PlanID"`
+	CustomerID         string `dynamodbav:"CustomerID"`
+	PaymentMethodID    string `dynamodbav:"PaymentMethodID"`
+	Status             string `dynamodbav:"Status"`
+	TrialEnd           int64  `dynamodbav:"TrialEnd"`
+	BillingAnchor      int64  `dynamodbav:"BillingAnchor"`
+	PeriodsBilled      int    `dynamodbav:"PeriodsBilled"`
+	CurrentPeriodStart int64  `dynamodbav:"CurrentPeriodStart"`
+	CurrentPeriodEnd   int64  `dynamodbav:"CurrentPeriodEnd"`
+	NextAttempt        int64  `dynamodbav:"NextAttempt"`
+	FailedAttempts     int    `dynamodbav:"FailedAttempts"`
+	LastPaymentID      string `dynamodbav:"LastPaymentID"`
+	LastError          string `dynamodbav:"LastError"`
+	CancelledTimestamp int64  `dynamodbav:"CancelledTimestamp"`
+	Timestamp          int64  `dynamodbav:"Timestamp"`
+	UpdatedTimestamp   int64  `dynamodbav:"UpdatedTimestamp"`
+}
+
+func NewSubscriptionItemFromSubscription(subscription entities.Subscription) SubscriptionItem {
+	return SubscriptionItem{
+		PK:                 subscription.MerchantID,
+		SK:                 "SUBSCRIPTION#" + subscription.ID,
+		PlanID:             subscription.PlanID,
+		CustomerID:         subscription.CustomerID,
+		PaymentMethodID:    subscription.PaymentMethodID,
+		Status:             subscription.Status,
+		TrialEnd:           subscription.TrialEnd,
+		BillingAnchor:      subscription.BillingAnchor,
+		PeriodsBilled:      subscription.PeriodsBilled,
+		CurrentPeriodStart: subscription.CurrentPeriodStart,
+		CurrentPeriodEnd:   subscription.CurrentPeriodEnd,
+		NextAttempt:        subscription.NextAttempt,
+		FailedAttempts:     subscription.FailedAttempts,
+		LastPaymentID:      subscription.LastPaymentID,
+		LastError:          subscription.LastError,
+		CancelledTimestamp: subscription.CancelledTimestamp,
+		Timestamp:          subscription.Timestamp,
+		UpdatedTimestamp:   subscription.UpdatedTimestamp,
+	}
+}
+
+func (i SubscriptionItem) Subscription() entities.Subscription {
+	return entities.Subscription{
+		ID:                 strings.TrimPrefix(i.SK, "SUBSCRIPTION#"),
+		MerchantID:         i.PK,
+		PlanID:             i.PlanID,
+		CustomerID:         i.CustomerID,
+		PaymentMethodID:    i.PaymentMethodID,
+		Status:             i.Status,
+		TrialEnd:           i.TrialEnd,
+		BillingAnchor:      i.BillingAnchor,
+		PeriodsBilled:      i.PeriodsBilled,
+		CurrentPeriodStart: i.CurrentPeriodStart,
+		CurrentPeriodEnd:   i.CurrentPeriodEnd,
+		NextAttempt:        i.NextAttempt,
+		FailedAttempts:     i.FailedAttempts,
+		LastPaymentID:      i.LastPaymentID,
+		LastError:          i.LastError,
+		CancelledTimestamp: i.CancelledTimestamp,
+		Timestamp:          i.Timestamp,
+		UpdatedTimestamp:   i.UpdatedTimestamp,
+	}
+}
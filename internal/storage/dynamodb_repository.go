@@ -2,7 +2,11 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"math"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -14,11 +18,211 @@ import (
 	"github.com/mgajewskik/payment-platform/internal/domain/entities"
 )
 
+var (
+	ErrNotFound = errors.New("item not found")
+	ErrConflict = errors.New("item already exists")
+)
+
 type DBRepository interface {
-	GetMerchantDetails(merchantID string) (entities.Merchant, error)
-	CreateNewPayment(payment entities.Payment) error
-	UpdatePayment(payment entities.Payment) error
+	MerchantRepository
+	// CreateNewPayment writes the journal entries atomically with the payment and returns
+	// ErrConflict when one of the entries was already posted
+	CreateNewPayment(payment entities.Payment, entries ...entities.JournalEntry) error
+	// UpdatePayment replaces the previous version of the payment, it returns ErrConflict when the
+	// payment was refunded, adjusted or disputed since the previous version was read
+	UpdatePayment(previous, payment entities.Payment) error
 	GetPayment(merchantID, paymentID string) (entities.Payment, error)
+	LedgerRepository
+	PayoutRepository
+	DisputeRepository
+	WebhookRepository
+	SubscriptionRepository
+	PaymentMethodRepository
+	CounterRepository
+	APIKeyRepository
+	TokenRevocationRepository
+	NonceRepository
+	AuditRepository
+}
+
+type MerchantRepository interface {
+	// GetMerchantDetails returns ErrNotFound for unknown merchants
+	GetMerchantDetails(merchantID string) (entities.Merchant, error)
+	// CreateMerchant returns ErrConflict when a merchant with the same ID exists
+	CreateMerchant(merchant entities.Merchant) error
+	// UpdateMerchant replaces the previous version of the merchant, it returns ErrConflict when
+	// the merchant was changed or removed since the previous version was read
+	UpdateMerchant(previous, merchant entities.Merchant) error
+	ListMerchants() ([]entities.Merchant, error)
+}
+
+type LedgerRepository interface {
+	// GetAccountBalances returns the balances of the merchant accounts that have postings
+	GetAccountBalances(merchantID string) ([]entities.AccountBalance, error)
+	ListJournalEntries(merchantID string) ([]entities.JournalEntry, error)
+	// GetJournalEntry returns ErrNotFound for entries that were not posted
+	GetJournalEntry(merchantID, entryID string) (entities.JournalEntry, error)
+	// PostJournalEntries returns ErrConflict when one of the entries was already posted
+	PostJournalEntries(entries ...entities.JournalEntry) error
+}
+
+type PayoutRepository interface {
+	// CreatePayout and UpdatePayout write the journal entries atomically with the payout and
+	// return ErrConflict when one of the entries was already posted. CreatePayout also returns
+	// ErrConflict when a merchant account debited by the entries does not hold the debited
+	// amount so that concurrent runs cannot pay out the same funds twice.
+	CreatePayout(payout entities.Payout, entries ...entities.JournalEntry) error
+	UpdatePayout(payout entities.Payout, entries ...entities.JournalEntry) error
+	// GetPayout returns ErrNotFound for unknown payouts
+	GetPayout(merchantID, payoutID string) (entities.Payout, error)
+	// ListPayouts returns the payouts of the merchant, the latest first
+	ListPayouts(merchantID string) ([]entities.Payout, error)
+}
+
+type DisputeRepository interface {
+	// CreateDispute adds the disputed amount and the open dispute to the payment atomically with
+	// creating the dispute, it returns ErrConflict when the payment was refunded or the amount
+	// disputed by its disputes that were not won would exceed the price
+	CreateDispute(dispute entities.Dispute, price entities.Money) error
+	// UpdateDispute replaces the previous version of the dispute, applies the change to the
+	// disputed payment and posts the journal entries atomically. It returns ErrConflict when the
+	// dispute was changed since the previous version was read or one of the entries was already
+	// posted.
+	UpdateDispute(
+		previous, dispute entities.Dispute,
+		change PaymentChange,
+		entries ...entities.JournalEntry,
+	) error
+	// GetDispute returns ErrNotFound for unknown disputes
+	GetDispute(merchantID, disputeID string) (entities.Dispute, error)
+	// ListDisputes returns the disputes of the merchant, the latest first
+	ListDisputes(merchantID string) ([]entities.Dispute, error)
+}
+
+// PaymentChange is applied to the disputed payment together with updating the dispute
+type PaymentChange struct {
+	Adjustment *entities.Adjustment // appended to the adjustments of the payment
+	Disputed   int64                // added to the disputed amount of the payment
+	Open       int64                // added to the number of open disputes of the payment
+}
+
+type WebhookRepository interface {
+	CreateWebhookEndpoint(endpoint entities.WebhookEndpoint) error
+	// GetWebhookEndpoint returns ErrNotFound for unknown endpoints
+	GetWebhookEndpoint(merchantID, endpointID string) (entities.WebhookEndpoint, error)
+	ListWebhookEndpoints(merchantID string) ([]entities.WebhookEndpoint, error)
+	// DeleteWebhookEndpoint returns ErrNotFound when the endpoint does not exist
+	DeleteWebhookEndpoint(merchantID, endpointID string) error
+	// CreateWebhookDelivery stores the delivery and queues it for its next attempt
+	CreateWebhookDelivery(delivery entities.WebhookDelivery) error
+	// UpdateWebhookDelivery takes the previous version of the delivery off the queue and queues
+	// the delivery again while it is pending, it returns ErrConflict when the previous version
+	// is no longer queued so that a delivery is only ever claimed by one worker. The attempts
+	// are recorded atomically with the delivery.
+	UpdateWebhookDelivery(
+		previous, delivery entities.WebhookDelivery,
+		attempts ...entities.WebhookAttempt,
+	) error
+	// GetWebhookDelivery returns ErrNotFound for unknown deliveries
+	GetWebhookDelivery(merchantID, deliveryID string) (entities.WebhookDelivery, error)
+	// ListWebhookDeliveries returns the deliveries of the merchant matching the filter, the
+	// latest first. It returns ErrNotFound when the merchant has no delivery with the ID of
+	// filter.After.
+	ListWebhookDeliveries(
+		merchantID string,
+		filter WebhookDeliveryFilter,
+	) ([]entities.WebhookDelivery, error)
+	// ListWebhookAttempts returns the attempts of the delivery, the first first
+	ListWebhookAttempts(merchantID, deliveryID string) ([]entities.WebhookAttempt, error)
+	// ListDueWebhookDeliveries returns at most limit queued deliveries whose next attempt is not
+	// after the time (milliseconds), the earliest first
+	ListDueWebhookDeliveries(before int64, limit int) ([]entities.WebhookDelivery, error)
+}
+
+// WebhookDeliveryFilter narrows the listed webhook deliveries, empty fields match every
+// delivery. Deliveries are listed the latest first starting after the delivery with the ID of
+// After and at most Limit deliveries are returned when Limit is positive.
+type WebhookDeliveryFilter struct {
+	Status     string
+	EventType  string
+	EndpointID string
+	EventID    string
+	After      string
+	Limit      int
+}
+
+func (f WebhookDeliveryFilter) matches(delivery entities.WebhookDelivery) bool {
+	return (f.Status == "" || delivery.Status == f.Status) &&
+		(f.EventType == "" || delivery.EventType == f.EventType) &&
+		(f.EndpointID == "" || delivery.EndpointID == f.EndpointID) &&
+		(f.EventID == "" || delivery.EventID == f.EventID)
+}
+
+type SubscriptionRepository interface {
+	CreatePlan(plan entities.Plan) error
+	// GetPlan returns ErrNotFound for unknown plans
+	GetPlan(merchantID, planID string) (entities.Plan, error)
+	// ListPlans returns the plans of the merchant, the latest first
+	ListPlans(merchantID string) ([]entities.Plan, error)
+	CreateSubscription(subscription entities.Subscription) error
+	// UpdateSubscription replaces the previous version of the subscription, it returns
+	// ErrConflict when the subscription was changed since the previous version was read so that
+	// a billing run and a cancellation cannot overwrite each other
+	UpdateSubscription(previous, subscription entities.Subscription) error
+	// GetSubscription returns ErrNotFound for unknown subscriptions
+	GetSubscription(merchantID, subscriptionID string) (entities.Subscription, error)
+	// ListSubscriptions returns the subscriptions of the merchant, the latest first
+	ListSubscriptions(merchantID string) ([]entities.Subscription, error)
+}
+
+// AuditEventFilter narrows the listed audit events, events are listed by ascending sequence
+// starting after AfterSequence and at most Limit events are returned when Limit is positive
+type AuditEventFilter struct {
+	Action        string
+	ResourceID    string
+	AfterSequence int64
+	Limit         int
+}
+
+type AuditRepository interface {
+	// CreateAuditEvent returns ErrConflict when the merchant already has an event with the
+	// same sequence number
+	CreateAuditEvent(event entities.AuditEvent) error
+	GetLatestAuditEvent(merchantID string) (entities.AuditEvent, error)
+	ListAuditEvents(merchantID string, filter AuditEventFilter) ([]entities.AuditEvent, error)
+}
+
+type NonceRepository interface {
+	// UseNonce records the nonce until expiresAt (unix seconds) and returns false when it
+	// was already recorded
+	UseNonce(keyID, nonce string, expiresAt int64) (bool, error)
+}
+
+type TokenRevocationRepository interface {
+	// RevokeToken records the token as revoked until expiresAt (unix seconds), after which
+	// the token is rejected for being expired anyway
+	RevokeToken(tokenID, merchantID string, expiresAt int64) error
+	IsTokenRevoked(tokenID string) (bool, error)
+}
+
+type APIKeyRepository interface {
+	CreateAPIKey(key entities.APIKey) error
+	UpdateAPIKey(key entities.APIKey) error
+	GetAPIKey(keyID string) (entities.APIKey, error)
+	ListAPIKeys(merchantID string) ([]entities.APIKey, error)
+}
+
+type CounterRepository interface {
+	// IncrementCounter atomically adds delta to the counter and returns its new value,
+	// the counter is removed after expiresAt (unix seconds)
+	IncrementCounter(merchantID, counter string, delta, expiresAt int64) (int64, error)
+}
+
+type PaymentMethodRepository interface {
+	CreatePaymentMethod(method entities.PaymentMethod) error
+	GetPaymentMethod(merchantID, customerID, paymentMethodID string) (entities.PaymentMethod, error)
+	ListPaymentMethods(merchantID, customerID string) ([]entities.PaymentMethod, error)
+	DeletePaymentMethod(merchantID, customerID, paymentMethodID string) error
 }
 
 type DynamoDBClient interface {
@@ -37,6 +241,26 @@ type DynamoDBClient interface {
 		params *dynamodb.GetItemInput,
 		optFns ...func(*dynamodb.Options),
 	) (*dynamodb.GetItemOutput, error)
+	DeleteItem(
+		ctx context.Context,
+		params *dynamodb.DeleteItemInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.DeleteItemOutput, error)
+	Query(
+		ctx context.Context,
+		params *dynamodb.QueryInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.QueryOutput, error)
+	TransactWriteItems(
+		ctx context.Context,
+		params *dynamodb.TransactWriteItemsInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.TransactWriteItemsOutput, error)
+	Scan(
+		ctx context.Context,
+		params *dynamodb.ScanInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.ScanOutput, error)
 }
 
 type DynamoDBRepository struct {
@@ -58,38 +282,128 @@ func NewDynamoDBRepository(
 }
 
 func (r *DynamoDBRepository) GetMerchantDetails(merchantID string) (entities.Merchant, error) {
-	input := &dynamodb.GetItemInput{
-		TableName: aws.String(r.tableName),
-		Key: map[string]types.AttributeValue{
-			"PK": &types.AttributeValueMemberS{Value: merchantID},
-			"SK": &types.AttributeValueMemberS{Value: "MERCHANT"},
+	var item MerchantItem
+
+	err := r.getItem(merchantID, "MERCHANT", &item)
+	if err != nil {
+		return entities.Merchant{}, err
+	}
+
+	return item.Merchant(), nil
+}
+
+// ListMerchants NOTE: merchants are the only items without a partition of their own so the whole
+// table is scanned, this is only done by the payout scheduler
+func (r *DynamoDBRepository) ListMerchants() ([]entities.Merchant, error) {
+	input := &dynamodb.ScanInput{
+		TableName:        aws.String(r.tableName),
+		FilterExpression: aws.String("SK = :sk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":sk": &types.AttributeValueMemberS{Value: "MERCHANT"},
 		},
 	}
 
-	result, err := r.db.GetItem(context.TODO(), input)
+	var items []MerchantItem
+
+	for {
+		result, err := r.db.Scan(context.TODO(), input)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []MerchantItem
+
+		err = attributevalue.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, page...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	merchants := make([]entities.Merchant, 0, len(items))
+	for _, item := range items {
+		merchants = append(merchants, item.Merchant())
+	}
+
+	return merchants, nil
+}
+
+func (r *DynamoDBRepository) CreateMerchant(merchant entities.Merchant) error {
+	return r.putMerchant(merchant, "attribute_not_exists(PK)", nil)
+}
+
+func (r *DynamoDBRepository) UpdateMerchant(previous, merchant entities.Merchant) error {
+	condition := "Timestamp = :timestamp"
+	values := map[string]types.AttributeValue{
+		":timestamp": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(previous.Timestamp, 10),
+		},
+	}
+
+	// NOTE: both attributes are omitted while they are zero
+	for _, attribute := range []struct {
+		name  string
+		value int64
+	}{
+		{"DeactivatedTimestamp", previous.DeactivatedTimestamp},
+		{"UpdatedTimestamp", previous.UpdatedTimestamp},
+	} {
+		if attribute.value == 0 {
+			condition += " AND attribute_not_exists(" + attribute.name + ")"
+			continue
+		}
+
+		condition += " AND " + attribute.name + " = :" + attribute.name
+		values[":"+attribute.name] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(attribute.value, 10),
+		}
+	}
+
+	return r.putMerchant(merchant, condition, values)
+}
+
+// putMerchant writes the merchant when the condition holds, ErrConflict is returned otherwise
+func (r *DynamoDBRepository) putMerchant(
+	merchant entities.Merchant,
+	condition string,
+	values map[string]types.AttributeValue,
+) error {
+	item, err := attributevalue.MarshalMap(NewMerchantItemFromMerchant(merchant))
 	if err != nil {
-		return entities.Merchant{}, err
+		return err
 	}
 
-	var item MerchantItem
+	input := &dynamodb.PutItemInput{
+		Item:                      item,
+		TableName:                 aws.String(r.tableName),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	}
 
-	err = attributevalue.UnmarshalMap(result.Item, &item)
+	_, err = r.db.PutItem(context.TODO(), input)
 	if err != nil {
-		return entities.Merchant{}, err
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrConflict
+		}
+
+		return err
 	}
 
-	return entities.Merchant{
-		ID: item.PK,
-		AccountDetails: entities.AccountDetails{
-			Name:     item.AccountDetails.Name,
-			IBAN:     item.AccountDetails.IBAN,
-			BIC:      item.AccountDetails.BIC,
-			Currency: item.AccountDetails.Currency,
-		},
-	}, nil
+	return nil
 }
 
-func (r *DynamoDBRepository) CreateNewPayment(payment entities.Payment) error {
+func (r *DynamoDBRepository) CreateNewPayment(
+	payment entities.Payment,
+	entries ...entities.JournalEntry,
+) error {
 	item := NewPaymentsItemFromPayment(payment)
 
 	av, err := attributevalue.MarshalMap(item)
@@ -97,6 +411,11 @@ func (r *DynamoDBRepository) CreateNewPayment(payment entities.Payment) error {
 		return err
 	}
 
+	if len(entries) > 0 {
+		put := &types.Put{TableName: aws.String(r.tableName), Item: av}
+		return r.postJournalEntries([]types.TransactWriteItem{{Put: put}}, entries, false)
+	}
+
 	input := &dynamodb.PutItemInput{
 		Item:      av,
 		TableName: aws.String(r.tableName),
@@ -110,33 +429,65 @@ func (r *DynamoDBRepository) CreateNewPayment(payment entities.Payment) error {
 	return nil
 }
 
-func (r *DynamoDBRepository) UpdatePayment(payment entities.Payment) error {
-	// NOTE: DynamoDB PutItem operation also updates the item if it exists
-	err := r.CreateNewPayment(payment)
-	if err != nil {
-		return err
-	}
-
-	// NOTE: this UpdateItem operation could be used to update specific fields only
-	// input := &dynamodb.UpdateItemInput{
-	// 	TableName: aws.String(r.tableName),
-	// 	Key: map[string]types.AttributeValue{
-	// 		"PK": &types.AttributeValueMemberS{Value: payment.Merchant.ID},
-	// 		"SK": &types.AttributeValueMemberS{Value: "PAYMENT#" + payment.ID},
-	// 	},
-	// 	UpdateExpression: aws.String("SET Refunded = :r, RefundTimestamp = :rt"),
-	// 	ExpressionAttributeValues: map[string]types.AttributeValue{
-	// 		":r": &types.AttributeValueMemberBOOL{Value: true},
-	// 		":rt": &types.AttributeValueMemberN{
-	// 			Value: strconv.Itoa(int(now().UnixNano() / int64(time.Millisecond))),
-	// 		},
-	// 	},
-	// }
-	//
-	// _, err := r.db.UpdateItem(context.TODO(), input)
-	// if err != nil {
-	// 	return err
-	// }
+func (r *DynamoDBRepository) UpdatePayment(previous, payment entities.Payment) error {
+	item, err := attributevalue.MarshalMap(NewPaymentsItemFromPayment(payment))
+	if err != nil {
+		return err
+	}
+
+	condition := "Refunded = :refunded AND RefundTimestamp = :refundTimestamp"
+	values := map[string]types.AttributeValue{
+		":refunded": &types.AttributeValueMemberBOOL{Value: previous.Refunded},
+		":refundTimestamp": &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(previous.RefundTimestamp, 10),
+		},
+	}
+
+	// NOTE: adjustments are only ever appended so their number identifies the version
+	if len(previous.Adjustments) == 0 {
+		condition += " AND attribute_not_exists(Adjustments)"
+	} else {
+		condition += " AND size(Adjustments) = :adjustments"
+		values[":adjustments"] = &types.AttributeValueMemberN{
+			Value: strconv.Itoa(len(previous.Adjustments)),
+		}
+	}
+
+	// NOTE: the dispute counters are only stored once the payment was disputed
+	values[":zero"] = &types.AttributeValueMemberN{Value: "0"}
+
+	if previous.DisputedAmount == 0 {
+		condition += " AND (attribute_not_exists(DisputedAmount) OR DisputedAmount = :zero)"
+	} else {
+		condition += " AND DisputedAmount = :disputed"
+		values[":disputed"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(previous.DisputedAmount, 10),
+		}
+	}
+
+	if previous.OpenDisputes == 0 {
+		condition += " AND (attribute_not_exists(OpenDisputes) OR OpenDisputes = :zero)"
+	} else {
+		condition += " AND OpenDisputes = :open"
+		values[":open"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(previous.OpenDisputes, 10),
+		}
+	}
+
+	_, err = r.db.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:                 aws.String(r.tableName),
+		Item:                      item,
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrConflict
+		}
+
+		return err
+	}
 
 	return nil
 }
@@ -155,6 +506,10 @@ func (r *DynamoDBRepository) GetPayment(merchantID, paymentID string) (entities.
 		return entities.Payment{}, err
 	}
 
+	if result.Item == nil {
+		return entities.Payment{}, ErrNotFound
+	}
+
 	var item PaymentsItem
 
 	err = attributevalue.UnmarshalMap(result.Item, &item)
@@ -167,6 +522,31 @@ func (r *DynamoDBRepository) GetPayment(merchantID, paymentID string) (entities.
 		return entities.Payment{}, err
 	}
 
+	price := entities.Money{
+		Amount:   int64(amount),
+		Currency: strings.Split(item.DATA, "#")[0],
+	}
+
+	settlement := price
+	var fxRate *entities.FXRate
+
+	if item.Settlement != nil {
+		settlement = entities.Money{
+			Amount:   item.Settlement.Amount,
+			Currency: item.Settlement.Currency,
+		}
+
+		if item.Settlement.FX != nil {
+			fxRate = &entities.FXRate{
+				Provider:    item.Settlement.FX.Provider,
+				MidRate:     item.Settlement.FX.MidRate,
+				Markup:      item.Settlement.FX.Markup,
+				AppliedRate: item.Settlement.FX.AppliedRate,
+				Timestamp:   item.Settlement.FX.Timestamp,
+			}
+		}
+	}
+
 	return entities.Payment{
 		ID:       strings.Split(item.SK, "#")[1],
 		Merchant: entities.Merchant{ID: item.PK},
@@ -179,12 +559,1467 @@ func (r *DynamoDBRepository) GetPayment(merchantID, paymentID string) (entities.
 				ExpirationDate: item.CardDetails.ExpirationDate,
 			},
 		},
-		Price: entities.Money{
-			Amount:   int64(amount),
-			Currency: strings.Split(item.DATA, "#")[0],
+		PaymentMethodID: item.PaymentMethodID,
+		CardLast4:       item.CardLast4,
+		CardBrand:       item.CardBrand,
+		IPAddress:       item.IPAddress,
+		Price:           price,
+		Settlement:      settlement,
+		FX:              fxRate,
+		Fees:            item.Fees.fees(),
+		Risk: entities.RiskAssessment{
+			Score:    item.Risk.Score,
+			Decision: item.Risk.Decision,
+			Rules:    item.Risk.Rules,
 		},
 		Timestamp:       item.Timestamp,
 		Refunded:        item.Refunded,
 		RefundTimestamp: item.RefundTimestamp,
+		Adjustments:     adjustments(item.Adjustments),
+		DisputedAmount:  item.DisputedAmount,
+		OpenDisputes:    item.OpenDisputes,
 	}, nil
 }
+
+func (r *DynamoDBRepository) IncrementCounter(
+	merchantID, counter string,
+	delta, expiresAt int64,
+) (int64, error) {
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: merchantID},
+			"SK": &types.AttributeValueMemberS{Value: "COUNTER#" + counter},
+		},
+		UpdateExpression: aws.String("ADD #value :delta SET #ttl = if_not_exists(#ttl, :ttl)"),
+		ExpressionAttributeNames: map[string]string{
+			"#value": "Value",
+			"#ttl":   "TTL",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":delta": &types.AttributeValueMemberN{Value: strconv.FormatInt(delta, 10)},
+			":ttl":   &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt, 10)},
+		},
+		ReturnValues: types.ReturnValueUpdatedNew,
+	}
+
+	result, err := r.db.UpdateItem(context.TODO(), input)
+	if err != nil {
+		return 0, err
+	}
+
+	var item CounterItem
+
+	err = attributevalue.UnmarshalMap(result.Attributes, &item)
+	if err != nil {
+		return 0, err
+	}
+
+	return item.Value, nil
+}
+
+func (r *DynamoDBRepository) CreatePaymentMethod(method entities.PaymentMethod) error {
+	item := NewPaymentMethodItemFromPaymentMethod(method)
+
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(r.tableName),
+	}
+
+	_, err = r.db.PutItem(context.TODO(), input)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) GetPaymentMethod(
+	merchantID, customerID, paymentMethodID string,
+) (entities.PaymentMethod, error) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: merchantID},
+			"SK": &types.AttributeValueMemberS{
+				Value: paymentMethodSortKey(customerID, paymentMethodID),
+			},
+		},
+	}
+
+	result, err := r.db.GetItem(context.TODO(), input)
+	if err != nil {
+		return entities.PaymentMethod{}, err
+	}
+
+	if result.Item == nil {
+		return entities.PaymentMethod{}, ErrNotFound
+	}
+
+	var item PaymentMethodItem
+
+	err = attributevalue.UnmarshalMap(result.Item, &item)
+	if err != nil {
+		return entities.PaymentMethod{}, err
+	}
+
+	return item.PaymentMethod(), nil
+}
+
+func (r *DynamoDBRepository) ListPaymentMethods(
+	merchantID, customerID string,
+) ([]entities.PaymentMethod, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: paymentMethodSortKey(customerID, "")},
+		},
+	}
+
+	var items []PaymentMethodItem
+
+	err := r.query(input, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	methods := make([]entities.PaymentMethod, 0, len(items))
+	for _, item := range items {
+		methods = append(methods, item.PaymentMethod())
+	}
+
+	return methods, nil
+}
+
+func (r *DynamoDBRepository) DeletePaymentMethod(
+	merchantID, customerID, paymentMethodID string,
+) error {
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: merchantID},
+			"SK": &types.AttributeValueMemberS{
+				Value: paymentMethodSortKey(customerID, paymentMethodID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+	}
+
+	_, err := r.db.DeleteItem(context.TODO(), input)
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) CreateAPIKey(key entities.APIKey) error {
+	item, err := attributevalue.MarshalMap(NewAPIKeyItemFromAPIKey(key))
+	if err != nil {
+		return err
+	}
+
+	lookup, err := attributevalue.MarshalMap(APIKeyLookupItem{
+		PK:         "APIKEY#" + key.ID,
+		SK:         "APIKEY",
+		MerchantID: key.MerchantID,
+	})
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{Put: &types.Put{TableName: aws.String(r.tableName), Item: item}},
+			{Put: &types.Put{
+				TableName:           aws.String(r.tableName),
+				Item:                lookup,
+				ConditionExpression: aws.String("attribute_not_exists(PK)"),
+			}},
+		},
+	}
+
+	_, err = r.db.TransactWriteItems(context.TODO(), input)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) UpdateAPIKey(key entities.APIKey) error {
+	item, err := attributevalue.MarshalMap(NewAPIKeyItemFromAPIKey(key))
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:                item,
+		TableName:           aws.String(r.tableName),
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+	}
+
+	_, err = r.db.PutItem(context.TODO(), input)
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) GetAPIKey(keyID string) (entities.APIKey, error) {
+	var lookup APIKeyLookupItem
+
+	err := r.getItem("APIKEY#"+keyID, "APIKEY", &lookup)
+	if err != nil {
+		return entities.APIKey{}, err
+	}
+
+	var item APIKeyItem
+
+	err = r.getItem(lookup.MerchantID, "APIKEY#"+keyID, &item)
+	if err != nil {
+		return entities.APIKey{}, err
+	}
+
+	return item.APIKey(), nil
+}
+
+func (r *DynamoDBRepository) ListAPIKeys(merchantID string) ([]entities.APIKey, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: "APIKEY#"},
+		},
+	}
+
+	var items []APIKeyItem
+
+	err := r.query(input, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]entities.APIKey, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.APIKey())
+	}
+
+	return keys, nil
+}
+
+func (r *DynamoDBRepository) RevokeToken(tokenID, merchantID string, expiresAt int64) error {
+	item, err := attributevalue.MarshalMap(RevokedTokenItem{
+		PK:         "TOKEN#" + tokenID,
+		SK:         "REVOKED",
+		MerchantID: merchantID,
+		TTL:        expiresAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(r.tableName),
+	}
+
+	_, err = r.db.PutItem(context.TODO(), input)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) IsTokenRevoked(tokenID string) (bool, error) {
+	var item RevokedTokenItem
+
+	err := r.getItem("TOKEN#"+tokenID, "REVOKED", &item)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *DynamoDBRepository) UseNonce(keyID, nonce string, expiresAt int64) (bool, error) {
+	item, err := attributevalue.MarshalMap(NonceItem{
+		PK:  "NONCE#" + keyID + "#" + nonce,
+		SK:  "NONCE",
+		TTL: expiresAt,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:                item,
+		TableName:           aws.String(r.tableName),
+		ConditionExpression: aws.String("attribute_not_exists(PK)"),
+	}
+
+	_, err = r.db.PutItem(context.TODO(), input)
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (r *DynamoDBRepository) CreateAuditEvent(event entities.AuditEvent) error {
+	item, err := attributevalue.MarshalMap(NewAuditEventItemFromAuditEvent(event))
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		Item:                item,
+		TableName:           aws.String(r.tableName),
+		ConditionExpression: aws.String("attribute_not_exists(SK)"),
+	}
+
+	_, err = r.db.PutItem(context.TODO(), input)
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) GetLatestAuditEvent(merchantID string) (entities.AuditEvent, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: "AUDIT#"},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int32(1),
+	}
+
+	result, err := r.db.Query(context.TODO(), input)
+	if err != nil {
+		return entities.AuditEvent{}, err
+	}
+
+	if len(result.Items) == 0 {
+		return entities.AuditEvent{}, ErrNotFound
+	}
+
+	var item AuditEventItem
+
+	err = attributevalue.UnmarshalMap(result.Items[0], &item)
+	if err != nil {
+		return entities.AuditEvent{}, err
+	}
+
+	return item.AuditEvent(), nil
+}
+
+func (r *DynamoDBRepository) ListAuditEvents(
+	merchantID string,
+	filter AuditEventFilter,
+) ([]entities.AuditEvent, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND SK BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":   &types.AttributeValueMemberS{Value: merchantID},
+			":from": &types.AttributeValueMemberS{Value: auditSortKey(filter.AfterSequence + 1)},
+			":to":   &types.AttributeValueMemberS{Value: auditSortKey(math.MaxInt64)},
+		},
+	}
+
+	var conditions []string
+
+	// NOTE: Action is a reserved word and has to be referenced through a name placeholder
+	if filter.Action != "" {
+		conditions = append(conditions, "#action = :action")
+		input.ExpressionAttributeNames = map[string]string{"#action": "Action"}
+		input.ExpressionAttributeValues[":action"] = &types.AttributeValueMemberS{
+			Value: filter.Action,
+		}
+	}
+
+	if filter.ResourceID != "" {
+		conditions = append(conditions, "ResourceID = :resourceID")
+		input.ExpressionAttributeValues[":resourceID"] = &types.AttributeValueMemberS{
+			Value: filter.ResourceID,
+		}
+	}
+
+	if len(conditions) > 0 {
+		input.FilterExpression = aws.String(strings.Join(conditions, " AND "))
+	}
+
+	// NOTE: the query limit applies before filtering, so pages are read until enough events match
+	var items []AuditEventItem
+
+	for {
+		result, err := r.db.Query(context.TODO(), input)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []AuditEventItem
+
+		err = attributevalue.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, page...)
+
+		if filter.Limit > 0 && len(items) >= filter.Limit {
+			items = items[:filter.Limit]
+			break
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	events := make([]entities.AuditEvent, 0, len(items))
+	for _, item := range items {
+		events = append(events, item.AuditEvent())
+	}
+
+	return events, nil
+}
+
+func (r *DynamoDBRepository) PostJournalEntries(entries ...entities.JournalEntry) error {
+	return r.postJournalEntries(nil, entries, false)
+}
+
+// postJournalEntries writes the items together with the entries and adds their postings to the
+// account balances in a single transaction. When covered is set the merchant accounts debited by
+// the entries must owe the merchant at least the debited amount.
+func (r *DynamoDBRepository) postJournalEntries(
+	items []types.TransactWriteItem,
+	entries []entities.JournalEntry,
+	covered bool,
+) error {
+
+	// NOTE: a transaction cannot touch the same item twice so postings to the same account are
+	// added up first
+	var keys []balanceKey
+	balances := make(map[balanceKey]int64)
+
+	for _, entry := range entries {
+		av, err := attributevalue.MarshalMap(NewJournalEntryItemFromJournalEntry(entry))
+		if err != nil {
+			return err
+		}
+
+		items = append(items, types.TransactWriteItem{Put: &types.Put{
+			TableName:           aws.String(r.tableName),
+			Item:                av,
+			ConditionExpression: aws.String("attribute_not_exists(PK)"),
+		}})
+
+		for _, posting := range entry.Postings {
+			key := balanceKey{
+				merchantID: entry.MerchantID,
+				account:    posting.Account,
+				currency:   posting.Amount.Currency,
+			}
+
+			if _, ok := balances[key]; !ok {
+				keys = append(keys, key)
+			}
+
+			balances[key] += posting.Amount.Amount
+		}
+	}
+
+	for _, key := range keys {
+		update := &types.Update{
+			TableName: aws.String(r.tableName),
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: key.merchantID},
+				"SK": &types.AttributeValueMemberS{Value: key.sortKey()},
+			},
+			UpdateExpression: aws.String(
+				"ADD Balance :amount SET Account = :account, Currency = :currency",
+			),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":amount": &types.AttributeValueMemberN{
+					Value: strconv.FormatInt(balances[key], 10),
+				},
+				":account":  &types.AttributeValueMemberS{Value: key.account},
+				":currency": &types.AttributeValueMemberS{Value: key.currency},
+			},
+		}
+
+		// NOTE: the merchant accounts have credit balances, the debit is covered while the
+		// balance stays at or below zero
+		if covered && isMerchantAccount(key.account) && balances[key] > 0 {
+			update.ConditionExpression = aws.String("Balance <= :limit")
+			update.ExpressionAttributeValues[":limit"] = &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(-balances[key], 10),
+			}
+		}
+
+		items = append(items, types.TransactWriteItem{Update: update})
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{TransactItems: items}
+
+	_, err := r.db.TransactWriteItems(context.TODO(), input)
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			for _, reason := range canceled.CancellationReasons {
+				if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+					return ErrConflict
+				}
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) GetAccountBalances(
+	merchantID string,
+) ([]entities.AccountBalance, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: "BALANCE#"},
+		},
+	}
+
+	var items []AccountBalanceItem
+
+	err := r.query(input, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make([]entities.AccountBalance, 0, len(items))
+	for _, item := range items {
+		balances = append(balances, item.AccountBalance())
+	}
+
+	return balances, nil
+}
+
+func (r *DynamoDBRepository) ListJournalEntries(
+	merchantID string,
+) ([]entities.JournalEntry, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: "JOURNAL#"},
+		},
+	}
+
+	var items []JournalEntryItem
+
+	err := r.query(input, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]entities.JournalEntry, 0, len(items))
+	for _, item := range items {
+		entries = append(entries, item.JournalEntry())
+	}
+
+	return entries, nil
+}
+
+func (r *DynamoDBRepository) GetJournalEntry(
+	merchantID, entryID string,
+) (entities.JournalEntry, error) {
+	var item JournalEntryItem
+
+	err := r.getItem(merchantID, "JOURNAL#"+entryID, &item)
+	if err != nil {
+		return entities.JournalEntry{}, err
+	}
+
+	return item.JournalEntry(), nil
+}
+
+func (r *DynamoDBRepository) CreatePayout(
+	payout entities.Payout,
+	entries ...entities.JournalEntry,
+) error {
+	return r.putPayout(payout, entries, true)
+}
+
+func (r *DynamoDBRepository) UpdatePayout(
+	payout entities.Payout,
+	entries ...entities.JournalEntry,
+) error {
+	// NOTE: DynamoDB PutItem operation also updates the item if it exists
+	return r.putPayout(payout, entries, false)
+}
+
+func (r *DynamoDBRepository) putPayout(
+	payout entities.Payout,
+	entries []entities.JournalEntry,
+	covered bool,
+) error {
+	av, err := attributevalue.MarshalMap(NewPayoutItemFromPayout(payout))
+	if err != nil {
+		return err
+	}
+
+	put := &types.Put{TableName: aws.String(r.tableName), Item: av}
+
+	if len(entries) > 0 {
+		return r.postJournalEntries([]types.TransactWriteItem{{Put: put}}, entries, covered)
+	}
+
+	_, err = r.db.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: put.TableName,
+		Item:      put.Item,
+	})
+
+	return err
+}
+
+func (r *DynamoDBRepository) GetPayout(merchantID, payoutID string) (entities.Payout, error) {
+	var item PayoutItem
+
+	err := r.getItem(merchantID, "PAYOUT#"+payoutID, &item)
+	if err != nil {
+		return entities.Payout{}, err
+	}
+
+	return item.Payout(), nil
+}
+
+func (r *DynamoDBRepository) ListPayouts(merchantID string) ([]entities.Payout, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: "PAYOUT#"},
+		},
+	}
+
+	var items []PayoutItem
+
+	err := r.query(input, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	payouts := make([]entities.Payout, 0, len(items))
+	for _, item := range items {
+		payouts = append(payouts, item.Payout())
+	}
+
+	sort.SliceStable(payouts, func(i, j int) bool {
+		return payouts[i].Timestamp > payouts[j].Timestamp
+	})
+
+	return payouts, nil
+}
+
+func (r *DynamoDBRepository) CreateDispute(dispute entities.Dispute, price entities.Money) error {
+	av, err := attributevalue.MarshalMap(NewDisputeItemFromDispute(dispute))
+	if err != nil {
+		return err
+	}
+
+	// NOTE: the disputed amount is reserved on the payment so that disputes opened concurrently
+	// cannot exceed the price together
+	reserve := &types.Update{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: dispute.MerchantID},
+			"SK": &types.AttributeValueMemberS{Value: "PAYMENT#" + dispute.PaymentID},
+		},
+		UpdateExpression: aws.String("ADD DisputedAmount :amount, OpenDisputes :one"),
+		ConditionExpression: aws.String(
+			"attribute_exists(SK) AND Refunded = :false AND " +
+				"(attribute_not_exists(DisputedAmount) OR DisputedAmount <= :limit)",
+		),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":amount": &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(dispute.Amount.Amount, 10),
+			},
+			":one":   &types.AttributeValueMemberN{Value: "1"},
+			":false": &types.AttributeValueMemberBOOL{Value: false},
+			":limit": &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(price.Amount-dispute.Amount.Amount, 10),
+			},
+		},
+	}
+
+	return r.postJournalEntries([]types.TransactWriteItem{
+		{Put: &types.Put{
+			TableName:           aws.String(r.tableName),
+			Item:                av,
+			ConditionExpression: aws.String("attribute_not_exists(SK)"),
+		}},
+		{Update: reserve},
+	}, nil, false)
+}
+
+func (r *DynamoDBRepository) UpdateDispute(
+	previous, dispute entities.Dispute,
+	change PaymentChange,
+	entries ...entities.JournalEntry,
+) error {
+	av, err := attributevalue.MarshalMap(NewDisputeItemFromDispute(dispute))
+	if err != nil {
+		return err
+	}
+
+	put := &types.Put{
+		TableName:                aws.String(r.tableName),
+		Item:                     av,
+		ConditionExpression:      aws.String("#status = :status AND UpdatedTimestamp = :updated"),
+		ExpressionAttributeNames: map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: previous.Status},
+			":updated": &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(previous.UpdatedTimestamp, 10),
+			},
+		},
+	}
+
+	items := []types.TransactWriteItem{{Put: put}}
+
+	update, err := r.paymentChangeUpdate(dispute.MerchantID, dispute.PaymentID, change)
+	if err != nil {
+		return err
+	}
+
+	if update != nil {
+		items = append(items, types.TransactWriteItem{Update: update})
+	}
+
+	if len(items) > 1 || len(entries) > 0 {
+		return r.postJournalEntries(items, entries, false)
+	}
+
+	_, err = r.db.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName:                 put.TableName,
+		Item:                      put.Item,
+		ConditionExpression:       put.ConditionExpression,
+		ExpressionAttributeNames:  put.ExpressionAttributeNames,
+		ExpressionAttributeValues: put.ExpressionAttributeValues,
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// paymentChangeUpdate returns the update applying the change to the payment, nil when nothing
+// is changed. The adjustment is appended on its own so that the rest of the payment is not
+// overwritten.
+func (r *DynamoDBRepository) paymentChangeUpdate(
+	merchantID, paymentID string,
+	change PaymentChange,
+) (*types.Update, error) {
+	var expressions, additions []string
+	values := make(map[string]types.AttributeValue)
+
+	if change.Adjustment != nil {
+		av, err := attributevalue.MarshalList(
+			newAdjustments([]entities.Adjustment{*change.Adjustment}),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		expressions = append(
+			expressions,
+			"SET Adjustments = list_append(if_not_exists(Adjustments, :empty), :adjustments)",
+		)
+		values[":empty"] = &types.AttributeValueMemberL{Value: []types.AttributeValue{}}
+		values[":adjustments"] = &types.AttributeValueMemberL{Value: av}
+	}
+
+	if change.Disputed != 0 {
+		additions = append(additions, "DisputedAmount :disputed")
+		values[":disputed"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(change.Disputed, 10),
+		}
+	}
+
+	if change.Open != 0 {
+		additions = append(additions, "OpenDisputes :open")
+		values[":open"] = &types.AttributeValueMemberN{
+			Value: strconv.FormatInt(change.Open, 10),
+		}
+	}
+
+	if len(additions) > 0 {
+		expressions = append(expressions, "ADD "+strings.Join(additions, ", "))
+	}
+
+	if len(expressions) == 0 {
+		return nil, nil
+	}
+
+	return &types.Update{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: merchantID},
+			"SK": &types.AttributeValueMemberS{Value: "PAYMENT#" + paymentID},
+		},
+		UpdateExpression:          aws.String(strings.Join(expressions, " ")),
+		ConditionExpression:       aws.String("attribute_exists(SK)"),
+		ExpressionAttributeValues: values,
+	}, nil
+}
+
+func (r *DynamoDBRepository) GetDispute(merchantID, disputeID string) (entities.Dispute, error) {
+	var item DisputeItem
+
+	err := r.getItem(merchantID, "DISPUTE#"+disputeID, &item)
+	if err != nil {
+		return entities.Dispute{}, err
+	}
+
+	return item.Dispute(), nil
+}
+
+func (r *DynamoDBRepository) ListDisputes(merchantID string) ([]entities.Dispute, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: "DISPUTE#"},
+		},
+	}
+
+	var items []DisputeItem
+
+	err := r.query(input, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	disputes := make([]entities.Dispute, 0, len(items))
+	for _, item := range items {
+		disputes = append(disputes, item.Dispute())
+	}
+
+	sort.SliceStable(disputes, func(i, j int) bool {
+		return disputes[i].Timestamp > disputes[j].Timestamp
+	})
+
+	return disputes, nil
+}
+
+func (r *DynamoDBRepository) CreateWebhookEndpoint(endpoint entities.WebhookEndpoint) error {
+	item, err := attributevalue.MarshalMap(NewWebhookEndpointItemFromWebhookEndpoint(endpoint))
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+
+	return err
+}
+
+func (r *DynamoDBRepository) GetWebhookEndpoint(
+	merchantID, endpointID string,
+) (entities.WebhookEndpoint, error) {
+	var item WebhookEndpointItem
+
+	err := r.getItem(merchantID, "WEBHOOK_ENDPOINT#"+endpointID, &item)
+	if err != nil {
+		return entities.WebhookEndpoint{}, err
+	}
+
+	return item.WebhookEndpoint(), nil
+}
+
+func (r *DynamoDBRepository) ListWebhookEndpoints(
+	merchantID string,
+) ([]entities.WebhookEndpoint, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: "WEBHOOK_ENDPOINT#"},
+		},
+	}
+
+	var items []WebhookEndpointItem
+
+	err := r.query(input, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]entities.WebhookEndpoint, 0, len(items))
+	for _, item := range items {
+		endpoints = append(endpoints, item.WebhookEndpoint())
+	}
+
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return endpoints[i].Timestamp < endpoints[j].Timestamp
+	})
+
+	return endpoints, nil
+}
+
+func (r *DynamoDBRepository) DeleteWebhookEndpoint(merchantID, endpointID string) error {
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: merchantID},
+			"SK": &types.AttributeValueMemberS{Value: "WEBHOOK_ENDPOINT#" + endpointID},
+		},
+		ConditionExpression: aws.String("attribute_exists(PK)"),
+	}
+
+	_, err := r.db.DeleteItem(context.TODO(), input)
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrNotFound
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) CreateWebhookDelivery(delivery entities.WebhookDelivery) error {
+	return r.writeWebhookDelivery(nil, delivery, nil)
+}
+
+func (r *DynamoDBRepository) UpdateWebhookDelivery(
+	previous, delivery entities.WebhookDelivery,
+	attempts ...entities.WebhookAttempt,
+) error {
+	return r.writeWebhookDelivery(&previous, delivery, attempts)
+}
+
+// writeWebhookDelivery NOTE: the queue lives in a partition of its own sorted by the next
+// attempt, so that due deliveries of all merchants are found with a single query
+func (r *DynamoDBRepository) writeWebhookDelivery(
+	previous *entities.WebhookDelivery,
+	delivery entities.WebhookDelivery,
+	attempts []entities.WebhookAttempt,
+) error {
+	av, err := attributevalue.MarshalMap(NewWebhookDeliveryItemFromWebhookDelivery(delivery))
+	if err != nil {
+		return err
+	}
+
+	items := []types.TransactWriteItem{
+		{Put: &types.Put{TableName: aws.String(r.tableName), Item: av}},
+	}
+
+	for _, attempt := range attempts {
+		av, err := attributevalue.MarshalMap(NewWebhookAttemptItemFromWebhookAttempt(attempt))
+		if err != nil {
+			return err
+		}
+
+		items = append(items, types.TransactWriteItem{Put: &types.Put{
+			TableName:           aws.String(r.tableName),
+			Item:                av,
+			ConditionExpression: aws.String("attribute_not_exists(PK)"),
+		}})
+	}
+
+	var queued *types.Put
+	if delivery.Status == entities.WebhookDeliveryPending {
+		av, err := attributevalue.MarshalMap(NewWebhookQueueItemFromWebhookDelivery(delivery))
+		if err != nil {
+			return err
+		}
+
+		queued = &types.Put{TableName: aws.String(r.tableName), Item: av}
+	}
+
+	switch {
+	case previous == nil:
+		if queued != nil {
+			items = append(items, types.TransactWriteItem{Put: queued})
+		}
+	case queued != nil && webhookQueueSortKey(*previous) == webhookQueueSortKey(delivery):
+		// NOTE: a transaction cannot touch the same item twice so the queue item is overwritten
+		queued.ConditionExpression = aws.String("attribute_exists(PK)")
+		items = append(items, types.TransactWriteItem{Put: queued})
+	default:
+		items = append(items, types.TransactWriteItem{Delete: &types.Delete{
+			TableName: aws.String(r.tableName),
+			Key: map[string]types.AttributeValue{
+				"PK": &types.AttributeValueMemberS{Value: webhookQueuePartitionKey},
+				"SK": &types.AttributeValueMemberS{Value: webhookQueueSortKey(*previous)},
+			},
+			ConditionExpression: aws.String("attribute_exists(PK)"),
+		}})
+
+		if queued != nil {
+			items = append(items, types.TransactWriteItem{Put: queued})
+		}
+	}
+
+	input := &dynamodb.TransactWriteItemsInput{TransactItems: items}
+
+	_, err = r.db.TransactWriteItems(context.TODO(), input)
+	if err != nil {
+		var canceled *types.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			for _, reason := range canceled.CancellationReasons {
+				if aws.ToString(reason.Code) == "ConditionalCheckFailed" {
+					return ErrConflict
+				}
+			}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) GetWebhookDelivery(
+	merchantID, deliveryID string,
+) (entities.WebhookDelivery, error) {
+	var item WebhookDeliveryItem
+
+	err := r.getItem(merchantID, "WEBHOOK_DELIVERY#"+deliveryID, &item)
+	if err != nil {
+		return entities.WebhookDelivery{}, err
+	}
+
+	return item.WebhookDelivery(), nil
+}
+
+func (r *DynamoDBRepository) ListWebhookDeliveries(
+	merchantID string,
+	filter WebhookDeliveryFilter,
+) ([]entities.WebhookDelivery, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		IndexName:              aws.String(webhookDeliveriesIndex),
+		KeyConditionExpression: aws.String("PK = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+		},
+		ScanIndexForward: aws.Bool(false),
+	}
+
+	if filter.After != "" {
+		after, err := r.GetWebhookDelivery(merchantID, filter.After)
+		if err != nil {
+			return nil, err
+		}
+
+		input.KeyConditionExpression = aws.String("PK = :pk AND DeliveryTime < :after")
+		input.ExpressionAttributeValues[":after"] = &types.AttributeValueMemberS{
+			Value: webhookDeliveryTime(after),
+		}
+	}
+
+	var conditions []string
+
+	// NOTE: Status is a reserved word and has to be referenced through a name placeholder
+	if filter.Status != "" {
+		conditions = append(conditions, "#status = :status")
+		input.ExpressionAttributeNames = map[string]string{"#status": "Status"}
+		input.ExpressionAttributeValues[":status"] = &types.AttributeValueMemberS{
+			Value: filter.Status,
+		}
+	}
+
+	if filter.EventType != "" {
+		conditions = append(conditions, "EventType = :eventType")
+		input.ExpressionAttributeValues[":eventType"] = &types.AttributeValueMemberS{
+			Value: filter.EventType,
+		}
+	}
+
+	if filter.EndpointID != "" {
+		conditions = append(conditions, "EndpointID = :endpointID")
+		input.ExpressionAttributeValues[":endpointID"] = &types.AttributeValueMemberS{
+			Value: filter.EndpointID,
+		}
+	}
+
+	if filter.EventID != "" {
+		conditions = append(conditions, "EventID = :eventID")
+		input.ExpressionAttributeValues[":eventID"] = &types.AttributeValueMemberS{
+			Value: filter.EventID,
+		}
+	}
+
+	if len(conditions) > 0 {
+		input.FilterExpression = aws.String(strings.Join(conditions, " AND "))
+	}
+
+	if filter.Limit > 0 {
+		input.Limit = aws.Int32(int32(min(filter.Limit, math.MaxInt32)))
+	}
+
+	// NOTE: the query limit applies before filtering, so pages are read until enough
+	// deliveries match
+	var items []WebhookDeliveryItem
+
+	for {
+		result, err := r.db.Query(context.TODO(), input)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []WebhookDeliveryItem
+
+		err = attributevalue.UnmarshalListOfMaps(result.Items, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		items = append(items, page...)
+
+		if filter.Limit > 0 && len(items) >= filter.Limit {
+			items = items[:filter.Limit]
+			break
+		}
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	deliveries := make([]entities.WebhookDelivery, 0, len(items))
+	for _, item := range items {
+		deliveries = append(deliveries, item.WebhookDelivery())
+	}
+
+	return deliveries, nil
+}
+
+func (r *DynamoDBRepository) ListWebhookAttempts(
+	merchantID, deliveryID string,
+) ([]entities.WebhookAttempt, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: "WEBHOOK_ATTEMPT#" + deliveryID + "#"},
+		},
+	}
+
+	var items []WebhookAttemptItem
+
+	err := r.query(input, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: the attempt numbers are zero padded so the items are already in order
+	attempts := make([]entities.WebhookAttempt, 0, len(items))
+	for _, item := range items {
+		attempts = append(attempts, item.WebhookAttempt())
+	}
+
+	return attempts, nil
+}
+
+func (r *DynamoDBRepository) ListDueWebhookDeliveries(
+	before int64,
+	limit int,
+) ([]entities.WebhookDelivery, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND SK BETWEEN :from AND :to"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk":   &types.AttributeValueMemberS{Value: webhookQueuePartitionKey},
+			":from": &types.AttributeValueMemberS{Value: "DELIVERY#"},
+			// NOTE: ~ sorts after the # separating the time from the delivery ID
+			":to": &types.AttributeValueMemberS{
+				Value: fmt.Sprintf("DELIVERY#%013d~", max(before, 0)),
+			},
+		},
+		Limit: aws.Int32(int32(min(limit, math.MaxInt32))),
+	}
+
+	// NOTE: a single page is read as only the earliest deliveries are wanted
+	result, err := r.db.Query(context.TODO(), input)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []WebhookQueueItem
+
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]entities.WebhookDelivery, 0, len(items))
+	for _, item := range items {
+		delivery, err := r.GetWebhookDelivery(item.MerchantID, item.DeliveryID)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+func (r *DynamoDBRepository) CreatePlan(plan entities.Plan) error {
+	item, err := attributevalue.MarshalMap(NewPlanItemFromPlan(plan))
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+
+	return err
+}
+
+func (r *DynamoDBRepository) GetPlan(merchantID, planID string) (entities.Plan, error) {
+	var item PlanItem
+
+	err := r.getItem(merchantID, "PLAN#"+planID, &item)
+	if err != nil {
+		return entities.Plan{}, err
+	}
+
+	return item.Plan(), nil
+}
+
+func (r *DynamoDBRepository) ListPlans(merchantID string) ([]entities.Plan, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: "PLAN#"},
+		},
+	}
+
+	var items []PlanItem
+
+	err := r.query(input, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	plans := make([]entities.Plan, 0, len(items))
+	for _, item := range items {
+		plans = append(plans, item.Plan())
+	}
+
+	sort.SliceStable(plans, func(i, j int) bool {
+		return plans[i].Timestamp > plans[j].Timestamp
+	})
+
+	return plans, nil
+}
+
+func (r *DynamoDBRepository) CreateSubscription(subscription entities.Subscription) error {
+	item, err := attributevalue.MarshalMap(NewSubscriptionItemFromSubscription(subscription))
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+
+	return err
+}
+
+func (r *DynamoDBRepository) UpdateSubscription(
+	previous, subscription entities.Subscription,
+) error {
+	item, err := attributevalue.MarshalMap(NewSubscriptionItemFromSubscription(subscription))
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.PutItem(context.TODO(), &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+		ConditionExpression: aws.String(
+			"#status = :status AND NextAttempt = :next AND UpdatedTimestamp = :updated",
+		),
+		ExpressionAttributeNames: map[string]string{"#status": "Status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: previous.Status},
+			":next": &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(previous.NextAttempt, 10),
+			},
+			":updated": &types.AttributeValueMemberN{
+				Value: strconv.FormatInt(previous.UpdatedTimestamp, 10),
+			},
+		},
+	})
+	if err != nil {
+		var conditionFailed *types.ConditionalCheckFailedException
+		if errors.As(err, &conditionFailed) {
+			return ErrConflict
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (r *DynamoDBRepository) GetSubscription(
+	merchantID, subscriptionID string,
+) (entities.Subscription, error) {
+	var item SubscriptionItem
+
+	err := r.getItem(merchantID, "SUBSCRIPTION#"+subscriptionID, &item)
+	if err != nil {
+		return entities.Subscription{}, err
+	}
+
+	return item.Subscription(), nil
+}
+
+func (r *DynamoDBRepository) ListSubscriptions(
+	merchantID string,
+) ([]entities.Subscription, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(r.tableName),
+		KeyConditionExpression: aws.String("PK = :pk AND begins_with(SK, :sk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: merchantID},
+			":sk": &types.AttributeValueMemberS{Value: "SUBSCRIPTION#"},
+		},
+	}
+
+	var items []SubscriptionItem
+
+	err := r.query(input, &items)
+	if err != nil {
+		return nil, err
+	}
+
+	subscriptions := make([]entities.Subscription, 0, len(items))
+	for _, item := range items {
+		subscriptions = append(subscriptions, item.Subscription())
+	}
+
+	sort.SliceStable(subscriptions, func(i, j int) bool {
+		return subscriptions[i].Timestamp > subscriptions[j].Timestamp
+	})
+
+	return subscriptions, nil
+}
+
+// getItem reads a single item into out and returns ErrNotFound when it does not exist
+func (r *DynamoDBRepository) getItem(pk, sk string, out any) error {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: pk},
+			"SK": &types.AttributeValueMemberS{Value: sk},
+		},
+	}
+
+	result, err := r.db.GetItem(context.TODO(), input)
+	if err != nil {
+		return err
+	}
+
+	if result.Item == nil {
+		return ErrNotFound
+	}
+
+	return attributevalue.UnmarshalMap(result.Item, out)
+}
+
+// query reads all pages of the query result into out, which must be a pointer to a slice
+func (r *DynamoDBRepository) query(input *dynamodb.QueryInput, out any) error {
+	var items []map[string]types.AttributeValue
+
+	for {
+		result, err := r.db.Query(context.TODO(), input)
+		if err != nil {
+			return err
+		}
+
+		items = append(items, result.Items...)
+
+		if len(result.LastEvaluatedKey) == 0 {
+			break
+		}
+
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+
+	return attributevalue.UnmarshalListOfMaps(items, out)
+}
@@ -46,6 +46,44 @@ func (m *MockDynamoDBClient) GetItem(
 	return cast, args.Error(1)
 }
 
+func (m *MockDynamoDBClient) DeleteItem(
+	ctx context.Context,
+	params *dynamodb.DeleteItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.DeleteItemOutput, error) {
+	args := m.Called(ctx, params)
+	return &dynamodb.DeleteItemOutput{}, args.Error(0)
+}
+
+func (m *MockDynamoDBClient) Query(
+	ctx context.Context,
+	params *dynamodb.QueryInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.QueryOutput, error) {
+	args := m.Called(ctx, params)
+	cast, _ := args.Get(0).(*dynamodb.QueryOutput)
+	return cast, args.Error(1)
+}
+
+func (m *MockDynamoDBClient) TransactWriteItems(
+	ctx context.Context,
+	params *dynamodb.TransactWriteItemsInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.TransactWriteItemsOutput, error) {
+	args := m.Called(ctx, params)
+	return &dynamodb.TransactWriteItemsOutput{}, args.Error(0)
+}
+
+func (m *MockDynamoDBClient) Scan(
+	ctx context.Context,
+	params *dynamodb.ScanInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.ScanOutput, error) {
+	args := m.Called(ctx, params)
+	cast, _ := args.Get(0).(*dynamodb.ScanOutput)
+	return cast, args.Error(1)
+}
+
 func TestGetMerchantDetails(t *testing.T) {
 	md := MockDynamoDBClient{}
 	repo := DynamoDBRepository{
@@ -88,6 +126,17 @@ func TestGetMerchantDetails(t *testing.T) {
 
 		assert.Equal(t, got, want)
 	})
+
+	t.Run("should return not found for unknown merchants", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("GetItem", mock.Anything, mock.Anything).Return(&dynamodb.GetItemOutput{}, nil)
+
+		// tested function
+		_, err := repo.GetMerchantDetails("unknownMerchantID")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
 }
 
 func TestCreateNewPayment(t *testing.T) {
@@ -200,13 +249,38 @@ func TestUpdatePayment(t *testing.T) {
 		md.On("PutItem", context.TODO(), &dynamodb.PutItemInput{
 			TableName: aws.String("table"),
 			Item:      input,
+			ConditionExpression: aws.String(
+				"Refunded = :refunded AND RefundTimestamp = :refundTimestamp" +
+					" AND attribute_not_exists(Adjustments)" +
+					" AND (attribute_not_exists(DisputedAmount) OR DisputedAmount = :zero)" +
+					" AND (attribute_not_exists(OpenDisputes) OR OpenDisputes = :zero)",
+			),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":refunded":        &types.AttributeValueMemberBOOL{Value: false},
+				":refundTimestamp": &types.AttributeValueMemberN{Value: "0"},
+				":zero":            &types.AttributeValueMemberN{Value: "0"},
+			},
 		}).Return(nil)
 
 		// tested function
-		err := repo.UpdatePayment(payment)
+		err := repo.UpdatePayment(payment, payment)
 		assert.NoError(t, err)
 	})
 
+	t.Run("should report payments changed since they were read", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("PutItem", mock.Anything, mock.Anything).
+			Return(&types.ConditionalCheckFailedException{})
+
+		payment := entities.Payment{ID: "paymentID", Merchant: entities.Merchant{ID: "merchantID"}}
+
+		// tested function
+		err := repo.UpdatePayment(payment, payment)
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
 	// t.Run("should update payment with update action", func(t *testing.T) {
 	// 	repo := DynamoDBRepository{
 	// 		db:        &md,
@@ -286,6 +360,10 @@ func TestGetPayment(t *testing.T) {
 				Amount:   100,
 				Currency: "USD",
 			},
+			Settlement: entities.Money{
+				Amount:   100,
+				Currency: "USD",
+			},
 			Timestamp:       123,
 			Refunded:        false,
 			RefundTimestamp: 0,
@@ -293,4 +371,999 @@ func TestGetPayment(t *testing.T) {
 
 		assert.Equal(t, got, want)
 	})
+
+	t.Run("should get payment with settlement", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{
+			db:        &md,
+			tableName: "table",
+			logger:    nil,
+		}
+
+		item, _ := attributevalue.MarshalMap(PaymentsItem{
+			PK:         "merchantID",
+			SK:         "PAYMENT#paymentID",
+			DATA:       "USD#10000",
+			CustomerID: "customerID",
+			Settlement: &Settlement{
+				Amount:   9167,
+				Currency: "EUR",
+				FX: &FXRate{
+					Provider:    "static",
+					MidRate:     "0.92592593",
+					Markup:      "0.01",
+					AppliedRate: "0.91666666",
+					Timestamp:   100,
+				},
+			},
+			Fees: &Fees{
+				Currency:     "EUR",
+				Gross:        9167,
+				Fee:          296,
+				Net:          8871,
+				FixedFee:     30,
+				RefundPolicy: "retain",
+			},
+			Timestamp: 123,
+		})
+
+		md.On("GetItem", mock.Anything, mock.Anything).Return(&dynamodb.GetItemOutput{
+			Item: item,
+		}, nil)
+
+		// tested function
+		got, err := repo.GetPayment("merchantID", "paymentID")
+		assert.NoError(t, err)
+
+		assert.Equal(t, entities.Money{Amount: 10000, Currency: "USD"}, got.Price)
+		assert.Equal(t, entities.Money{Amount: 9167, Currency: "EUR"}, got.Settlement)
+		assert.Equal(t, &entities.FXRate{
+			Provider:    "static",
+			MidRate:     "0.92592593",
+			Markup:      "0.01",
+			AppliedRate: "0.91666666",
+			Timestamp:   100,
+		}, got.FX)
+		assert.Equal(t, entities.Fees{
+			Gross:        entities.Money{Amount: 9167, Currency: "EUR"},
+			Fee:          entities.Money{Amount: 296, Currency: "EUR"},
+			Net:          entities.Money{Amount: 8871, Currency: "EUR"},
+			FixedFee:     entities.Money{Amount: 30, Currency: "EUR"},
+			RefundPolicy: "retain",
+			RefundedFee:  entities.Money{Amount: 0, Currency: "EUR"},
+		}, got.Fees)
+	})
+}
+
+func TestListPaymentMethods(t *testing.T) {
+	md := MockDynamoDBClient{}
+	repo := DynamoDBRepository{
+		db:        &md,
+		tableName: "table",
+		logger:    nil,
+	}
+
+	t.Run("should list payment methods", func(t *testing.T) {
+		md.On("Query", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{
+				{
+					"PK": &types.AttributeValueMemberS{Value: "merchantID"},
+					"SK": &types.AttributeValueMemberS{
+						Value: "PAYMENT_METHOD#customerID#paymentMethodID",
+					},
+					"CardToken":      &types.AttributeValueMemberS{Value: "tok_test"},
+					"CardName":       &types.AttributeValueMemberS{Value: "Test Name"},
+					"CardLast4":      &types.AttributeValueMemberS{Value: "1234"},
+					"CardExpiryDate": &types.AttributeValueMemberS{Value: "12/23"},
+					"Timestamp":      &types.AttributeValueMemberN{Value: "123"},
+				},
+			},
+		}, nil)
+
+		// tested function
+		got, err := repo.ListPaymentMethods("merchantID", "customerID")
+		assert.NoError(t, err)
+
+		want := []entities.PaymentMethod{
+			{
+				ID:             "paymentMethodID",
+				MerchantID:     "merchantID",
+				CustomerID:     "customerID",
+				CardToken:      "tok_test",
+				CardName:       "Test Name",
+				CardLast4:      "1234",
+				CardExpiryDate: "12/23",
+				Timestamp:      123,
+			},
+		}
+
+		assert.Equal(t, got, want)
+	})
+}
+
+func TestCreateAuditEvent(t *testing.T) {
+	event := entities.AuditEvent{
+		MerchantID: "merchantID",
+		Sequence:   7,
+		Action:     entities.AuditActionPaymentRefund,
+		Actor: entities.Actor{
+			Type:      entities.ActorTypeAPIKey,
+			ID:        "keyID",
+			IPAddress: "10.0.0.1",
+			RequestID: "requestID",
+		},
+		ResourceID:   "paymentID",
+		Before:       []byte(`{"Refunded":false}`),
+		After:        []byte(`{"Refunded":true}`),
+		Outcome:      entities.AuditOutcomeSuccess,
+		Timestamp:    123,
+		PreviousHash: "previousHash",
+		Hash:         "hash",
+	}
+
+	t.Run("should store the event under its sequence", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var stored map[string]types.AttributeValue
+		md.On("PutItem", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*dynamodb.PutItemInput).Item
+		}).Return(nil)
+
+		// tested function
+		err := repo.CreateAuditEvent(event)
+		assert.NoError(t, err)
+
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberS{Value: "AUDIT#0000000000000000007"},
+			stored["SK"],
+		)
+
+		var item AuditEventItem
+		err = attributevalue.UnmarshalMap(stored, &item)
+		assert.NoError(t, err)
+		assert.Equal(t, event, item.AuditEvent())
+	})
+
+	t.Run("should report a taken sequence as a conflict", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("PutItem", mock.Anything, mock.Anything).
+			Return(&types.ConditionalCheckFailedException{})
+
+		// tested function
+		err := repo.CreateAuditEvent(event)
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+}
+
+func TestPostJournalEntries(t *testing.T) {
+	payment := entities.Payment{
+		ID:       "paymentID",
+		Merchant: entities.Merchant{ID: "merchantID"},
+		Price:    entities.Money{Amount: 1000, Currency: "EUR"},
+	}
+
+	entries := []entities.JournalEntry{
+		entities.NewJournalEntry(
+			payment,
+			entities.JournalEntryCharge,
+			entities.AccountBankClearing,
+			entities.AccountMerchantPending,
+			entities.Money{Amount: 1000, Currency: "EUR"},
+			123,
+		),
+		entities.NewJournalEntry(
+			payment,
+			entities.JournalEntryFee,
+			entities.AccountMerchantPending,
+			entities.AccountPlatformFees,
+			entities.Money{Amount: 30, Currency: "EUR"},
+			123,
+		),
+	}
+
+	t.Run("should write the payment, entries and balances in one transaction", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var items []types.TransactWriteItem
+		md.On("TransactWriteItems", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			items = args.Get(1).(*dynamodb.TransactWriteItemsInput).TransactItems
+		}).Return(nil)
+
+		// tested function
+		err := repo.CreateNewPayment(payment, entries...)
+		assert.NoError(t, err)
+
+		md.AssertNotCalled(t, "PutItem", mock.Anything, mock.Anything)
+
+		// payment, two entries and three accounts
+		assert.Len(t, items, 6)
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberS{Value: "PAYMENT#paymentID"},
+			items[0].Put.Item["SK"],
+		)
+
+		var entry JournalEntryItem
+		err = attributevalue.UnmarshalMap(items[1].Put.Item, &entry)
+		assert.NoError(t, err)
+		assert.Equal(t, entries[0], entry.JournalEntry())
+		assert.Equal(t, "attribute_not_exists(PK)", aws.ToString(items[1].Put.ConditionExpression))
+
+		// the postings to the pending account are added up into a single update
+		pending := items[4].Update
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberS{Value: "BALANCE#merchant_pending#EUR"},
+			pending.Key["SK"],
+		)
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberN{Value: "-970"},
+			pending.ExpressionAttributeValues[":amount"],
+		)
+	})
+
+	t.Run("should report entries posted before as a conflict", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("TransactWriteItems", mock.Anything, mock.Anything).
+			Return(&types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("None")},
+					{Code: aws.String("ConditionalCheckFailed")},
+				},
+			})
+
+		// tested function
+		err := repo.CreateNewPayment(payment, entries...)
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+}
+
+func TestGetJournalEntry(t *testing.T) {
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String("table"),
+		Key: map[string]types.AttributeValue{
+			"PK": &types.AttributeValueMemberS{Value: "merchantID"},
+			"SK": &types.AttributeValueMemberS{Value: "JOURNAL#release_paymentID"},
+		},
+	}
+
+	t.Run("should get the entry by its ID", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		entry := entities.NewReleaseJournalEntry(
+			"merchantID",
+			"paymentID",
+			entities.Money{Amount: 1000, Currency: "EUR"},
+			123,
+		)
+
+		item, err := attributevalue.MarshalMap(NewJournalEntryItemFromJournalEntry(entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		md.On("GetItem", context.TODO(), input).Return(&dynamodb.GetItemOutput{Item: item}, nil)
+
+		// tested function
+		got, err := repo.GetJournalEntry("merchantID", "release_paymentID")
+		assert.NoError(t, err)
+		assert.Equal(t, entry, got)
+	})
+
+	t.Run("should report entries that were not posted", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("GetItem", context.TODO(), input).Return(&dynamodb.GetItemOutput{}, nil)
+
+		// tested function
+		_, err := repo.GetJournalEntry("merchantID", "release_paymentID")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestGetAccountBalances(t *testing.T) {
+	md := MockDynamoDBClient{}
+	repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+	t.Run("should get account balances", func(t *testing.T) {
+		md.On("Query", mock.Anything, mock.Anything).Return(&dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{
+				{
+					"PK":       &types.AttributeValueMemberS{Value: "merchantID"},
+					"SK":       &types.AttributeValueMemberS{Value: "BALANCE#merchant_pending#EUR"},
+					"Account":  &types.AttributeValueMemberS{Value: "merchant_pending"},
+					"Currency": &types.AttributeValueMemberS{Value: "EUR"},
+					"Balance":  &types.AttributeValueMemberN{Value: "-970"},
+				},
+			},
+		}, nil)
+
+		// tested function
+		got, err := repo.GetAccountBalances("merchantID")
+		assert.NoError(t, err)
+
+		want := []entities.AccountBalance{
+			{
+				Account: entities.AccountMerchantPending,
+				Balance: entities.Money{Amount: -970, Currency: "EUR"},
+			},
+		}
+
+		assert.Equal(t, want, got)
+	})
+}
+
+func TestListMerchants(t *testing.T) {
+	md := MockDynamoDBClient{}
+	repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+	t.Run("should scan all pages of merchants", func(t *testing.T) {
+		first, _ := attributevalue.MarshalMap(
+			NewMerchantItemFromMerchant(entities.Merchant{ID: "first", Timestamp: 1}),
+		)
+		second, _ := attributevalue.MarshalMap(
+			NewMerchantItemFromMerchant(entities.Merchant{ID: "second", Timestamp: 2}),
+		)
+
+		md.On("Scan", mock.Anything, mock.MatchedBy(func(input *dynamodb.ScanInput) bool {
+			return input.ExclusiveStartKey == nil
+		})).Return(&dynamodb.ScanOutput{
+			Items:            []map[string]types.AttributeValue{first},
+			LastEvaluatedKey: map[string]types.AttributeValue{"PK": first["PK"]},
+		}, nil).Once()
+		md.On("Scan", mock.Anything, mock.Anything).Return(&dynamodb.ScanOutput{
+			Items: []map[string]types.AttributeValue{second},
+		}, nil).Once()
+
+		// tested function
+		got, err := repo.ListMerchants()
+		assert.NoError(t, err)
+
+		assert.Len(t, got, 2)
+		assert.Equal(t, "first", got[0].ID)
+		assert.Equal(t, "second", got[1].ID)
+	})
+}
+
+func TestUpdateMerchant(t *testing.T) {
+	previous := entities.Merchant{ID: "merchantID", Timestamp: 123}
+
+	merchant := previous
+	merchant.Deactivated = true
+	merchant.DeactivatedTimestamp = 456
+	merchant.UpdatedTimestamp = 456
+
+	t.Run("should condition the update on the version that was read", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var input *dynamodb.PutItemInput
+		md.On("PutItem", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			input = args.Get(1).(*dynamodb.PutItemInput)
+		}).Return(nil)
+
+		// tested function
+		err := repo.UpdateMerchant(previous, merchant)
+		assert.NoError(t, err)
+
+		assert.Equal(
+			t,
+			"Timestamp = :timestamp AND attribute_not_exists(DeactivatedTimestamp)"+
+				" AND attribute_not_exists(UpdatedTimestamp)",
+			*input.ConditionExpression,
+		)
+
+		var item MerchantItem
+		err = attributevalue.UnmarshalMap(input.Item, &item)
+		assert.NoError(t, err)
+		assert.Equal(t, merchant, item.Merchant())
+
+		// tested function
+		err = repo.UpdateMerchant(merchant, merchant)
+		assert.NoError(t, err)
+
+		assert.Equal(
+			t,
+			"Timestamp = :timestamp AND DeactivatedTimestamp = :DeactivatedTimestamp"+
+				" AND UpdatedTimestamp = :UpdatedTimestamp",
+			*input.ConditionExpression,
+		)
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberN{Value: "456"},
+			input.ExpressionAttributeValues[":UpdatedTimestamp"],
+		)
+	})
+
+	t.Run("should report merchants changed since they were read", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("PutItem", mock.Anything, mock.Anything).
+			Return(&types.ConditionalCheckFailedException{})
+
+		// tested function
+		err := repo.UpdateMerchant(previous, merchant)
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+}
+
+func TestPayoutItem(t *testing.T) {
+	payout := entities.Payout{
+		ID:         "payoutID",
+		MerchantID: "merchantID",
+		Amount:     entities.Money{Amount: 9700, Currency: "EUR"},
+		Status:     entities.PayoutStatusFailed,
+		Destination: entities.AccountDetails{
+			Name:     "Test Merchant",
+			IBAN:     "DE89370400440532013000",
+			BIC:      "COBADEFFXXX",
+			Currency: "EUR",
+		},
+		BankTransferID:   "transferID",
+		FailureReason:    "account closed",
+		Timestamp:        123,
+		UpdatedTimestamp: 456,
+	}
+
+	t.Run("should store the payout under its ID", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var stored map[string]types.AttributeValue
+		md.On("PutItem", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*dynamodb.PutItemInput).Item
+		}).Return(nil)
+
+		// tested function
+		err := repo.UpdatePayout(payout)
+		assert.NoError(t, err)
+
+		assert.Equal(t, &types.AttributeValueMemberS{Value: "PAYOUT#payoutID"}, stored["SK"])
+
+		var item PayoutItem
+		err = attributevalue.UnmarshalMap(stored, &item)
+		assert.NoError(t, err)
+		assert.Equal(t, payout, item.Payout())
+	})
+
+	t.Run("should only create payouts covered by the available balance", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var items []types.TransactWriteItem
+		md.On("TransactWriteItems", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			items = args.Get(1).(*dynamodb.TransactWriteItemsInput).TransactItems
+		}).Return(nil)
+
+		entry := entities.NewPayoutJournalEntry(
+			payout,
+			entities.JournalEntryPayout,
+			entities.AccountMerchantAvailable,
+			entities.AccountBankClearing,
+			payout.Amount,
+			123,
+		)
+
+		// tested function
+		err := repo.CreatePayout(payout, entry)
+		assert.NoError(t, err)
+
+		assert.Len(t, items, 4)
+		assert.Equal(t, "Balance <= :limit", aws.ToString(items[2].Update.ConditionExpression))
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberN{Value: "-9700"},
+			items[2].Update.ExpressionAttributeValues[":limit"],
+		)
+		assert.Nil(t, items[3].Update.ConditionExpression)
+
+		// tested function
+		err = repo.UpdatePayout(payout, entry)
+		assert.NoError(t, err)
+
+		assert.Nil(t, items[2].Update.ConditionExpression)
+	})
+
+	t.Run("should return not found for unknown payouts", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("GetItem", mock.Anything, mock.Anything).Return(&dynamodb.GetItemOutput{}, nil)
+
+		// tested function
+		_, err := repo.GetPayout("merchantID", "payoutID")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestDisputeItem(t *testing.T) {
+	dispute := entities.Dispute{
+		ID:         "disputeID",
+		MerchantID: "merchantID",
+		PaymentID:  "paymentID",
+		Reason:     entities.DisputeReasonFraudulent,
+		Amount:     entities.Money{Amount: 2500, Currency: "EUR"},
+		Status:     entities.DisputeStatusUnderReview,
+		Deadline:   789,
+		Evidence: &entities.DisputeEvidence{
+			Text: "The customer received the goods",
+			Files: []entities.EvidenceFile{{
+				ID:          "fileID",
+				Name:        "receipt.pdf",
+				ContentType: "application/pdf",
+				Size:        7,
+				Key:         "merchantID/disputeID/fileID",
+			}},
+			Timestamp: 456,
+		},
+		Timestamp:        123,
+		UpdatedTimestamp: 456,
+	}
+
+	t.Run("should store the dispute with its evidence", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var stored map[string]types.AttributeValue
+		md.On("PutItem", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*dynamodb.PutItemInput).Item
+		}).Return(nil)
+
+		// tested function
+		err := repo.UpdateDispute(dispute, dispute, PaymentChange{})
+		assert.NoError(t, err)
+
+		assert.Equal(t, &types.AttributeValueMemberS{Value: "DISPUTE#disputeID"}, stored["SK"])
+
+		var item DisputeItem
+		err = attributevalue.UnmarshalMap(stored, &item)
+		assert.NoError(t, err)
+		assert.Equal(t, dispute, item.Dispute())
+	})
+
+	t.Run("should keep the adjustments of payments", func(t *testing.T) {
+		payment := entities.Payment{
+			ID:       "paymentID",
+			Merchant: entities.Merchant{ID: "merchantID"},
+			Price:    entities.Money{Amount: 10000, Currency: "EUR"},
+			Adjustments: []entities.Adjustment{{
+				ID:        "chargeback_disputeID",
+				Type:      entities.AdjustmentChargeback,
+				DisputeID: "disputeID",
+				Amount:    entities.Money{Amount: -2500, Currency: "EUR"},
+				Timestamp: 456,
+			}},
+		}
+
+		av, err := attributevalue.MarshalMap(NewPaymentsItemFromPayment(payment))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("GetItem", mock.Anything, mock.Anything).
+			Return(&dynamodb.GetItemOutput{Item: av}, nil)
+
+		// tested function
+		got, err := repo.GetPayment("merchantID", "paymentID")
+		assert.NoError(t, err)
+		assert.Equal(t, payment.Adjustments, got.Adjustments)
+	})
+
+	t.Run("should reserve the disputed amount on the payment", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var items []types.TransactWriteItem
+		md.On("TransactWriteItems", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			items = args.Get(1).(*dynamodb.TransactWriteItemsInput).TransactItems
+		}).Return(nil).Once()
+
+		// tested function
+		err := repo.CreateDispute(dispute, entities.Money{Amount: 10000, Currency: "EUR"})
+		assert.NoError(t, err)
+
+		assert.Len(t, items, 2)
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberS{Value: "DISPUTE#disputeID"},
+			items[0].Put.Item["SK"],
+		)
+
+		reserve := items[1].Update
+		assert.Equal(t, &types.AttributeValueMemberS{Value: "PAYMENT#paymentID"}, reserve.Key["SK"])
+		assert.Equal(t, "ADD DisputedAmount :amount, OpenDisputes :one", *reserve.UpdateExpression)
+		assert.Contains(t, *reserve.ConditionExpression, "DisputedAmount <= :limit")
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberN{Value: "7500"},
+			reserve.ExpressionAttributeValues[":limit"],
+		)
+
+		md.On("TransactWriteItems", mock.Anything, mock.Anything).
+			Return(&types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("None")},
+					{Code: aws.String("ConditionalCheckFailed")},
+				},
+			}).Once()
+
+		// tested function
+		err = repo.CreateDispute(dispute, entities.Money{Amount: 10000, Currency: "EUR"})
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("should report disputes changed since they were read", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var input *dynamodb.PutItemInput
+		md.On("PutItem", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) {
+				input = args.Get(1).(*dynamodb.PutItemInput)
+			}).
+			Return(&types.ConditionalCheckFailedException{})
+
+		previous := dispute
+		previous.Status = entities.DisputeStatusNeedsResponse
+
+		// tested function
+		err := repo.UpdateDispute(previous, dispute, PaymentChange{})
+		assert.ErrorIs(t, err, ErrConflict)
+
+		assert.Equal(
+			t,
+			"#status = :status AND UpdatedTimestamp = :updated",
+			*input.ConditionExpression,
+		)
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberS{Value: entities.DisputeStatusNeedsResponse},
+			input.ExpressionAttributeValues[":status"],
+		)
+	})
+
+	t.Run("should append adjustments in the transaction of the dispute", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var items []types.TransactWriteItem
+		md.On("TransactWriteItems", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			items = args.Get(1).(*dynamodb.TransactWriteItemsInput).TransactItems
+		}).Return(nil)
+
+		adjustment := entities.Adjustment{
+			ID:        "chargeback_disputeID",
+			Type:      entities.AdjustmentChargeback,
+			DisputeID: "disputeID",
+			Amount:    entities.Money{Amount: -2500, Currency: "EUR"},
+			Timestamp: 456,
+		}
+
+		lost := dispute
+		lost.Status = entities.DisputeStatusLost
+
+		// tested function
+		err := repo.UpdateDispute(dispute, lost, PaymentChange{Adjustment: &adjustment, Open: -1})
+		assert.NoError(t, err)
+
+		assert.Len(t, items, 2)
+		assert.NotNil(t, items[0].Put.ConditionExpression)
+
+		update := items[1].Update
+		assert.Equal(t, &types.AttributeValueMemberS{Value: "PAYMENT#paymentID"}, update.Key["SK"])
+		assert.Equal(
+			t,
+			"SET Adjustments = list_append(if_not_exists(Adjustments, :empty), :adjustments)"+
+				" ADD OpenDisputes :open",
+			*update.UpdateExpression,
+		)
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberN{Value: "-1"},
+			update.ExpressionAttributeValues[":open"],
+		)
+		assert.Equal(t, "attribute_exists(SK)", *update.ConditionExpression)
+
+		var appended []Adjustment
+		err = attributevalue.UnmarshalList(
+			update.ExpressionAttributeValues[":adjustments"].(*types.AttributeValueMemberL).Value,
+			&appended,
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, []entities.Adjustment{adjustment}, adjustments(appended))
+	})
+}
+
+func TestUpdateWebhookDelivery(t *testing.T) {
+	previous := entities.WebhookDelivery{
+		ID:          "deliveryID",
+		MerchantID:  "merchantID",
+		EndpointID:  "endpointID",
+		EventID:     "eventID",
+		EventType:   entities.WebhookEventPaymentCreated,
+		Payload:     []byte(`{"Type":"payment.created"}`),
+		Status:      entities.WebhookDeliveryPending,
+		NextAttempt: 1000,
+		Timestamp:   1000,
+	}
+
+	t.Run("should requeue the delivery for its next attempt", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var items []types.TransactWriteItem
+		md.On("TransactWriteItems", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			items = args.Get(1).(*dynamodb.TransactWriteItemsInput).TransactItems
+		}).Return(nil)
+
+		delivery := previous
+		delivery.Attempts = 1
+		delivery.NextAttempt = 61000
+		delivery.LastError = "unexpected status 500"
+
+		// tested function
+		err := repo.UpdateWebhookDelivery(previous, delivery)
+		assert.NoError(t, err)
+
+		assert.Len(t, items, 3)
+
+		var item WebhookDeliveryItem
+		err = attributevalue.UnmarshalMap(items[0].Put.Item, &item)
+		assert.NoError(t, err)
+		assert.Equal(t, delivery, item.WebhookDelivery())
+
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberS{Value: "DELIVERY#0000000001000#deliveryID"},
+			items[1].Delete.Key["SK"],
+		)
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberS{Value: "DELIVERY#0000000061000#deliveryID"},
+			items[2].Put.Item["SK"],
+		)
+	})
+
+	t.Run("should take finished deliveries off the queue", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var items []types.TransactWriteItem
+		md.On("TransactWriteItems", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			items = args.Get(1).(*dynamodb.TransactWriteItemsInput).TransactItems
+		}).Return(nil)
+
+		delivery := previous
+		delivery.Attempts = 1
+		delivery.Status = entities.WebhookDeliverySucceeded
+
+		// tested function
+		err := repo.UpdateWebhookDelivery(previous, delivery)
+		assert.NoError(t, err)
+
+		assert.Len(t, items, 2)
+		assert.NotNil(t, items[1].Delete)
+	})
+
+	t.Run("should record the attempts with the delivery", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var items []types.TransactWriteItem
+		md.On("TransactWriteItems", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			items = args.Get(1).(*dynamodb.TransactWriteItemsInput).TransactItems
+		}).Return(nil)
+
+		delivery := previous
+		delivery.Attempts = 1
+		delivery.Status = entities.WebhookDeliverySucceeded
+
+		attempt := entities.WebhookAttempt{
+			DeliveryID:     "deliveryID",
+			MerchantID:     "merchantID",
+			Number:         1,
+			URL:            "https://merchant.example/webhooks",
+			RequestBody:    previous.Payload,
+			ResponseStatus: 204,
+			Latency:        35,
+			Timestamp:      1000,
+		}
+
+		// tested function
+		err := repo.UpdateWebhookDelivery(previous, delivery, attempt)
+		assert.NoError(t, err)
+
+		assert.Len(t, items, 3)
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberS{Value: "WEBHOOK_ATTEMPT#deliveryID#000001"},
+			items[1].Put.Item["SK"],
+		)
+
+		var item WebhookAttemptItem
+		err = attributevalue.UnmarshalMap(items[1].Put.Item, &item)
+		assert.NoError(t, err)
+		assert.Equal(t, attempt, item.WebhookAttempt())
+	})
+
+	t.Run("should report deliveries claimed by another worker as a conflict", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("TransactWriteItems", mock.Anything, mock.Anything).
+			Return(&types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{
+					{Code: aws.String("None")},
+					{Code: aws.String("ConditionalCheckFailed")},
+				},
+			})
+
+		// tested function
+		err := repo.UpdateWebhookDelivery(previous, previous)
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+}
+
+func TestListWebhookDeliveries(t *testing.T) {
+	delivery := func(id string, timestamp int64) map[string]types.AttributeValue {
+		item, err := attributevalue.MarshalMap(
+			NewWebhookDeliveryItemFromWebhookDelivery(entities.WebhookDelivery{
+				ID:         id,
+				MerchantID: "merchantID",
+				Status:     entities.WebhookDeliveryFailed,
+				Timestamp:  timestamp,
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return item
+	}
+
+	t.Run("should read pages of the index after the cursor until the limit", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("GetItem", mock.Anything, mock.Anything).
+			Return(&dynamodb.GetItemOutput{Item: delivery("afterID", 3000)}, nil)
+
+		var inputs []dynamodb.QueryInput
+		capture := func(args mock.Arguments) {
+			inputs = append(inputs, *args.Get(1).(*dynamodb.QueryInput))
+		}
+
+		md.On("Query", mock.Anything, mock.Anything).Run(capture).Return(&dynamodb.QueryOutput{
+			Items:            []map[string]types.AttributeValue{delivery("secondID", 2000)},
+			LastEvaluatedKey: delivery("secondID", 2000),
+		}, nil).Once()
+		md.On("Query", mock.Anything, mock.Anything).Run(capture).Return(&dynamodb.QueryOutput{
+			Items: []map[string]types.AttributeValue{
+				delivery("firstID", 1000),
+				delivery("zeroID", 0),
+			},
+		}, nil).Once()
+
+		// tested function
+		got, err := repo.ListWebhookDeliveries("merchantID", WebhookDeliveryFilter{
+			Status: entities.WebhookDeliveryFailed,
+			After:  "afterID",
+			Limit:  2,
+		})
+		assert.NoError(t, err)
+
+		assert.Len(t, got, 2)
+		assert.Equal(t, "secondID", got[0].ID)
+		assert.Equal(t, "firstID", got[1].ID)
+
+		assert.Len(t, inputs, 2)
+		assert.Equal(t, webhookDeliveriesIndex, *inputs[0].IndexName)
+		assert.False(t, *inputs[0].ScanIndexForward)
+		assert.Equal(t, "PK = :pk AND DeliveryTime < :after", *inputs[0].KeyConditionExpression)
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberS{Value: "0000000003000#afterID"},
+			inputs[0].ExpressionAttributeValues[":after"],
+		)
+		assert.Equal(t, "#status = :status", *inputs[0].FilterExpression)
+		assert.NotEmpty(t, inputs[1].ExclusiveStartKey)
+	})
+
+	t.Run("should report unknown cursors", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("GetItem", mock.Anything, mock.Anything).Return(&dynamodb.GetItemOutput{}, nil)
+
+		// tested function
+		_, err := repo.ListWebhookDeliveries(
+			"merchantID",
+			WebhookDeliveryFilter{After: "unknownID"},
+		)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestSubscriptionItem(t *testing.T) {
+	subscription := entities.Subscription{
+		ID:                 "subscriptionID",
+		MerchantID:         "merchantID",
+		PlanID:             "planID",
+		CustomerID:         "customerID",
+		PaymentMethodID:    "paymentMethodID",
+		Status:             entities.SubscriptionStatusPastDue,
+		TrialEnd:           1000,
+		BillingAnchor:      1000,
+		PeriodsBilled:      2,
+		CurrentPeriodStart: 2000,
+		CurrentPeriodEnd:   3000,
+		NextAttempt:        4000,
+		FailedAttempts:     1,
+		LastPaymentID:      "paymentID",
+		LastError:          "card declined",
+		Timestamp:          123,
+		UpdatedTimestamp:   456,
+	}
+
+	t.Run("should store the subscription under its ID", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		var stored map[string]types.AttributeValue
+		md.On("PutItem", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*dynamodb.PutItemInput).Item
+		}).Return(nil)
+
+		// tested function
+		err := repo.UpdateSubscription(subscription, subscription)
+		assert.NoError(t, err)
+
+		assert.Equal(
+			t,
+			&types.AttributeValueMemberS{Value: "SUBSCRIPTION#subscriptionID"},
+			stored["SK"],
+		)
+
+		var item SubscriptionItem
+		err = attributevalue.UnmarshalMap(stored, &item)
+		assert.NoError(t, err)
+		assert.Equal(t, subscription, item.Subscription())
+	})
+
+	t.Run("should report subscriptions changed since they were read", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("PutItem", mock.Anything, mock.Anything).
+			Return(&types.ConditionalCheckFailedException{})
+
+		// tested function
+		err := repo.UpdateSubscription(subscription, subscription)
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("should return not found for unknown plans", func(t *testing.T) {
+		md := MockDynamoDBClient{}
+		repo := DynamoDBRepository{db: &md, tableName: "table"}
+
+		md.On("GetItem", mock.Anything, mock.Anything).Return(&dynamodb.GetItemOutput{}, nil)
+
+		// tested function
+		_, err := repo.GetPlan("merchantID", "planID")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
 }
@@ -2,45 +2,788 @@ package storage
 
 import (
 	"fmt"
+	"slices"
+	"sort"
 
 	"github.com/mgajewskik/payment-platform/internal/domain/entities"
 )
 
 type MemoryRepository struct {
-	payments map[string]entities.Payment
+	merchants      map[string]entities.Merchant
+	payments       map[string]entities.Payment
+	paymentMethods map[string]entities.PaymentMethod
+	counters       map[string]int64
+	apiKeys        map[string]entities.APIKey
+	revokedTokens  map[string]int64
+	nonces         map[string]int64
+	auditEvents    map[string][]entities.AuditEvent
+	journalEntries map[string][]entities.JournalEntry
+	payouts        map[string]entities.Payout
+	disputes       map[string]entities.Dispute
+	endpoints      map[string]entities.WebhookEndpoint
+	deliveries     map[string]entities.WebhookDelivery
+	attempts       map[string][]entities.WebhookAttempt
+	plans          map[string]entities.Plan
+	subscriptions  map[string]entities.Subscription
+	// queue holds the next attempt of pending deliveries by delivery ID
+	queue map[string]int64
 }
 
 func NewMemoryRepository() *MemoryRepository {
 	return &MemoryRepository{
-		payments: make(map[string]entities.Payment),
+		merchants:      make(map[string]entities.Merchant),
+		payments:       make(map[string]entities.Payment),
+		paymentMethods: make(map[string]entities.PaymentMethod),
+		counters:       make(map[string]int64),
+		apiKeys:        make(map[string]entities.APIKey),
+		revokedTokens:  make(map[string]int64),
+		nonces:         make(map[string]int64),
+		auditEvents:    make(map[string][]entities.AuditEvent),
+		journalEntries: make(map[string][]entities.JournalEntry),
+		payouts:        make(map[string]entities.Payout),
+		disputes:       make(map[string]entities.Dispute),
+		endpoints:      make(map[string]entities.WebhookEndpoint),
+		deliveries:     make(map[string]entities.WebhookDelivery),
+		attempts:       make(map[string][]entities.WebhookAttempt),
+		plans:          make(map[string]entities.Plan),
+		subscriptions:  make(map[string]entities.Subscription),
+		queue:          make(map[string]int64),
 	}
 }
 
 func (r *MemoryRepository) GetMerchantDetails(merchantID string) (entities.Merchant, error) {
-	return entities.Merchant{ID: merchantID, AccountDetails: entities.AccountDetails{
-		Name:     "Test Merchant",
-		IBAN:     "DE89370400440532013000",
-		BIC:      "COBADEFFXXX",
-		Currency: "EUR",
-	}}, nil
+	merchant, ok := r.merchants[merchantID]
+	if !ok {
+		return entities.Merchant{}, ErrNotFound
+	}
+
+	return merchant, nil
 }
 
-func (r *MemoryRepository) CreateNewPayment(payment entities.Payment) error {
-	r.payments[payment.ID] = payment
+func (r *MemoryRepository) CreateMerchant(merchant entities.Merchant) error {
+	if _, ok := r.merchants[merchant.ID]; ok {
+		return ErrConflict
+	}
+
+	r.merchants[merchant.ID] = merchant
 
 	return nil
 }
 
-func (r *MemoryRepository) UpdatePayment(payment entities.Payment) error {
-	r.payments[payment.ID] = payment
+func (r *MemoryRepository) UpdateMerchant(previous, merchant entities.Merchant) error {
+	stored, ok := r.merchants[previous.ID]
+	if !ok ||
+		stored.Timestamp != previous.Timestamp ||
+		stored.DeactivatedTimestamp != previous.DeactivatedTimestamp ||
+		stored.UpdatedTimestamp != previous.UpdatedTimestamp {
+		return ErrConflict
+	}
+
+	r.merchants[merchant.ID] = merchant
 
 	return nil
 }
 
+func (r *MemoryRepository) ListMerchants() ([]entities.Merchant, error) {
+	merchants := make([]entities.Merchant, 0, len(r.merchants))
+	for _, merchant := range r.merchants {
+		merchants = append(merchants, merchant)
+	}
+
+	sort.Slice(merchants, func(i, j int) bool {
+		return merchants[i].ID < merchants[j].ID
+	})
+
+	return merchants, nil
+}
+
+func (r *MemoryRepository) CreateNewPayment(
+	payment entities.Payment,
+	entries ...entities.JournalEntry,
+) error {
+	err := r.checkJournalEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	r.payments[payment.ID] = payment
+
+	return r.PostJournalEntries(entries...)
+}
+
+func (r *MemoryRepository) UpdatePayment(previous, payment entities.Payment) error {
+	stored, ok := r.payments[previous.ID]
+	if !ok ||
+		stored.Refunded != previous.Refunded ||
+		stored.RefundTimestamp != previous.RefundTimestamp ||
+		len(stored.Adjustments) != len(previous.Adjustments) ||
+		stored.DisputedAmount != previous.DisputedAmount ||
+		stored.OpenDisputes != previous.OpenDisputes {
+		return ErrConflict
+	}
+
+	return r.CreateNewPayment(payment)
+}
+
 func (r *MemoryRepository) GetPayment(_, paymentID string) (entities.Payment, error) {
 	if _, ok := r.payments[paymentID]; !ok {
-		return entities.Payment{}, fmt.Errorf("payment with ID %s not found", paymentID)
+		return entities.Payment{}, fmt.Errorf("%w: payment with ID %s", ErrNotFound, paymentID)
 	}
 
 	return r.payments[paymentID], nil
 }
+
+func (r *MemoryRepository) CreatePaymentMethod(method entities.PaymentMethod) error {
+	r.paymentMethods[paymentMethodSortKey(method.CustomerID, method.ID)] = method
+
+	return nil
+}
+
+func (r *MemoryRepository) GetPaymentMethod(
+	merchantID, customerID, paymentMethodID string,
+) (entities.PaymentMethod, error) {
+	method, ok := r.paymentMethods[paymentMethodSortKey(customerID, paymentMethodID)]
+	if !ok || method.MerchantID != merchantID {
+		return entities.PaymentMethod{}, ErrNotFound
+	}
+
+	return method, nil
+}
+
+func (r *MemoryRepository) ListPaymentMethods(
+	merchantID, customerID string,
+) ([]entities.PaymentMethod, error) {
+	methods := []entities.PaymentMethod{}
+
+	for _, method := range r.paymentMethods {
+		if method.MerchantID == merchantID && method.CustomerID == customerID {
+			methods = append(methods, method)
+		}
+	}
+
+	sort.Slice(methods, func(i, j int) bool {
+		return methods[i].ID < methods[j].ID
+	})
+
+	return methods, nil
+}
+
+func (r *MemoryRepository) DeletePaymentMethod(
+	merchantID, customerID, paymentMethodID string,
+) error {
+	_, err := r.GetPaymentMethod(merchantID, customerID, paymentMethodID)
+	if err != nil {
+		return err
+	}
+
+	delete(r.paymentMethods, paymentMethodSortKey(customerID, paymentMethodID))
+
+	return nil
+}
+
+func (r *MemoryRepository) IncrementCounter(
+	merchantID, counter string,
+	delta, _ int64,
+) (int64, error) {
+	key := merchantID + "#" + counter
+	r.counters[key] += delta
+
+	return r.counters[key], nil
+}
+
+func (r *MemoryRepository) CreateAPIKey(key entities.APIKey) error {
+	if _, ok := r.apiKeys[key.ID]; ok {
+		return fmt.Errorf("API key with ID %s already exists", key.ID)
+	}
+
+	r.apiKeys[key.ID] = key
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateAPIKey(key entities.APIKey) error {
+	if _, ok := r.apiKeys[key.ID]; !ok {
+		return ErrNotFound
+	}
+
+	r.apiKeys[key.ID] = key
+
+	return nil
+}
+
+func (r *MemoryRepository) GetAPIKey(keyID string) (entities.APIKey, error) {
+	key, ok := r.apiKeys[keyID]
+	if !ok {
+		return entities.APIKey{}, ErrNotFound
+	}
+
+	return key, nil
+}
+
+func (r *MemoryRepository) ListAPIKeys(merchantID string) ([]entities.APIKey, error) {
+	keys := []entities.APIKey{}
+
+	for _, key := range r.apiKeys {
+		if key.MerchantID == merchantID {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Timestamp < keys[j].Timestamp ||
+			(keys[i].Timestamp == keys[j].Timestamp && keys[i].ID < keys[j].ID)
+	})
+
+	return keys, nil
+}
+
+func (r *MemoryRepository) RevokeToken(tokenID, _ string, expiresAt int64) error {
+	r.revokedTokens[tokenID] = expiresAt
+
+	return nil
+}
+
+func (r *MemoryRepository) IsTokenRevoked(tokenID string) (bool, error) {
+	_, ok := r.revokedTokens[tokenID]
+
+	return ok, nil
+}
+
+func (r *MemoryRepository) UseNonce(keyID, nonce string, expiresAt int64) (bool, error) {
+	key := keyID + "#" + nonce
+	if _, ok := r.nonces[key]; ok {
+		return false, nil
+	}
+
+	r.nonces[key] = expiresAt
+
+	return true, nil
+}
+
+func (r *MemoryRepository) CreateAuditEvent(event entities.AuditEvent) error {
+	events := r.auditEvents[event.MerchantID]
+	if event.Sequence <= int64(len(events)) {
+		return ErrConflict
+	}
+
+	r.auditEvents[event.MerchantID] = append(events, event)
+
+	return nil
+}
+
+func (r *MemoryRepository) GetLatestAuditEvent(merchantID string) (entities.AuditEvent, error) {
+	events := r.auditEvents[merchantID]
+	if len(events) == 0 {
+		return entities.AuditEvent{}, ErrNotFound
+	}
+
+	return events[len(events)-1], nil
+}
+
+func (r *MemoryRepository) ListAuditEvents(
+	merchantID string,
+	filter AuditEventFilter,
+) ([]entities.AuditEvent, error) {
+	events := []entities.AuditEvent{}
+
+	for _, event := range r.auditEvents[merchantID] {
+		if event.Sequence <= filter.AfterSequence ||
+			(filter.Action != "" && event.Action != filter.Action) ||
+			(filter.ResourceID != "" && event.ResourceID != filter.ResourceID) {
+			continue
+		}
+
+		events = append(events, event)
+
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+
+	return events, nil
+}
+
+func (r *MemoryRepository) GetAccountBalances(
+	merchantID string,
+) ([]entities.AccountBalance, error) {
+	var balances []entities.AccountBalance
+
+	for _, entry := range r.journalEntries[merchantID] {
+		for _, posting := range entry.Postings {
+			index := slices.IndexFunc(balances, func(balance entities.AccountBalance) bool {
+				return balance.Account == posting.Account &&
+					balance.Balance.Currency == posting.Amount.Currency
+			})
+
+			if index < 0 {
+				balances = append(balances, entities.AccountBalance{
+					Account: posting.Account,
+					Balance: posting.Amount,
+				})
+				continue
+			}
+
+			balances[index].Balance.Amount += posting.Amount.Amount
+		}
+	}
+
+	return balances, nil
+}
+
+func (r *MemoryRepository) PostJournalEntries(entries ...entities.JournalEntry) error {
+	err := r.checkJournalEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		r.journalEntries[entry.MerchantID] = append(r.journalEntries[entry.MerchantID], entry)
+	}
+
+	return nil
+}
+
+// checkJournalEntries returns ErrConflict when one of the entries was already posted
+func (r *MemoryRepository) checkJournalEntries(entries []entities.JournalEntry) error {
+	for _, entry := range entries {
+		for _, posted := range r.journalEntries[entry.MerchantID] {
+			if posted.ID == entry.ID {
+				return ErrConflict
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) ListJournalEntries(
+	merchantID string,
+) ([]entities.JournalEntry, error) {
+	return slices.Clone(r.journalEntries[merchantID]), nil
+}
+
+func (r *MemoryRepository) GetJournalEntry(
+	merchantID, entryID string,
+) (entities.JournalEntry, error) {
+	for _, entry := range r.journalEntries[merchantID] {
+		if entry.ID == entryID {
+			return entry, nil
+		}
+	}
+
+	return entities.JournalEntry{}, ErrNotFound
+}
+
+func (r *MemoryRepository) CreatePayout(
+	payout entities.Payout,
+	entries ...entities.JournalEntry,
+) error {
+	balances, err := r.GetAccountBalances(payout.MerchantID)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		for _, posting := range entry.Postings {
+			if !isMerchantAccount(posting.Account) || posting.Amount.Amount <= 0 {
+				continue
+			}
+
+			covered := slices.ContainsFunc(balances, func(balance entities.AccountBalance) bool {
+				return balance.Account == posting.Account &&
+					balance.Balance.Currency == posting.Amount.Currency &&
+					balance.Balance.Amount+posting.Amount.Amount <= 0
+			})
+			if !covered {
+				return ErrConflict
+			}
+		}
+	}
+
+	return r.UpdatePayout(payout, entries...)
+}
+
+func (r *MemoryRepository) UpdatePayout(
+	payout entities.Payout,
+	entries ...entities.JournalEntry,
+) error {
+	err := r.checkJournalEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	r.payouts[payout.ID] = payout
+
+	return r.PostJournalEntries(entries...)
+}
+
+func (r *MemoryRepository) GetPayout(merchantID, payoutID string) (entities.Payout, error) {
+	payout, ok := r.payouts[payoutID]
+	if !ok || payout.MerchantID != merchantID {
+		return entities.Payout{}, ErrNotFound
+	}
+
+	return payout, nil
+}
+
+func (r *MemoryRepository) ListPayouts(merchantID string) ([]entities.Payout, error) {
+	payouts := []entities.Payout{}
+
+	for _, payout := range r.payouts {
+		if payout.MerchantID == merchantID {
+			payouts = append(payouts, payout)
+		}
+	}
+
+	sort.Slice(payouts, func(i, j int) bool {
+		if payouts[i].Timestamp != payouts[j].Timestamp {
+			return payouts[i].Timestamp > payouts[j].Timestamp
+		}
+
+		return payouts[i].ID < payouts[j].ID
+	})
+
+	return payouts, nil
+}
+
+func (r *MemoryRepository) CreateDispute(dispute entities.Dispute, price entities.Money) error {
+	payment, ok := r.payments[dispute.PaymentID]
+	if !ok ||
+		payment.Merchant.ID != dispute.MerchantID ||
+		payment.Refunded ||
+		payment.DisputedAmount+dispute.Amount.Amount > price.Amount {
+		return ErrConflict
+	}
+
+	payment.DisputedAmount += dispute.Amount.Amount
+	payment.OpenDisputes++
+	r.payments[payment.ID] = payment
+
+	r.disputes[dispute.ID] = dispute
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateDispute(
+	previous, dispute entities.Dispute,
+	change PaymentChange,
+	entries ...entities.JournalEntry,
+) error {
+	stored, ok := r.disputes[previous.ID]
+	if !ok ||
+		stored.Status != previous.Status ||
+		stored.UpdatedTimestamp != previous.UpdatedTimestamp {
+		return ErrConflict
+	}
+
+	payment, ok := r.payments[dispute.PaymentID]
+	if !ok {
+		return ErrConflict
+	}
+
+	err := r.checkJournalEntries(entries)
+	if err != nil {
+		return err
+	}
+
+	if change.Adjustment != nil {
+		payment.Adjustments = append(slices.Clone(payment.Adjustments), *change.Adjustment)
+	}
+
+	payment.DisputedAmount += change.Disputed
+	payment.OpenDisputes += change.Open
+	r.payments[payment.ID] = payment
+
+	r.disputes[dispute.ID] = dispute
+
+	return r.PostJournalEntries(entries...)
+}
+
+func (r *MemoryRepository) GetDispute(merchantID, disputeID string) (entities.Dispute, error) {
+	dispute, ok := r.disputes[disputeID]
+	if !ok || dispute.MerchantID != merchantID {
+		return entities.Dispute{}, ErrNotFound
+	}
+
+	return dispute, nil
+}
+
+func (r *MemoryRepository) ListDisputes(merchantID string) ([]entities.Dispute, error) {
+	disputes := []entities.Dispute{}
+
+	for _, dispute := range r.disputes {
+		if dispute.MerchantID == merchantID {
+			disputes = append(disputes, dispute)
+		}
+	}
+
+	sort.Slice(disputes, func(i, j int) bool {
+		if disputes[i].Timestamp != disputes[j].Timestamp {
+			return disputes[i].Timestamp > disputes[j].Timestamp
+		}
+
+		return disputes[i].ID < disputes[j].ID
+	})
+
+	return disputes, nil
+}
+
+func (r *MemoryRepository) CreateWebhookEndpoint(endpoint entities.WebhookEndpoint) error {
+	r.endpoints[endpoint.ID] = endpoint
+
+	return nil
+}
+
+func (r *MemoryRepository) GetWebhookEndpoint(
+	merchantID, endpointID string,
+) (entities.WebhookEndpoint, error) {
+	endpoint, ok := r.endpoints[endpointID]
+	if !ok || endpoint.MerchantID != merchantID {
+		return entities.WebhookEndpoint{}, ErrNotFound
+	}
+
+	return endpoint, nil
+}
+
+func (r *MemoryRepository) ListWebhookEndpoints(
+	merchantID string,
+) ([]entities.WebhookEndpoint, error) {
+	endpoints := []entities.WebhookEndpoint{}
+
+	for _, endpoint := range r.endpoints {
+		if endpoint.MerchantID == merchantID {
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool {
+		if endpoints[i].Timestamp != endpoints[j].Timestamp {
+			return endpoints[i].Timestamp < endpoints[j].Timestamp
+		}
+
+		return endpoints[i].ID < endpoints[j].ID
+	})
+
+	return endpoints, nil
+}
+
+func (r *MemoryRepository) DeleteWebhookEndpoint(merchantID, endpointID string) error {
+	if _, err := r.GetWebhookEndpoint(merchantID, endpointID); err != nil {
+		return err
+	}
+
+	delete(r.endpoints, endpointID)
+
+	return nil
+}
+
+func (r *MemoryRepository) CreateWebhookDelivery(delivery entities.WebhookDelivery) error {
+	r.deliveries[delivery.ID] = delivery
+
+	if delivery.Status == entities.WebhookDeliveryPending {
+		r.queue[delivery.ID] = delivery.NextAttempt
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateWebhookDelivery(
+	previous, delivery entities.WebhookDelivery,
+	attempts ...entities.WebhookAttempt,
+) error {
+	nextAttempt, ok := r.queue[previous.ID]
+	if !ok || nextAttempt != previous.NextAttempt {
+		return ErrConflict
+	}
+
+	for _, attempt := range attempts {
+		for _, recorded := range r.attempts[attempt.DeliveryID] {
+			if recorded.Number == attempt.Number {
+				return ErrConflict
+			}
+		}
+	}
+
+	delete(r.queue, previous.ID)
+
+	for _, attempt := range attempts {
+		r.attempts[attempt.DeliveryID] = append(r.attempts[attempt.DeliveryID], attempt)
+	}
+
+	return r.CreateWebhookDelivery(delivery)
+}
+
+func (r *MemoryRepository) GetWebhookDelivery(
+	merchantID, deliveryID string,
+) (entities.WebhookDelivery, error) {
+	delivery, ok := r.deliveries[deliveryID]
+	if !ok || delivery.MerchantID != merchantID {
+		return entities.WebhookDelivery{}, ErrNotFound
+	}
+
+	return delivery, nil
+}
+
+func (r *MemoryRepository) ListWebhookDeliveries(
+	merchantID string,
+	filter WebhookDeliveryFilter,
+) ([]entities.WebhookDelivery, error) {
+	var before string
+	if filter.After != "" {
+		after, err := r.GetWebhookDelivery(merchantID, filter.After)
+		if err != nil {
+			return nil, err
+		}
+
+		before = webhookDeliveryTime(after)
+	}
+
+	deliveries := []entities.WebhookDelivery{}
+
+	for _, delivery := range r.deliveries {
+		if delivery.MerchantID == merchantID &&
+			filter.matches(delivery) &&
+			(before == "" || webhookDeliveryTime(delivery) < before) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return webhookDeliveryTime(deliveries[i]) > webhookDeliveryTime(deliveries[j])
+	})
+
+	if filter.Limit > 0 && len(deliveries) > filter.Limit {
+		deliveries = deliveries[:filter.Limit]
+	}
+
+	return deliveries, nil
+}
+
+func (r *MemoryRepository) ListWebhookAttempts(
+	merchantID, deliveryID string,
+) ([]entities.WebhookAttempt, error) {
+	attempts := []entities.WebhookAttempt{}
+
+	for _, attempt := range r.attempts[deliveryID] {
+		if attempt.MerchantID == merchantID {
+			attempts = append(attempts, attempt)
+		}
+	}
+
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].Number < attempts[j].Number
+	})
+
+	return attempts, nil
+}
+
+func (r *MemoryRepository) ListDueWebhookDeliveries(
+	before int64,
+	limit int,
+) ([]entities.WebhookDelivery, error) {
+	deliveries := []entities.WebhookDelivery{}
+
+	for id, nextAttempt := range r.queue {
+		if nextAttempt <= before {
+			deliveries = append(deliveries, r.deliveries[id])
+		}
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		if deliveries[i].NextAttempt != deliveries[j].NextAttempt {
+			return deliveries[i].NextAttempt < deliveries[j].NextAttempt
+		}
+
+		return deliveries[i].ID < deliveries[j].ID
+	})
+
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+
+	return deliveries, nil
+}
+
+func (r *MemoryRepository) CreatePlan(plan entities.Plan) error {
+	r.plans[plan.ID] = plan
+
+	return nil
+}
+
+func (r *MemoryRepository) GetPlan(merchantID, planID string) (entities.Plan, error) {
+	plan, ok := r.plans[planID]
+	if !ok || plan.MerchantID != merchantID {
+		return entities.Plan{}, ErrNotFound
+	}
+
+	return plan, nil
+}
+
+func (r *MemoryRepository) ListPlans(merchantID string) ([]entities.Plan, error) {
+	plans := []entities.Plan{}
+
+	for _, plan := range r.plans {
+		if plan.MerchantID == merchantID {
+			plans = append(plans, plan)
+		}
+	}
+
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].Timestamp != plans[j].Timestamp {
+			return plans[i].Timestamp > plans[j].Timestamp
+		}
+
+		return plans[i].ID < plans[j].ID
+	})
+
+	return plans, nil
+}
+
+func (r *MemoryRepository) CreateSubscription(subscription entities.Subscription) error {
+	r.subscriptions[subscription.ID] = subscription
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateSubscription(previous, subscription entities.Subscription) error {
+	stored, ok := r.subscriptions[previous.ID]
+	if !ok ||
+		stored.Status != previous.Status ||
+		stored.NextAttempt != previous.NextAttempt ||
+		stored.UpdatedTimestamp != previous.UpdatedTimestamp {
+		return ErrConflict
+	}
+
+	return r.CreateSubscription(subscription)
+}
+
+func (r *MemoryRepository) GetSubscription(
+	merchantID, subscriptionID string,
+) (entities.Subscription, error) {
+	subscription, ok := r.subscriptions[subscriptionID]
+	if !ok || subscription.MerchantID != merchantID {
+		return entities.Subscription{}, ErrNotFound
+	}
+
+	return subscription, nil
+}
+
+func (r *MemoryRepository) ListSubscriptions(merchantID string) ([]entities.Subscription, error) {
+	subscriptions := []entities.Subscription{}
+
+	for _, subscription := range r.subscriptions {
+		if subscription.MerchantID == merchantID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if subscriptions[i].Timestamp != subscriptions[j].Timestamp {
+			return subscriptions[i].Timestamp > subscriptions[j].Timestamp
+		}
+
+		return subscriptions[i].ID < subscriptions[j].ID
+	})
+
+	return subscriptions, nil
+}
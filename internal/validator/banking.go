@@ -0,0 +1,89 @@
+package validator
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	RgxIBAN = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]+$`)
+	RgxBIC  = regexp.MustCompile(`^[A-Z]{4}[A-Z]{2}[A-Z0-9]{2}([A-Z0-9]{3})?$`)
+)
+
+// ibanLengths maps the countries of the SWIFT IBAN registry to the length of their IBANs
+var ibanLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16, "BG": 22,
+	"BH": 22, "BI": 27, "BR": 29, "BY": 28, "CH": 21, "CR": 22, "CY": 28, "CZ": 24,
+	"DE": 22, "DJ": 27, "DK": 18, "DO": 28, "EE": 20, "EG": 29, "ES": 24, "FI": 18,
+	"FK": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18, "GR": 27,
+	"GT": 28, "HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23, "IS": 26, "IT": 27,
+	"JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LC": 32, "LI": 21, "LT": 20, "LU": 20,
+	"LV": 21, "LY": 25, "MC": 27, "MD": 24, "ME": 22, "MK": 19, "MN": 20, "MR": 27,
+	"MT": 31, "MU": 30, "NI": 28, "NL": 18, "NO": 15, "OM": 23, "PK": 24, "PL": 28,
+	"PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "RU": 33, "SA": 24, "SC": 31,
+	"SD": 18, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "SO": 23, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20, "YE": 30,
+}
+
+// ibanTerritories lists the territories whose banks use the IBANs of another country, their
+// BICs may carry either country code
+var ibanTerritories = map[string][]string{
+	"FI": {"AX"},
+	"FR": {"BL", "GF", "GP", "MF", "MQ", "NC", "PF", "PM", "RE", "TF", "WF", "YT"},
+	"GB": {"GG", "IM", "JE"},
+}
+
+// NormalizeIBAN returns the IBAN in electronic format, without spaces and in upper case
+func NormalizeIBAN(value string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(value), ""))
+}
+
+// NormalizeBIC returns the BIC without surrounding spaces and in upper case
+func NormalizeBIC(value string) string {
+	return strings.ToUpper(strings.TrimSpace(value))
+}
+
+// IsIBAN checks the IBAN in electronic format against the length of its country and
+// the ISO 13616 mod-97 checksum
+func IsIBAN(value string) bool {
+	if !RgxIBAN.MatchString(value) {
+		return false
+	}
+
+	length, ok := ibanLengths[value[:2]]
+	if !ok || len(value) != length {
+		return false
+	}
+
+	// NOTE: the country code and check digits are moved to the end and letters are
+	// replaced with numbers from 10 to 35, the remainder is computed digit by digit
+	rearranged := value[4:] + value[:4]
+
+	remainder := 0
+	for _, c := range rearranged {
+		if c >= 'A' && c <= 'Z' {
+			remainder = (remainder*100 + int(c-'A') + 10) % 97
+		} else {
+			remainder = (remainder*10 + int(c-'0')) % 97
+		}
+	}
+
+	return remainder == 1
+}
+
+// IsBIC checks the ISO 9362 format of the BIC, with or without the branch code
+func IsBIC(value string) bool {
+	return RgxBIC.MatchString(value)
+}
+
+// IBANMatchesBIC checks that the IBAN and BIC belong to the same country, both have to be valid
+func IBANMatchesBIC(iban, bic string) bool {
+	ibanCountry := iban[:2]
+	bicCountry := bic[4:6]
+
+	if ibanCountry == bicCountry {
+		return true
+	}
+
+	return In(bicCountry, ibanTerritories[ibanCountry]...)
+}
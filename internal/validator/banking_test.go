@@ -0,0 +1,67 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsIBAN(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "should accept a German IBAN", value: "DE89370400440532013000", want: true},
+		{name: "should accept a Polish IBAN", value: "PL61109010140000071219812874", want: true},
+		{name: "should accept a British IBAN", value: "GB29NWBK60161331926819", want: true},
+		{name: "should accept a Norwegian IBAN", value: "NO9386011117947", want: true},
+		{name: "should reject a wrong checksum", value: "DE89370400440532013001"},
+		{name: "should reject swapped digits", value: "DE89370400440532031000"},
+		{name: "should reject a wrong length", value: "DE8937040044053201300"},
+		{name: "should reject an unknown country", value: "XX89370400440532013000"},
+		{name: "should reject lower case", value: "de89370400440532013000"},
+		{name: "should reject spaces", value: "DE89 3704 0044 0532 0130 00"},
+		{name: "should reject an empty value", value: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsIBAN(tt.value))
+		})
+	}
+}
+
+func TestNormalizeIBAN(t *testing.T) {
+	assert.Equal(t, "DE89370400440532013000", NormalizeIBAN(" de89 3704 0044 0532 0130 00 "))
+	assert.True(t, IsIBAN(NormalizeIBAN("gb29 nwbk 6016 1331 9268 19")))
+}
+
+func TestIsBIC(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  bool
+	}{
+		{name: "should accept a BIC without branch", value: "WBKPPLPP", want: true},
+		{name: "should accept a BIC with branch", value: "COBADEFFXXX", want: true},
+		{name: "should accept digits in the location", value: "DEUTDEDB101", want: true},
+		{name: "should reject a wrong length", value: "COBADEFFXX"},
+		{name: "should reject digits in the bank code", value: "C0BADEFF"},
+		{name: "should reject digits in the country", value: "COBAD3FF"},
+		{name: "should reject lower case", value: "cobadeff"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsBIC(tt.value))
+		})
+	}
+}
+
+func TestIBANMatchesBIC(t *testing.T) {
+	assert.True(t, IBANMatchesBIC("DE89370400440532013000", "COBADEFFXXX"))
+	assert.False(t, IBANMatchesBIC("DE89370400440532013000", "WBKPPLPP"))
+	assert.True(t, IBANMatchesBIC("FR1420041010050500013M02606", "BNPAGPGP"))
+	assert.False(t, IBANMatchesBIC("GP1420041010050500013M02606", "BNPAFRPP"))
+}
@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// maxResponseBytes of the endpoint response are drained, the connection of longer responses is
+// not reused
+const maxResponseBytes = 4096
+
+var (
+	ErrInsecureURL      = errors.New("webhook: endpoint URL must use https")
+	ErrForbiddenAddress = errors.New("webhook: endpoint address is not publicly routable")
+)
+
+// reservedPrefixes are not publicly routable although they are global unicast addresses
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+}
+
+// Sender posts webhook deliveries to merchant endpoints
+type Sender interface {
+	// Send returns the status code of the response, an error is only returned when no response
+	// was received
+	Send(url string, header http.Header, body []byte) (int, error)
+}
+
+type HTTPSender struct {
+	client *http.Client
+}
+
+// NewHTTPSender sends deliveries with the timeout, redirects are not followed as the endpoint
+// is expected to accept the delivery itself. Connections are only made to public addresses, the
+// address is checked when dialing so that a host resolving to an internal address after the
+// endpoint was registered is refused too.
+func NewHTTPSender(timeout time.Duration) *HTTPSender {
+	dialer := &net.Dialer{Timeout: timeout, Control: controlPublicAddress}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// NOTE: a proxy would be dialed instead of the endpoint and bypass the address check
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &HTTPSender{
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+func (s *HTTPSender) Send(endpoint string, header http.Header, body []byte) (int, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return 0, err
+	}
+
+	if u.Scheme != "https" {
+		return 0, ErrInsecureURL
+	}
+
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// NOTE: the body is drained so that the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBytes))
+
+	return resp.StatusCode, nil
+}
+
+// IsPublicAddress reports whether the address is publicly routable, loopback, private,
+// link-local and other reserved addresses are not
+func IsPublicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// controlPublicAddress refuses connections to addresses that are not publicly routable, it is
+// called with the resolved address of every connection
+func controlPublicAddress(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !IsPublicAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPublicAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			// tested function
+			got := IsPublicAddress(netip.MustParseAddr(tt.address))
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHTTPSender(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sender := NewHTTPSender(time.Second)
+
+	t.Run("should refuse plain http endpoints", func(t *testing.T) {
+		// tested function
+		_, err := sender.Send("http://merchant.example/webhooks", http.Header{}, nil)
+		assert.ErrorIs(t, err, ErrInsecureURL)
+	})
+
+	t.Run("should refuse internal addresses when dialing", func(t *testing.T) {
+		// tested function
+		_, err := sender.Send(server.URL, http.Header{}, nil)
+		assert.ErrorIs(t, err, ErrForbiddenAddress)
+	})
+}
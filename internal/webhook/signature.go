@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderID        = "X-Webhook-ID"
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderSignature = "X-Webhook-Signature"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+)
+
+var (
+	ErrMissingSignature = errors.New("webhook: missing signature headers")
+	ErrInvalidTimestamp = errors.New("webhook: timestamp outside the allowed window")
+	ErrInvalidSignature = errors.New("webhook: signature mismatch")
+)
+
+// Sign returns the base64 encoded HMAC-SHA256 of the timestamp (unix seconds) and the body
+// joined with a dot, the timestamp is signed so that captured deliveries cannot be replayed
+// later
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and that the timestamp is within tolerance of now, it is what
+// merchants are expected to do when receiving a delivery
+func Verify(
+	secret, timestamp string,
+	body []byte,
+	signature string,
+	now time.Time,
+	tolerance time.Duration,
+) error {
+	if signature == "" || timestamp == "" {
+		return ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew > tolerance || skew < -tolerance {
+		return ErrInvalidTimestamp
+	}
+
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
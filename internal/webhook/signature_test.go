@@ -0,0 +1,39 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"Type":"payment.created"}`)
+	signature := Sign("secret", "1700000000", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      []byte
+		signature string
+		err       error
+	}{
+		{"valid", "secret", "1700000000", body, signature, nil},
+		{"missing signature", "secret", "1700000000", body, "", ErrMissingSignature},
+		{"old timestamp", "secret", "1699999000", body, signature, ErrInvalidTimestamp},
+		{"other timestamp", "secret", "1700000001", body, signature, ErrInvalidSignature},
+		{"other secret", "other", "1700000000", body, signature, ErrInvalidSignature},
+		{"other body", "secret", "1700000000", []byte(`{}`), signature, ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// tested function
+			err := Verify(tt.secret, tt.timestamp, tt.body, tt.signature, now, 5*time.Minute)
+
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}